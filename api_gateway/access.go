@@ -0,0 +1,349 @@
+package api_gateway
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// accessPolicy is a compiled AccessPolicy with its IP sets resolved
+type accessPolicy struct {
+	allow          []netip.Prefix
+	deny           []netip.Prefix
+	allowCountries map[string]bool
+	denyCountries  map[string]bool
+	body           string
+	contentType    string
+	source         AccessPolicy // the policy and IP sets it was compiled from
+	sets           []IPSet
+}
+
+// compileAccessPolicy resolves a policy against the configured IP sets; nil means no policy
+func compileAccessPolicy(p *AccessPolicy, sets []IPSet) (*accessPolicy, error) {
+	if p == nil {
+		return nil, nil
+	}
+	c := &accessPolicy{body: p.DenyBody, contentType: p.DenyContentType}
+	if c.body == "" {
+		c.body = "Forbidden"
+	}
+	if c.contentType == "" {
+		c.contentType = "text/plain; charset=utf-8"
+	}
+
+	var err error
+	if c.allow, err = parsePrefixes(p.Allow); err != nil {
+		return nil, err
+	}
+	if c.deny, err = parsePrefixes(p.Deny); err != nil {
+		return nil, err
+	}
+	for _, name := range p.AllowSets {
+		prefixes, err := ipSetPrefixes(sets, name)
+		if err != nil {
+			return nil, err
+		}
+		c.allow = append(c.allow, prefixes...)
+	}
+	for _, name := range p.DenySets {
+		prefixes, err := ipSetPrefixes(sets, name)
+		if err != nil {
+			return nil, err
+		}
+		c.deny = append(c.deny, prefixes...)
+	}
+	c.allowCountries = countrySet(p.AllowCountries)
+	c.denyCountries = countrySet(p.DenyCountries)
+	return c, nil
+}
+
+func ipSetPrefixes(sets []IPSet, name string) ([]netip.Prefix, error) {
+	for _, set := range sets {
+		if set.Name == name {
+			prefixes, err := parsePrefixes(set.CIDRs)
+			if err != nil {
+				return nil, fmt.Errorf("IP set %s: %w", name, err)
+			}
+			return prefixes, nil
+		}
+	}
+	return nil, fmt.Errorf("IP set with name %s not found", name)
+}
+
+// parsePrefixes parses CIDR ranges; plain addresses become single-address prefixes
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if strings.Contains(v, "/") {
+			p, err := netip.ParsePrefix(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", v)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address %q", v)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func countrySet(codes []string) map[string]bool {
+	if len(codes) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		set[strings.ToUpper(strings.TrimSpace(code))] = true
+	}
+	return set
+}
+
+// compiledFrom reports whether the policy was compiled from p and the IP sets it references
+func (p *accessPolicy) compiledFrom(policy *AccessPolicy, sets []IPSet) bool {
+	if !reflect.DeepEqual(p.source, *policy) {
+		return false
+	}
+	return len(policy.AllowSets)+len(policy.DenySets) == 0 || reflect.DeepEqual(p.sets, sets)
+}
+
+func (p *accessPolicy) usesCountries() bool {
+	return len(p.allowCountries) > 0 || len(p.denyCountries) > 0
+}
+
+// allows reports whether a client may pass; country is "" when unknown
+func (p *accessPolicy) allows(addr netip.Addr, country string) bool {
+	if prefixesContain(p.deny, addr) || (country != "" && p.denyCountries[country]) {
+		return false
+	}
+	if len(p.allow) == 0 && len(p.allowCountries) == 0 {
+		return true
+	}
+	return prefixesContain(p.allow, addr) || (country != "" && p.allowCountries[country])
+}
+
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAccessPolicies checks every access policy of a configuration before it is saved
+func validateAccessPolicies(cfg *GatewayConfig) error {
+	names := make(map[string]bool, len(cfg.IPSets))
+	for _, set := range cfg.IPSets {
+		if set.Name == "" {
+			return fmt.Errorf("IP set requires a name")
+		}
+		if names[set.Name] {
+			return fmt.Errorf("IP set with name %s already exists", set.Name)
+		}
+		names[set.Name] = true
+		if _, err := parsePrefixes(set.CIDRs); err != nil {
+			return fmt.Errorf("IP set %s: %w", set.Name, err)
+		}
+	}
+
+	usesCountries := false
+	check := func(kind, id string, p *AccessPolicy) error {
+		c, err := compileAccessPolicy(p, cfg.IPSets)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", kind, id, err)
+		}
+		if c != nil && c.usesCountries() {
+			usesCountries = true
+		}
+		return nil
+	}
+	for _, r := range cfg.Routes {
+		if err := check("route", r.ID, r.Access); err != nil {
+			return err
+		}
+	}
+	for _, r := range cfg.TCPRoutes {
+		if err := check("TCP route", r.ID, r.Access); err != nil {
+			return err
+		}
+	}
+	for _, r := range cfg.UDPRoutes {
+		if err := check("UDP route", r.ID, r.Access); err != nil {
+			return err
+		}
+	}
+	if usesCountries && cfg.GeoIPDatabase == "" {
+		return fmt.Errorf("country access rules require a GeoIP database")
+	}
+	if cfg.GeoIPDatabase != "" {
+		if err := checkMMDB(cfg.GeoIPDatabase); err != nil {
+			return fmt.Errorf("failed to open GeoIP database: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateRouteAccessLocked checks a route's access policy against the configured IP sets (must be called with g.mu held)
+func (g *Gateway) validateRouteAccessLocked(route *Route) error {
+	c, err := compileAccessPolicy(route.Access, g.config.IPSets)
+	if err != nil {
+		return err
+	}
+	if c != nil && c.usesCountries() && g.config.GeoIPDatabase == "" {
+		return fmt.Errorf("country access rules require a GeoIP database")
+	}
+	return nil
+}
+
+// accessPolicyFor returns the cached compiled policy of a route, compiling it on first use.
+// key distinguishes HTTP, TCP and UDP routes sharing an ID.
+func (g *Gateway) accessPolicyFor(key string, p *AccessPolicy) *accessPolicy {
+	if p == nil {
+		return nil
+	}
+	g.mu.RLock()
+	sets := g.config.IPSets
+	g.mu.RUnlock()
+
+	g.accessPoliciesMu.Lock()
+	defer g.accessPoliciesMu.Unlock()
+	if g.accessPolicies == nil {
+		g.accessPolicies = make(map[string]*accessPolicy)
+	}
+	c, ok := g.accessPolicies[key]
+	if !ok {
+		var err error
+		if c, err = compileAccessPolicy(p, sets); err != nil {
+			// Rejected on save; fail closed for a policy that no longer resolves
+			log.Printf("API Gateway: access policy %s: %v", key, err)
+			c = &accessPolicy{deny: []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")}, body: "Forbidden", contentType: "text/plain; charset=utf-8"}
+		}
+		c.source, c.sets = *p, sets
+		g.accessPolicies[key] = c
+	}
+	return c
+}
+
+// refreshAccessPolicies drops the compiled policies of routes that were removed or whose policy or
+// referenced IP sets changed (must be called with g.mu held after the routes are published)
+func (g *Gateway) refreshAccessPolicies() {
+	g.accessPoliciesMu.Lock()
+	defer g.accessPoliciesMu.Unlock()
+
+	policies := make(map[string]*accessPolicy)
+	keep := func(key string, p *AccessPolicy) {
+		if c, ok := g.accessPolicies[key]; ok && p != nil && c.compiledFrom(p, g.config.IPSets) {
+			policies[key] = c
+		}
+	}
+	for _, route := range g.routes {
+		keep("http:"+route.ID, route.Access)
+	}
+	for _, route := range g.config.TCPRoutes {
+		keep("tcp:"+route.ID, route.Access)
+	}
+	for _, route := range g.config.UDPRoutes {
+		keep("udp:"+route.ID, route.Access)
+	}
+	g.accessPolicies = policies
+}
+
+// clientAllowed evaluates a compiled policy for a client address
+func (g *Gateway) clientAllowed(p *accessPolicy, ip string) bool {
+	if p == nil {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		// Without a usable address only a policy that allows everyone lets the client pass
+		return len(p.allow) == 0 && len(p.allowCountries) == 0 && len(p.deny) == 0 && len(p.denyCountries) == 0
+	}
+	addr = addr.Unmap()
+	country := ""
+	if p.usesCountries() {
+		country = g.lookupCountry(addr)
+	}
+	return p.allows(addr, country)
+}
+
+// checkRouteAccess applies the access policy of an HTTP route, writing the 403 response
+// when the client is rejected.
+func (g *Gateway) checkRouteAccess(w http.ResponseWriter, route *Route, clientIP string) bool {
+	p := g.accessPolicyFor("http:"+route.ID, route.Access)
+	if g.clientAllowed(p, clientIP) {
+		return true
+	}
+	w.Header().Set("Content-Type", p.contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusForbidden)
+	w.Write([]byte(p.body))
+	return false
+}
+
+// geoIPFile identifies the version of the GeoIP database that is loaded
+type geoIPFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// loadGeoIP opens the configured GeoIP database when its path changed or the file was replaced.
+// The file is read without holding g.mu or geoIPMu; only the swap happens under geoIPMu.
+func (g *Gateway) loadGeoIP() {
+	g.mu.RLock()
+	file := geoIPFile{path: g.config.GeoIPDatabase}
+	g.mu.RUnlock()
+	if file.path != "" {
+		if info, err := os.Stat(file.path); err == nil {
+			file.modTime, file.size = info.ModTime(), info.Size()
+		}
+	}
+
+	g.geoIPMu.RLock()
+	loaded := g.geoIPFile
+	g.geoIPMu.RUnlock()
+	if file == loaded {
+		return
+	}
+
+	var db *mmdbReader
+	if file.path != "" {
+		var err error
+		if db, err = openMMDB(file.path); err != nil {
+			log.Printf("API Gateway: failed to load GeoIP database %s: %v", file.path, err)
+		}
+	}
+
+	g.mu.RLock()
+	current := g.config.GeoIPDatabase
+	g.mu.RUnlock()
+	if current != file.path {
+		// The config changed while the file was read; the load started by that change wins
+		return
+	}
+	g.geoIPMu.Lock()
+	g.geoIP, g.geoIPFile = db, file
+	g.geoIPMu.Unlock()
+}
+
+// lookupCountry returns the ISO country code of an address, "" when unknown
+func (g *Gateway) lookupCountry(addr netip.Addr) string {
+	g.geoIPMu.RLock()
+	db := g.geoIP
+	g.geoIPMu.RUnlock()
+	if db == nil {
+		return ""
+	}
+	return db.country(addr)
+}
@@ -0,0 +1,237 @@
+package api_gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestMMDB writes a minimal IPv6 country database (24-bit records) mapping prefixes to
+// ISO codes; IPv4 prefixes are placed below ::/96 the way MaxMind databases store them.
+func buildTestMMDB(t *testing.T, countries map[string]string) string {
+	t.Helper()
+	type node struct{ next, data [2]int }
+	nodes := []*node{{next: [2]int{-1, -1}, data: [2]int{-1, -1}}}
+
+	var data []byte
+	encodeString := func(s string) []byte { return append([]byte{byte(2<<5 | len(s))}, s...) }
+	for prefix, code := range countries {
+		p := netip.MustParsePrefix(prefix)
+		var ip [16]byte
+		bits := p.Bits()
+		if p.Addr().Is4() {
+			v4 := p.Addr().As4()
+			copy(ip[12:], v4[:])
+			bits += 96
+		} else {
+			ip = p.Addr().As16()
+		}
+		offset := len(data)
+		data = append(data, 7<<5|1)
+		data = append(data, encodeString("country")...)
+		data = append(data, 7<<5|1)
+		data = append(data, encodeString("iso_code")...)
+		data = append(data, encodeString(code)...)
+
+		cur := 0
+		for i := 0; i < bits; i++ {
+			b := int(ip[i/8]>>(7-i%8)) & 1
+			if i == bits-1 {
+				nodes[cur].data[b] = offset
+				break
+			}
+			if nodes[cur].next[b] < 0 {
+				nodes = append(nodes, &node{next: [2]int{-1, -1}, data: [2]int{-1, -1}})
+				nodes[cur].next[b] = len(nodes) - 1
+			}
+			cur = nodes[cur].next[b]
+		}
+	}
+
+	var buf []byte
+	for _, n := range nodes {
+		for b := 0; b < 2; b++ {
+			record := len(nodes)
+			if n.next[b] >= 0 {
+				record = n.next[b]
+			} else if n.data[b] >= 0 {
+				record = len(nodes) + 16 + n.data[b]
+			}
+			buf = append(buf, byte(record>>16), byte(record>>8), byte(record))
+		}
+	}
+	buf = append(buf, make([]byte, 16)...)
+	buf = append(buf, data...)
+	buf = append(buf, mmdbMetadataMarker...)
+	buf = append(buf, 7<<5|3)
+	buf = append(buf, encodeString("node_count")...)
+	buf = append(buf, 6<<5|4)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(nodes)))
+	buf = append(buf, encodeString("record_size")...)
+	buf = append(buf, 5<<5|1, 24)
+	buf = append(buf, encodeString("ip_version")...)
+	buf = append(buf, 5<<5|1, 6)
+
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	require.NoError(t, os.WriteFile(path, buf, 0o644))
+	return path
+}
+
+func TestMMDBCountryLookup(t *testing.T) {
+	path := buildTestMMDB(t, map[string]string{
+		"81.2.69.0/24":   "GB",
+		"2001:db8::/32":  "DE",
+		"203.0.113.0/25": "JP",
+	})
+	db, err := openMMDB(path)
+	require.NoError(t, err)
+	assert.Equal(t, "GB", db.country(netip.MustParseAddr("81.2.69.160")))
+	assert.Equal(t, "GB", db.country(netip.MustParseAddr("::ffff:81.2.69.1")))
+	assert.Equal(t, "DE", db.country(netip.MustParseAddr("2001:db8::1")))
+	assert.Equal(t, "JP", db.country(netip.MustParseAddr("203.0.113.5")))
+	assert.Equal(t, "", db.country(netip.MustParseAddr("203.0.113.200")))
+	assert.Equal(t, "", db.country(netip.MustParseAddr("8.8.8.8")))
+
+	_, err = newMMDBReader([]byte("not a database"))
+	assert.Error(t, err)
+
+	// validation only reads the metadata
+	assert.NoError(t, checkMMDB(path))
+	notDB := filepath.Join(t.TempDir(), "not.mmdb")
+	require.NoError(t, os.WriteFile(notDB, bytes.Repeat([]byte("x"), 2*mmdbMaxMetadataSize), 0o644))
+	assert.ErrorContains(t, checkMMDB(notDB), "metadata marker not found")
+	assert.Error(t, checkMMDB(filepath.Join(t.TempDir(), "missing.mmdb")))
+}
+
+func TestRouteAccessPolicy(t *testing.T) {
+	g, hits := newWAFTestGateway(t, nil)
+	g.config.IPSets = []IPSet{{Name: "office", CIDRs: []string{"10.1.0.0/16", "192.0.2.10"}}}
+	g.config.GeoIPDatabase = buildTestMMDB(t, map[string]string{"81.2.69.0/24": "GB", "198.51.100.0/24": "RU"})
+	g.loadGeoIP()
+	g.routes[0].Access = &AccessPolicy{
+		AllowSets:       []string{"office"},
+		AllowCountries:  []string{"gb"},
+		Deny:            []string{"10.1.99.0/24"},
+		DenyBody:        `{"error":"access denied"}`,
+		DenyContentType: "application/json",
+	}
+
+	get := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote + ":5000"
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, req)
+		return rec
+	}
+	assert.Equal(t, http.StatusOK, get("10.1.2.3").Code)
+	assert.Equal(t, http.StatusOK, get("192.0.2.10").Code)
+	assert.Equal(t, http.StatusOK, get("81.2.69.7").Code)
+
+	rec := get("10.1.99.4")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, `{"error":"access denied"}`, rec.Body.String())
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusForbidden, get("198.51.100.1").Code)
+	assert.Equal(t, http.StatusForbidden, get("8.8.8.8").Code)
+	assert.Equal(t, int32(3), atomic.LoadInt32(hits))
+
+	// deny-only policies let everyone else through
+	g.routes[0].Access = &AccessPolicy{DenyCountries: []string{"RU"}}
+	g.refreshAccessPolicies()
+	assert.Equal(t, http.StatusOK, get("8.8.8.8").Code)
+	assert.Equal(t, "Forbidden", get("198.51.100.1").Body.String())
+}
+
+func TestStreamRouteAccessPolicy(t *testing.T) {
+	g := newProxyTestGateway(&Service{ID: "svc", Enabled: true})
+	g.config.IPSets = []IPSet{{Name: "blocked", CIDRs: []string{"2001:db8::/32"}}}
+	tcp := TCPRoute{ID: "ssh", Access: &AccessPolicy{DenySets: []string{"blocked"}}}
+	udp := UDPRoute{ID: "ssh", Access: &AccessPolicy{Allow: []string{"127.0.0.1"}}}
+
+	assert.True(t, g.clientAllowed(g.accessPolicyFor("tcp:"+tcp.ID, tcp.Access), "192.0.2.1"))
+	assert.False(t, g.clientAllowed(g.accessPolicyFor("tcp:"+tcp.ID, tcp.Access), "2001:db8::5"))
+	assert.True(t, g.clientAllowed(g.accessPolicyFor("udp:"+udp.ID, udp.Access), "127.0.0.1"))
+	assert.False(t, g.clientAllowed(g.accessPolicyFor("udp:"+udp.ID, udp.Access), "192.0.2.1"))
+	assert.False(t, g.clientAllowed(g.accessPolicyFor("udp:"+udp.ID, udp.Access), "not-an-ip"))
+	assert.True(t, g.clientAllowed(nil, "not-an-ip"))
+}
+
+func TestValidateAccessPolicies(t *testing.T) {
+	cfg := &GatewayConfig{
+		IPSets:    []IPSet{{Name: "lan", CIDRs: []string{"192.168.0.0/16"}}},
+		TCPRoutes: []TCPRoute{{ID: "db", Access: &AccessPolicy{AllowSets: []string{"lan"}}}},
+	}
+	assert.NoError(t, validateAccessPolicies(cfg))
+
+	cfg.UDPRoutes = []UDPRoute{{ID: "dns", Access: &AccessPolicy{DenySets: []string{"missing"}}}}
+	assert.ErrorContains(t, validateAccessPolicies(cfg), "IP set with name missing not found")
+
+	cfg.UDPRoutes = nil
+	cfg.Routes = []Route{{ID: "web", Access: &AccessPolicy{DenyCountries: []string{"RU"}}}}
+	assert.ErrorContains(t, validateAccessPolicies(cfg), "GeoIP database")
+	cfg.GeoIPDatabase = buildTestMMDB(t, map[string]string{"198.51.100.0/24": "RU"})
+	assert.NoError(t, validateAccessPolicies(cfg))
+	cfg.GeoIPDatabase = filepath.Join(t.TempDir(), "missing.mmdb")
+	assert.ErrorContains(t, validateAccessPolicies(cfg), "failed to open GeoIP database")
+	cfg.GeoIPDatabase = ""
+
+	cfg.Routes = nil
+	cfg.IPSets = append(cfg.IPSets, IPSet{Name: "bad", CIDRs: []string{"10.0.0.0/33"}})
+	assert.Error(t, validateAccessPolicies(cfg))
+}
+
+func TestAccessPoliciesKeptForUnchangedRoutes(t *testing.T) {
+	g := NewGateway(t.TempDir())
+	cfg := g.GetConfigCopy()
+	cfg.HTTPPort = 80
+	cfg.IPSets = []IPSet{{Name: "blocked", CIDRs: []string{"192.0.2.0/24"}}}
+	cfg.Services = []Service{{ID: "web", Host: "127.0.0.1", Port: 9000, Enabled: true}}
+	api := Route{ID: "api", ServiceID: "web", Paths: []string{"/api"}, Access: &AccessPolicy{DenySets: []string{"blocked"}}, Enabled: true}
+	cfg.Routes = []Route{api, {ID: "other", ServiceID: "web", Paths: []string{"/other"}, Enabled: true}}
+	require.NoError(t, g.UpdateConfig(cfg))
+
+	policy := g.accessPolicyFor("http:api", api.Access)
+	require.NoError(t, g.UpdateRoute(Route{ID: "other", ServiceID: "web", Paths: []string{"/other", "/more"}, Enabled: true}))
+	assert.Same(t, policy, g.accessPolicyFor("http:api", api.Access), "editing another route keeps the compiled policy")
+
+	// a changed IP set is resolved again
+	cfg = g.GetConfigCopy()
+	cfg.IPSets[0].CIDRs = []string{"198.51.100.0/24"}
+	require.NoError(t, g.UpdateConfig(cfg))
+	rebuilt := g.accessPolicyFor("http:api", api.Access)
+	assert.NotSame(t, policy, rebuilt)
+	assert.True(t, g.clientAllowed(rebuilt, "192.0.2.1"))
+	assert.False(t, g.clientAllowed(rebuilt, "198.51.100.1"))
+}
+
+func TestGeoIPReloadedWhenFileReplaced(t *testing.T) {
+	g := NewGateway(t.TempDir())
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	require.NoError(t, os.Rename(buildTestMMDB(t, map[string]string{"81.2.69.0/24": "GB"}), path))
+	g.mu.Lock()
+	g.config.GeoIPDatabase = path
+	g.mu.Unlock()
+	g.loadGeoIP()
+	addr := netip.MustParseAddr("81.2.69.7")
+	assert.Equal(t, "GB", g.lookupCountry(addr))
+
+	// an update written over the same path is picked up on the next reload
+	require.NoError(t, os.Rename(buildTestMMDB(t, map[string]string{"81.2.69.0/24": "DE"}), path))
+	g.loadGeoIP()
+	assert.Equal(t, "DE", g.lookupCountry(addr))
+
+	g.mu.Lock()
+	g.config.GeoIPDatabase = ""
+	g.mu.Unlock()
+	g.loadGeoIP()
+	assert.Empty(t, g.lookupCountry(addr))
+}
@@ -0,0 +1,255 @@
+package api_gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"redock/cloudflare"
+	"redock/dns_server"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	acmeChallengeHTTP01 = "http-01"
+	acmeChallengeDNS01  = "dns-01"
+
+	dnsProviderCloudflare = "cloudflare"
+	dnsProviderDNSServer  = "dns_server"
+
+	defaultDNSPropagationTimeout = 2 * time.Minute
+	dnsPropagationPollInterval   = 5 * time.Second
+	acmeChallengeTXTTTL          = 120
+)
+
+// dns01Solver publishes and removes _acme-challenge TXT records
+type dns01Solver interface {
+	Present(ctx context.Context, fqdn, value string) error
+	CleanUp(ctx context.Context, fqdn, value string) error
+	// Nameservers returns the servers to poll for propagation of fqdn (host:port);
+	// an empty list means the record is visible as soon as Present returns.
+	Nameservers(ctx context.Context, fqdn string) ([]string, error)
+}
+
+// challengeType returns the configured ACME challenge type (http-01 by default)
+func (c *LetsEncryptConfig) challengeType() string {
+	if strings.EqualFold(c.ChallengeType, acmeChallengeDNS01) {
+		return acmeChallengeDNS01
+	}
+	return acmeChallengeHTTP01
+}
+
+// newDNS01Solver builds the solver for the configured DNS provider. It is a variable so tests can stub it.
+var newDNS01Solver = func(cfg *LetsEncryptConfig) (dns01Solver, error) {
+	switch strings.ToLower(cfg.DNSProvider) {
+	case "", dnsProviderCloudflare:
+		manager := cloudflare.GetCloudflareManager()
+		if manager == nil {
+			return nil, errors.New("cloudflare manager is not initialized")
+		}
+		return newCloudflareDNS01Solver(manager), nil
+	case dnsProviderDNSServer:
+		server := dns_server.GetDNSServer()
+		if !server.IsRunning() {
+			return nil, errors.New("built-in DNS server is not running")
+		}
+		return &dnsServerDNS01Solver{server: server}, nil
+	default:
+		return nil, fmt.Errorf("unsupported DNS provider %q", cfg.DNSProvider)
+	}
+}
+
+// challengeFQDN returns the TXT record name for a domain ("*.example.com" -> "_acme-challenge.example.com.")
+func challengeFQDN(domain string) string {
+	return dns.Fqdn("_acme-challenge." + strings.TrimPrefix(domain, "*."))
+}
+
+// cloudflareDNSAPI is the subset of cloudflare.CloudflareManager used by the DNS-01 solver
+type cloudflareDNSAPI interface {
+	GetZoneByName(name string) (*cloudflare.CloudflareZone, error)
+	CreateDNSRecord(zoneID string, params cloudflare.DNSRecordParams) (*cloudflare.CloudflareDNSRecord, error)
+	DeleteDNSRecord(zoneID, recordID string) error
+}
+
+// cloudflareDNS01Solver creates challenge records in the Cloudflare zone owning the domain
+type cloudflareDNS01Solver struct {
+	api     cloudflareDNSAPI
+	mu      sync.Mutex
+	records map[string]*cloudflare.CloudflareDNSRecord // fqdn + value -> created record
+}
+
+func newCloudflareDNS01Solver(api cloudflareDNSAPI) *cloudflareDNS01Solver {
+	return &cloudflareDNS01Solver{api: api, records: make(map[string]*cloudflare.CloudflareDNSRecord)}
+}
+
+// findZone walks up the labels of fqdn until a synced Cloudflare zone matches
+func (s *cloudflareDNS01Solver) findZone(fqdn string) (*cloudflare.CloudflareZone, error) {
+	name := strings.TrimSuffix(strings.ToLower(fqdn), ".")
+	for {
+		if zone, err := s.api.GetZoneByName(name); err == nil && zone != nil {
+			return zone, nil
+		}
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			return nil, fmt.Errorf("no Cloudflare zone found for %s", fqdn)
+		}
+		name = name[i+1:]
+	}
+}
+
+func (s *cloudflareDNS01Solver) Present(ctx context.Context, fqdn, value string) error {
+	zone, err := s.findZone(fqdn)
+	if err != nil {
+		return err
+	}
+	// Create rather than upsert: an order for example.com and *.example.com needs two values on one name
+	record, err := s.api.CreateDNSRecord(zone.ZoneID, cloudflare.DNSRecordParams{
+		Type:    "TXT",
+		Name:    strings.TrimSuffix(fqdn, "."),
+		Content: value,
+		TTL:     acmeChallengeTXTTTL,
+		Comment: "ACME DNS-01 challenge (redock api gateway)",
+	})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.records[fqdn+" "+value] = record
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *cloudflareDNS01Solver) CleanUp(ctx context.Context, fqdn, value string) error {
+	s.mu.Lock()
+	record := s.records[fqdn+" "+value]
+	delete(s.records, fqdn+" "+value)
+	s.mu.Unlock()
+	if record == nil {
+		return nil
+	}
+	return s.api.DeleteDNSRecord(record.ZoneID, record.RecordID)
+}
+
+func (s *cloudflareDNS01Solver) Nameservers(ctx context.Context, fqdn string) ([]string, error) {
+	return authoritativeNameservers(ctx, fqdn)
+}
+
+// dnsServerDNS01Solver serves challenge records from the built-in DNS server, which must be
+// authoritative (delegated) for the _acme-challenge names.
+type dnsServerDNS01Solver struct {
+	server *dns_server.DNSServer
+}
+
+func (s *dnsServerDNS01Solver) Present(ctx context.Context, fqdn, value string) error {
+	s.server.SetChallengeTXT(fqdn, value)
+	return nil
+}
+
+func (s *dnsServerDNS01Solver) CleanUp(ctx context.Context, fqdn, value string) error {
+	s.server.ClearChallengeTXT(fqdn, value)
+	return nil
+}
+
+func (s *dnsServerDNS01Solver) Nameservers(ctx context.Context, fqdn string) ([]string, error) {
+	return nil, nil
+}
+
+// authoritativeNameservers finds the NS records of the closest enclosing zone of fqdn
+func authoritativeNameservers(ctx context.Context, fqdn string) ([]string, error) {
+	name := strings.TrimSuffix(fqdn, ".")
+	for strings.Contains(name, ".") {
+		nss, err := net.DefaultResolver.LookupNS(ctx, name)
+		if err == nil && len(nss) > 0 {
+			servers := make([]string, 0, len(nss))
+			for _, ns := range nss {
+				servers = append(servers, net.JoinHostPort(strings.TrimSuffix(ns.Host, "."), "53"))
+			}
+			return servers, nil
+		}
+		name = name[strings.IndexByte(name, '.')+1:]
+	}
+	return nil, fmt.Errorf("no nameservers found for %s", fqdn)
+}
+
+// txtRecordPresent queries a nameserver directly for the TXT value
+func txtRecordPresent(ctx context.Context, server, fqdn, value string) (bool, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(fqdn), dns.TypeTXT)
+	msg.RecursionDesired = false
+	client := &dns.Client{Timeout: 5 * time.Second}
+	resp, _, err := client.ExchangeContext(ctx, msg, server)
+	if err != nil {
+		return false, err
+	}
+	for _, rr := range resp.Answer {
+		if txt, ok := rr.(*dns.TXT); ok && strings.Join(txt.Txt, "") == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// waitForDNSPropagation polls the nameservers until all of them serve the TXT value.
+// Configured resolvers take precedence over the authoritative nameservers from the solver.
+func waitForDNSPropagation(ctx context.Context, cfg *LetsEncryptConfig, solver dns01Solver, fqdn, value string) error {
+	servers := cfg.DNSResolvers
+	if len(servers) == 0 {
+		var err error
+		if servers, err = solver.Nameservers(ctx, fqdn); err != nil {
+			return err
+		}
+	}
+	if len(servers) == 0 {
+		return nil
+	}
+
+	timeout := time.Duration(cfg.DNSPropagationTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultDNSPropagationTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		pending := 0
+		var lastErr error
+		for _, server := range servers {
+			if !strings.Contains(server, ":") {
+				server = net.JoinHostPort(server, "53")
+			}
+			ok, err := txtRecordPresent(ctx, server, fqdn, value)
+			if err != nil {
+				lastErr = err
+			}
+			if !ok {
+				pending++
+			}
+		}
+		if pending == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return fmt.Errorf("TXT record %s not visible on %d nameserver(s): %w", fqdn, pending, lastErr)
+			}
+			return fmt.Errorf("TXT record %s not visible on %d nameserver(s) after %s", fqdn, pending, timeout)
+		case <-time.After(dnsPropagationPollInterval):
+		}
+	}
+}
+
+// logDNS01CleanUp removes a challenge record, logging failures (cleanup must not fail the order)
+func logDNS01CleanUp(solver dns01Solver, fqdn, value string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := solver.CleanUp(ctx, fqdn, value); err != nil {
+		log.Printf("API Gateway: failed to clean up ACME challenge record %s: %v", fqdn, err)
+	}
+}
@@ -0,0 +1,104 @@
+package api_gateway
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"redock/cloudflare"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCloudflareDNS struct {
+	zones   map[string]string // name -> zone ID
+	records map[string]cloudflare.DNSRecordParams
+	nextID  int
+}
+
+func (f *fakeCloudflareDNS) GetZoneByName(name string) (*cloudflare.CloudflareZone, error) {
+	if id, ok := f.zones[name]; ok {
+		return &cloudflare.CloudflareZone{ZoneID: id, Name: name}, nil
+	}
+	return nil, fmt.Errorf("zone not found: %s", name)
+}
+
+func (f *fakeCloudflareDNS) CreateDNSRecord(zoneID string, params cloudflare.DNSRecordParams) (*cloudflare.CloudflareDNSRecord, error) {
+	f.nextID++
+	id := fmt.Sprintf("rec%d", f.nextID)
+	f.records[id] = params
+	return &cloudflare.CloudflareDNSRecord{ZoneID: zoneID, RecordID: id, Type: params.Type, Name: params.Name, Content: params.Content}, nil
+}
+
+func (f *fakeCloudflareDNS) DeleteDNSRecord(zoneID, recordID string) error {
+	delete(f.records, recordID)
+	return nil
+}
+
+func TestChallengeFQDN(t *testing.T) {
+	assert.Equal(t, "_acme-challenge.example.com.", challengeFQDN("example.com"))
+	assert.Equal(t, "_acme-challenge.tunnel.example.com.", challengeFQDN("*.tunnel.example.com"))
+	assert.Equal(t, acmeChallengeHTTP01, (&LetsEncryptConfig{}).challengeType())
+	assert.Equal(t, acmeChallengeDNS01, (&LetsEncryptConfig{ChallengeType: "DNS-01"}).challengeType())
+}
+
+func TestCloudflareDNS01Solver(t *testing.T) {
+	api := &fakeCloudflareDNS{zones: map[string]string{"example.com": "z1"}, records: make(map[string]cloudflare.DNSRecordParams)}
+	solver := newCloudflareDNS01Solver(api)
+	ctx := context.Background()
+	fqdn := challengeFQDN("*.tunnel.example.com")
+
+	// base domain and wildcard share the record name but need separate values
+	require.NoError(t, solver.Present(ctx, fqdn, "value-1"))
+	require.NoError(t, solver.Present(ctx, fqdn, "value-2"))
+	require.Len(t, api.records, 2)
+	for _, rec := range api.records {
+		assert.Equal(t, "TXT", rec.Type)
+		assert.Equal(t, "_acme-challenge.tunnel.example.com", rec.Name)
+	}
+
+	require.NoError(t, solver.CleanUp(ctx, fqdn, "value-1"))
+	assert.Len(t, api.records, 1)
+	require.NoError(t, solver.CleanUp(ctx, fqdn, "value-2"))
+	assert.Empty(t, api.records)
+
+	assert.Error(t, solver.Present(ctx, challengeFQDN("example.org"), "v"))
+}
+
+func TestWaitForDNSPropagation(t *testing.T) {
+	var mu sync.Mutex
+	published := ""
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		msg := new(dns.Msg)
+		msg.SetReply(r)
+		mu.Lock()
+		if published != "" {
+			msg.Answer = append(msg.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+				Txt: []string{published},
+			})
+		}
+		mu.Unlock()
+		w.WriteMsg(msg)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	cfg := &LetsEncryptConfig{DNSResolvers: []string{pc.LocalAddr().String()}, DNSPropagationTimeout: 1}
+	solver := newCloudflareDNS01Solver(&fakeCloudflareDNS{})
+	fqdn := challengeFQDN("example.com")
+
+	err = waitForDNSPropagation(context.Background(), cfg, solver, fqdn, "token")
+	assert.Error(t, err)
+
+	mu.Lock()
+	published = "token"
+	mu.Unlock()
+	assert.NoError(t, waitForDNSPropagation(context.Background(), cfg, solver, fqdn, "token"))
+}
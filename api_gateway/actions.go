@@ -0,0 +1,309 @@
+package api_gateway
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Route action types
+const (
+	routeActionRedirect = "redirect"
+	routeActionStatic   = "static"
+	routeActionRespond  = "respond"
+	routeActionMock     = "mock"
+)
+
+const maxMockDelay = time.Minute
+
+// validateRouteAction checks a route's action before it is saved
+func validateRouteAction(route *Route) error {
+	a := route.Action
+	if a == nil {
+		return nil
+	}
+	switch a.Type {
+	case routeActionRedirect:
+		if a.Redirect == nil || strings.TrimSpace(a.Redirect.Target) == "" {
+			return fmt.Errorf("redirect action requires a target")
+		}
+		switch a.Redirect.StatusCode {
+		case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return fmt.Errorf("invalid redirect status code %d", a.Redirect.StatusCode)
+		}
+	case routeActionStatic:
+		if a.Static == nil || strings.TrimSpace(a.Static.Root) == "" {
+			return fmt.Errorf("static action requires a root directory")
+		}
+		for _, name := range a.Static.IndexFiles {
+			if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+				return fmt.Errorf("invalid index file %q", name)
+			}
+		}
+	case routeActionRespond:
+		if a.Respond == nil {
+			return fmt.Errorf("respond action requires a response")
+		}
+		return validateFixedResponse(a.Respond)
+	case routeActionMock:
+		if a.Mock == nil || len(a.Mock.Responses) == 0 {
+			return fmt.Errorf("mock action requires at least one response")
+		}
+		for i, m := range a.Mock.Responses {
+			if m.Path != "" && !strings.HasPrefix(m.Path, "/") {
+				return fmt.Errorf("mock response %d: path must start with /", i+1)
+			}
+			if m.DelayMs < 0 || time.Duration(m.DelayMs)*time.Millisecond > maxMockDelay {
+				return fmt.Errorf("mock response %d: delay_ms must be between 0 and %d", i+1, maxMockDelay.Milliseconds())
+			}
+			if err := validateFixedResponse(&m.FixedResponse); err != nil {
+				return fmt.Errorf("mock response %d: %w", i+1, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown route action type %q", a.Type)
+	}
+	return nil
+}
+
+func validateFixedResponse(resp *FixedResponse) error {
+	if resp.StatusCode != 0 && (resp.StatusCode < 200 || resp.StatusCode > 599) {
+		return fmt.Errorf("invalid response status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// routeActionAnswers reports whether the gateway answers the request itself instead of
+// proxying it. Mock requests without a matching response go to the route's service, if any.
+func routeActionAnswers(route *Route, r *http.Request) bool {
+	if route.Action == nil {
+		return false
+	}
+	if route.Action.Type == routeActionMock && matchMockResponse(route.Action.Mock, r) == nil {
+		return route.ServiceID == "" && (route.Split == nil || len(route.Split.Backends) == 0)
+	}
+	return true
+}
+
+// serveRouteAction answers the request from the route's action. It returns false when the
+// request has to be proxied.
+func (g *Gateway) serveRouteAction(w http.ResponseWriter, r *http.Request, route *Route) bool {
+	if !routeActionAnswers(route, r) {
+		return false
+	}
+	applyCORSHeaders(w.Header(), r.Header.Get("Origin"), route.CORS)
+	applyResponseHeaders(w.Header(), route.ResponseHeaders)
+	vars := transformVars{r: r, route: route}
+
+	a := route.Action
+	switch a.Type {
+	case routeActionRedirect:
+		code := a.Redirect.StatusCode
+		if code == 0 {
+			code = http.StatusFound
+		}
+		http.Redirect(w, r, vars.expand(a.Redirect.Target), code)
+	case routeActionStatic:
+		serveStatic(w, r, route, a.Static)
+	case routeActionRespond:
+		writeFixedResponse(w, r, a.Respond, vars)
+	case routeActionMock:
+		m := matchMockResponse(a.Mock, r)
+		if m == nil {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return true
+		}
+		if m.DelayMs > 0 {
+			timer := time.NewTimer(time.Duration(m.DelayMs) * time.Millisecond)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				return true
+			}
+		}
+		writeFixedResponse(w, r, &m.FixedResponse, vars)
+	}
+	return true
+}
+
+// writeFixedResponse writes a configured response; header values are expanded as templates
+func writeFixedResponse(w http.ResponseWriter, r *http.Request, resp *FixedResponse, vars transformVars) {
+	h := w.Header()
+	for name, value := range resp.Headers {
+		h.Set(name, vars.expand(value))
+	}
+	status := resp.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		w.WriteHeader(status)
+		return
+	}
+	if resp.Body != "" && h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	h.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		io.WriteString(w, resp.Body)
+	}
+}
+
+// matchMockResponse returns the first mock response matching the request, or nil
+func matchMockResponse(mock *MockAction, r *http.Request) *MockResponse {
+	if mock == nil {
+		return nil
+	}
+	var query url.Values
+	for i := range mock.Responses {
+		m := &mock.Responses[i]
+		if m.Method != "" && !strings.EqualFold(m.Method, r.Method) {
+			continue
+		}
+		if m.Path != "" && !matchMockPath(m.Path, r.URL.Path) {
+			continue
+		}
+		if len(m.Query) > 0 {
+			if query == nil {
+				query = r.URL.Query()
+			}
+			if !matchMockQuery(m.Query, query) {
+				continue
+			}
+		}
+		return m
+	}
+	return nil
+}
+
+// matchMockPath compares a mock path with the request path segment by segment. A {name}
+// segment matches any one non-empty segment; a trailing * matches the remaining path.
+func matchMockPath(pattern, requestPath string) bool {
+	want := strings.Split(pattern, "/")
+	got := strings.Split(requestPath, "/")
+	for i, seg := range want {
+		if seg == "*" && i == len(want)-1 {
+			return true
+		}
+		if i >= len(got) {
+			return false
+		}
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			if got[i] == "" {
+				return false
+			}
+			continue
+		}
+		if seg != got[i] {
+			return false
+		}
+	}
+	return len(want) == len(got)
+}
+
+func matchMockQuery(want map[string]string, query url.Values) bool {
+	for name, value := range want {
+		if !query.Has(name) || (value != "" && query.Get(name) != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// serveStatic serves a file of a static action. Directory requests get an index file, missing
+// files the root index file when SPA fallback is on; ranges and conditional requests are
+// answered by http.ServeContent.
+func serveStatic(w http.ResponseWriter, r *http.Request, route *Route, cfg *StaticAction) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Path
+	if route.StripPath {
+		name = stripRoutePath(route, name)
+	}
+	name = path.Clean("/" + name)
+	// Dotfiles such as .env or .git are never served
+	if strings.Contains(name, "/.") {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	f, info, err := openStaticFile(cfg.Root, name)
+	if err == nil && info.IsDir() {
+		f.Close()
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			// Relative links in the index file resolve against the directory
+			target := r.URL.Path + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		f, info, err = openStaticIndex(cfg, name)
+	}
+	if err != nil && cfg.SPAFallback {
+		f, info, err = openStaticIndex(cfg, "/")
+	}
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	h := w.Header()
+	if cfg.CacheControl != "" {
+		h.Set("Cache-Control", cfg.CacheControl)
+	}
+	h.Set("ETag", fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// openStaticFile opens a file below root; symlinks and .. may not leave it
+func openStaticFile(root, name string) (*os.File, fs.FileInfo, error) {
+	rel := strings.TrimPrefix(name, "/")
+	if rel == "" {
+		rel = "."
+	}
+	f, err := os.OpenInRoot(root, rel)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+// openStaticIndex opens the first index file present in dir
+func openStaticIndex(cfg *StaticAction, dir string) (*os.File, fs.FileInfo, error) {
+	indexFiles := cfg.IndexFiles
+	if len(indexFiles) == 0 {
+		indexFiles = []string{"index.html"}
+	}
+	for _, index := range indexFiles {
+		f, info, err := openStaticFile(cfg.Root, path.Join(dir, index))
+		if err != nil {
+			continue
+		}
+		if info.Mode().IsRegular() {
+			return f, info, nil
+		}
+		f.Close()
+	}
+	return nil, nil, fs.ErrNotExist
+}
@@ -0,0 +1,188 @@
+package api_gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newActionTestGateway returns a gateway whose only route answers with action
+func newActionTestGateway(route *Route, action *RouteAction) *Gateway {
+	g := newProxyTestGateway(&Service{ID: "backend", Enabled: true})
+	route.ID = "r1"
+	route.Enabled = true
+	route.Action = action
+	if len(route.Paths) == 0 {
+		route.Paths = []string{"/"}
+	}
+	g.routes = []*Route{route}
+	return g
+}
+
+func serveAction(g *Gateway, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, req)
+	return rec
+}
+
+func TestValidateRouteAction(t *testing.T) {
+	valid := []*RouteAction{
+		{Type: "redirect", Redirect: &RedirectAction{Target: "https://${host}${request_uri}", StatusCode: 308}},
+		{Type: "static", Static: &StaticAction{Root: "/srv/www", IndexFiles: []string{"index.htm"}}},
+		{Type: "respond", Respond: &FixedResponse{StatusCode: 503}},
+		{Type: "mock", Mock: &MockAction{Responses: []MockResponse{{Path: "/api/users/{id}", DelayMs: 200}}}},
+	}
+	for _, action := range valid {
+		assert.NoError(t, validateRouteAction(&Route{Action: action}), action.Type)
+	}
+
+	invalid := map[string]*RouteAction{
+		"unknown route action type \"proxy\"":                   {Type: "proxy"},
+		"redirect action requires a target":                     {Type: "redirect", Redirect: &RedirectAction{}},
+		"invalid redirect status code 200":                      {Type: "redirect", Redirect: &RedirectAction{Target: "/", StatusCode: 200}},
+		"static action requires a root directory":               {Type: "static", Static: &StaticAction{}},
+		"invalid index file \"../index.html\"":                  {Type: "static", Static: &StaticAction{Root: "/srv", IndexFiles: []string{"../index.html"}}},
+		"invalid response status code 99":                       {Type: "respond", Respond: &FixedResponse{StatusCode: 99}},
+		"mock action requires at least one response":            {Type: "mock", Mock: &MockAction{}},
+		"mock response 1: path must start with /":               {Type: "mock", Mock: &MockAction{Responses: []MockResponse{{Path: "users"}}}},
+		"mock response 1: delay_ms must be between 0 and 60000": {Type: "mock", Mock: &MockAction{Responses: []MockResponse{{DelayMs: -1}}}},
+	}
+	for msg, action := range invalid {
+		assert.EqualError(t, validateRouteAction(&Route{Action: action}), msg)
+	}
+}
+
+func TestRedirectAction(t *testing.T) {
+	g := newActionTestGateway(&Route{ResponseHeaders: map[string]string{"X-Site": "old"}},
+		&RouteAction{Type: "redirect", Redirect: &RedirectAction{Target: "https://new.example.com${request_uri}", StatusCode: 301}})
+
+	rec := serveAction(g, "GET", "http://old.example.com/docs/intro?lang=en", nil)
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "https://new.example.com/docs/intro?lang=en", rec.Header().Get("Location"))
+	assert.Equal(t, "old", rec.Header().Get("X-Site"))
+}
+
+func TestFixedResponseAction(t *testing.T) {
+	g := newActionTestGateway(&Route{CORS: &CORSConfig{Enabled: true, AllowOrigins: []string{"*"}}},
+		&RouteAction{Type: "respond", Respond: &FixedResponse{
+			StatusCode: http.StatusServiceUnavailable,
+			Headers:    map[string]string{"Content-Type": "text/html", "Retry-After": "120", "X-Request-Id": "${request_id}"},
+			Body:       "<h1>Down for maintenance</h1>",
+		}})
+
+	rec := serveAction(g, "GET", "/anything", http.Header{"X-Request-Id": {"abc"}, "Origin": {"https://app.example.com"}})
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "<h1>Down for maintenance</h1>", rec.Body.String())
+	assert.Equal(t, "text/html", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "120", rec.Header().Get("Retry-After"))
+	assert.Equal(t, "abc", rec.Header().Get("X-Request-Id"))
+	assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = serveAction(g, "HEAD", "/", nil)
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, "29", rec.Header().Get("Content-Length"))
+}
+
+func TestStaticAction(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "index.html"), []byte("<app>"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "assets"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "assets", "app.js"), []byte("console.log(1)"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "docs"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "docs", "index.html"), []byte("<docs>"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".env"), []byte("SECRET=1"), 0o644))
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "leak.txt")))
+
+	static := &StaticAction{Root: root, CacheControl: "public, max-age=60"}
+	g := newActionTestGateway(&Route{Paths: []string{"/app/*"}, StripPath: true}, &RouteAction{Type: "static", Static: static})
+
+	rec := serveAction(g, "GET", "/app/assets/app.js", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "console.log(1)", rec.Body.String())
+	assert.Contains(t, rec.Header().Get("Content-Type"), "javascript")
+	assert.Equal(t, "public, max-age=60", rec.Header().Get("Cache-Control"))
+
+	rec = serveAction(g, "GET", "/app/assets/app.js", http.Header{"Range": {"bytes=0-6"}})
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "console", rec.Body.String())
+
+	etag := rec.Header().Get("ETag")
+	rec = serveAction(g, "GET", "/app/assets/app.js", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	rec = serveAction(g, "GET", "/app/docs", nil)
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "/app/docs/", rec.Header().Get("Location"))
+	rec = serveAction(g, "GET", "/app/docs/", nil)
+	assert.Equal(t, "<docs>", rec.Body.String())
+
+	for _, target := range []string{"/app/missing", "/app/.env", "/app/leak.txt", "/app/../../etc/passwd"} {
+		assert.Equal(t, http.StatusNotFound, serveAction(g, "GET", target, nil).Code, target)
+	}
+	assert.Equal(t, http.StatusMethodNotAllowed, serveAction(g, "POST", "/app/", nil).Code)
+
+	// single-page apps get their index file for client-side routes
+	static.SPAFallback = true
+	rec = serveAction(g, "GET", "/app/users/42", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<app>", rec.Body.String())
+	assert.Equal(t, http.StatusNotFound, serveAction(g, "GET", "/app/.env", nil).Code)
+}
+
+func TestMockAction(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("real " + r.URL.Path))
+	}))
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+
+	mock := &MockAction{Responses: []MockResponse{
+		{Method: "GET", Path: "/api/users", Query: map[string]string{"role": "admin"}, FixedResponse: FixedResponse{Body: `[{"id":1,"admin":true}]`}},
+		{Method: "GET", Path: "/api/users", FixedResponse: FixedResponse{Body: `[{"id":1},{"id":2}]`}},
+		{Method: "GET", Path: "/api/users/{id}", FixedResponse: FixedResponse{Body: `{"id":1}`, Headers: map[string]string{"Content-Type": "application/json"}}},
+		{Method: "POST", Path: "/api/users", FixedResponse: FixedResponse{StatusCode: http.StatusCreated}},
+		{Path: "/api/files/*", FixedResponse: FixedResponse{StatusCode: http.StatusNoContent}},
+	}}
+	g := newActionTestGateway(&Route{ServiceID: "backend"}, &RouteAction{Type: "mock", Mock: mock})
+	g.services["backend"] = &Service{ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true}
+
+	body := func(method, target string) (int, string) {
+		rec := serveAction(g, method, target, nil)
+		return rec.Code, rec.Body.String()
+	}
+	code, text := body("GET", "/api/users?role=admin")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `[{"id":1,"admin":true}]`, text)
+	_, text = body("GET", "/api/users?role=dev")
+	assert.Equal(t, `[{"id":1},{"id":2}]`, text)
+	rec := serveAction(g, "GET", "/api/users/7", nil)
+	assert.Equal(t, `{"id":1}`, rec.Body.String())
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	code, _ = body("POST", "/api/users")
+	assert.Equal(t, http.StatusCreated, code)
+	code, _ = body("DELETE", "/api/files/a/b.txt")
+	assert.Equal(t, http.StatusNoContent, code)
+
+	// anything not mocked reaches the real service
+	code, text = body("GET", "/api/orders")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "real /api/orders", text)
+	_, text = body("GET", "/api/users/")
+	assert.Equal(t, "real /api/users/", text)
+
+	// without a service unmatched requests are not found
+	g.routes[0].ServiceID = ""
+	code, _ = body("GET", "/api/orders")
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,211 @@
+package api_gateway
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"redock/dns_server"
+)
+
+const (
+	autoBlockTriggerAuthFailure = "auth_failure"
+	autoBlockTriggerRateLimited = "rate_limited"
+	autoBlockTriggerWAF         = "waf"
+	autoBlockTriggerServerError = "server_error"
+	autoBlockTriggerRequestRate = "request_rate"
+
+	slidingWindowBuckets        = 10
+	defaultEscalationMultiplier = 2
+	defaultEscalationMax        = 24 * time.Hour
+	defaultEscalationForget     = 24 * time.Hour
+)
+
+// windowBucket counts the events of one slice of a sliding window
+type windowBucket struct {
+	slot  int64
+	count int
+}
+
+// slidingWindow counts events over a window split into slices, so old events age out
+// slice by slice instead of all at once when a fixed window rolls over.
+type slidingWindow struct {
+	span    time.Duration
+	buckets [slidingWindowBuckets]windowBucket
+}
+
+// add records an event and returns the number of events within the window
+func (w *slidingWindow) add(now time.Time, window time.Duration) int {
+	span := max(window/slidingWindowBuckets, time.Second)
+	if w.span != span {
+		*w = slidingWindow{span: span}
+	}
+	slot := now.UnixNano() / int64(span)
+	bucket := &w.buckets[slot%slidingWindowBuckets]
+	if bucket.slot != slot {
+		*bucket = windowBucket{slot: slot}
+	}
+	bucket.count++
+
+	slices := int64((window + span - 1) / span)
+	total := 0
+	for _, b := range w.buckets {
+		if b.slot > slot-slices {
+			total += b.count
+		}
+	}
+	return total
+}
+
+// policyMatches reports whether a finished request counts towards a policy trigger; waf is
+// the request's WAF match in block or detect mode, if any
+func policyMatches(trigger string, statusCode int, waf *wafHit) bool {
+	switch trigger {
+	case autoBlockTriggerAuthFailure:
+		// WAF rejections are 403s too but have their own trigger
+		return (waf == nil || !waf.blocked) && (statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden)
+	case autoBlockTriggerRateLimited:
+		return statusCode == http.StatusTooManyRequests
+	case autoBlockTriggerWAF:
+		return waf != nil
+	case autoBlockTriggerServerError:
+		// 503 is the gateway's answer for unavailable services and open circuits, which the client did not cause
+		return statusCode >= http.StatusInternalServerError && statusCode != http.StatusServiceUnavailable
+	case autoBlockTriggerRequestRate:
+		return true
+	}
+	return false
+}
+
+// evaluateAutoBlockPolicies counts a request against the policies and returns the first one
+// whose threshold is reached with its count (must be called with g.clientStatsMu held)
+func evaluateAutoBlockPolicies(tracker *clientStatsTracker, policies []AutoBlockPolicy, statusCode int, waf *wafHit, now time.Time) (*AutoBlockPolicy, int) {
+	if len(tracker.policyWindows) != len(policies) {
+		tracker.policyWindows = make([]slidingWindow, len(policies))
+	}
+	var triggered *AutoBlockPolicy
+	triggeredCount := 0
+	for i := range policies {
+		p := &policies[i]
+		if p.Threshold <= 0 || p.WindowSec <= 0 || !policyMatches(p.Trigger, statusCode, waf) {
+			continue
+		}
+		count := tracker.policyWindows[i].add(now, time.Duration(p.WindowSec)*time.Second)
+		if triggered == nil && count >= p.Threshold {
+			triggered, triggeredCount = p, count
+		}
+	}
+	return triggered, triggeredCount
+}
+
+// reason describes why a policy blocked a client
+func (p *AutoBlockPolicy) reason(count int) string {
+	window := time.Duration(p.WindowSec) * time.Second
+	switch p.Trigger {
+	case autoBlockTriggerAuthFailure:
+		return fmt.Sprintf("blocked after %d failed authentications within %s", count, window)
+	case autoBlockTriggerRateLimited:
+		return fmt.Sprintf("blocked after %d rate-limited requests within %s", count, window)
+	case autoBlockTriggerWAF:
+		return fmt.Sprintf("blocked after %d requests rejected by the WAF within %s", count, window)
+	case autoBlockTriggerServerError:
+		return fmt.Sprintf("blocked after %d server errors within %s", count, window)
+	default:
+		return fmt.Sprintf("blocked after %d requests within %s", count, window)
+	}
+}
+
+// escalatedBlockDuration multiplies the base duration for every earlier offense, capped at
+// the configured maximum. Without escalation every block lasts the base duration.
+func escalatedBlockDuration(base time.Duration, offenses int, esc *BlockEscalation) time.Duration {
+	if esc == nil || offenses <= 1 {
+		return base
+	}
+	multiplier := esc.Multiplier
+	if multiplier < 1 {
+		multiplier = defaultEscalationMultiplier
+	}
+	maxDuration := defaultEscalationMax
+	if esc.MaxDurationSec > 0 {
+		maxDuration = time.Duration(esc.MaxDurationSec) * time.Second
+	}
+	duration := base
+	for i := 1; i < offenses && duration < maxDuration; i++ {
+		duration = time.Duration(float64(duration) * multiplier)
+	}
+	return max(min(duration, maxDuration), base)
+}
+
+// autoBlockAllowed reports whether an address may be auto-blocked under the allow list
+func autoBlockAllowed(cfg *ClientSecurityConfig, ip string) bool {
+	if len(cfg.AllowList) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return true
+	}
+	prefixes, err := parsePrefixes(cfg.AllowList)
+	if err != nil {
+		// Rejected on save
+		return true
+	}
+	return !prefixesContain(prefixes, addr.Unmap())
+}
+
+// validateClientSecurityConfig checks auto-block policies, escalation and the allow list before they are saved
+func validateClientSecurityConfig(cfg *ClientSecurityConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	for i, p := range cfg.Policies {
+		switch p.Trigger {
+		case autoBlockTriggerAuthFailure, autoBlockTriggerRateLimited, autoBlockTriggerWAF, autoBlockTriggerServerError, autoBlockTriggerRequestRate:
+		default:
+			return fmt.Errorf("auto-block policy %d: invalid trigger %q", i+1, p.Trigger)
+		}
+		if p.Threshold <= 0 || p.WindowSec <= 0 {
+			return fmt.Errorf("auto-block policy %d: threshold and window_seconds must be positive", i+1)
+		}
+		if p.DurationSec < 0 {
+			return fmt.Errorf("auto-block policy %d: duration_seconds must not be negative", i+1)
+		}
+	}
+	if esc := cfg.Escalation; esc != nil {
+		if esc.Multiplier != 0 && esc.Multiplier < 1 {
+			return fmt.Errorf("escalation multiplier must be at least 1")
+		}
+		if esc.MaxDurationSec < 0 || esc.ForgetAfterSec < 0 {
+			return fmt.Errorf("escalation durations must not be negative")
+		}
+	}
+	if _, err := parsePrefixes(cfg.AllowList); err != nil {
+		return fmt.Errorf("auto-block allow list: %w", err)
+	}
+	return nil
+}
+
+// dnsBanOwner marks the DNS client bans the gateway placed
+const dnsBanOwner = "api_gateway"
+
+// shareDNSBan copies an auto-block to the DNS server's client ban list; bans already there are
+// only extended. It is a variable so tests can stub it.
+var shareDNSBan = func(ip, reason string, until time.Time) error {
+	engine := dns_server.GetDNSServer().GetFilterEngine()
+	if engine == nil {
+		return errors.New("built-in DNS server is not initialized")
+	}
+	return engine.BanClient(ip, dnsBanOwner, "api gateway: "+reason, until)
+}
+
+// liftDNSBan removes a ban shareDNSBan created; bans placed in the DNS server are kept. It is a
+// variable so tests can stub it.
+var liftDNSBan = func(ip string) error {
+	engine := dns_server.GetDNSServer().GetFilterEngine()
+	if engine == nil {
+		return nil
+	}
+	return engine.UnbanClient(ip, dnsBanOwner)
+}
@@ -0,0 +1,148 @@
+package api_gateway
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAutoBlockTestGateway(cfg *ClientSecurityConfig) *Gateway {
+	return &Gateway{
+		config:      &GatewayConfig{ClientSecurity: cfg},
+		clientStats: make(map[string]*clientStatsTracker),
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	var w slidingWindow
+	start := time.Unix(1_700_000_000, 0)
+	window := time.Minute
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, i+1, w.add(start.Add(time.Duration(i)*10*time.Second), window))
+	}
+	// the first events age out slice by slice as the window slides
+	assert.Equal(t, 5, w.add(start.Add(65*time.Second), window))
+	assert.Equal(t, 1, w.add(start.Add(10*time.Minute), window))
+
+	// windows shorter than the bucket count fall back to one-second slices
+	var short slidingWindow
+	assert.Equal(t, 1, short.add(start, 3*time.Second))
+	assert.Equal(t, 2, short.add(start.Add(2*time.Second), 3*time.Second))
+	assert.Equal(t, 1, short.add(start.Add(5*time.Second), 3*time.Second))
+}
+
+func TestAutoBlockPolicies(t *testing.T) {
+	cfg := defaultClientSecurityConfig()
+	cfg.Policies = []AutoBlockPolicy{
+		{Trigger: autoBlockTriggerAuthFailure, Threshold: 3, WindowSec: 60},
+		{Trigger: autoBlockTriggerRateLimited, Threshold: 2, WindowSec: 60, DurationSec: 30},
+		{Trigger: autoBlockTriggerServerError, Threshold: 2, WindowSec: 60},
+	}
+	g := newAutoBlockTestGateway(cfg)
+
+	for i := 0; i < 2; i++ {
+		g.trackClientActivity("198.51.100.1", "/login", "r1", http.StatusUnauthorized, true, nil)
+		g.trackClientActivity("198.51.100.1", "/", "r1", http.StatusOK, true, nil)
+	}
+	blocked, _ := g.isClientBlocked("198.51.100.1")
+	assert.False(t, blocked)
+	g.trackClientActivity("198.51.100.1", "/login", "r1", http.StatusForbidden, true, nil)
+	blocked, reason := g.isClientBlocked("198.51.100.1")
+	assert.True(t, blocked)
+	assert.Contains(t, reason, "3 failed authentications")
+
+	// the policy's own duration overrides the default
+	g.trackClientActivity("198.51.100.2", "/", "r1", http.StatusTooManyRequests, true, nil)
+	g.trackClientActivity("198.51.100.2", "/", "r1", http.StatusTooManyRequests, true, nil)
+	tracker := g.clientStats["198.51.100.2"]
+	assert.WithinDuration(t, tracker.blockedAt.Add(30*time.Second), tracker.blockedUntil, time.Millisecond)
+
+	// 503s answered for unavailable services are not held against the client
+	for i := 0; i < 3; i++ {
+		g.trackClientActivity("198.51.100.3", "/", "r1", http.StatusServiceUnavailable, true, nil)
+	}
+	blocked, _ = g.isClientBlocked("198.51.100.3")
+	assert.False(t, blocked)
+	g.trackClientActivity("198.51.100.3", "/", "r1", http.StatusInternalServerError, true, nil)
+	g.trackClientActivity("198.51.100.3", "/", "r1", http.StatusBadGateway, true, nil)
+	blocked, _ = g.isClientBlocked("198.51.100.3")
+	assert.True(t, blocked)
+}
+
+func TestAutoBlockEscalationAndAllowList(t *testing.T) {
+	cfg := defaultClientSecurityConfig()
+	cfg.AutoBlockDurationSec = 60
+	cfg.Escalation = &BlockEscalation{Multiplier: 3, MaxDurationSec: 600}
+	cfg.AllowList = []string{"10.0.0.0/8"}
+	g := newAutoBlockTestGateway(cfg)
+
+	tracker := g.getOrCreateClientTrackerLocked("203.0.113.9")
+	var durations []time.Duration
+	for i := 0; i < 4; i++ {
+		require.True(t, g.autoBlockClientLocked(tracker, cfg, time.Minute, "test"))
+		durations = append(durations, tracker.blockedUntil.Sub(tracker.blockedAt))
+		assert.False(t, g.autoBlockClientLocked(tracker, cfg, time.Minute, "test"), "already blocked")
+		tracker.blockedUntil = time.Now().Add(-time.Second)
+	}
+	assert.Equal(t, []time.Duration{time.Minute, 3 * time.Minute, 9 * time.Minute, 10 * time.Minute}, durations)
+	assert.Equal(t, 4, tracker.offenses)
+
+	// offenses are forgotten once the memory has passed
+	tracker.offensesExpire = time.Now().Add(-time.Second)
+	require.True(t, g.autoBlockClientLocked(tracker, cfg, time.Minute, "test"))
+	assert.Equal(t, 1, tracker.offenses)
+
+	for i := 0; i < cfg.NoRouteThreshold; i++ {
+		g.trackClientActivity("10.1.2.3", "/missing", "", http.StatusNotFound, false, nil)
+	}
+	blocked, _ := g.isClientBlocked("10.1.2.3")
+	assert.False(t, blocked)
+	assert.Zero(t, g.clientStats["10.1.2.3"].consecutiveMisses)
+}
+
+func TestAutoBlockSharedWithDNS(t *testing.T) {
+	var banned, lifted []string
+	var bannedUntil time.Time
+	origShare, origLift := shareDNSBan, liftDNSBan
+	shareDNSBan = func(ip, reason string, until time.Time) error {
+		banned = append(banned, ip)
+		bannedUntil = until
+		return nil
+	}
+	liftDNSBan = func(ip string) error {
+		lifted = append(lifted, ip)
+		return nil
+	}
+	t.Cleanup(func() { shareDNSBan, liftDNSBan = origShare, origLift })
+
+	cfg := defaultClientSecurityConfig()
+	cfg.ShareWithDNS = true
+	cfg.Policies = []AutoBlockPolicy{{Trigger: autoBlockTriggerRequestRate, Threshold: 3, WindowSec: 1}}
+	g := newAutoBlockTestGateway(cfg)
+	for i := 0; i < 3; i++ {
+		g.trackClientActivity("192.0.2.44", "/", "r1", http.StatusOK, true, nil)
+	}
+	assert.Equal(t, []string{"192.0.2.44"}, banned)
+	assert.Equal(t, g.clientStats["192.0.2.44"].blockedUntil, bannedUntil)
+
+	require.NoError(t, g.ManualUnblockClient("192.0.2.44"))
+	assert.Equal(t, []string{"192.0.2.44"}, lifted)
+	blocked, _ := g.isClientBlocked("192.0.2.44")
+	assert.False(t, blocked)
+}
+
+func TestValidateClientSecurityConfig(t *testing.T) {
+	assert.NoError(t, validateClientSecurityConfig(nil))
+	assert.NoError(t, validateClientSecurityConfig(&ClientSecurityConfig{
+		Policies:   []AutoBlockPolicy{{Trigger: autoBlockTriggerWAF, Threshold: 5, WindowSec: 300}},
+		Escalation: &BlockEscalation{Multiplier: 2},
+		AllowList:  []string{"192.168.0.0/16", "2001:db8::1"},
+	}))
+	assert.Error(t, validateClientSecurityConfig(&ClientSecurityConfig{Policies: []AutoBlockPolicy{{Trigger: "login", Threshold: 1, WindowSec: 1}}}))
+	assert.Error(t, validateClientSecurityConfig(&ClientSecurityConfig{Policies: []AutoBlockPolicy{{Trigger: autoBlockTriggerWAF, Threshold: 0, WindowSec: 1}}}))
+	assert.Error(t, validateClientSecurityConfig(&ClientSecurityConfig{Escalation: &BlockEscalation{Multiplier: 0.5}}))
+	assert.Error(t, validateClientSecurityConfig(&ClientSecurityConfig{AllowList: []string{"10.0.0.0/40"}}))
+}
@@ -0,0 +1,109 @@
+package api_gateway
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestBodyIsStreamed(t *testing.T) {
+	firstChunk := make(chan struct{})
+	var received int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 1024)
+		n, _ := io.ReadFull(r.Body, buf)
+		close(firstChunk)
+		rest, _ := io.Copy(io.Discard, r.Body)
+		atomic.StoreInt64(&received, int64(n)+rest)
+	}))
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+	g := newProxyTestGateway(&Service{ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true})
+
+	pr, pw := io.Pipe()
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, httptest.NewRequest("POST", "/upload", pr))
+		done <- rec
+	}()
+
+	// the upstream sees the first chunk while the client is still sending
+	pw.Write(bytes.Repeat([]byte("a"), 1024))
+	select {
+	case <-firstChunk:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream did not receive the body before it was complete")
+	}
+	for i := 0; i < 64; i++ {
+		pw.Write(bytes.Repeat([]byte("b"), 64<<10))
+	}
+	pw.Close()
+	rec := <-done
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int64(1024+64*64<<10), atomic.LoadInt64(&received))
+}
+
+func TestRequestBodyTeeLogInfo(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("x", 10000)))
+	tee := teeRequestBody(r, maxLoggedBodyBytes, nil)
+	io.Copy(io.Discard, r.Body)
+	info := tee.LogInfo()
+	assert.Len(t, info.body, maxLoggedBodyBytes)
+	assert.True(t, info.truncated)
+	assert.Equal(t, int64(10000), info.size)
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader("--boundary"))
+	r.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+	tee = teeRequestBody(r, maxLoggedBodyBytes, []string{"multipart/", "application/octet-stream"})
+	io.Copy(io.Discard, r.Body)
+	info = tee.LogInfo()
+	assert.Empty(t, info.body)
+	assert.False(t, info.truncated)
+	assert.Equal(t, int64(10), info.size)
+
+	assert.True(t, skipBodyLog("Application/Octet-Stream", []string{"application/octet-stream"}))
+	assert.False(t, skipBodyLog("application/json", []string{"multipart/", "application/octet-stream"}))
+
+	lw := newLoggingResponseWriter(httptest.NewRecorder(), maxLoggedBodyBytes)
+	lw.skipTypes = []string{"image/"}
+	lw.Header().Set("Content-Type", "image/png")
+	lw.Write([]byte("png-bytes"))
+	assert.Empty(t, lw.LogInfo().body)
+	assert.Equal(t, int64(9), lw.LogInfo().size)
+}
+
+func TestRouteMaxRequestBodyBytes(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+	g := newProxyTestGateway(&Service{ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true})
+	g.routes[0].MaxRequestBodyBytes = 100
+
+	// declared length over the limit: rejected before proxying
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("x", 101))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&hits))
+
+	// streamed body over the limit
+	rec = httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("POST", "/", io.MultiReader(strings.NewReader(strings.Repeat("x", 1000)))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	rec = httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("x", 100))))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,797 @@
+package api_gateway
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cacheStatusHit         = "HIT"
+	cacheStatusMiss        = "MISS"
+	cacheStatusStale       = "STALE"
+	cacheStatusRevalidated = "REVALIDATED"
+
+	defaultCacheMaxBytes      = 64 << 20
+	defaultCacheEntryMaxBytes = 1 << 20
+	cacheEntryOverhead        = 256
+	cacheRevalidateTimeout    = 30 * time.Second
+)
+
+var (
+	defaultCacheMethods     = []string{http.MethodGet, http.MethodHead}
+	defaultCacheStatusCodes = []int{200, 203, 204, 301, 404, 410}
+)
+
+// cacheEntry is a stored upstream response. Entries are never modified once stored;
+// a revalidation replaces the entry under the same key.
+type cacheEntry struct {
+	key          string
+	primary      string // key without the Vary part
+	routeID      string
+	path         string
+	status       int
+	header       http.Header
+	body         []byte
+	storedAt     time.Time
+	freshUntil   time.Time
+	staleUntil   time.Time // end of the stale-while-revalidate window
+	etag         string
+	lastModified string
+	size         int64
+	elem         *list.Element
+}
+
+// routeCacheCounters counts cache lookups of a route
+type routeCacheCounters struct {
+	hits        int64
+	misses      int64
+	stale       int64
+	revalidated int64
+}
+
+// responseCache is an LRU of upstream responses bounded by their approximate memory size
+type responseCache struct {
+	mu           sync.Mutex
+	maxBytes     int64
+	size         int64
+	entries      map[string]*cacheEntry
+	lru          *list.List          // most recently used at the front
+	vary         map[string][]string // primary key -> request headers named by Vary
+	revalidating map[string]bool
+	counters     map[string]*routeCacheCounters
+}
+
+func newResponseCache(maxBytes int64) *responseCache {
+	if maxBytes <= 0 {
+		maxBytes = defaultCacheMaxBytes
+	}
+	return &responseCache{
+		maxBytes:     maxBytes,
+		entries:      make(map[string]*cacheEntry),
+		lru:          list.New(),
+		vary:         make(map[string][]string),
+		revalidating: make(map[string]bool),
+		counters:     make(map[string]*routeCacheCounters),
+	}
+}
+
+// responseCacheStore returns the gateway's response cache, creating it on first use.
+func (g *Gateway) responseCacheStore() *responseCache {
+	g.mu.RLock()
+	maxBytes := g.config.CacheMaxBytes
+	g.mu.RUnlock()
+
+	g.responseCacheMu.Lock()
+	defer g.responseCacheMu.Unlock()
+	if g.responseCache == nil {
+		g.responseCache = newResponseCache(maxBytes)
+	}
+	return g.responseCache
+}
+
+// resizeResponseCache applies a changed memory bound, evicting entries when it shrank.
+func (g *Gateway) resizeResponseCache(maxBytes int64) {
+	g.responseCacheMu.Lock()
+	c := g.responseCache
+	g.responseCacheMu.Unlock()
+	if c == nil {
+		return
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultCacheMaxBytes
+	}
+	c.mu.Lock()
+	c.maxBytes = maxBytes
+	c.evictLocked()
+	c.mu.Unlock()
+}
+
+// PurgeCache removes cached responses and returns how many were dropped. Empty arguments
+// match everything; pathPrefix matches the request path and key an exact cache key
+// (a key without its Vary part purges every variant).
+func (g *Gateway) PurgeCache(routeID, pathPrefix, key string) int {
+	g.responseCacheMu.Lock()
+	c := g.responseCache
+	g.responseCacheMu.Unlock()
+	if c == nil {
+		return 0
+	}
+	return c.purge(routeID, pathPrefix, key)
+}
+
+// purgeChangedRoutes drops the cached responses of routes that were removed or whose settings
+// differ between two configurations
+func (g *Gateway) purgeChangedRoutes(previous, next []Route) {
+	routes := make(map[string]Route, len(next))
+	for _, r := range next {
+		routes[r.ID] = r
+	}
+	for _, r := range previous {
+		if n, ok := routes[r.ID]; !ok || !reflect.DeepEqual(r, n) {
+			g.PurgeCache(r.ID, "", "")
+		}
+	}
+}
+
+func (c *responseCache) purge(routeID, pathPrefix, key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	purged := 0
+	for _, e := range c.entries {
+		if routeID != "" && e.routeID != routeID {
+			continue
+		}
+		if pathPrefix != "" && !strings.HasPrefix(e.path, pathPrefix) {
+			continue
+		}
+		if key != "" && e.key != key && e.primary != key {
+			continue
+		}
+		c.removeLocked(e)
+		purged++
+	}
+	return purged
+}
+
+func (c *responseCache) removeLocked(e *cacheEntry) {
+	c.lru.Remove(e.elem)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
+
+func (c *responseCache) evictLocked() {
+	for c.size > c.maxBytes {
+		back := c.lru.Back()
+		if back == nil {
+			return
+		}
+		c.removeLocked(back.Value.(*cacheEntry))
+	}
+}
+
+// count records the outcome of a lookup on a route
+func (c *responseCache) count(routeID, status string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counters := c.counters[routeID]
+	if counters == nil {
+		counters = &routeCacheCounters{}
+		c.counters[routeID] = counters
+	}
+	switch status {
+	case cacheStatusHit:
+		counters.hits++
+	case cacheStatusMiss:
+		counters.misses++
+	case cacheStatusStale:
+		counters.stale++
+	case cacheStatusRevalidated:
+		counters.revalidated++
+	}
+}
+
+// cacheStats returns the response cache statistics for GatewayStats
+func (g *Gateway) cacheStats() CacheStats {
+	g.responseCacheMu.Lock()
+	c := g.responseCache
+	g.responseCacheMu.Unlock()
+	if c == nil {
+		return CacheStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := CacheStats{Entries: len(c.entries), SizeBytes: c.size, MaxBytes: c.maxBytes}
+	for routeID, counters := range c.counters {
+		route := RouteCacheStats{
+			RouteID:     routeID,
+			Hits:        counters.hits,
+			Misses:      counters.misses,
+			Stale:       counters.stale,
+			Revalidated: counters.revalidated,
+			HitRatio:    hitRatio(counters.hits+counters.stale+counters.revalidated, counters.misses),
+		}
+		stats.Routes = append(stats.Routes, route)
+		stats.Hits += route.Hits
+		stats.Misses += route.Misses
+		stats.Stale += route.Stale
+		stats.Revalidated += route.Revalidated
+	}
+	sort.Slice(stats.Routes, func(i, j int) bool { return stats.Routes[i].RouteID < stats.Routes[j].RouteID })
+	stats.HitRatio = hitRatio(stats.Hits+stats.Stale+stats.Revalidated, stats.Misses)
+	return stats
+}
+
+func hitRatio(served, misses int64) float64 {
+	if served+misses == 0 {
+		return 0
+	}
+	return float64(served) / float64(served+misses)
+}
+
+// cacheLookup carries the response cache state of one request
+type cacheLookup struct {
+	cache      *responseCache
+	cfg        *RouteCacheConfig
+	routeID    string
+	path       string
+	primary    string
+	key        string
+	reqHeader  http.Header
+	entry      *cacheEntry // cached response for the key, fresh or not
+	status     string
+	injected   bool // conditional headers were added to revalidate entry
+	authorized bool // the request carried credentials or passed route auth
+}
+
+type cacheLookupKey struct{}
+
+func withCacheLookup(r *http.Request, l *cacheLookup) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), cacheLookupKey{}, l))
+}
+
+func cacheLookupFromRequest(r *http.Request) *cacheLookup {
+	l, _ := r.Context().Value(cacheLookupKey{}).(*cacheLookup)
+	return l
+}
+
+// cacheStatusFromRequest returns the final cache status of a request on a cached route
+func cacheStatusFromRequest(r *http.Request) string {
+	if l := cacheLookupFromRequest(r); l != nil {
+		return l.status
+	}
+	return ""
+}
+
+func (cfg *RouteCacheConfig) cacheableMethod(method string) bool {
+	methods := cfg.Methods
+	if len(methods) == 0 {
+		methods = defaultCacheMethods
+	}
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *RouteCacheConfig) cacheableStatus(code int) bool {
+	codes := cfg.StatusCodes
+	if len(codes) == 0 {
+		codes = defaultCacheStatusCodes
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *RouteCacheConfig) maxEntryBytes() int64 {
+	if cfg.MaxEntryBytes > 0 {
+		return cfg.MaxEntryBytes
+	}
+	return defaultCacheEntryMaxBytes
+}
+
+// cacheKey builds the primary cache key of a request on route
+func cacheKey(r *http.Request, route *Route) string {
+	cfg := route.Cache
+	var b strings.Builder
+	b.WriteString(route.ID)
+	b.WriteByte('|')
+	b.WriteString(r.Method)
+	b.WriteByte('|')
+	if !cfg.KeyIgnoreHost {
+		b.WriteString(strings.ToLower(normalizeHost(r.Host)))
+	}
+	b.WriteByte('|')
+	b.WriteString(r.URL.Path)
+
+	query := r.URL.Query()
+	if len(cfg.KeyQueryParams) > 0 {
+		selected := url.Values{}
+		for _, name := range cfg.KeyQueryParams {
+			if values, ok := query[name]; ok {
+				selected[name] = values
+			}
+		}
+		query = selected
+	}
+	if len(query) > 0 {
+		b.WriteByte('?')
+		b.WriteString(query.Encode())
+	}
+
+	b.WriteByte('|')
+	for i, name := range cfg.KeyHeaders {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(strings.ToLower(name))
+		b.WriteByte('=')
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// varyKey appends the values of the Vary request headers to a primary key
+func varyKey(primary string, header http.Header, vary []string) string {
+	if len(vary) == 0 {
+		return primary
+	}
+	var b strings.Builder
+	b.WriteString(primary)
+	for _, name := range vary {
+		b.WriteString("|vary:")
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strings.Join(header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// parseVary returns the normalized header names of a Vary response header
+func parseVary(h http.Header) []string {
+	var names []string
+	for _, value := range h.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cacheControl holds the directives of a Cache-Control header
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, value := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, arg, _ := strings.Cut(directive, "=")
+			cc[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds returns a delta-seconds directive
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	value, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// cacheFreshness decides whether a response may be stored and for how long it is fresh
+// and then servable while stale.
+func cacheFreshness(cfg *RouteCacheConfig, status int, h http.Header, now time.Time, authorized bool) (ttl, swr time.Duration, ok bool) {
+	if !cfg.cacheableStatus(status) || len(h.Values("Set-Cookie")) > 0 {
+		return 0, 0, false
+	}
+	for _, name := range parseVary(h) {
+		if name == "*" {
+			return 0, 0, false
+		}
+	}
+	cc := parseCacheControl(h)
+	if cc.has("no-store") || cc.has("private") {
+		return 0, 0, false
+	}
+	// Shared caches must not store answers to authenticated requests unless allowed explicitly
+	if authorized && !cc.has("public") && !cc.has("s-maxage") {
+		return 0, 0, false
+	}
+
+	if cc.has("no-cache") {
+		// Stored for conditional revalidation only
+		ttl = 0
+	} else if d, found := cc.seconds("s-maxage"); found {
+		ttl = d
+	} else if d, found := cc.seconds("max-age"); found {
+		ttl = d
+	} else if expires := h.Get("Expires"); expires != "" {
+		// An invalid Expires (like "0") means already expired
+		if exp, err := http.ParseTime(expires); err == nil {
+			date := now
+			if d, err := http.ParseTime(h.Get("Date")); err == nil {
+				date = d
+			}
+			ttl = max(exp.Sub(date), 0)
+		}
+	} else if cfg.DefaultTTL > 0 {
+		ttl = time.Duration(cfg.DefaultTTL) * time.Second
+	} else {
+		return 0, 0, false
+	}
+	if cfg.MaxTTL > 0 {
+		ttl = min(ttl, time.Duration(cfg.MaxTTL)*time.Second)
+	}
+
+	if d, found := cc.seconds("stale-while-revalidate"); found {
+		swr = d
+	} else {
+		swr = time.Duration(cfg.StaleWhileRevalidate) * time.Second
+	}
+	if cc.has("must-revalidate") || cc.has("proxy-revalidate") || cc.has("no-cache") {
+		swr = 0
+	}
+
+	// Without freshness or validators the entry could never be used
+	if ttl == 0 && swr == 0 && h.Get("ETag") == "" && h.Get("Last-Modified") == "" {
+		return 0, 0, false
+	}
+	return ttl, swr, true
+}
+
+// lookupResponseCache finds the cached response for a request on a route with caching enabled.
+// It returns nil when the request bypasses the cache.
+func (g *Gateway) lookupResponseCache(r *http.Request, route *Route) *cacheLookup {
+	cfg := route.Cache
+	if cfg == nil || !cfg.Enabled || !cfg.cacheableMethod(r.Method) || r.Header.Get("Upgrade") != "" {
+		return nil
+	}
+	reqCC := parseCacheControl(r.Header)
+	if reqCC.has("no-store") {
+		return nil
+	}
+
+	c := g.responseCacheStore()
+	// Credentials of auth routes may be an API key, a cookie or any header, none of which is
+	// part of the key, so their responses are only shared when upstream marks them public
+	l := &cacheLookup{
+		cache:      c,
+		cfg:        cfg,
+		routeID:    route.ID,
+		path:       r.URL.Path,
+		primary:    cacheKey(r, route),
+		reqHeader:  r.Header,
+		status:     cacheStatusMiss,
+		authorized: route.AuthRequired || r.Header.Get("Authorization") != "",
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	l.key = varyKey(l.primary, r.Header, c.vary[l.primary])
+	if e := c.entries[l.key]; e != nil {
+		c.lru.MoveToFront(e.elem)
+		l.entry = e
+	}
+	c.mu.Unlock()
+
+	// no-cache and max-age=0 from the client force a revalidation with upstream
+	maxAge, hasMaxAge := reqCC.seconds("max-age")
+	if l.entry != nil && !reqCC.has("no-cache") && (!hasMaxAge || maxAge > 0) {
+		switch {
+		case now.Before(l.entry.freshUntil):
+			l.status = cacheStatusHit
+		case now.Before(l.entry.staleUntil):
+			l.status = cacheStatusStale
+		}
+	}
+	return l
+}
+
+// served reports whether the request is answered from the cache without calling upstream
+func (l *cacheLookup) served() bool {
+	return l.status == cacheStatusHit || l.status == cacheStatusStale
+}
+
+// prepareRevalidation turns a proxied request into a conditional one when an expired entry
+// with validators exists, so a 304 from upstream can refresh it.
+func (l *cacheLookup) prepareRevalidation(r *http.Request) {
+	e := l.entry
+	if e == nil || r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+		return
+	}
+	if e.etag == "" && e.lastModified == "" {
+		return
+	}
+	if e.etag != "" {
+		r.Header.Set("If-None-Match", e.etag)
+	}
+	if e.lastModified != "" {
+		r.Header.Set("If-Modified-Since", e.lastModified)
+	}
+	l.injected = true
+}
+
+// store caches a response if its headers allow it and returns whether it was stored
+func (l *cacheLookup) store(status int, header http.Header, body []byte, now time.Time) bool {
+	ttl, swr, ok := cacheFreshness(l.cfg, status, header, now, l.authorized)
+	if !ok || int64(len(body)) > l.cfg.maxEntryBytes() {
+		return false
+	}
+	vary := parseVary(header)
+
+	header = header.Clone()
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+	header.Del("Age")
+	e := &cacheEntry{
+		primary:      l.primary,
+		routeID:      l.routeID,
+		path:         l.path,
+		status:       status,
+		header:       header,
+		body:         body,
+		storedAt:     now,
+		freshUntil:   now.Add(ttl),
+		staleUntil:   now.Add(ttl + swr),
+		etag:         header.Get("ETag"),
+		lastModified: header.Get("Last-Modified"),
+	}
+	e.key = varyKey(l.primary, l.reqHeader, vary)
+	e.size = int64(len(body)+len(e.key)) + cacheEntryOverhead
+	for name, values := range header {
+		e.size += int64(len(name))
+		for _, v := range values {
+			e.size += int64(len(v))
+		}
+	}
+
+	c := l.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e.size > c.maxBytes {
+		return false
+	}
+	if len(vary) > 0 {
+		c.vary[l.primary] = vary
+	} else {
+		delete(c.vary, l.primary)
+	}
+	if old := c.entries[e.key]; old != nil {
+		c.removeLocked(old)
+	}
+	e.elem = c.lru.PushFront(e)
+	c.entries[e.key] = e
+	c.size += e.size
+	c.evictLocked()
+	return true
+}
+
+// refresh stores the cached entry again with the headers of a 304 revalidation response
+func (l *cacheLookup) refresh(notModified http.Header, now time.Time) http.Header {
+	merged := l.entry.header.Clone()
+	for name, values := range notModified {
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Length", "Content-Type", "Content-Encoding", "Transfer-Encoding":
+			continue
+		}
+		merged[name] = values
+	}
+	l.store(l.entry.status, merged, l.entry.body, now)
+	return merged
+}
+
+// finish counts the final outcome of the lookup
+func (l *cacheLookup) finish() {
+	l.cache.count(l.routeID, l.status)
+}
+
+// cacheUpstreamResponse handles an upstream response on a cached route: a 304 answering an
+// injected revalidation becomes the cached response, cacheable responses are captured.
+func (l *cacheLookup) cacheUpstreamResponse(resp *http.Response) {
+	now := time.Now()
+	if resp.StatusCode == http.StatusNotModified && l.injected {
+		e := l.entry
+		resp.Header = l.refresh(resp.Header, now)
+		resp.StatusCode = e.status
+		resp.Status = strconv.Itoa(e.status) + " " + http.StatusText(e.status)
+		resp.Body = io.NopCloser(bytes.NewReader(e.body))
+		resp.ContentLength = int64(len(e.body))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(e.body)))
+		l.status = cacheStatusRevalidated
+		resp.Header.Set("X-Cache", l.status)
+		return
+	}
+
+	if _, _, ok := cacheFreshness(l.cfg, resp.StatusCode, resp.Header, now, l.authorized); ok && resp.ContentLength <= l.cfg.maxEntryBytes() {
+		header := resp.Header.Clone()
+		status := resp.StatusCode
+		resp.Body = &cacheCaptureBody{
+			ReadCloser: resp.Body,
+			limit:      l.cfg.maxEntryBytes(),
+			done: func(body []byte) {
+				l.store(status, header, body, time.Now())
+			},
+		}
+	}
+	resp.Header.Set("X-Cache", l.status)
+}
+
+// cacheCaptureBody copies a response body while it is streamed to the client and hands the
+// copy to done once the body was read completely.
+type cacheCaptureBody struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	limit    int64
+	overflow bool
+	done     func([]byte)
+}
+
+func (b *cacheCaptureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.overflow {
+		if int64(b.buf.Len()+n) > b.limit {
+			b.overflow = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !b.overflow && b.done != nil {
+		b.done(b.buf.Bytes())
+		b.done = nil
+	}
+	return n, err
+}
+
+// serveCachedResponse writes a cached response with the route's response headers applied
+// for this request, answering conditional requests with 304.
+func (g *Gateway) serveCachedResponse(w http.ResponseWriter, r *http.Request, route *Route, service *Service, l *cacheLookup) {
+	e := l.entry
+	h := w.Header()
+	for name, values := range e.header {
+		h[name] = append([]string(nil), values...)
+	}
+	applyCORSHeaders(h, r.Header.Get("Origin"), route.CORS)
+	applyResponseHeaders(h, route.ResponseHeaders)
+	if t := g.transformerFor(route); t != nil {
+		applyHeaderTransform(h, t.cfg.ResponseHeaders, transformVars{r: r, route: route, service: service})
+	}
+	h.Set("Age", strconv.FormatInt(int64(time.Since(e.storedAt)/time.Second), 10))
+	h.Set("X-Cache", l.status)
+
+	if notModified(r, e) {
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Length", strconv.Itoa(len(e.body)))
+	w.WriteHeader(e.status)
+	if r.Method != http.MethodHead {
+		w.Write(e.body)
+	}
+}
+
+// notModified evaluates the client's conditional headers against a cached entry
+func notModified(r *http.Request, e *cacheEntry) bool {
+	if e.status != http.StatusOK {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if e.etag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(e.etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && e.lastModified != "" {
+		since, err := http.ParseTime(ims)
+		modified, err2 := http.ParseTime(e.lastModified)
+		return err == nil && err2 == nil && !modified.After(since)
+	}
+	return false
+}
+
+// revalidateInBackground refreshes a stale entry served under stale-while-revalidate.
+// Only one revalidation per key runs at a time.
+func (g *Gateway) revalidateInBackground(r *http.Request, route *Route, service *Service, l *cacheLookup) {
+	c := l.cache
+	c.mu.Lock()
+	if c.revalidating[l.key] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[l.key] = true
+	c.mu.Unlock()
+	done := func() {
+		c.mu.Lock()
+		delete(c.revalidating, l.key)
+		c.mu.Unlock()
+	}
+
+	_, target := g.pickTarget(service, r, getClientIP(r))
+	transport, err := g.transportFor(service)
+	if target == nil || err != nil {
+		done()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cacheRevalidateTimeout)
+	out := r.Clone(ctx)
+	out.RequestURI = ""
+	out.Body = http.NoBody
+	out.ContentLength = 0
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	out.Header.Del("If-None-Match")
+	out.Header.Del("If-Modified-Since")
+	if l.entry.etag != "" {
+		out.Header.Set("If-None-Match", l.entry.etag)
+	}
+	if l.entry.lastModified != "" {
+		out.Header.Set("If-Modified-Since", l.entry.lastModified)
+	}
+	directUpstreamRequest(out, r, route, service, &url.URL{Scheme: service.upstreamScheme(), Host: target.address}, g.transformerFor(route))
+
+	go func() {
+		defer done()
+		defer cancel()
+		resp, err := transport.RoundTrip(out)
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		now := time.Now()
+		if resp.StatusCode == http.StatusNotModified {
+			l.refresh(resp.Header, now)
+			return
+		}
+		limit := l.cfg.maxEntryBytes()
+		body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+		if err != nil || int64(len(body)) > limit {
+			return
+		}
+		l.store(resp.StatusCode, resp.Header, body, now)
+	}()
+}
@@ -0,0 +1,278 @@
+package api_gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCacheTestGateway(t *testing.T, handler http.HandlerFunc, cfg *RouteCacheConfig) *Gateway {
+	t.Helper()
+	backend := httptest.NewServer(handler)
+	t.Cleanup(backend.Close)
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+	g := newProxyTestGateway(&Service{ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true})
+	g.routes[0].Cache = cfg
+	return g
+}
+
+func cachedGet(g *Gateway, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, req)
+	return rec
+}
+
+func TestResponseCacheHitAndMiss(t *testing.T) {
+	var hits int32
+	g := newCacheTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprintf(w, "%s #%d", r.URL.Path, n)
+	}, &RouteCacheConfig{Enabled: true, KeyQueryParams: []string{"page"}})
+
+	rec := cachedGet(g, "/items?page=1&utm=a", nil)
+	assert.Equal(t, "/items #1", rec.Body.String())
+	assert.Equal(t, cacheStatusMiss, rec.Header().Get("X-Cache"))
+
+	// unselected query parameters do not split the key
+	rec = cachedGet(g, "/items?utm=b&page=1", nil)
+	assert.Equal(t, "/items #1", rec.Body.String())
+	assert.Equal(t, cacheStatusHit, rec.Header().Get("X-Cache"))
+	assert.NotEmpty(t, rec.Header().Get("Age"))
+
+	rec = cachedGet(g, "/items?page=2", nil)
+	assert.Equal(t, "/items #2", rec.Body.String())
+
+	// POST is not cached; client no-store bypasses
+	req := httptest.NewRequest("POST", "/items?page=1", nil)
+	g.handleRequest(httptest.NewRecorder(), req)
+	rec = cachedGet(g, "/items?page=1", map[string]string{"Cache-Control": "no-store"})
+	assert.Equal(t, "/items #4", rec.Body.String())
+	assert.Equal(t, int32(4), atomic.LoadInt32(&hits))
+
+	stats := g.GetStats().CacheStats
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+	assert.InDelta(t, 1.0/3, stats.HitRatio, 0.001)
+	require.Len(t, stats.Routes, 1)
+	assert.Equal(t, "r1", stats.Routes[0].RouteID)
+	assert.Equal(t, 2, stats.Entries)
+}
+
+func TestResponseCacheRespectsHeaders(t *testing.T) {
+	cfg := &RouteCacheConfig{Enabled: true}
+	now := time.Now()
+	cases := []struct {
+		name       string
+		header     http.Header
+		authorized bool
+		cacheable  bool
+		ttl        time.Duration
+	}{
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=30"}}, false, true, 30 * time.Second},
+		{"s-maxage wins", http.Header{"Cache-Control": {"max-age=30, s-maxage=90"}}, false, true, 90 * time.Second},
+		{"expires", http.Header{"Expires": {now.Add(time.Minute).UTC().Format(http.TimeFormat)}, "Date": {now.UTC().Format(http.TimeFormat)}}, false, true, time.Minute},
+		{"no-store", http.Header{"Cache-Control": {"no-store"}}, false, false, 0},
+		{"private", http.Header{"Cache-Control": {"private, max-age=60"}}, false, false, 0},
+		{"set-cookie", http.Header{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"a=b"}}, false, false, 0},
+		{"vary star", http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}, false, false, 0},
+		{"no freshness", http.Header{}, false, false, 0},
+		{"no-cache with validator", http.Header{"Cache-Control": {"no-cache"}, "Etag": {`"v1"`}}, false, true, 0},
+		{"authorized", http.Header{"Cache-Control": {"max-age=60"}}, true, false, 0},
+		{"authorized public", http.Header{"Cache-Control": {"public, max-age=60"}}, true, true, time.Minute},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ttl, _, ok := cacheFreshness(cfg, http.StatusOK, tc.header, now, tc.authorized)
+			assert.Equal(t, tc.cacheable, ok)
+			if ok {
+				assert.InDelta(t, tc.ttl.Seconds(), ttl.Seconds(), 1)
+			}
+		})
+	}
+
+	ttl, _, ok := cacheFreshness(&RouteCacheConfig{DefaultTTL: 10, MaxTTL: 5}, http.StatusOK, http.Header{}, now, false)
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, ttl)
+	_, _, ok = cacheFreshness(cfg, http.StatusInternalServerError, http.Header{"Cache-Control": {"max-age=60"}}, now, false)
+	assert.False(t, ok)
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	var hits int32
+	g := newCacheTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	}, &RouteCacheConfig{Enabled: true})
+
+	assert.Equal(t, "de", cachedGet(g, "/", map[string]string{"Accept-Language": "de"}).Body.String())
+	assert.Equal(t, "en", cachedGet(g, "/", map[string]string{"Accept-Language": "en"}).Body.String())
+	assert.Equal(t, "de", cachedGet(g, "/", map[string]string{"Accept-Language": "de"}).Body.String())
+	assert.Equal(t, "en", cachedGet(g, "/", map[string]string{"Accept-Language": "en"}).Body.String())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestResponseCacheRevalidation(t *testing.T) {
+	var hits, notModified int32
+	g := newCacheTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("payload"))
+	}, &RouteCacheConfig{Enabled: true})
+
+	rec := cachedGet(g, "/doc", nil)
+	assert.Equal(t, "payload", rec.Body.String())
+
+	// expired: the gateway revalidates and upstream answers 304
+	rec = cachedGet(g, "/doc", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "payload", rec.Body.String())
+	assert.Equal(t, cacheStatusRevalidated, rec.Header().Get("X-Cache"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notModified))
+
+	// the client's own conditional request is passed through
+	rec = cachedGet(g, "/doc", map[string]string{"If-None-Match": `"v1"`})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+
+	assert.Equal(t, int64(1), g.GetStats().CacheStats.Revalidated)
+}
+
+func TestResponseCacheStaleWhileRevalidate(t *testing.T) {
+	var version int32 = 1
+	var hits int32
+	g := newCacheTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=30")
+		fmt.Fprintf(w, "v%d", atomic.LoadInt32(&version))
+	}, &RouteCacheConfig{Enabled: true})
+
+	assert.Equal(t, "v1", cachedGet(g, "/", nil).Body.String())
+	atomic.StoreInt32(&version, 2)
+	time.Sleep(1100 * time.Millisecond)
+
+	rec := cachedGet(g, "/", nil)
+	assert.Equal(t, "v1", rec.Body.String())
+	assert.Equal(t, cacheStatusStale, rec.Header().Get("X-Cache"))
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&hits) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		rec := cachedGet(g, "/", nil)
+		return rec.Body.String() == "v2" && rec.Header().Get("X-Cache") == cacheStatusHit
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestResponseCacheEvictionAndPurge(t *testing.T) {
+	g := newCacheTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(strings.Repeat("x", 1000)))
+	}, &RouteCacheConfig{Enabled: true})
+	g.config.CacheMaxBytes = 5000
+
+	for i := 0; i < 10; i++ {
+		cachedGet(g, fmt.Sprintf("/a/%d", i), nil)
+	}
+	stats := g.GetStats().CacheStats
+	assert.LessOrEqual(t, stats.SizeBytes, int64(5000))
+	assert.Less(t, stats.Entries, 10)
+	// the most recent entries survive
+	assert.Equal(t, cacheStatusHit, cachedGet(g, "/a/9", nil).Header().Get("X-Cache"))
+	assert.Equal(t, cacheStatusMiss, cachedGet(g, "/a/0", nil).Header().Get("X-Cache"))
+
+	cachedGet(g, "/b/1", nil)
+	assert.Equal(t, 1, g.PurgeCache("", "/b/", ""))
+	assert.Equal(t, 1, g.PurgeCache("", "", "r1|GET|example.com|/a/9|"))
+	assert.Equal(t, cacheStatusMiss, cachedGet(g, "/a/9", nil).Header().Get("X-Cache"))
+	assert.Positive(t, g.PurgeCache("r1", "", ""))
+	assert.Zero(t, g.GetStats().CacheStats.Entries)
+}
+
+func TestResponseCacheSeparatesConsumers(t *testing.T) {
+	var hits int32
+	g := newCacheTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		cc := "max-age=60"
+		if r.URL.Path == "/catalog" {
+			cc = "public, max-age=60"
+		}
+		w.Header().Set("Cache-Control", cc)
+		fmt.Fprintf(w, "%s for %s #%d", r.URL.Path, r.Header.Get("X-Consumer"), n)
+	}, &RouteCacheConfig{Enabled: true, DefaultTTL: 60})
+	route := g.routes[0]
+	route.AuthRequired = true
+	route.AuthType = "api_key"
+	route.Transform = &RouteTransform{RequestHeaders: &HeaderTransform{Add: map[string]string{"X-Consumer": "${consumer}"}}}
+
+	keys := map[string]string{}
+	for _, name := range []string{"alice", "bob"} {
+		require.NoError(t, g.AddConsumer(Consumer{ID: name, Name: name, Enabled: true}))
+		key, _, err := g.CreateConsumerAPIKey(name)
+		require.NoError(t, err)
+		keys[name] = key
+	}
+
+	// private responses of one consumer are never served to another
+	assert.Equal(t, "/orders for alice #1", cachedGet(g, "/orders", map[string]string{"X-API-Key": keys["alice"]}).Body.String())
+	assert.Equal(t, "/orders for bob #2", cachedGet(g, "/orders", map[string]string{"X-API-Key": keys["bob"]}).Body.String())
+	assert.Equal(t, "/orders for alice #3", cachedGet(g, "/orders", map[string]string{"X-API-Key": keys["alice"]}).Body.String())
+
+	// responses upstream marks public are shared
+	assert.Equal(t, "/catalog for alice #4", cachedGet(g, "/catalog", map[string]string{"X-API-Key": keys["alice"]}).Body.String())
+	rec := cachedGet(g, "/catalog", map[string]string{"X-API-Key": keys["bob"]})
+	assert.Equal(t, "/catalog for alice #4", rec.Body.String())
+	assert.Equal(t, cacheStatusHit, rec.Header().Get("X-Cache"))
+}
+
+func TestUpdateConfigPurgesChangedRoutes(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+
+	g := NewGateway(t.TempDir())
+	cfg := g.GetConfigCopy()
+	cfg.HTTPPort = 80
+	cfg.Services = []Service{{ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true}}
+	cfg.Routes = []Route{
+		{ID: "a", ServiceID: "backend", Paths: []string{"/a/*"}, Cache: &RouteCacheConfig{Enabled: true}, Enabled: true},
+		{ID: "b", ServiceID: "backend", Paths: []string{"/b/*"}, Cache: &RouteCacheConfig{Enabled: true}, Enabled: true},
+	}
+	require.NoError(t, g.UpdateConfig(cfg))
+	cachedGet(g, "/a/1", nil)
+	cachedGet(g, "/b/1", nil)
+
+	cfg = g.GetConfigCopy()
+	cfg.Routes[1].Cache.DefaultTTL = 30
+	require.NoError(t, g.UpdateConfig(cfg))
+	assert.Equal(t, cacheStatusHit, cachedGet(g, "/a/1", nil).Header().Get("X-Cache"), "unchanged routes keep their entries")
+	assert.Equal(t, cacheStatusMiss, cachedGet(g, "/b/1", nil).Header().Get("X-Cache"))
+
+	cfg = g.GetConfigCopy()
+	cfg.Routes = cfg.Routes[1:]
+	require.NoError(t, g.UpdateConfig(cfg))
+	assert.Zero(t, g.PurgeCache("a", "", ""), "entries of removed routes are dropped")
+}
@@ -0,0 +1,397 @@
+package api_gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	certSourceDefault     = "default"
+	certSourceUpload      = "upload"
+	certSourceDirectory   = "directory"
+	certSourceLetsEncrypt = "letsencrypt"
+
+	// certWatchInterval is how often certificate files and the watched directory are checked for changes.
+	certWatchInterval = 30 * time.Second
+)
+
+// certFileSource is a cert/key file pair that feeds the certificate store
+type certFileSource struct {
+	id       string
+	source   string
+	certFile string
+	keyFile  string
+}
+
+// certEntry is a loaded certificate in the store
+type certEntry struct {
+	certFileSource
+	cert *tls.Certificate
+	leaf *x509.Certificate
+}
+
+// certStore holds the HTTPS certificates indexed by hostname
+type certStore struct {
+	mu          sync.RWMutex
+	exact       map[string]*certEntry
+	wildcard    map[string]*certEntry // keyed by the parent domain of "*.<domain>"
+	entries     []*certEntry
+	fallback    *certEntry
+	fingerprint string
+}
+
+// certDir returns the directory holding gateway-managed certificates of a source
+func (g *Gateway) certDir(source string) string {
+	return filepath.Join(g.workDir, "data", "certs", source)
+}
+
+// certificateSources lists every cert/key pair that should be in the store.
+func (g *Gateway) certificateSources() []certFileSource {
+	g.mu.RLock()
+	var sources []certFileSource
+	var watchDir string
+	if g.config != nil {
+		if g.config.TLSCertFile != "" && g.config.TLSKeyFile != "" {
+			sources = append(sources, certFileSource{id: certSourceDefault, source: certSourceDefault, certFile: g.config.TLSCertFile, keyFile: g.config.TLSKeyFile})
+		}
+		for _, c := range g.config.Certificates {
+			sources = append(sources, certFileSource{id: c.ID, source: certSourceUpload, certFile: c.CertFile, keyFile: c.KeyFile})
+		}
+		watchDir = g.config.CertificateDir
+	}
+	g.mu.RUnlock()
+
+	sources = append(sources, scanCertificateDir(g.certDir(certSourceLetsEncrypt), certSourceLetsEncrypt)...)
+	if watchDir != "" {
+		sources = append(sources, scanCertificateDir(watchDir, certSourceDirectory)...)
+	}
+	return sources
+}
+
+// scanCertificateDir finds "<name>.crt|.pem|.cer" files with a matching "<name>.key".
+func scanCertificateDir(dir, source string) []certFileSource {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var sources []certFileSource
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(f.Name())
+		if ext != ".crt" && ext != ".pem" && ext != ".cer" {
+			continue
+		}
+		name := strings.TrimSuffix(f.Name(), ext)
+		keyFile := filepath.Join(dir, name+".key")
+		if _, err := os.Stat(keyFile); err != nil {
+			continue
+		}
+		sources = append(sources, certFileSource{id: name, source: source, certFile: filepath.Join(dir, f.Name()), keyFile: keyFile})
+	}
+	return sources
+}
+
+// sourcesFingerprint identifies the current state of all certificate files
+func sourcesFingerprint(sources []certFileSource) string {
+	var b strings.Builder
+	for _, s := range sources {
+		for _, path := range []string{s.certFile, s.keyFile} {
+			b.WriteString(path)
+			if fi, err := os.Stat(path); err == nil {
+				fmt.Fprintf(&b, ":%d:%d", fi.Size(), fi.ModTime().UnixNano())
+			}
+			b.WriteByte('|')
+		}
+	}
+	return b.String()
+}
+
+// reloadCertificates rebuilds the store when any certificate file changed (or always when force is set).
+func (g *Gateway) reloadCertificates(force bool) {
+	sources := g.certificateSources()
+	fingerprint := sourcesFingerprint(sources)
+
+	g.certs.mu.RLock()
+	unchanged := g.certs.exact != nil && g.certs.fingerprint == fingerprint
+	g.certs.mu.RUnlock()
+	if unchanged && !force {
+		return
+	}
+
+	entries := make([]*certEntry, 0, len(sources))
+	for _, s := range sources {
+		cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+		if err != nil {
+			log.Printf("API Gateway: TLS certificate load failed (cert=%s): %v", s.certFile, err)
+			continue
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			log.Printf("API Gateway: TLS certificate parse failed (cert=%s): %v", s.certFile, err)
+			continue
+		}
+		cert.Leaf = leaf
+		entries = append(entries, &certEntry{certFileSource: s, cert: &cert, leaf: leaf})
+	}
+	g.certs.replace(entries, fingerprint)
+}
+
+// replace swaps in a new set of certificates
+func (s *certStore) replace(entries []*certEntry, fingerprint string) {
+	exact := make(map[string]*certEntry)
+	wildcard := make(map[string]*certEntry)
+	var fallback *certEntry
+	now := time.Now()
+	for _, e := range entries {
+		for _, name := range certNames(e.leaf) {
+			if strings.HasPrefix(name, "*.") {
+				parent := name[2:]
+				wildcard[parent] = preferredCert(wildcard[parent], e, now)
+			} else {
+				exact[name] = preferredCert(exact[name], e, now)
+			}
+		}
+		if e.source == certSourceDefault {
+			fallback = e
+		}
+	}
+	if fallback == nil && len(entries) > 0 {
+		fallback = entries[0]
+	}
+
+	s.mu.Lock()
+	s.exact = exact
+	s.wildcard = wildcard
+	s.entries = entries
+	s.fallback = fallback
+	s.fingerprint = fingerprint
+	s.mu.Unlock()
+}
+
+// certNames returns the lowercased DNS names of a certificate (SANs, or CN without SANs)
+func certNames(leaf *x509.Certificate) []string {
+	names := leaf.DNSNames
+	if len(names) == 0 && leaf.Subject.CommonName != "" {
+		names = []string{leaf.Subject.CommonName}
+	}
+	out := make([]string, 0, len(names))
+	for _, n := range names {
+		out = append(out, strings.ToLower(strings.TrimSuffix(n, ".")))
+	}
+	return out
+}
+
+// preferredCert picks between two certificates for the same name: currently valid first, then the later expiry.
+func preferredCert(current, candidate *certEntry, now time.Time) *certEntry {
+	if current == nil {
+		return candidate
+	}
+	currentValid := now.Before(current.leaf.NotAfter) && now.After(current.leaf.NotBefore)
+	candidateValid := now.Before(candidate.leaf.NotAfter) && now.After(candidate.leaf.NotBefore)
+	if currentValid != candidateValid {
+		if candidateValid {
+			return candidate
+		}
+		return current
+	}
+	if candidate.leaf.NotAfter.After(current.leaf.NotAfter) {
+		return candidate
+	}
+	return current
+}
+
+// lookup returns the certificate for a server name: exact match, then one-level wildcard, then the fallback.
+func (s *certStore) lookup(serverName string) *certEntry {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if name != "" {
+		if e, ok := s.exact[name]; ok {
+			return e
+		}
+		if i := strings.IndexByte(name, '.'); i > 0 {
+			if e, ok := s.wildcard[name[i+1:]]; ok {
+				return e
+			}
+		}
+	}
+	return s.fallback
+}
+
+// getCertificate is the tls.Config.GetCertificate callback of the HTTPS listener
+func (g *Gateway) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	e := g.certs.lookup(hello.ServerName)
+	if e == nil {
+		return nil, fmt.Errorf("no TLS certificate for %q", hello.ServerName)
+	}
+	return e.cert, nil
+}
+
+// watchCertificates reloads the store when certificate files change
+func (g *Gateway) watchCertificates(stopChan chan struct{}) {
+	ticker := time.NewTicker(certWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+			g.reloadCertificates(false)
+		}
+	}
+}
+
+// httpsConfigured reports whether HTTPS is enabled and any certificate source is configured
+func (g *Gateway) httpsConfigured() bool {
+	if !g.config.HTTPSEnabled {
+		return false
+	}
+	if g.config.TLSCertFile != "" && g.config.TLSKeyFile != "" {
+		return true
+	}
+	if len(g.config.Certificates) > 0 || g.config.CertificateDir != "" {
+		return true
+	}
+	return g.config.LetsEncrypt != nil && g.config.LetsEncrypt.Enabled && g.config.LetsEncrypt.PerDomain
+}
+
+// ListCertificates returns every certificate in the store with its expiry
+func (g *Gateway) ListCertificates() []CertificateInfo {
+	g.reloadCertificates(false)
+
+	g.certs.mu.RLock()
+	defer g.certs.mu.RUnlock()
+	now := time.Now()
+	list := make([]CertificateInfo, 0, len(g.certs.entries))
+	for _, e := range g.certs.entries {
+		list = append(list, CertificateInfo{
+			ID:        e.id,
+			Source:    e.source,
+			CertFile:  e.certFile,
+			KeyFile:   e.keyFile,
+			Subject:   e.leaf.Subject.CommonName,
+			Issuer:    e.leaf.Issuer.CommonName,
+			DNSNames:  certNames(e.leaf),
+			NotBefore: e.leaf.NotBefore,
+			NotAfter:  e.leaf.NotAfter,
+			Valid:     now.Before(e.leaf.NotAfter) && now.After(e.leaf.NotBefore),
+			Default:   e == g.certs.fallback,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].NotAfter.Before(list[j].NotAfter)
+	})
+	return list
+}
+
+// AddCertificate stores an uploaded PEM certificate chain and key and adds it to the store
+func (g *Gateway) AddCertificate(name string, certPEM, keyPEM []byte) (*TLSCertificate, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate or key: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+
+	id := uuid.New().String()
+	dir := g.certDir(certSourceUpload)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	entry := TLSCertificate{
+		ID:        id,
+		Name:      name,
+		CertFile:  filepath.Join(dir, id+".crt"),
+		KeyFile:   filepath.Join(dir, id+".key"),
+		DNSNames:  certNames(leaf),
+		NotAfter:  leaf.NotAfter.Format(time.RFC3339),
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	if entry.Name == "" && len(entry.DNSNames) > 0 {
+		entry.Name = entry.DNSNames[0]
+	}
+	if err := os.WriteFile(entry.CertFile, certPEM, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(entry.KeyFile, keyPEM, 0600); err != nil {
+		os.Remove(entry.CertFile)
+		return nil, err
+	}
+
+	g.mu.Lock()
+	g.config.Certificates = append(g.config.Certificates, entry)
+	err = g.saveConfigLocked()
+	g.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	g.reloadCertificates(true)
+	return &entry, nil
+}
+
+// DeleteCertificate removes an uploaded certificate
+func (g *Gateway) DeleteCertificate(id string) error {
+	g.mu.Lock()
+	var removed *TLSCertificate
+	for i, c := range g.config.Certificates {
+		if c.ID == id {
+			removed = &c
+			g.config.Certificates = append(g.config.Certificates[:i], g.config.Certificates[i+1:]...)
+			break
+		}
+	}
+	if removed == nil {
+		g.mu.Unlock()
+		return fmt.Errorf("certificate with ID %s not found", id)
+	}
+	err := g.saveConfigLocked()
+	g.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Only remove files the gateway wrote itself
+	uploadDir := g.certDir(certSourceUpload)
+	for _, path := range []string{removed.CertFile, removed.KeyFile} {
+		if filepath.Dir(path) == uploadDir {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("API Gateway: failed to remove %s: %v", path, err)
+			}
+		}
+	}
+	g.reloadCertificates(true)
+	return nil
+}
+
+// certificateExpiry reads the NotAfter of the first certificate in a PEM file
+func certificateExpiry(certPath string) (time.Time, error) {
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("no PEM data in %s", certPath)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
@@ -0,0 +1,94 @@
+package api_gateway
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertStoreSNISelection(t *testing.T) {
+	tmpDir := t.TempDir()
+	watchDir := filepath.Join(tmpDir, "watched")
+	require.NoError(t, generateSelfSignedCert([]string{"default.local"}, filepath.Join(tmpDir, "tls.crt"), filepath.Join(tmpDir, "tls.key")))
+	require.NoError(t, generateSelfSignedCert([]string{"api.example.com"}, filepath.Join(watchDir, "api.crt"), filepath.Join(watchDir, "api.key")))
+	require.NoError(t, generateSelfSignedCert([]string{"*.example.com"}, filepath.Join(watchDir, "wild.crt"), filepath.Join(watchDir, "wild.key")))
+
+	g := &Gateway{
+		workDir: tmpDir,
+		config: &GatewayConfig{
+			HTTPSEnabled:   true,
+			TLSCertFile:    filepath.Join(tmpDir, "tls.crt"),
+			TLSKeyFile:     filepath.Join(tmpDir, "tls.key"),
+			CertificateDir: watchDir,
+		},
+	}
+	g.reloadCertificates(false)
+
+	tests := map[string]string{
+		"api.example.com":   "api.example.com",
+		"API.Example.com.":  "api.example.com",
+		"www.example.com":   "*.example.com",
+		"a.b.example.com":   "default.local",
+		"":                  "default.local",
+		"other.example.org": "default.local",
+	}
+	for serverName, expected := range tests {
+		cert, err := g.getCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		require.NoError(t, err, serverName)
+		assert.Equal(t, expected, cert.Leaf.DNSNames[0], serverName)
+	}
+
+	// new files in the watched directory are picked up on reload
+	require.NoError(t, generateSelfSignedCert([]string{"new.example.org"}, filepath.Join(watchDir, "new.pem"), filepath.Join(watchDir, "new.key")))
+	g.reloadCertificates(false)
+	cert, err := g.getCertificate(&tls.ClientHelloInfo{ServerName: "new.example.org"})
+	require.NoError(t, err)
+	assert.Equal(t, "new.example.org", cert.Leaf.DNSNames[0])
+
+	list := g.ListCertificates()
+	require.Len(t, list, 4)
+	for _, info := range list {
+		assert.True(t, info.Valid)
+		assert.WithinDuration(t, time.Now().AddDate(0, 0, 90), info.NotAfter, time.Minute)
+		assert.Equal(t, info.Source == certSourceDefault, info.Default)
+	}
+}
+
+func TestCertStoreUploadAndDelete(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(tmpDir+"/data", 0755)
+	g := &Gateway{workDir: tmpDir, config: &GatewayConfig{}}
+
+	_, err := g.getCertificate(&tls.ClientHelloInfo{ServerName: "shop.example.com"})
+	assert.Error(t, err)
+
+	srcDir := t.TempDir()
+	require.NoError(t, generateSelfSignedCert([]string{"shop.example.com"}, filepath.Join(srcDir, "c.crt"), filepath.Join(srcDir, "c.key")))
+	certPEM, err := os.ReadFile(filepath.Join(srcDir, "c.crt"))
+	require.NoError(t, err)
+	keyPEM, err := os.ReadFile(filepath.Join(srcDir, "c.key"))
+	require.NoError(t, err)
+
+	_, err = g.AddCertificate("bad", certPEM, []byte("not a key"))
+	assert.Error(t, err)
+
+	uploaded, err := g.AddCertificate("", certPEM, keyPEM)
+	require.NoError(t, err)
+	assert.Equal(t, "shop.example.com", uploaded.Name)
+	assert.Len(t, g.config.Certificates, 1)
+
+	cert, err := g.getCertificate(&tls.ClientHelloInfo{ServerName: "shop.example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "shop.example.com", cert.Leaf.DNSNames[0])
+
+	require.NoError(t, g.DeleteCertificate(uploaded.ID))
+	assert.NoFileExists(t, uploaded.KeyFile)
+	_, err = g.getCertificate(&tls.ClientHelloInfo{ServerName: "shop.example.com"})
+	assert.Error(t, err)
+	assert.Error(t, g.DeleteCertificate(uploaded.ID))
+}
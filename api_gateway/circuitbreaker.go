@@ -0,0 +1,345 @@
+package api_gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+
+	defaultCircuitConsecutiveFailures = 5
+	defaultCircuitMinRequests         = 20
+	defaultCircuitWindow              = 10 * time.Second
+	defaultCircuitEjection            = 30 * time.Second
+	defaultCircuitMaxEjection         = 5 * time.Minute
+	defaultCircuitHalfOpenRequests    = 1
+)
+
+// circuitSettings is the resolved CircuitBreakerConfig of a service
+type circuitSettings struct {
+	consecutiveFailures int
+	errorRatePercent    int
+	minRequests         int64
+	window              time.Duration
+	ejection            time.Duration
+	maxEjection         time.Duration
+	halfOpenRequests    int
+}
+
+// newCircuitSettings resolves the breaker settings of a service; nil means breakers are disabled
+func newCircuitSettings(cfg *CircuitBreakerConfig) *circuitSettings {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	s := &circuitSettings{
+		consecutiveFailures: defaultCircuitConsecutiveFailures,
+		errorRatePercent:    cfg.ErrorRatePercent,
+		minRequests:         defaultCircuitMinRequests,
+		window:              defaultCircuitWindow,
+		ejection:            defaultCircuitEjection,
+		maxEjection:         defaultCircuitMaxEjection,
+		halfOpenRequests:    defaultCircuitHalfOpenRequests,
+	}
+	if cfg.ConsecutiveFailures > 0 {
+		s.consecutiveFailures = cfg.ConsecutiveFailures
+	}
+	if cfg.MinRequests > 0 {
+		s.minRequests = int64(cfg.MinRequests)
+	}
+	if cfg.WindowSeconds > 0 {
+		s.window = time.Duration(cfg.WindowSeconds) * time.Second
+	}
+	if cfg.EjectionSeconds > 0 {
+		s.ejection = time.Duration(cfg.EjectionSeconds) * time.Second
+	}
+	if cfg.MaxEjectionSeconds > 0 {
+		s.maxEjection = time.Duration(cfg.MaxEjectionSeconds) * time.Second
+	}
+	if s.maxEjection < s.ejection {
+		s.maxEjection = s.ejection
+	}
+	if cfg.HalfOpenRequests > 0 {
+		s.halfOpenRequests = cfg.HalfOpenRequests
+	}
+	return s
+}
+
+// circuitBucket counts live results for one second of the error rate window
+type circuitBucket struct {
+	second   int64
+	requests int64
+	failures int64
+}
+
+// circuitBreaker tracks live results of a single upstream target
+type circuitBreaker struct {
+	mu          sync.Mutex
+	settings    *circuitSettings
+	state       string
+	consecutive int
+	buckets     []circuitBucket
+	ejections   int
+	openUntil   time.Time
+	closedAt    time.Time
+	probes      int // probes in flight while half-open
+	probesOK    int // successful probes while half-open
+}
+
+func newCircuitBreaker(settings *circuitSettings) *circuitBreaker {
+	seconds := int(settings.window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return &circuitBreaker{
+		settings: settings,
+		state:    circuitClosed,
+		buckets:  make([]circuitBucket, seconds),
+	}
+}
+
+// currentStateLocked moves an open breaker to half-open once its ejection time has passed
+func (b *circuitBreaker) currentStateLocked(now time.Time) string {
+	if b.state == circuitOpen && !now.Before(b.openUntil) {
+		b.state = circuitHalfOpen
+		b.probes = 0
+		b.probesOK = 0
+	}
+	return b.state
+}
+
+// allow reports whether the target may be picked for a request
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.currentStateLocked(now) {
+	case circuitClosed:
+		return true
+	case circuitHalfOpen:
+		return b.probes < b.settings.halfOpenRequests-b.probesOK
+	default:
+		return false
+	}
+}
+
+// reserve is allow for the target picked for a request: while half-open it also takes a probe
+// slot, reported by probe, which the request gives back through record or abandon
+func (b *circuitBreaker) reserve(now time.Time) (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.currentStateLocked(now) {
+	case circuitClosed:
+		return true, false
+	case circuitHalfOpen:
+		if b.probes >= b.settings.halfOpenRequests-b.probesOK {
+			return false, false
+		}
+		b.probes++
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+// abandon releases the probe slot of a request that ended without an upstream result
+func (b *circuitBreaker) abandon() {
+	b.mu.Lock()
+	if b.state == circuitHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+	b.mu.Unlock()
+}
+
+// record applies the result of a live request to the breaker; probe tells whether the request
+// holds a probe slot
+func (b *circuitBreaker) record(now time.Time, failed, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentStateLocked(now) {
+	case circuitHalfOpen:
+		if !probe {
+			// Requests started before the breaker opened
+			return
+		}
+		if b.probes > 0 {
+			b.probes--
+		}
+		if failed {
+			b.tripLocked(now)
+			return
+		}
+		b.probesOK++
+		if b.probesOK >= b.settings.halfOpenRequests {
+			b.state = circuitClosed
+			b.closedAt = now
+			b.consecutive = 0
+			for i := range b.buckets {
+				b.buckets[i] = circuitBucket{}
+			}
+		}
+		return
+	case circuitOpen:
+		// Requests started before the breaker opened
+		return
+	}
+
+	bucket := b.bucketLocked(now)
+	bucket.requests++
+	if !failed {
+		b.consecutive = 0
+		return
+	}
+	bucket.failures++
+	b.consecutive++
+	if b.consecutive >= b.settings.consecutiveFailures {
+		b.tripLocked(now)
+		return
+	}
+	if b.settings.errorRatePercent > 0 {
+		requests, failures := b.windowLocked(now)
+		if requests >= b.settings.minRequests && failures*100 >= requests*int64(b.settings.errorRatePercent) {
+			b.tripLocked(now)
+		}
+	}
+}
+
+// tripLocked opens the breaker; the ejection time doubles with each ejection that follows
+// shortly after the previous one and is capped at maxEjection.
+func (b *circuitBreaker) tripLocked(now time.Time) {
+	if b.state == circuitClosed && !b.closedAt.IsZero() && now.Sub(b.closedAt) > b.settings.maxEjection {
+		b.ejections = 0
+	}
+	b.ejections++
+	ejection := b.settings.ejection
+	for i := 1; i < b.ejections && ejection < b.settings.maxEjection; i++ {
+		ejection *= 2
+	}
+	ejection = min(ejection, b.settings.maxEjection)
+
+	b.state = circuitOpen
+	b.openUntil = now.Add(ejection)
+	b.consecutive = 0
+	b.probes = 0
+	b.probesOK = 0
+}
+
+func (b *circuitBreaker) bucketLocked(now time.Time) *circuitBucket {
+	sec := now.Unix()
+	bucket := &b.buckets[sec%int64(len(b.buckets))]
+	if bucket.second != sec {
+		*bucket = circuitBucket{second: sec}
+	}
+	return bucket
+}
+
+func (b *circuitBreaker) windowLocked(now time.Time) (requests, failures int64) {
+	oldest := now.Unix() - int64(len(b.buckets))
+	for _, bucket := range b.buckets {
+		if bucket.second > oldest {
+			requests += bucket.requests
+			failures += bucket.failures
+		}
+	}
+	return requests, failures
+}
+
+func (b *circuitBreaker) status(address string, now time.Time) TargetCircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := TargetCircuitStatus{
+		Address:             address,
+		State:               b.currentStateLocked(now),
+		ConsecutiveFailures: b.consecutive,
+		Ejections:           b.ejections,
+	}
+	st.Requests, st.Failures = b.windowLocked(now)
+	if st.State == circuitOpen {
+		st.OpenUntil = b.openUntil
+	}
+	return st
+}
+
+// breakerAllows reports whether the breaker of the target at address lets requests through
+func (lb *loadBalancer) breakerAllows(address string, now time.Time) bool {
+	t := lb.byAddress[address]
+	if t == nil || t.breaker == nil {
+		return true
+	}
+	return t.breaker.allow(now)
+}
+
+// circuitStatus summarizes the breakers of all targets; nil when breakers are disabled
+func (lb *loadBalancer) circuitStatus(now time.Time) *CircuitStatus {
+	if lb.circuit == nil {
+		return nil
+	}
+	status := &CircuitStatus{State: circuitOpen, Targets: make([]TargetCircuitStatus, 0, len(lb.targets))}
+	halfOpen := false
+	for _, t := range lb.targets {
+		st := t.breaker.status(t.address, now)
+		status.Targets = append(status.Targets, st)
+		switch st.State {
+		case circuitClosed:
+			status.State = circuitClosed
+		case circuitHalfOpen:
+			halfOpen = true
+		}
+	}
+	if status.State != circuitClosed && halfOpen {
+		status.State = circuitHalfOpen
+	}
+	return status
+}
+
+// circuitProbeKey marks upstream requests that hold a probe slot of their target's breaker
+type circuitProbeKey struct{}
+
+// withCircuitProbe records whether the upstream request holds a probe slot of its target's breaker
+func withCircuitProbe(ctx context.Context, probe bool) context.Context {
+	return context.WithValue(ctx, circuitProbeKey{}, probe)
+}
+
+// circuitTransport feeds the result of every upstream attempt into the target's breaker
+type circuitTransport struct {
+	base http.RoundTripper
+	lb   *loadBalancer
+}
+
+func (t *circuitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := t.lb.byAddress[req.URL.Host]
+	if target == nil || target.breaker == nil {
+		return t.base.RoundTrip(req)
+	}
+	probe, _ := req.Context().Value(circuitProbeKey{}).(bool)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil && errors.Is(err, context.Canceled) {
+		// The client went away; this says nothing about the upstream
+		if probe {
+			target.breaker.abandon()
+		}
+		return resp, err
+	}
+	target.breaker.record(time.Now(), err != nil || resp.StatusCode >= http.StatusInternalServerError, probe)
+	return resp, err
+}
+
+// circuitOpen reports whether every target of the service is ejected by its breaker
+func (g *Gateway) circuitOpen(service *Service) bool {
+	lb := g.balancerFor(service)
+	if lb.circuit == nil {
+		return false
+	}
+	now := time.Now()
+	for _, t := range lb.targets {
+		if t.breaker.allow(now) {
+			return false
+		}
+	}
+	return len(lb.targets) > 0
+}
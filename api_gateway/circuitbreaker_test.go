@@ -0,0 +1,245 @@
+package api_gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	settings := newCircuitSettings(&CircuitBreakerConfig{Enabled: true, ConsecutiveFailures: 3, EjectionSeconds: 10, MaxEjectionSeconds: 30})
+	require.NotNil(t, settings)
+	b := newCircuitBreaker(settings)
+	now := time.Unix(1700000000, 0)
+
+	// consecutive failures open the breaker; a success in between resets the count
+	b.record(now, true, false)
+	b.record(now, true, false)
+	b.record(now, false, false)
+	b.record(now, true, false)
+	b.record(now, true, false)
+	assert.True(t, b.allow(now))
+	b.record(now, true, false)
+	assert.False(t, b.allow(now))
+	assert.Equal(t, circuitOpen, b.status("t", now).State)
+
+	// after the ejection time one probe is let through
+	now = now.Add(10 * time.Second)
+	assert.True(t, b.allow(now))
+	ok, probe := b.reserve(now)
+	assert.True(t, ok && probe)
+	assert.False(t, b.allow(now))
+	ok, _ = b.reserve(now)
+	assert.False(t, ok)
+
+	// results of requests that aren't probes don't count
+	b.record(now, false, false)
+	assert.Equal(t, circuitHalfOpen, b.status("t", now).State)
+
+	// a failed probe re-opens the breaker for twice as long
+	b.record(now, true, true)
+	assert.False(t, b.allow(now.Add(19*time.Second)))
+	now = now.Add(20 * time.Second)
+	require.True(t, b.allow(now))
+	_, probe = b.reserve(now)
+	b.record(now, false, probe)
+	assert.Equal(t, circuitClosed, b.status("t", now).State)
+	assert.Equal(t, 2, b.status("t", now).Ejections)
+
+	assert.Nil(t, newCircuitSettings(&CircuitBreakerConfig{}))
+}
+
+func TestCircuitBreakerErrorRate(t *testing.T) {
+	b := newCircuitBreaker(newCircuitSettings(&CircuitBreakerConfig{
+		Enabled:             true,
+		ConsecutiveFailures: 100,
+		ErrorRatePercent:    50,
+		MinRequests:         10,
+	}))
+	now := time.Unix(1700000000, 0)
+	for i := 0; i < 8; i++ {
+		b.record(now, i%2 == 0, false)
+	}
+	// 4 of 8 failed, but the window has too few requests yet
+	assert.True(t, b.allow(now))
+	b.record(now, false, false)
+	b.record(now, true, false)
+	assert.False(t, b.allow(now))
+
+	// old results fall out of the window
+	b = newCircuitBreaker(b.settings)
+	for i := 0; i < 9; i++ {
+		b.record(now, true, false)
+	}
+	assert.Equal(t, int64(9), b.status("t", now).Failures)
+	now = now.Add(defaultCircuitWindow)
+	assert.Zero(t, b.status("t", now).Requests)
+	b.record(now, true, false)
+	assert.True(t, b.allow(now))
+}
+
+func TestHandleRequestCircuitBreaker(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+
+	service := &Service{
+		ID:             "svc",
+		Host:           hostParts[0],
+		Port:           mustParseInt(hostParts[1]),
+		CircuitBreaker: &CircuitBreakerConfig{Enabled: true, ConsecutiveFailures: 2, EjectionSeconds: 1},
+		Enabled:        true,
+	}
+	g := newProxyTestGateway(service)
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	}
+
+	// open: the backend is no longer called
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+
+	health := g.GetServiceHealth()
+	require.Len(t, health, 1)
+	require.NotNil(t, health[0].Circuit)
+	assert.Equal(t, circuitOpen, health[0].Circuit.State)
+	assert.False(t, health[0].Healthy)
+
+	// half-open probe succeeds and closes the breaker
+	failing.Store(false)
+	time.Sleep(1100 * time.Millisecond)
+	rec = httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, circuitClosed, g.GetServiceHealth()[0].Circuit.State)
+}
+
+func TestCircuitBreakerHalfOpenProbeLimit(t *testing.T) {
+	release := make(chan struct{})
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+	}))
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+
+	service := &Service{
+		ID:             "svc",
+		Host:           hostParts[0],
+		Port:           mustParseInt(hostParts[1]),
+		CircuitBreaker: &CircuitBreakerConfig{Enabled: true, ConsecutiveFailures: 1, EjectionSeconds: 1},
+		Enabled:        true,
+	}
+	g := newProxyTestGateway(service)
+	breaker := g.balancerFor(service).targets[0].breaker
+	breaker.record(time.Now().Add(-time.Second), true, false)
+
+	// concurrent requests to the half-open target: one probes, the others fail fast
+	codes := make(chan int, 10)
+	for i := 0; i < cap(codes); i++ {
+		go func() {
+			rec := httptest.NewRecorder()
+			g.handleRequest(rec, httptest.NewRequest("GET", "/", nil))
+			codes <- rec.Code
+		}()
+	}
+	for i := 0; i < cap(codes)-1; i++ {
+		assert.Equal(t, http.StatusServiceUnavailable, <-codes)
+	}
+	close(release)
+	assert.Equal(t, http.StatusOK, <-codes)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	assert.Equal(t, circuitClosed, breaker.status("t", time.Now()).State)
+}
+
+func TestCircuitBreakerEjectsSingleTarget(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer bad.Close()
+	var goodHits int32
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&goodHits, 1)
+	}))
+	defer good.Close()
+
+	service := &Service{
+		ID:             "svc",
+		Targets:        []ServiceTarget{targetOf(t, bad.Listener.Addr().String()), targetOf(t, good.Listener.Addr().String())},
+		CircuitBreaker: &CircuitBreakerConfig{Enabled: true, ConsecutiveFailures: 1, EjectionSeconds: 60},
+		Enabled:        true,
+	}
+	g := newProxyTestGateway(service)
+	for i := 0; i < 10; i++ {
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, httptest.NewRequest("GET", "/", nil))
+	}
+	// at most one request reached the bad target before it was ejected
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&goodHits), int32(9))
+	status := g.GetServiceHealth()[0].Circuit
+	assert.Equal(t, circuitClosed, status.State)
+	states := map[string]string{}
+	for _, st := range status.Targets {
+		states[st.Address] = st.State
+	}
+	assert.Equal(t, circuitOpen, states[bad.Listener.Addr().String()])
+	assert.Equal(t, circuitClosed, states[good.Listener.Addr().String()])
+}
+
+func TestCircuitBreakerSurvivesConfigChanges(t *testing.T) {
+	g := NewGateway(t.TempDir())
+	require.NoError(t, g.AddService(Service{
+		ID:             "svc",
+		Targets:        []ServiceTarget{{Host: "10.0.0.1", Port: 80}, {Host: "10.0.0.2", Port: 80}},
+		CircuitBreaker: &CircuitBreakerConfig{Enabled: true, ConsecutiveFailures: 1, EjectionSeconds: 60},
+		Enabled:        true,
+	}))
+	service := func() *Service {
+		g.mu.RLock()
+		defer g.mu.RUnlock()
+		return g.services["svc"]
+	}
+	states := func() map[string]string {
+		states := map[string]string{}
+		for _, st := range g.balancerFor(service()).circuitStatus(time.Now()).Targets {
+			states[st.Address] = st.State
+		}
+		return states
+	}
+	g.balancerFor(service()).byAddress["10.0.0.1:80"].breaker.record(time.Now(), true, false)
+
+	// unrelated changes keep the breakers
+	config := g.GetConfigCopy()
+	config.Routes = append(config.Routes, Route{ID: "api", ServiceID: "svc", Paths: []string{"/"}, Enabled: true})
+	require.NoError(t, g.UpdateConfig(config))
+	assert.Equal(t, circuitOpen, states()["10.0.0.1:80"])
+
+	// a new target gets a breaker, the others keep theirs
+	config = g.GetConfigCopy()
+	config.Services[0].Targets = append(config.Services[0].Targets, ServiceTarget{Host: "10.0.0.3", Port: 80})
+	require.NoError(t, g.UpdateConfig(config))
+	assert.Equal(t, map[string]string{"10.0.0.1:80": circuitOpen, "10.0.0.2:80": circuitClosed, "10.0.0.3:80": circuitClosed}, states())
+
+	// other breaker settings start over
+	config.Services[0].CircuitBreaker = &CircuitBreakerConfig{Enabled: true, ConsecutiveFailures: 1, EjectionSeconds: 30}
+	require.NoError(t, g.UpdateService(config.Services[0]))
+	assert.Equal(t, circuitClosed, states()["10.0.0.1:80"])
+}
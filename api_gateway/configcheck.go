@@ -0,0 +1,235 @@
+package api_gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ValidateConfig dry-runs a configuration: it reports what saving it would reject, references
+// to missing services, ports used twice and routes that can never match, together with the
+// changes against the current configuration. Nothing is saved.
+func (g *Gateway) ValidateConfig(config *GatewayConfig) *ConfigValidation {
+	result := &ConfigValidation{Changes: []ConfigChange{}}
+	g.mu.RLock()
+	config = g.withDiscoveredLocked(config)
+	g.mu.RUnlock()
+	result.Errors, result.Warnings = checkConfig(config)
+	result.Valid = len(result.Errors) == 0
+
+	g.mu.RLock()
+	current, err := json.Marshal(g.config)
+	g.mu.RUnlock()
+	proposed, err2 := json.Marshal(config)
+	if err == nil && err2 == nil {
+		from, err := revisionJSON(current)
+		to, err2 := revisionJSON(proposed)
+		if err == nil && err2 == nil {
+			if changes, err := diffConfigJSON(from, to); err == nil {
+				result.Changes = changes
+			}
+		}
+	}
+	return result
+}
+
+// checkConfig returns the errors and warnings of a configuration
+func checkConfig(config *GatewayConfig) (errs, warnings []string) {
+	for _, validate := range []func(*GatewayConfig) error{
+		func(c *GatewayConfig) error { return validateWAFConfig(c.WAF) },
+		validateAccessPolicies,
+		validateClientAddressConfig,
+		func(c *GatewayConfig) error { return validateClientSecurityConfig(c.ClientSecurity) },
+		func(c *GatewayConfig) error { return validateTracingConfig(c.Observability) },
+	} {
+		if err := validate(config); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for i := range config.Routes {
+		route := &config.Routes[i]
+		if err := validateRouteTransform(route); err != nil {
+			errs = append(errs, fmt.Sprintf("route %s: %v", route.ID, err))
+		}
+		if err := validateRouteWAF(route); err != nil {
+			errs = append(errs, fmt.Sprintf("route %s: %v", route.ID, err))
+		}
+		if err := validateRouteAction(route); err != nil {
+			errs = append(errs, fmt.Sprintf("route %s: %v", route.ID, err))
+		}
+		if err := validateForwardAuth(route); err != nil {
+			errs = append(errs, fmt.Sprintf("route %s: %v", route.ID, err))
+		}
+		if err := validateRouteOIDC(route); err != nil {
+			errs = append(errs, fmt.Sprintf("route %s: %v", route.ID, err))
+		}
+	}
+
+	e, w := checkServiceReferences(config)
+	errs, warnings = append(errs, e...), append(warnings, w...)
+	errs = append(errs, checkPorts(config)...)
+	e, w = checkRouteOverlaps(config.Routes)
+	errs, warnings = append(errs, e...), append(warnings, w...)
+	return errs, warnings
+}
+
+// checkServiceReferences reports duplicate IDs and references to missing or disabled services
+func checkServiceReferences(config *GatewayConfig) (errs, warnings []string) {
+	duplicates := func(kind string, ids []string) {
+		seen := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			if id == "" {
+				errs = append(errs, fmt.Sprintf("%s without an ID", kind))
+			} else if seen[id] {
+				errs = append(errs, fmt.Sprintf("%s with ID %s already exists", kind, id))
+			}
+			seen[id] = true
+		}
+	}
+	ids := func(n int, id func(int) string) []string {
+		list := make([]string, n)
+		for i := range list {
+			list[i] = id(i)
+		}
+		return list
+	}
+	duplicates("service", ids(len(config.Services), func(i int) string { return config.Services[i].ID }))
+	duplicates("route", ids(len(config.Routes), func(i int) string { return config.Routes[i].ID }))
+	duplicates("UDP route", ids(len(config.UDPRoutes), func(i int) string { return config.UDPRoutes[i].ID }))
+	duplicates("TCP route", ids(len(config.TCPRoutes), func(i int) string { return config.TCPRoutes[i].ID }))
+	duplicates("consumer", ids(len(config.Consumers), func(i int) string { return config.Consumers[i].ID }))
+
+	services := make(map[string]*Service, len(config.Services))
+	for i := range config.Services {
+		services[config.Services[i].ID] = &config.Services[i]
+	}
+	check := func(owner, serviceID string, enabled bool) {
+		svc, ok := services[serviceID]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Sprintf("%s: service with ID %s not found", owner, serviceID))
+		case enabled && !svc.Enabled:
+			warnings = append(warnings, fmt.Sprintf("%s: service %s is disabled", owner, serviceID))
+		}
+	}
+	for _, r := range config.Routes {
+		owner := "route " + r.ID
+		switch {
+		case r.Split != nil && len(r.Split.Backends) > 0:
+			for _, b := range r.Split.Backends {
+				check(owner, b.ServiceID, r.Enabled)
+			}
+		case r.Action != nil && r.ServiceID == "":
+			// answered by the gateway without a service
+		default:
+			check(owner, r.ServiceID, r.Enabled)
+		}
+		if r.Mirror != nil {
+			check(owner+" mirror", r.Mirror.ServiceID, false)
+		}
+	}
+	for _, r := range config.UDPRoutes {
+		check("UDP route "+r.ID, r.ServiceID, r.Enabled)
+	}
+	for _, r := range config.TCPRoutes {
+		check("TCP route "+r.ID, r.ServiceID, r.Enabled)
+	}
+	return errs, warnings
+}
+
+// checkPorts reports listen ports that are out of range or used by more than one listener.
+// TCP and UDP ports are separate, so a UDP route may share its number with a TCP listener.
+func checkPorts(config *GatewayConfig) []string {
+	var errs []string
+	owners := make(map[string]string)
+	claim := func(network string, port int, owner string) {
+		if port < 1 || port > 65535 {
+			errs = append(errs, fmt.Sprintf("%s: invalid port %d", owner, port))
+			return
+		}
+		key := fmt.Sprintf("%s/%d", network, port)
+		if previous, ok := owners[key]; ok {
+			errs = append(errs, fmt.Sprintf("%s: %s port %d is already used by %s", owner, strings.ToUpper(network), port, previous))
+			return
+		}
+		owners[key] = owner
+	}
+	claim("tcp", config.HTTPPort, "HTTP listener")
+	if config.HTTPSEnabled {
+		claim("tcp", config.HTTPSPort, "HTTPS listener")
+	}
+	for _, r := range config.TCPRoutes {
+		if r.Enabled {
+			claim("tcp", r.ListenPort, "TCP route "+r.ID)
+		}
+	}
+	for _, r := range config.UDPRoutes {
+		if r.Enabled {
+			claim("udp", r.ListenPort, "UDP route "+r.ID)
+		}
+	}
+	return errs
+}
+
+// checkRouteOverlaps compares enabled routes that share a path. Two routes with the same
+// priority and the same hosts, methods and headers are ambiguous; a route whose match is
+// fully covered by a higher-priority one is unreachable for that path.
+func checkRouteOverlaps(routes []Route) (errs, warnings []string) {
+	for i := range routes {
+		a := &routes[i]
+		if !a.Enabled {
+			continue
+		}
+		for j := i + 1; j < len(routes); j++ {
+			b := &routes[j]
+			if !b.Enabled {
+				continue
+			}
+			for _, path := range a.Paths {
+				if !slices.Contains(b.Paths, path) {
+					continue
+				}
+				aCovers, bCovers := routeCovers(a, b), routeCovers(b, a)
+				switch {
+				case a.Priority == b.Priority && aCovers && bCovers:
+					errs = append(errs, fmt.Sprintf("routes %s and %s both match path %s with the same priority", a.ID, b.ID, path))
+				case a.Priority > b.Priority && aCovers:
+					warnings = append(warnings, fmt.Sprintf("route %s is shadowed by route %s on path %s", b.ID, a.ID, path))
+				case b.Priority > a.Priority && bCovers:
+					warnings = append(warnings, fmt.Sprintf("route %s is shadowed by route %s on path %s", a.ID, b.ID, path))
+				}
+			}
+		}
+	}
+	return errs, warnings
+}
+
+// routeCovers reports whether every request matching b's hosts, methods and headers also matches a's
+func routeCovers(a, b *Route) bool {
+	if !coversList(a.Hosts, b.Hosts) || !coversList(a.Methods, b.Methods) {
+		return false
+	}
+	for key, value := range a.Headers {
+		if bv, ok := b.Headers[key]; !ok || bv != value {
+			return false
+		}
+	}
+	return true
+}
+
+// coversList reports whether the match list a (empty = anything) includes every entry of b
+func coversList(a, b []string) bool {
+	if len(a) == 0 {
+		return true
+	}
+	if len(b) == 0 {
+		return false
+	}
+	for _, v := range b {
+		if !slices.ContainsFunc(a, func(x string) bool { return strings.EqualFold(x, v) }) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,351 @@
+package api_gateway
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultAPIKeyHeader = "X-API-Key"
+	apiKeyPrefixLength  = 8
+	// basicAuthCacheTTL bounds how long a successful bcrypt comparison is reused,
+	// so busy routes do not pay the bcrypt cost on every request.
+	basicAuthCacheTTL = 5 * time.Minute
+)
+
+// dummyPasswordHash is compared against for unknown usernames, so the response time does not
+// tell which usernames exist
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a consumer password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// consumerIndex is a lookup structure built from GatewayConfig.Consumers
+type consumerIndex struct {
+	byUsername map[string]*Consumer
+	byKeyHash  map[string]*Consumer
+	verified   map[string]time.Time // sha256(username, password, hash) -> expiry
+}
+
+func newConsumerIndex(consumers []Consumer) *consumerIndex {
+	idx := &consumerIndex{
+		byUsername: make(map[string]*Consumer),
+		byKeyHash:  make(map[string]*Consumer),
+		verified:   make(map[string]time.Time),
+	}
+	for i := range consumers {
+		// Copy so requests never read config entries that are being replaced
+		entry := consumers[i]
+		c := &entry
+		if !c.Enabled {
+			continue
+		}
+		if c.BasicAuth != nil && c.BasicAuth.Username != "" {
+			idx.byUsername[c.BasicAuth.Username] = c
+		}
+		for _, k := range c.APIKeys {
+			if k.KeyHash != "" {
+				idx.byKeyHash[k.KeyHash] = c
+			}
+		}
+	}
+	return idx
+}
+
+// refreshConsumers rebuilds the consumer index (must be called with g.mu held)
+func (g *Gateway) refreshConsumers() {
+	var consumers []Consumer
+	if g.config != nil {
+		consumers = g.config.Consumers
+	}
+	idx := newConsumerIndex(consumers)
+	g.consumersMu.Lock()
+	g.consumers = idx
+	g.consumersMu.Unlock()
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyBasicCredentials returns the consumer owning the username if the password matches.
+func (g *Gateway) verifyBasicCredentials(username, password string) *Consumer {
+	g.consumersMu.RLock()
+	idx := g.consumers
+	var consumer *Consumer
+	if idx != nil {
+		consumer = idx.byUsername[username]
+	}
+	g.consumersMu.RUnlock()
+	if consumer == nil || consumer.BasicAuth == nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil
+	}
+
+	cacheKey := hashAPIKey(username + "\x00" + password + "\x00" + consumer.BasicAuth.PasswordHash)
+	now := time.Now()
+	g.consumersMu.RLock()
+	expires, ok := idx.verified[cacheKey]
+	g.consumersMu.RUnlock()
+	if ok && now.Before(expires) {
+		return consumer
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(consumer.BasicAuth.PasswordHash), []byte(password)) != nil {
+		return nil
+	}
+	g.consumersMu.Lock()
+	for k, exp := range idx.verified {
+		if now.After(exp) {
+			delete(idx.verified, k)
+		}
+	}
+	idx.verified[cacheKey] = now.Add(basicAuthCacheTTL)
+	g.consumersMu.Unlock()
+	return consumer
+}
+
+// lookupAPIKey returns the consumer owning the given plain API key.
+func (g *Gateway) lookupAPIKey(key string) *Consumer {
+	if key == "" {
+		return nil
+	}
+	g.consumersMu.RLock()
+	defer g.consumersMu.RUnlock()
+	if g.consumers == nil {
+		return nil
+	}
+	return g.consumers.byKeyHash[hashAPIKey(key)]
+}
+
+// consumerAllowed reports whether the route accepts the consumer by name or group.
+func consumerAllowed(route *Route, consumer *Consumer) bool {
+	if len(route.Consumers) == 0 && len(route.ConsumerGroups) == 0 {
+		return true
+	}
+	for _, name := range route.Consumers {
+		if name == consumer.Name {
+			return true
+		}
+	}
+	for _, group := range route.ConsumerGroups {
+		for _, g := range consumer.Groups {
+			if g == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkConsumerAuth authenticates basic or api_key routes against the consumer registry.
+func (g *Gateway) checkConsumerAuth(r *http.Request, route *Route) (*authResult, error) {
+	var consumer *Consumer
+	switch route.AuthType {
+	case "basic":
+		username, password, ok := r.BasicAuth()
+		if !ok || username == "" || password == "" {
+			return nil, &authError{scheme: "Basic", reason: "missing basic credentials"}
+		}
+		if consumer = g.verifyBasicCredentials(username, password); consumer == nil {
+			return nil, &authError{scheme: "Basic", reason: "invalid credentials"}
+		}
+	case "api_key":
+		header := route.APIKeyHeader
+		if header == "" {
+			header = defaultAPIKeyHeader
+		}
+		key := r.Header.Get(header)
+		if key == "" {
+			return nil, &authError{reason: "missing API key"}
+		}
+		if consumer = g.lookupAPIKey(key); consumer == nil {
+			return nil, &authError{reason: "invalid API key"}
+		}
+	}
+	if !consumerAllowed(route, consumer) {
+		return nil, &authError{status: http.StatusForbidden, reason: fmt.Sprintf("consumer %s is not allowed on this route", consumer.Name)}
+	}
+	return &authResult{consumer: consumer.Name}, nil
+}
+
+// ListConsumers returns all consumers from the current config without their password and API
+// key hashes.
+func (g *Gateway) ListConsumers() []Consumer {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.config == nil || len(g.config.Consumers) == 0 {
+		return nil
+	}
+	out := make([]Consumer, len(g.config.Consumers))
+	for i, c := range g.config.Consumers {
+		if c.BasicAuth != nil {
+			c.BasicAuth = &ConsumerBasicAuth{Username: c.BasicAuth.Username}
+		}
+		c.APIKeys = slices.Clone(c.APIKeys)
+		for j := range c.APIKeys {
+			c.APIKeys[j].KeyHash = ""
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// HashConsumerPassword returns the bcrypt hash stored in ConsumerBasicAuth.PasswordHash.
+func HashConsumerPassword(password string) (string, error) {
+	if password == "" {
+		return "", fmt.Errorf("password is required")
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hashed), nil
+}
+
+func (g *Gateway) validateConsumerLocked(consumer Consumer) error {
+	if strings.TrimSpace(consumer.Name) == "" {
+		return fmt.Errorf("consumer name is required")
+	}
+	for _, c := range g.config.Consumers {
+		if c.ID == consumer.ID {
+			continue
+		}
+		if c.Name == consumer.Name {
+			return fmt.Errorf("consumer with name %s already exists", consumer.Name)
+		}
+		if consumer.BasicAuth != nil && c.BasicAuth != nil && c.BasicAuth.Username == consumer.BasicAuth.Username {
+			return fmt.Errorf("basic auth username %s is already used by consumer %s", consumer.BasicAuth.Username, c.Name)
+		}
+	}
+	return nil
+}
+
+// AddConsumer adds a new consumer to the gateway
+func (g *Gateway) AddConsumer(consumer Consumer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, c := range g.config.Consumers {
+		if c.ID == consumer.ID {
+			return fmt.Errorf("consumer with ID %s already exists", consumer.ID)
+		}
+	}
+	if err := g.validateConsumerLocked(consumer); err != nil {
+		return err
+	}
+
+	g.config.Consumers = append(g.config.Consumers, consumer)
+	g.refreshConsumers()
+	return g.saveConfigLocked()
+}
+
+// UpdateConsumer updates an existing consumer. API keys are kept as stored; an empty
+// password hash keeps the current basic auth password.
+func (g *Gateway) UpdateConsumer(consumer Consumer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i, c := range g.config.Consumers {
+		if c.ID != consumer.ID {
+			continue
+		}
+		if err := g.validateConsumerLocked(consumer); err != nil {
+			return err
+		}
+		consumer.APIKeys = c.APIKeys
+		if consumer.BasicAuth != nil && consumer.BasicAuth.PasswordHash == "" && c.BasicAuth != nil {
+			consumer.BasicAuth.PasswordHash = c.BasicAuth.PasswordHash
+		}
+		g.config.Consumers[i] = consumer
+		g.refreshConsumers()
+		return g.saveConfigLocked()
+	}
+
+	return fmt.Errorf("consumer with ID %s not found", consumer.ID)
+}
+
+// DeleteConsumer removes a consumer from the gateway
+func (g *Gateway) DeleteConsumer(consumerID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i, c := range g.config.Consumers {
+		if c.ID == consumerID {
+			g.config.Consumers = append(g.config.Consumers[:i], g.config.Consumers[i+1:]...)
+			g.refreshConsumers()
+			return g.saveConfigLocked()
+		}
+	}
+
+	return fmt.Errorf("consumer with ID %s not found", consumerID)
+}
+
+// CreateConsumerAPIKey generates a new API key for a consumer and returns the plain key.
+// Only the hash is stored, so the key cannot be shown again.
+func (g *Gateway) CreateConsumerAPIKey(consumerID string) (string, *ConsumerAPIKey, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	key := "rdk_" + base64.RawURLEncoding.EncodeToString(raw)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i := range g.config.Consumers {
+		c := &g.config.Consumers[i]
+		if c.ID != consumerID {
+			continue
+		}
+		entry := ConsumerAPIKey{
+			ID:        uuid.New().String(),
+			Prefix:    key[:len("rdk_")+apiKeyPrefixLength],
+			KeyHash:   hashAPIKey(key),
+			CreatedAt: time.Now().Format(time.RFC3339),
+		}
+		c.APIKeys = append(c.APIKeys, entry)
+		g.refreshConsumers()
+		if err := g.saveConfigLocked(); err != nil {
+			return "", nil, err
+		}
+		return key, &entry, nil
+	}
+
+	return "", nil, fmt.Errorf("consumer with ID %s not found", consumerID)
+}
+
+// DeleteConsumerAPIKey revokes an API key of a consumer
+func (g *Gateway) DeleteConsumerAPIKey(consumerID, keyID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i := range g.config.Consumers {
+		c := &g.config.Consumers[i]
+		if c.ID != consumerID {
+			continue
+		}
+		for j, k := range c.APIKeys {
+			if k.ID == keyID {
+				c.APIKeys = append(c.APIKeys[:j], c.APIKeys[j+1:]...)
+				g.refreshConsumers()
+				return g.saveConfigLocked()
+			}
+		}
+		return fmt.Errorf("API key with ID %s not found", keyID)
+	}
+
+	return fmt.Errorf("consumer with ID %s not found", consumerID)
+}
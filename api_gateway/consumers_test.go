@@ -0,0 +1,161 @@
+package api_gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newConsumerTestGateway(t *testing.T) *Gateway {
+	t.Helper()
+	tmpDir := t.TempDir()
+	os.MkdirAll(tmpDir+"/data", 0755)
+	return &Gateway{
+		services:      make(map[string]*Service),
+		serviceHealth: make(map[string]*ServiceHealth),
+		config:        &GatewayConfig{},
+		workDir:       tmpDir,
+		stats:         &gatewayStatsTracker{startTime: time.Now(), serviceStats: make(map[string]*serviceStatsTracker)},
+	}
+}
+
+func TestConsumerBasicAuth(t *testing.T) {
+	g := newConsumerTestGateway(t)
+	hash, err := HashConsumerPassword("s3cret")
+	require.NoError(t, err)
+	require.NoError(t, g.AddConsumer(Consumer{
+		ID:        "c1",
+		Name:      "alice",
+		Groups:    []string{"admins"},
+		BasicAuth: &ConsumerBasicAuth{Username: "alice", PasswordHash: hash},
+		Enabled:   true,
+	}))
+
+	listed := g.ListConsumers()
+	require.Len(t, listed, 1)
+	assert.Equal(t, &ConsumerBasicAuth{Username: "alice"}, listed[0].BasicAuth, "the password hash is not listed")
+	assert.Equal(t, hash, g.config.Consumers[0].BasicAuth.PasswordHash)
+
+	route := &Route{AuthRequired: true, AuthType: "basic"}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("nobody", "s3cret")
+	_, err = g.checkAuth(req, route)
+	assert.Error(t, err)
+	req.SetBasicAuth("alice", "s3cret")
+	auth, err := g.checkAuth(req, route)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", auth.consumer)
+
+	// cached verification still rejects a different password
+	req.SetBasicAuth("alice", "wrong")
+	_, err = g.checkAuth(req, route)
+	assert.Error(t, err)
+
+	// password change invalidates the old password
+	newHash, err := HashConsumerPassword("changed")
+	require.NoError(t, err)
+	require.NoError(t, g.UpdateConsumer(Consumer{
+		ID:        "c1",
+		Name:      "alice",
+		BasicAuth: &ConsumerBasicAuth{Username: "alice", PasswordHash: newHash},
+		Enabled:   true,
+	}))
+	req.SetBasicAuth("alice", "s3cret")
+	_, err = g.checkAuth(req, route)
+	assert.Error(t, err)
+	req.SetBasicAuth("alice", "changed")
+	_, err = g.checkAuth(req, route)
+	assert.NoError(t, err)
+
+	// duplicate username is rejected
+	err = g.AddConsumer(Consumer{ID: "c2", Name: "bob", BasicAuth: &ConsumerBasicAuth{Username: "alice", PasswordHash: hash}, Enabled: true})
+	assert.Error(t, err)
+}
+
+func TestConsumerAPIKeys(t *testing.T) {
+	g := newConsumerTestGateway(t)
+	require.NoError(t, g.AddConsumer(Consumer{ID: "c1", Name: "svc", Enabled: true}))
+
+	key, entry, err := g.CreateConsumerAPIKey("c1")
+	require.NoError(t, err)
+	assert.NotContains(t, g.config.Consumers[0].APIKeys[0].KeyHash, key)
+	assert.True(t, len(entry.Prefix) < len(key))
+	listed := g.ListConsumers()
+	assert.Equal(t, entry.Prefix, listed[0].APIKeys[0].Prefix)
+	assert.Empty(t, listed[0].APIKeys[0].KeyHash, "key hashes are not listed")
+	assert.NotEmpty(t, g.config.Consumers[0].APIKeys[0].KeyHash)
+
+	route := &Route{AuthRequired: true, AuthType: "api_key", APIKeyHeader: "X-Token"}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Token", key)
+	auth, err := g.checkAuth(req, route)
+	require.NoError(t, err)
+	assert.Equal(t, "svc", auth.consumer)
+
+	req.Header.Set("X-Token", key+"x")
+	_, err = g.checkAuth(req, route)
+	assert.Error(t, err)
+
+	require.NoError(t, g.DeleteConsumerAPIKey("c1", entry.ID))
+	req.Header.Set("X-Token", key)
+	_, err = g.checkAuth(req, route)
+	assert.Error(t, err)
+
+	_, _, err = g.CreateConsumerAPIKey("missing")
+	assert.Error(t, err)
+}
+
+func TestHandleRequestConsumerRestriction(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+
+	g := newConsumerTestGateway(t)
+	g.services["backend"] = &Service{ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true}
+	g.routes = []*Route{{
+		ID:             "r1",
+		ServiceID:      "backend",
+		Paths:          []string{"/"},
+		AuthRequired:   true,
+		AuthType:       "api_key",
+		ConsumerGroups: []string{"partners"},
+		Enabled:        true,
+	}}
+	require.NoError(t, g.AddConsumer(Consumer{ID: "p", Name: "partner", Groups: []string{"partners"}, Enabled: true}))
+	require.NoError(t, g.AddConsumer(Consumer{ID: "o", Name: "other", Enabled: true}))
+	partnerKey, _, err := g.CreateConsumerAPIKey("p")
+	require.NoError(t, err)
+	otherKey, _, err := g.CreateConsumerAPIKey("o")
+	require.NoError(t, err)
+
+	tests := []struct {
+		key      string
+		expected int
+	}{
+		{"", http.StatusUnauthorized},
+		{otherKey, http.StatusForbidden},
+		{partnerKey, http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if test.key != "" {
+			req.Header.Set(defaultAPIKeyHeader, test.key)
+		}
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, req)
+		assert.Equal(t, test.expected, rec.Code)
+	}
+
+	// disabled consumers cannot authenticate
+	require.NoError(t, g.UpdateConsumer(Consumer{ID: "p", Name: "partner", Groups: []string{"partners"}, Enabled: false}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(defaultAPIKeyHeader, partnerKey)
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
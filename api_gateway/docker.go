@@ -0,0 +1,500 @@
+package api_gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+const (
+	providerDocker           = "docker"
+	defaultDockerLabelPrefix = "redock.gateway"
+	dockerSyncDelay          = 500 * time.Millisecond // events arriving together cause a single sync
+	dockerRetryDelay         = 5 * time.Second
+)
+
+var errDiscoveredEntry = errors.New("read-only entries are managed by their discovery provider")
+
+var dockerIDInvalidChars = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// dockerAPI is the part of the Docker client the discovery provider uses
+type dockerAPI interface {
+	ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error)
+	Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error)
+	Close() error
+}
+
+// newDockerAPI connects to endpoint, or to DOCKER_HOST and the Colima socket when it is empty
+func newDockerAPI(endpoint string) (dockerAPI, error) {
+	if endpoint == "" && os.Getenv("DOCKER_HOST") == "" {
+		socket := filepath.Join(os.Getenv("HOME"), ".colima/default/docker.sock")
+		if _, err := os.Stat(socket); err == nil {
+			endpoint = "unix://" + socket
+		}
+	}
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if endpoint != "" {
+		opts = append(opts, client.WithHost(endpoint))
+	}
+	return client.NewClientWithOpts(opts...)
+}
+
+// dockerDiscovery keeps the services and routes of labeled containers in the gateway config
+type dockerDiscovery struct {
+	g         *Gateway
+	cfg       DockerDiscoveryConfig
+	api       dockerAPI
+	cancel    context.CancelFunc
+	done      chan struct{}
+	conflicts string // entries last reported as conflicting with other entries
+}
+
+func startDockerDiscovery(g *Gateway, cfg DockerDiscoveryConfig, api dockerAPI) *dockerDiscovery {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &dockerDiscovery{g: g, cfg: cfg, api: api, cancel: cancel, done: make(chan struct{})}
+	go d.run(ctx)
+	return d
+}
+
+// close stops watching and waits until the provider is done
+func (d *dockerDiscovery) close() {
+	d.cancel()
+	<-d.done
+	d.api.Close()
+}
+
+// run watches the Docker API until the provider is closed. A broken event stream is opened
+// again after a delay, followed by a full sync since events may have been missed.
+func (d *dockerDiscovery) run(ctx context.Context) {
+	defer close(d.done)
+	for {
+		d.watch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(dockerRetryDelay):
+		}
+	}
+}
+
+func (d *dockerDiscovery) watch(ctx context.Context) {
+	// Subscribe before listing so that no change falls between the two
+	msgs, errs := d.api.Events(ctx, events.ListOptions{Filters: filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("type", string(events.NetworkEventType)),
+	)})
+	if err := d.sync(ctx); err != nil {
+		log.Printf("API Gateway: docker discovery: %v", err)
+		return
+	}
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-errs:
+			if ctx.Err() == nil {
+				log.Printf("API Gateway: docker discovery: event stream: %v", err)
+			}
+			return
+		case msg := <-msgs:
+			if dockerEventChangesRouting(msg) && pending == nil {
+				pending = time.After(dockerSyncDelay)
+			}
+		case <-pending:
+			pending = nil
+			if err := d.sync(ctx); err != nil {
+				log.Printf("API Gateway: docker discovery: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// dockerEventChangesRouting reports events that can add, remove or move a discovered upstream
+func dockerEventChangesRouting(msg events.Message) bool {
+	switch msg.Action {
+	case events.ActionStart, events.ActionDie, events.ActionDestroy, events.ActionPause, events.ActionUnPause,
+		events.ActionRename, events.ActionConnect, events.ActionDisconnect:
+		return true
+	}
+	return false
+}
+
+// sync lists the running containers and replaces the provider's entries in the gateway config
+func (d *dockerDiscovery) sync(ctx context.Context) error {
+	containers, err := d.api.ContainerList(ctx, container.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing containers: %w", err)
+	}
+	services, routes, problems := dockerEntries(containers, d.cfg)
+	for _, problem := range problems {
+		log.Printf("API Gateway: docker discovery: %s", problem)
+	}
+	conflicts := strings.Join(d.g.applyDiscovered(providerDocker, services, routes), ", ")
+	if conflicts != "" && conflicts != d.conflicts {
+		log.Printf("API Gateway: docker discovery: skipping %s, they conflict with other entries", conflicts)
+	}
+	d.conflicts = conflicts
+	return nil
+}
+
+// dockerGroup is a set of containers discovered as one service
+type dockerGroup struct {
+	name    string
+	labels  map[string]string // gateway labels of the first container, without the prefix
+	targets []ServiceTarget
+}
+
+// dockerEntries builds a service and a route for each group of labeled containers. Containers
+// are grouped by their service label or their compose service, so replicas become targets of
+// the same service. Containers with unusable labels are reported in problems and left out.
+func dockerEntries(containers []types.Container, cfg DockerDiscoveryConfig) (services []Service, routes []Route, problems []string) {
+	prefix := cfg.LabelPrefix
+	if prefix == "" {
+		prefix = defaultDockerLabelPrefix
+	}
+	prefix += "."
+
+	sorted := slices.Clone(containers)
+	sort.Slice(sorted, func(i, j int) bool { return dockerContainerName(sorted[i]) < dockerContainerName(sorted[j]) })
+	groups := make(map[string]*dockerGroup)
+	var order []string
+	for _, c := range sorted {
+		labels := make(map[string]string)
+		for key, value := range c.Labels {
+			if name, ok := strings.CutPrefix(key, prefix); ok {
+				labels[name] = value
+			}
+		}
+		if len(labels) == 0 || labels["enable"] == "false" || (c.State != "" && c.State != "running") {
+			continue
+		}
+		name := dockerContainerName(c)
+		target, err := dockerTarget(c, labels, cfg.Network)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("container %s: %v", name, err))
+			continue
+		}
+		groupName := labels["service"]
+		if groupName == "" {
+			groupName = name
+			if svc := c.Labels["com.docker.compose.service"]; svc != "" {
+				groupName = svc
+				if project := c.Labels["com.docker.compose.project"]; project != "" {
+					groupName = project + "-" + svc
+				}
+			}
+		}
+		group, ok := groups[groupName]
+		if !ok {
+			group = &dockerGroup{name: groupName, labels: labels}
+			groups[groupName] = group
+			order = append(order, groupName)
+		}
+		group.targets = append(group.targets, target)
+	}
+
+	sort.Strings(order)
+	for _, name := range order {
+		service, route, err := dockerGroupEntries(groups[name])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("service %s: %v", name, err))
+			continue
+		}
+		services = append(services, service)
+		routes = append(routes, route)
+	}
+	return services, routes, problems
+}
+
+func dockerContainerName(c types.Container) string {
+	if len(c.Names) > 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+	if len(c.ID) > 12 {
+		return c.ID[:12]
+	}
+	return c.ID
+}
+
+// dockerTarget resolves the address of a container: its IP on the configured network (by
+// default the compose project's network) and the labeled or only exposed port
+func dockerTarget(c types.Container, labels map[string]string, network string) (ServiceTarget, error) {
+	port := 0
+	if value := labels["port"]; value != "" {
+		p, err := strconv.Atoi(value)
+		if err != nil || p < 1 || p > 65535 {
+			return ServiceTarget{}, fmt.Errorf("invalid port label %q", value)
+		}
+		port = p
+	} else {
+		exposed := make(map[uint16]bool)
+		for _, p := range c.Ports {
+			if p.Type == "" || p.Type == "tcp" {
+				exposed[p.PrivatePort] = true
+			}
+		}
+		if len(exposed) != 1 {
+			return ServiceTarget{}, fmt.Errorf("no port label and %d exposed ports", len(exposed))
+		}
+		for p := range exposed {
+			port = int(p)
+		}
+	}
+
+	if labels["network"] != "" {
+		network = labels["network"]
+	}
+	var networks map[string]string // name -> IP
+	if c.NetworkSettings != nil {
+		networks = make(map[string]string, len(c.NetworkSettings.Networks))
+		for name, endpoint := range c.NetworkSettings.Networks {
+			if endpoint != nil && endpoint.IPAddress != "" {
+				networks[name] = endpoint.IPAddress
+			}
+		}
+	}
+	if network != "" {
+		ip, ok := networks[network]
+		if !ok {
+			return ServiceTarget{}, fmt.Errorf("no address on network %s", network)
+		}
+		return ServiceTarget{Host: ip, Port: port}, nil
+	}
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return ServiceTarget{}, fmt.Errorf("no network address")
+	}
+	sort.Strings(names)
+	chosen := names[0]
+	if project := c.Labels["com.docker.compose.project"]; project != "" {
+		if i := slices.IndexFunc(names, func(name string) bool { return strings.HasPrefix(name, project+"_") }); i >= 0 {
+			chosen = names[i]
+		}
+	}
+	return ServiceTarget{Host: networks[chosen], Port: port}, nil
+}
+
+// dockerGroupEntries builds the read-only service and route of a container group
+func dockerGroupEntries(group *dockerGroup) (Service, Route, error) {
+	labels := group.labels
+	id := "docker-" + strings.Trim(dockerIDInvalidChars.ReplaceAllString(strings.ToLower(group.name), "-"), "-")
+
+	protocol := labels["protocol"]
+	switch protocol {
+	case "":
+		protocol = "http"
+	case "http", "https", "h2c", "grpc", "grpcs":
+	default:
+		return Service{}, Route{}, fmt.Errorf("invalid protocol label %q", protocol)
+	}
+	paths := splitLabelList(labels["path"])
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+	for _, p := range paths {
+		if !strings.HasPrefix(p, "/") {
+			return Service{}, Route{}, fmt.Errorf("path %q must start with /", p)
+		}
+	}
+	stripPath := false
+	if value := labels["strip_path"]; value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return Service{}, Route{}, fmt.Errorf("invalid strip_path label %q", value)
+		}
+		stripPath = b
+	}
+	priority := 0
+	if value := labels["priority"]; value != "" {
+		p, err := strconv.Atoi(value)
+		if err != nil {
+			return Service{}, Route{}, fmt.Errorf("invalid priority label %q", value)
+		}
+		priority = p
+	}
+
+	// Replicas are listed in container name order, so the first one is stable
+	service := Service{
+		ID:       id,
+		Name:     group.name,
+		Host:     group.targets[0].Host,
+		Port:     group.targets[0].Port,
+		Protocol: protocol,
+		Provider: providerDocker,
+		ReadOnly: true,
+		Enabled:  true,
+	}
+	if len(group.targets) > 1 {
+		service.Targets = group.targets
+	}
+	route := Route{
+		ID:        id,
+		Name:      group.name,
+		ServiceID: id,
+		Paths:     paths,
+		Hosts:     splitLabelList(labels["host"]),
+		StripPath: stripPath,
+		Priority:  priority,
+		Provider:  providerDocker,
+		ReadOnly:  true,
+		Enabled:   true,
+	}
+	return service, route, nil
+}
+
+func splitLabelList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// withoutDiscovered returns a copy of config without the entries of discovery providers, as it
+// is saved: discovered entries are rebuilt by their provider after a restart
+func withoutDiscovered(config *GatewayConfig) *GatewayConfig {
+	c := *config
+	c.Services = slices.DeleteFunc(slices.Clone(config.Services), func(s Service) bool { return s.ReadOnly })
+	c.Routes = slices.DeleteFunc(slices.Clone(config.Routes), func(r Route) bool { return r.ReadOnly })
+	return &c
+}
+
+// replaceDiscovered returns a copy of config whose entries of provider are replaced by services
+// and routes. Discovered entries whose ID is taken by another entry, and routes matching the same
+// requests as another route at the same priority, are left out and returned: the config checks
+// would reject them, and with them every later save of the manual entries.
+func replaceDiscovered(config *GatewayConfig, provider string, services []Service, routes []Route) (*GatewayConfig, []string) {
+	c := *config
+	c.Services = slices.DeleteFunc(slices.Clone(config.Services), func(s Service) bool { return s.ReadOnly && s.Provider == provider })
+	c.Routes = slices.DeleteFunc(slices.Clone(config.Routes), func(r Route) bool { return r.ReadOnly && r.Provider == provider })
+
+	var conflicts []string
+	for _, s := range services {
+		if slices.ContainsFunc(c.Services, func(other Service) bool { return other.ID == s.ID }) {
+			conflicts = append(conflicts, "service "+s.ID)
+			continue
+		}
+		c.Services = append(c.Services, s)
+	}
+	for _, r := range routes {
+		if slices.ContainsFunc(c.Routes, func(other Route) bool { return other.ID == r.ID }) {
+			conflicts = append(conflicts, "route "+r.ID)
+			continue
+		}
+		if i := slices.IndexFunc(c.Routes, func(other Route) bool {
+			errs, _ := checkRouteOverlaps([]Route{other, r})
+			return len(errs) > 0
+		}); i >= 0 {
+			conflicts = append(conflicts, fmt.Sprintf("route %s (overlaps route %s)", r.ID, c.Routes[i].ID))
+			continue
+		}
+		c.Routes = append(c.Routes, r)
+	}
+	return &c, conflicts
+}
+
+// withDiscoveredLocked returns a copy of a config submitted through the API whose read-only
+// entries are replaced by the ones currently discovered (must be called with g.mu held)
+func (g *Gateway) withDiscoveredLocked(config *GatewayConfig) *GatewayConfig {
+	c := withoutDiscovered(config)
+	if g.config == nil {
+		return c
+	}
+	for _, s := range g.config.Services {
+		if s.ReadOnly && !slices.ContainsFunc(c.Services, func(other Service) bool { return other.ID == s.ID }) {
+			c.Services = append(c.Services, s)
+		}
+	}
+	for _, r := range g.config.Routes {
+		if r.ReadOnly && !slices.ContainsFunc(c.Routes, func(other Route) bool { return other.ID == r.ID }) {
+			c.Routes = append(c.Routes, r)
+		}
+	}
+	return c
+}
+
+// applyDiscovered publishes the entries a provider discovered in place of its previous ones and
+// returns those left out because they conflict with other entries. Nothing is saved.
+func (g *Gateway) applyDiscovered(provider string, services []Service, routes []Route) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	next, conflicts := replaceDiscovered(g.config, provider, services, routes)
+	servicesChanged := !reflect.DeepEqual(next.Services, g.config.Services)
+	routesChanged := !reflect.DeepEqual(next.Routes, g.config.Routes)
+	if !servicesChanged && !routesChanged {
+		return conflicts
+	}
+	previous := g.services
+	g.config = next
+	if servicesChanged {
+		g.publishServicesLocked()
+		g.refreshBalancers(previous)
+		g.refreshTransports(previous)
+		for id := range previous {
+			if _, ok := g.services[id]; !ok {
+				delete(g.serviceHealth, id)
+				g.dropRetryBudget(id)
+			}
+		}
+	}
+	if routesChanged {
+		g.refreshRoutes()
+	}
+	return conflicts
+}
+
+// reconcileDockerDiscovery starts, restarts or stops the Docker provider to match the config.
+// Turning discovery off removes the discovered entries.
+func (g *Gateway) reconcileDockerDiscovery() {
+	g.mu.RLock()
+	var cfg DockerDiscoveryConfig
+	if g.config.DockerDiscovery != nil {
+		cfg = *g.config.DockerDiscovery
+	}
+	g.mu.RUnlock()
+
+	g.dockerMu.Lock()
+	defer g.dockerMu.Unlock()
+	if d := g.docker; d != nil {
+		if cfg.Enabled && d.cfg == cfg {
+			return
+		}
+		d.close()
+		g.docker = nil
+	}
+	if !cfg.Enabled {
+		g.applyDiscovered(providerDocker, nil, nil)
+		return
+	}
+	api, err := newDockerAPI(cfg.Endpoint)
+	if err != nil {
+		log.Printf("API Gateway: docker discovery: %v", err)
+		return
+	}
+	g.docker = startDockerDiscovery(g, cfg, api)
+}
@@ -0,0 +1,237 @@
+package api_gateway
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDockerAPI serves a container list that tests change, and events they send
+type fakeDockerAPI struct {
+	mu         sync.Mutex
+	containers []types.Container
+	events     chan events.Message
+	closed     bool
+}
+
+func (f *fakeDockerAPI) ContainerList(context.Context, container.ListOptions) ([]types.Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.containers), nil
+}
+
+func (f *fakeDockerAPI) Events(context.Context, events.ListOptions) (<-chan events.Message, <-chan error) {
+	return f.events, make(chan error)
+}
+
+func (f *fakeDockerAPI) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+// composeContainer returns a running container of the compose project redock
+func composeContainer(name, service string, networks map[string]string, labels map[string]string) types.Container {
+	c := types.Container{
+		ID:              name + "-id",
+		Names:           []string{"/" + name},
+		State:           "running",
+		Labels:          map[string]string{"com.docker.compose.project": "redock", "com.docker.compose.service": service},
+		NetworkSettings: &types.SummaryNetworkSettings{Networks: map[string]*network.EndpointSettings{}},
+	}
+	for name, ip := range networks {
+		c.NetworkSettings.Networks[name] = &network.EndpointSettings{IPAddress: ip}
+	}
+	for key, value := range labels {
+		c.Labels[key] = value
+	}
+	return c
+}
+
+func TestDockerEntries(t *testing.T) {
+	apiLabels := map[string]string{
+		"redock.gateway.host":       "api.local",
+		"redock.gateway.port":       "8080",
+		"redock.gateway.path":       "/v1/*, /v2/*",
+		"redock.gateway.strip_path": "true",
+	}
+	mailpit := composeContainer("redock-mailpit-1", "mailpit", map[string]string{"bridge": "172.17.0.5", "redock_net": "10.0.0.9"}, map[string]string{"redock.gateway.host": "mail.local"})
+	mailpit.Ports = []types.Port{{PrivatePort: 8025, Type: "tcp"}, {PrivatePort: 8025, PublicPort: 8025, Type: "tcp"}}
+	containers := []types.Container{
+		composeContainer("redock-api-2", "api", map[string]string{"redock_net": "10.0.0.3"}, apiLabels),
+		composeContainer("redock-api-1", "api", map[string]string{"redock_net": "10.0.0.2"}, apiLabels),
+		mailpit,
+		composeContainer("redock-mysql-1", "mysql", map[string]string{"redock_net": "10.0.0.4"}, nil),
+		composeContainer("redock-web-1", "web", map[string]string{"redock_net": "10.0.0.5"}, map[string]string{"redock.gateway.enable": "false", "redock.gateway.port": "80"}),
+		composeContainer("redock-bad-1", "bad", map[string]string{"redock_net": "10.0.0.6"}, map[string]string{"redock.gateway.port": "http"}),
+		composeContainer("redock-elsewhere-1", "elsewhere", map[string]string{"redock_net": "10.0.0.7"}, map[string]string{"redock.gateway.port": "80", "redock.gateway.network": "frontend"}),
+	}
+
+	services, routes, problems := dockerEntries(containers, DockerDiscoveryConfig{})
+	assert.Equal(t, []string{
+		`container redock-bad-1: invalid port label "http"`,
+		"container redock-elsewhere-1: no address on network frontend",
+	}, problems)
+	require.Len(t, services, 2)
+	require.Len(t, routes, 2)
+
+	assert.Equal(t, Service{
+		ID: "docker-redock-api", Name: "redock-api", Host: "10.0.0.2", Port: 8080, Protocol: "http",
+		Targets:  []ServiceTarget{{Host: "10.0.0.2", Port: 8080}, {Host: "10.0.0.3", Port: 8080}},
+		Provider: "docker", ReadOnly: true, Enabled: true,
+	}, services[0])
+	assert.Equal(t, Route{
+		ID: "docker-redock-api", Name: "redock-api", ServiceID: "docker-redock-api",
+		Paths: []string{"/v1/*", "/v2/*"}, Hosts: []string{"api.local"}, StripPath: true,
+		Provider: "docker", ReadOnly: true, Enabled: true,
+	}, routes[0])
+
+	// the only exposed port and the address on the compose network are used
+	assert.Equal(t, "10.0.0.9", services[1].Host)
+	assert.Equal(t, 8025, services[1].Port)
+	assert.Nil(t, services[1].Targets)
+	assert.Equal(t, []string{"/"}, routes[1].Paths)
+
+	// a configured network wins over the compose network
+	services, _, _ = dockerEntries(containers[2:3], DockerDiscoveryConfig{Network: "bridge"})
+	assert.Equal(t, "172.17.0.5", services[0].Host)
+	// and so does another label prefix
+	services, _, _ = dockerEntries(containers, DockerDiscoveryConfig{LabelPrefix: "traefik"})
+	assert.Empty(t, services)
+}
+
+func TestDockerDiscovery(t *testing.T) {
+	g := NewGateway(t.TempDir())
+	require.NoError(t, g.AddService(Service{ID: "legacy", Host: "127.0.0.1", Port: 9000, Enabled: true}))
+	require.NoError(t, g.AddRoute(Route{ID: "legacy", ServiceID: "legacy", Paths: []string{"/"}, Hosts: []string{"legacy.local"}, Enabled: true}))
+
+	api := &fakeDockerAPI{events: make(chan events.Message)}
+	api.containers = []types.Container{
+		composeContainer("redock-api-1", "api", map[string]string{"redock_net": "10.0.0.2"}, map[string]string{"redock.gateway.host": "api.local", "redock.gateway.port": "8080"}),
+	}
+	cfg := DockerDiscoveryConfig{Enabled: true}
+	g.mu.Lock()
+	g.config.DockerDiscovery = &cfg
+	g.mu.Unlock()
+	g.dockerMu.Lock()
+	g.docker = startDockerDiscovery(g, cfg, api)
+	g.dockerMu.Unlock()
+
+	discovered := func(id string) *Service {
+		for _, s := range g.GetConfigCopy().Services {
+			if s.ID == id {
+				return &s
+			}
+		}
+		return nil
+	}
+	require.Eventually(t, func() bool { return discovered("docker-redock-api") != nil }, 2*time.Second, 10*time.Millisecond)
+	route, service, _, err := g.Validate("GET", "/users", "api.local", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "docker-redock-api", route.ID)
+	assert.Equal(t, "10.0.0.2", service.Host)
+
+	// discovered entries can't be changed through the API
+	assert.EqualError(t, g.UpdateRoute(Route{ID: "docker-redock-api", ServiceID: "legacy", Paths: []string{"/"}, Enabled: true}), "route docker-redock-api is managed by the docker provider and is read-only")
+	assert.EqualError(t, g.DeleteService("docker-redock-api"), "service docker-redock-api is managed by the docker provider and is read-only")
+	assert.ErrorIs(t, g.AddRoute(Route{ID: "copy", ServiceID: "legacy", Paths: []string{"/"}, ReadOnly: true, Provider: "docker"}), errDiscoveredEntry)
+
+	// saving a config keeps the discovered entries as they are but doesn't persist them
+	config := g.GetConfigCopy()
+	for i := range config.Routes {
+		config.Routes[i].Hosts = []string{"changed.local"}
+	}
+	require.NoError(t, g.UpdateConfig(config))
+	route, _, _, err = g.Validate("GET", "/", "api.local", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "docker-redock-api", route.ID)
+	latest := g.ListConfigRevisions()[0]
+	rev, err := g.GetConfigRevision(latest.Revision)
+	require.NoError(t, err)
+	require.Len(t, rev.Config.Routes, 1)
+	assert.Equal(t, "legacy", rev.Config.Routes[0].ID)
+
+	// container events trigger a sync: a second replica joins, a new container gets its entries
+	api.mu.Lock()
+	api.containers = append(api.containers,
+		composeContainer("redock-api-2", "api", map[string]string{"redock_net": "10.0.0.3"}, map[string]string{"redock.gateway.host": "api.local", "redock.gateway.port": "8080"}),
+		composeContainer("redock-grafana-1", "grafana", map[string]string{"redock_net": "10.0.0.4"}, map[string]string{"redock.gateway.host": "grafana.local", "redock.gateway.port": "3000"}),
+	)
+	api.mu.Unlock()
+	api.events <- events.Message{Type: events.ContainerEventType, Action: events.ActionStart}
+	require.Eventually(t, func() bool { return discovered("docker-redock-grafana") != nil }, 2*time.Second, 10*time.Millisecond)
+	assert.Len(t, discovered("docker-redock-api").Targets, 2)
+
+	api.mu.Lock()
+	api.containers = api.containers[2:]
+	api.mu.Unlock()
+	api.events <- events.Message{Type: events.ContainerEventType, Action: events.ActionDie}
+	require.Eventually(t, func() bool { return discovered("docker-redock-api") == nil }, 2*time.Second, 10*time.Millisecond)
+	_, _, _, err = g.Validate("GET", "/", "api.local", nil)
+	assert.Error(t, err)
+
+	// turning discovery off stops the provider and removes its entries
+	config = g.GetConfigCopy()
+	config.DockerDiscovery = nil
+	require.NoError(t, g.UpdateConfig(config))
+	assert.Nil(t, discovered("docker-redock-grafana"))
+	assert.NotNil(t, discovered("legacy"))
+	assert.True(t, api.closed)
+}
+
+func TestReplaceDiscoveredConflicts(t *testing.T) {
+	config := &GatewayConfig{
+		Services: []Service{{ID: "docker-app"}, {ID: "docker-old", Provider: "docker", ReadOnly: true}},
+		Routes:   []Route{{ID: "docker-old", Provider: "docker", ReadOnly: true}},
+	}
+	next, conflicts := replaceDiscovered(config, providerDocker,
+		[]Service{{ID: "docker-app", ReadOnly: true}, {ID: "docker-new", ReadOnly: true}}, []Route{{ID: "docker-new", ReadOnly: true}})
+	assert.Equal(t, []string{"service docker-app"}, conflicts)
+	assert.Equal(t, []Service{{ID: "docker-app"}, {ID: "docker-new", ReadOnly: true}}, next.Services)
+	assert.Equal(t, []Route{{ID: "docker-new", ReadOnly: true}}, next.Routes)
+	assert.Len(t, config.Services, 2, "the config itself is not modified")
+
+	// routes matching the same requests as a manual route at the same priority are left out
+	config = &GatewayConfig{Routes: []Route{{ID: "site", Paths: []string{"/"}, Enabled: true}}}
+	next, conflicts = replaceDiscovered(config, providerDocker, nil, []Route{
+		{ID: "docker-web", Paths: []string{"/"}, Enabled: true, ReadOnly: true},
+		{ID: "docker-api", Paths: []string{"/"}, Hosts: []string{"api.local"}, Enabled: true, ReadOnly: true},
+	})
+	assert.Equal(t, []string{"route docker-web (overlaps route site)"}, conflicts)
+	require.Len(t, next.Routes, 2)
+	assert.Equal(t, "docker-api", next.Routes[1].ID)
+	errs, _ := checkConfig(next)
+	assert.NotContains(t, strings.Join(errs, "; "), "same priority")
+}
+
+func TestDiscoveryChurnKeepsRouteState(t *testing.T) {
+	g := NewGateway(t.TempDir())
+	require.NoError(t, g.AddService(Service{ID: "web", Host: "127.0.0.1", Port: 9000, Enabled: true}))
+	site := Route{ID: "site", ServiceID: "web", Paths: []string{"/"}, AuthRequired: true, AuthType: "jwt", JWT: &JWTAuthConfig{Secret: "secret"}, Enabled: true}
+	require.NoError(t, g.AddRoute(site))
+	verifier := g.jwtVerifierFor(&site)
+
+	container := func(name string) ([]Service, []Route) {
+		id := "docker-" + name
+		return []Service{{ID: id, Host: "10.0.0.2", Port: 80, Enabled: true, Provider: providerDocker, ReadOnly: true}},
+			[]Route{{ID: id, ServiceID: id, Hosts: []string{name + ".local"}, Paths: []string{"/"}, Enabled: true, Provider: providerDocker, ReadOnly: true}}
+	}
+	services, routes := container("app")
+	assert.Empty(t, g.applyDiscovered(providerDocker, services, routes))
+	services, routes = container("blog")
+	assert.Empty(t, g.applyDiscovered(providerDocker, services, routes))
+	assert.Empty(t, g.applyDiscovered(providerDocker, nil, nil))
+
+	assert.Same(t, verifier, g.jwtVerifierFor(&site), "containers coming and going keep the state of other routes")
+}
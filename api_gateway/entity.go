@@ -24,3 +24,14 @@ type ApiGatewayBlockEntity struct {
 	BlockedUntil time.Time `json:"blocked_until"`
 	Reason       string    `json:"reason"`
 }
+
+// ApiGatewayConfigRevisionEntity konfigün kaydedilmiş bir sürümü (geçmiş, diff ve geri alma için).
+const tableApiGatewayConfigRevisions = "api_gateway_config_revisions"
+
+type ApiGatewayConfigRevisionEntity struct {
+	memory.BaseEntity
+	Revision   int    `json:"revision"`
+	Author     string `json:"author"`
+	Message    string `json:"message"`
+	ConfigJSON string `json:"config_json"`
+}
@@ -0,0 +1,232 @@
+package api_gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	defaultForwardAuthTimeout = 5 * time.Second
+	maxForwardAuthCacheTTL    = time.Hour
+	forwardAuthMaxBodyBytes   = 1 << 20
+	forwardAuthCacheLimit     = 10000
+)
+
+var defaultForwardAuthHeaders = []string{"Authorization", "Cookie"}
+
+// forwardAuthHopHeaders are not copied from an auth service answer to the client
+var forwardAuthHopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Upgrade", "Trailer", "Content-Length"}
+
+// validateForwardAuth checks the forward auth settings of a route before it is saved
+func validateForwardAuth(route *Route) error {
+	if route.AuthType != "forward" {
+		return nil
+	}
+	fa := route.ForwardAuth
+	if fa == nil || fa.URL == "" {
+		return fmt.Errorf("forward auth requires a url")
+	}
+	u, err := url.Parse(fa.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid forward auth url %q", fa.URL)
+	}
+	if fa.TimeoutMs < 0 {
+		return fmt.Errorf("forward auth timeout_ms must not be negative")
+	}
+	if fa.CacheTTL < 0 || time.Duration(fa.CacheTTL)*time.Second > maxForwardAuthCacheTTL {
+		return fmt.Errorf("forward auth cache_ttl must be between 0 and %d seconds", int(maxForwardAuthCacheTTL.Seconds()))
+	}
+	return nil
+}
+
+type forwardAuthEntry struct {
+	resp      *authResponse
+	expiresAt time.Time
+}
+
+// forwardAuthenticator asks a route's auth service and caches its decisions
+type forwardAuthenticator struct {
+	cfg     ForwardAuthConfig
+	client  *http.Client
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]forwardAuthEntry
+}
+
+func newForwardAuthenticator(cfg ForwardAuthConfig) *forwardAuthenticator {
+	timeout := defaultForwardAuthTimeout
+	if cfg.TimeoutMs > 0 {
+		timeout = time.Duration(cfg.TimeoutMs) * time.Millisecond
+	}
+	return &forwardAuthenticator{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: timeout,
+			// A redirect to a login page is an answer for the client, not for the gateway
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		ttl:     time.Duration(cfg.CacheTTL) * time.Second,
+		entries: make(map[string]forwardAuthEntry),
+	}
+}
+
+func (a *forwardAuthenticator) requestHeaders() []string {
+	if len(a.cfg.RequestHeaders) > 0 {
+		return a.cfg.RequestHeaders
+	}
+	return defaultForwardAuthHeaders
+}
+
+// check returns the auth service's answer for r, reusing a cached decision while it is fresh.
+// Answers with a 5xx status are never cached.
+func (a *forwardAuthenticator) check(r *http.Request) (*authResponse, error) {
+	if a.ttl <= 0 {
+		return a.ask(r)
+	}
+	key := a.cacheKey(r)
+	now := time.Now()
+	a.mu.Lock()
+	entry, ok := a.entries[key]
+	a.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.resp, nil
+	}
+
+	resp, err := a.ask(r)
+	if err != nil || resp.status >= http.StatusInternalServerError {
+		return resp, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.entries) >= forwardAuthCacheLimit {
+		for k, e := range a.entries {
+			if !now.Before(e.expiresAt) {
+				delete(a.entries, k)
+			}
+		}
+		if len(a.entries) >= forwardAuthCacheLimit {
+			clear(a.entries)
+		}
+	}
+	a.entries[key] = forwardAuthEntry{resp: resp, expiresAt: now.Add(a.ttl)}
+	return resp, nil
+}
+
+// cacheKey identifies the inputs of a decision: method, host, URI, client IP and the headers
+// sent to the auth service
+func (a *forwardAuthenticator) cacheKey(r *http.Request) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s", r.Method, r.Host, r.URL.RequestURI(), getClientIP(r))
+	for _, name := range a.requestHeaders() {
+		for _, value := range r.Header.Values(name) {
+			fmt.Fprintf(h, "\x00%s:%s", name, value)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ask sends the subrequest for r to the auth service
+func (a *forwardAuthenticator) ask(r *http.Request) (*authResponse, error) {
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, a.cfg.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range a.requestHeaders() {
+		for _, value := range r.Header.Values(name) {
+			req.Header.Add(name, value)
+		}
+	}
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	uri := r.URL.RequestURI()
+	req.Header.Set("X-Forwarded-Method", r.Method)
+	req.Header.Set("X-Forwarded-Proto", proto)
+	req.Header.Set("X-Forwarded-Host", r.Host)
+	req.Header.Set("X-Forwarded-Uri", uri)
+	req.Header.Set("X-Original-URI", uri)
+	if ip := getClientIP(r); ip != "" {
+		req.Header.Set("X-Forwarded-For", ip)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, forwardAuthMaxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > forwardAuthMaxBodyBytes {
+		return nil, fmt.Errorf("auth service answer exceeds %d bytes", forwardAuthMaxBodyBytes)
+	}
+	header := resp.Header.Clone()
+	for _, name := range forwardAuthHopHeaders {
+		header.Del(name)
+	}
+	return &authResponse{status: resp.StatusCode, header: header, body: body}, nil
+}
+
+// forwardAuthFor returns the cached authenticator of a route, creating it on first use
+func (g *Gateway) forwardAuthFor(route *Route) *forwardAuthenticator {
+	g.forwardAuthsMu.Lock()
+	defer g.forwardAuthsMu.Unlock()
+	if g.forwardAuths == nil {
+		g.forwardAuths = make(map[string]*forwardAuthenticator)
+	}
+	a, ok := g.forwardAuths[route.ID]
+	if !ok {
+		a = newForwardAuthenticator(*route.ForwardAuth)
+		g.forwardAuths[route.ID] = a
+	}
+	return a
+}
+
+// refreshForwardAuths drops the authenticators and cached decisions of routes that were removed or
+// whose forward-auth settings changed (must be called with g.mu held after the routes are published)
+func (g *Gateway) refreshForwardAuths() {
+	g.forwardAuthsMu.Lock()
+	defer g.forwardAuthsMu.Unlock()
+
+	auths := make(map[string]*forwardAuthenticator)
+	for _, route := range g.routes {
+		if a, ok := g.forwardAuths[route.ID]; ok && route.ForwardAuth != nil && reflect.DeepEqual(a.cfg, *route.ForwardAuth) {
+			auths[route.ID] = a
+		}
+	}
+	g.forwardAuths = auths
+}
+
+// checkForwardAuth lets the route's auth service decide on the request
+func (g *Gateway) checkForwardAuth(r *http.Request, route *Route) (*authResult, error) {
+	if route.ForwardAuth == nil || route.ForwardAuth.URL == "" {
+		return nil, &authError{reason: "no forward auth service configured for route"}
+	}
+	resp, err := g.forwardAuthFor(route).check(r)
+	if err != nil {
+		return nil, &authError{status: http.StatusBadGateway, reason: "forward auth: " + err.Error()}
+	}
+	if resp.status < 200 || resp.status > 299 {
+		return nil, &authError{status: resp.status, reason: fmt.Sprintf("forward auth denied with status %d", resp.status), response: resp}
+	}
+
+	result := &authResult{}
+	for _, name := range route.ForwardAuth.ResponseHeaders {
+		if value := resp.header.Get(name); value != "" {
+			if result.headers == nil {
+				result.headers = make(map[string]string, len(route.ForwardAuth.ResponseHeaders))
+			}
+			result.headers[name] = value
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,101 @@
+package api_gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateForwardAuth(t *testing.T) {
+	assert.NoError(t, validateForwardAuth(&Route{AuthType: "jwt"}))
+	assert.NoError(t, validateForwardAuth(&Route{AuthType: "forward", ForwardAuth: &ForwardAuthConfig{URL: "http://127.0.0.1:6001/api/v1/auth/verify", CacheTTL: 30}}))
+	assert.EqualError(t, validateForwardAuth(&Route{AuthType: "forward"}), "forward auth requires a url")
+	assert.EqualError(t, validateForwardAuth(&Route{AuthType: "forward", ForwardAuth: &ForwardAuthConfig{URL: "auth:80/verify"}}), `invalid forward auth url "auth:80/verify"`)
+	assert.EqualError(t, validateForwardAuth(&Route{AuthType: "forward", ForwardAuth: &ForwardAuthConfig{URL: "http://auth", CacheTTL: 7200}}), "forward auth cache_ttl must be between 0 and 3600 seconds")
+}
+
+func TestForwardAuth(t *testing.T) {
+	var asked atomic.Int32
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asked.Add(1)
+		assert.Equal(t, "DELETE", r.Method)
+		assert.Equal(t, "/items/1?force=true", r.Header.Get("X-Forwarded-Uri"))
+		assert.Equal(t, "/items/1?force=true", r.Header.Get("X-Original-URI"))
+		assert.Equal(t, "DELETE", r.Header.Get("X-Forwarded-Method"))
+		assert.Equal(t, "shop.example.com", r.Header.Get("X-Forwarded-Host"))
+		assert.Empty(t, r.Header.Get("X-Other"), "only the selected headers are sent")
+		switch r.Header.Get("Authorization") {
+		case "Bearer good":
+			w.Header().Set("X-Auth-User-Id", "42")
+			w.Header().Set("X-Auth-Debug", "not forwarded")
+		case "":
+			http.Redirect(w, r, "https://login.example.com/", http.StatusFound)
+		default:
+			w.Header().Set("Set-Cookie", "session=; Max-Age=0")
+			http.Error(w, "token expired", http.StatusUnauthorized)
+		}
+	}))
+	defer authServer.Close()
+
+	var upstreamUser string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamUser = r.Header.Get("X-Auth-User-Id")
+		assert.Empty(t, r.Header.Get("X-Auth-Debug"))
+	}))
+	defer backend.Close()
+	hostParts := splitHostPort(strings.TrimPrefix(backend.URL, "http://"))
+	g := newProxyTestGateway(&Service{ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true})
+	route := g.routes[0]
+	route.AuthRequired = true
+	route.AuthType = "forward"
+	route.ForwardAuth = &ForwardAuthConfig{URL: authServer.URL + "/verify", ResponseHeaders: []string{"X-Auth-User-Id"}, CacheTTL: 60}
+
+	send := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("DELETE", "http://shop.example.com/items/1?force=true", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		req.Header.Set("X-Other", "x")
+		req.Header.Set("X-Auth-User-Id", "spoofed")
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, req)
+		return rec
+	}
+
+	rec := send("Bearer good")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "42", upstreamUser, "allowing answers set upstream headers")
+
+	// denials are returned to the client as is
+	rec = send("Bearer expired")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "token expired\n", rec.Body.String())
+	assert.Equal(t, "session=; Max-Age=0", rec.Header().Get("Set-Cookie"))
+	rec = send("")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://login.example.com/", rec.Header().Get("Location"))
+	require.Equal(t, int32(3), asked.Load())
+
+	// decisions are cached per URI and headers
+	upstreamUser = ""
+	require.Equal(t, http.StatusOK, send("Bearer good").Code)
+	assert.Equal(t, "42", upstreamUser)
+	assert.Equal(t, http.StatusUnauthorized, send("Bearer expired").Code)
+	assert.Equal(t, int32(3), asked.Load())
+
+	// a reload keeps the decisions of unchanged routes
+	g.refreshForwardAuths()
+	require.Equal(t, http.StatusOK, send("Bearer good").Code)
+	assert.Equal(t, int32(3), asked.Load())
+
+	// an unreachable auth service fails closed once changed settings drop the cached decisions
+	authServer.Close()
+	route.ForwardAuth.CacheTTL = 30
+	g.refreshForwardAuths()
+	assert.Equal(t, http.StatusBadGateway, send("Bearer good").Code)
+}
@@ -0,0 +1,185 @@
+package api_gateway
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientInfo is the client address resolved for a request
+type clientInfo struct {
+	ip          string
+	trustedPeer bool // the direct peer is a trusted proxy, so its forwarded headers were used
+}
+
+type clientInfoKey struct{}
+
+func withClientInfo(r *http.Request, info clientInfo) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientInfoKey{}, info))
+}
+
+func clientInfoFromRequest(r *http.Request) (clientInfo, bool) {
+	info, ok := r.Context().Value(clientInfoKey{}).(clientInfo)
+	return info, ok
+}
+
+// getClientIP returns the client IP of a request. Requests that passed through handleRequest
+// carry the address resolved against the trusted proxies; otherwise the peer address is used
+// and forwarded headers are ignored.
+func getClientIP(r *http.Request) string {
+	if info, ok := clientInfoFromRequest(r); ok {
+		return info.ip
+	}
+	return peerIP(r.RemoteAddr)
+}
+
+func peerIP(remoteAddr string) string {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return ip
+}
+
+// rebuildTrustedProxies parses the trusted proxy list (must be called with g.mu held)
+func (g *Gateway) rebuildTrustedProxies() {
+	prefixes, err := parsePrefixes(g.config.TrustedProxies)
+	if err != nil {
+		// Rejected on save; trust nobody rather than part of a broken list
+		prefixes = nil
+	}
+	g.trustedProxiesMu.Lock()
+	g.trustedProxies = prefixes
+	g.trustedProxiesMu.Unlock()
+}
+
+// isTrustedProxy reports whether a peer address belongs to a trusted proxy
+func (g *Gateway) isTrustedProxy(addr netip.Addr) bool {
+	g.trustedProxiesMu.RLock()
+	defer g.trustedProxiesMu.RUnlock()
+	return prefixesContain(g.trustedProxies, addr.Unmap())
+}
+
+// resolveClientIP determines the client address of a request. Forwarded headers are only
+// honoured when the direct peer is a trusted proxy; the chain is then walked from the right
+// and the first address that is not a trusted proxy is the client, so entries a client
+// prepended itself are never reached.
+func (g *Gateway) resolveClientIP(r *http.Request) clientInfo {
+	peer := peerIP(r.RemoteAddr)
+	peerAddr, err := netip.ParseAddr(peer)
+	if err != nil || !g.isTrustedProxy(peerAddr) {
+		return clientInfo{ip: peer}
+	}
+
+	hops := forwardedHops(r.Header)
+	client := peerAddr.Unmap()
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseForwardedNode(hops[i])
+		if !ok {
+			// "unknown", obfuscated or garbled: the hop to its right is the best we know
+			break
+		}
+		client = addr
+		if !g.isTrustedProxy(addr) {
+			break
+		}
+	}
+	return clientInfo{ip: client.String(), trustedPeer: true}
+}
+
+// forwardedHops returns the client chain of a request, oldest first, from the RFC 7239
+// Forwarded header, X-Forwarded-For or X-Real-IP, in that order of preference.
+func forwardedHops(h http.Header) []string {
+	if values := h.Values("Forwarded"); len(values) > 0 {
+		var hops []string
+		for _, element := range splitQuoted(strings.Join(values, ","), ',') {
+			for _, pair := range splitQuoted(element, ';') {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(strings.TrimSpace(key), "for") {
+					hops = append(hops, value)
+				}
+			}
+		}
+		if len(hops) > 0 {
+			return hops
+		}
+	}
+	if values := h.Values("X-Forwarded-For"); len(values) > 0 {
+		return strings.Split(strings.Join(values, ","), ",")
+	}
+	if xri := h.Get("X-Real-IP"); xri != "" {
+		return []string{xri}
+	}
+	return nil
+}
+
+// splitQuoted splits s at sep outside double-quoted strings
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseForwardedNode parses an address from X-Forwarded-For or a Forwarded for= value,
+// e.g. 192.0.2.1, 192.0.2.1:8080, "[2001:db8::1]:4711" or 2001:db8::1.
+func parseForwardedNode(node string) (netip.Addr, bool) {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+	if strings.HasPrefix(node, "[") {
+		end := strings.IndexByte(node, ']')
+		if end < 0 {
+			return netip.Addr{}, false
+		}
+		node = node[1:end]
+	} else if strings.Count(node, ":") == 1 {
+		node, _, _ = strings.Cut(node, ":")
+	}
+	addr, err := netip.ParseAddr(node)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// validateClientAddressConfig checks the trusted proxy and PROXY protocol settings before they are saved
+func validateClientAddressConfig(cfg *GatewayConfig) error {
+	if _, err := parsePrefixes(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("trusted proxies: %w", err)
+	}
+	acceptsProxyProtocol := cfg.ProxyProtocol != nil && (cfg.ProxyProtocol.HTTP || cfg.ProxyProtocol.HTTPS)
+	for _, r := range cfg.TCPRoutes {
+		acceptsProxyProtocol = acceptsProxyProtocol || r.ProxyProtocol
+	}
+	if acceptsProxyProtocol && len(cfg.TrustedProxies) == 0 {
+		return fmt.Errorf("PROXY protocol requires trusted proxies")
+	}
+	for i := range cfg.Services {
+		if err := validateServiceProxyProtocol(&cfg.Services[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateServiceProxyProtocol checks the PROXY protocol version a service expects
+func validateServiceProxyProtocol(service *Service) error {
+	switch service.ProxyProtocol {
+	case "", proxyProtocolV1, proxyProtocolV2:
+		return nil
+	}
+	return fmt.Errorf("service %s: invalid proxy_protocol %q (use v1 or v2)", service.ID, service.ProxyProtocol)
+}
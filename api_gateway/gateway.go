@@ -4,8 +4,8 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -13,7 +13,9 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -21,6 +23,8 @@ import (
 	dockermanager "redock/docker-manager"
 	"redock/platform/database"
 	"redock/platform/memory"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 var (
@@ -35,6 +39,7 @@ const (
 	defaultClientStatsLimit  = 2048
 	defaultTopClientLimit    = 1000
 	defaultNoRouteThreshold  = 5
+	defaultWAFHitThreshold   = 3
 	defaultAutoBlockDuration = 5 * time.Minute
 )
 
@@ -44,6 +49,7 @@ func defaultClientSecurityConfig() *ClientSecurityConfig {
 		TopClientLimit:       defaultTopClientLimit,
 		AutoBlockEnabled:     true,
 		NoRouteThreshold:     defaultNoRouteThreshold,
+		WAFHitThreshold:      defaultWAFHitThreshold,
 		AutoBlockDurationSec: int(defaultAutoBlockDuration / time.Second),
 	}
 }
@@ -68,6 +74,9 @@ func (g *Gateway) ensureClientSecurityDefaultsLocked() {
 	if cfg.NoRouteThreshold <= 0 {
 		cfg.NoRouteThreshold = defaultNoRouteThreshold
 	}
+	if cfg.WAFHitThreshold <= 0 {
+		cfg.WAFHitThreshold = defaultWAFHitThreshold
+	}
 	if cfg.AutoBlockDurationSec <= 0 {
 		cfg.AutoBlockDurationSec = int(defaultAutoBlockDuration / time.Second)
 	}
@@ -328,6 +337,7 @@ func NewGateway(workDir string) *Gateway {
 		persistentBlocks: make(map[string]BlockedClient),
 	}
 	g.loadConfig()
+	g.loadConfigRevisions()
 	return g
 }
 
@@ -386,10 +396,11 @@ func (g *Gateway) SaveConfig() error {
 
 // saveConfigLocked saves the configuration to memory DB only (no file).
 func (g *Gateway) saveConfigLocked() error {
-	data, err := json.Marshal(g.config)
+	data, err := json.Marshal(withoutDiscovered(g.config))
 	if err != nil {
 		return err
 	}
+	g.recordConfigRevision(data)
 
 	db := g.db()
 	if db == nil {
@@ -407,38 +418,35 @@ func (g *Gateway) saveConfigLocked() error {
 // refreshServicesAndRoutes refreshes internal maps from config
 func (g *Gateway) refreshServicesAndRoutes() {
 	g.mu.Lock()
-	defer g.mu.Unlock()
 
-	// Rebuild services map
-	g.services = make(map[string]*Service)
-	for i := range g.config.Services {
-		svc := &g.config.Services[i]
-		g.services[svc.ID] = svc
-	}
-
-	// Rebuild routes slice and sort by priority
-	g.routes = make([]*Route, len(g.config.Routes))
-	for i := range g.config.Routes {
-		g.routes[i] = &g.config.Routes[i]
-	}
-	sort.Slice(g.routes, func(i, j int) bool {
-		return g.routes[i].Priority > g.routes[j].Priority
-	})
+	previous := g.services
+	g.publishServicesLocked()
+	g.publishRoutesLocked()
 
 	// Initialize rate limiters
-	if g.config.GlobalRateLimit != nil && g.config.GlobalRateLimit.Enabled {
-		g.globalLimiter = &rateLimiter{
-			clients:  make(map[string]*clientRateLimit),
-			requests: g.config.GlobalRateLimit.Requests,
-			window:   time.Duration(g.config.GlobalRateLimit.Window) * time.Second,
-		}
-	}
-
-	g.rateLimiter = &rateLimiter{
-		clients: make(map[string]*clientRateLimit),
-	}
+	g.rebuildGlobalLimiter()
+	if g.rateLimiter == nil {
+		g.rateLimiter = &rateLimiter{
+			clients: make(map[string]*clientRateLimit),
+		}
+	}
+
+	g.refreshBalancers(previous)
+	g.refreshTransports(previous)
+	g.refreshJWTVerifiers()
+	g.refreshForwardAuths()
+	g.refreshOIDCProviders()
+	g.refreshTransformers()
+	g.rebuildRouteLimiters()
+	g.refreshConsumers()
+	g.resizeResponseCache(g.config.CacheMaxBytes)
+	g.rebuildWAF()
+	g.refreshAccessPolicies()
+	g.rebuildTrustedProxies()
+	g.refreshTracer()
+	g.mu.Unlock()
 
-	g.clearRouteCache()
+	g.loadGeoIP()
 }
 
 // GetConfig returns the current gateway configuration
@@ -466,35 +474,68 @@ func (g *Gateway) GetConfigCopy() *GatewayConfig {
 	return &copy
 }
 
-// UpdateConfig updates the gateway configuration
+// checkCandidateLocked returns the errors ValidateConfig reports for a configuration about to
+// replace the current one (must be called with g.mu held)
+func (g *Gateway) checkCandidateLocked(config *GatewayConfig) error {
+	if errs, _ := checkConfig(g.withDiscoveredLocked(config)); len(errs) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// changeConfigLocked applies change to a copy of the configuration and keeps the copy only when
+// ValidateConfig would accept it (must be called with g.mu held)
+func (g *Gateway) changeConfigLocked(change func(config *GatewayConfig)) error {
+	candidate := *g.config
+	candidate.Services = slices.Clone(g.config.Services)
+	candidate.Routes = slices.Clone(g.config.Routes)
+	change(&candidate)
+	if err := g.checkCandidateLocked(&candidate); err != nil {
+		return err
+	}
+	g.config = &candidate
+	return nil
+}
+
+// UpdateConfig updates the gateway configuration. Configs with errors in ValidateConfig are rejected.
 func (g *Gateway) UpdateConfig(config *GatewayConfig) error {
+	// Whatever the dry-run rejects is not saved either
+	g.mu.RLock()
+	err := g.checkCandidateLocked(config)
+	g.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
 	gatewayLock.Lock()
 	defer gatewayLock.Unlock()
 
-	wasRunning := g.running
-	if wasRunning {
-		if err := g.stopLocked(); err != nil {
-			return fmt.Errorf("failed to stop gateway: %w", err)
-		}
-	}
-
+	// Requests keep being served while the new routing snapshot is swapped in
 	g.mu.Lock()
-	g.config = config
+	previous := g.config.Routes
+	g.config = g.withDiscoveredLocked(config)
+	next := g.config.Routes
 	g.mu.Unlock()
 
 	g.refreshServicesAndRoutes()
+	g.purgeChangedRoutes(previous, next)
 	g.refreshClientSecurity()
+	g.reconcileDockerDiscovery()
 
 	if err := g.SaveConfig(); err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
 
-	if wasRunning && config.Enabled {
-		if err := g.startLocked(); err != nil {
-			return fmt.Errorf("failed to restart gateway: %w", err)
-		}
+	if !g.running {
+		return nil
+	}
+	if !config.Enabled {
+		return g.stopLocked()
+	}
+	// Only listeners whose port, PROXY protocol or TLS settings changed are replaced
+	if err := g.reconcileListenersLocked(); err != nil {
+		return fmt.Errorf("failed to reload gateway: %w", err)
 	}
-
 	return nil
 }
 
@@ -515,87 +556,9 @@ func (g *Gateway) startLocked() error {
 	g.refreshClientSecurity()
 	g.stopChan = make(chan struct{})
 
-	// Create HTTP server
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", g.handleRequest)
-
-	g.httpServer = &http.Server{
-		Handler:      mux,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  60 * time.Second,
-	}
-
-	// Start HTTP listener
-	httpAddr := fmt.Sprintf(":%d", g.config.HTTPPort)
-	var err error
-	g.httpListener, err = net.Listen("tcp", httpAddr)
-	if err != nil {
-		return fmt.Errorf("failed to listen on %s: %w", httpAddr, err)
-	}
-
-	go func() {
-		log.Printf("API Gateway: HTTP server listening on %s", httpAddr)
-		if err := g.httpServer.Serve(g.httpListener); err != nil && err != http.ErrServerClosed {
-			log.Printf("API Gateway: HTTP server error: %v", err)
-		}
-	}()
-
-	// Start HTTPS if enabled. Use GetCertificate so renewed certs are picked up without restart.
-	if g.config.HTTPSEnabled && g.config.TLSCertFile != "" && g.config.TLSKeyFile != "" {
-		g.tlsConfig = &tls.Config{
-			MinVersion: tls.VersionTLS12,
-			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
-				g.mu.RLock()
-				certFile := g.config.TLSCertFile
-				keyFile := g.config.TLSKeyFile
-				g.mu.RUnlock()
-				if certFile == "" || keyFile == "" {
-					return nil, fmt.Errorf("TLS cert/key not configured")
-				}
-				cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-				if err != nil {
-					log.Printf("API Gateway: TLS certificate load failed (cert=%s): %v", certFile, err)
-					return nil, err
-				}
-				return &cert, nil
-			},
-		}
-
-		g.httpsServer = &http.Server{
-			Handler:      mux,
-			TLSConfig:    g.tlsConfig,
-			ReadTimeout:  30 * time.Second,
-			WriteTimeout: 30 * time.Second,
-			IdleTimeout:  60 * time.Second,
-		}
-
-		httpsAddr := fmt.Sprintf(":%d", g.config.HTTPSPort)
-		g.httpsListener, err = tls.Listen("tcp", httpsAddr, g.tlsConfig)
-		if err != nil {
-			log.Printf("API Gateway: Failed to listen on %s: %v", httpsAddr, err)
-		} else {
-			go func() {
-				log.Printf("API Gateway: HTTPS server listening on %s", httpsAddr)
-				if err := g.httpsServer.Serve(g.httpsListener); err != nil && err != http.ErrServerClosed {
-					log.Printf("API Gateway: HTTPS server error: %v", err)
-				}
-			}()
-		}
-	}
-
-	// Start UDP route listeners
-	for _, r := range g.config.UDPRoutes {
-		if r.Enabled {
-			go g.runUDPRoute(r, g.stopChan)
-		}
-	}
-
-	// Start TCP route listeners
-	for _, r := range g.config.TCPRoutes {
-		if r.Enabled {
-			go g.runTCPRoute(r, g.stopChan)
-		}
+	if err := g.reconcileListenersLocked(); err != nil {
+		g.closeListenersLocked()
+		return err
 	}
 
 	// Start health checks
@@ -625,25 +588,7 @@ func (g *Gateway) stopLocked() error {
 	}
 
 	close(g.stopChan)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	if g.httpServer != nil {
-		if err := g.httpServer.Shutdown(ctx); err != nil {
-			log.Printf("API Gateway: HTTP server shutdown error: %v", err)
-		}
-		g.httpServer = nil
-		g.httpListener = nil
-	}
-
-	if g.httpsServer != nil {
-		if err := g.httpsServer.Shutdown(ctx); err != nil {
-			log.Printf("API Gateway: HTTPS server shutdown error: %v", err)
-		}
-		g.httpsServer = nil
-		g.httpsListener = nil
-	}
+	g.closeListenersLocked()
 
 	g.running = false
 	g.mu.Lock()
@@ -666,17 +611,16 @@ func (g *Gateway) IsRunning() bool {
 func (g *Gateway) handleRequest(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 
+	skipTypes := g.bodyLogSkipTypes()
 	lw := newLoggingResponseWriter(w, maxLoggedBodyBytes)
-	reqInfo, err := captureRequestBody(r, maxLoggedBodyBytes)
-	if err != nil {
-		g.recordError()
-		status := http.StatusBadRequest
-		http.Error(lw, "Invalid request body", status)
-		g.logRequest(r, status, startTime, "", "", "", "", true, "failed to read request body", reqInfo, lw.LogInfo())
-		return
-	}
-
-	clientIP := getClientIP(r)
+	lw.skipTypes = skipTypes
+	reqBody := teeRequestBody(r, maxLoggedBodyBytes, skipTypes)
+
+	r = withRequestID(r)
+	r = g.startTrace(r)
+	client := g.resolveClientIP(r)
+	r = withClientInfo(r, client)
+	clientIP := client.ip
 	trackClient := clientIP != ""
 	statusCode := http.StatusOK
 	routeID := ""
@@ -684,10 +628,11 @@ func (g *Gateway) handleRequest(w http.ResponseWriter, r *http.Request) {
 	serviceID := ""
 	serviceName := ""
 	matchedRoute := false
+	var wafMatch *wafHit
 
 	defer func() {
 		if trackClient {
-			g.trackClientActivity(clientIP, r.URL.Path, routeID, statusCode, matchedRoute)
+			g.trackClientActivity(clientIP, r.URL.Path, routeID, statusCode, matchedRoute, wafMatch)
 		}
 	}()
 
@@ -698,7 +643,7 @@ func (g *Gateway) handleRequest(w http.ResponseWriter, r *http.Request) {
 			message = "Client blocked"
 		}
 		http.Error(lw, message, statusCode)
-		g.logRequest(r, statusCode, startTime, "", "", "", "", true, message, reqInfo, lw.LogInfo())
+		g.logRequest(r, statusCode, startTime, "", "", "", "", true, message, reqBody.LogInfo(), lw.LogInfo())
 		trackClient = false
 		return
 	}
@@ -706,7 +651,7 @@ func (g *Gateway) handleRequest(w http.ResponseWriter, r *http.Request) {
 	// Handle ACME challenges for Let's Encrypt
 	if HandleACMEChallenge(lw, r) {
 		statusCode = lw.StatusCode()
-		g.logRequest(r, statusCode, startTime, "", "", "", "", true, "", reqInfo, lw.LogInfo())
+		g.logRequest(r, statusCode, startTime, "", "", "", "", true, "", reqBody.LogInfo(), lw.LogInfo())
 		trackClient = false
 		return
 	}
@@ -717,82 +662,208 @@ func (g *Gateway) handleRequest(w http.ResponseWriter, r *http.Request) {
 	g.stats.mu.Unlock()
 
 	// Check global rate limit
-	if g.globalLimiter != nil {
-		if !g.checkRateLimit(g.globalLimiter, clientIP) {
+	g.mu.RLock()
+	globalLimiter := g.globalLimiter
+	g.mu.RUnlock()
+	if globalLimiter != nil {
+		span := startSpan(r, "rate_limit")
+		span.set("gateway.rate_limit.scope", "global")
+		allowed := g.checkRateLimit(globalLimiter, clientIP)
+		span.set("gateway.rate_limit.limited", !allowed)
+		span.end()
+		if !allowed {
 			g.recordError()
 			g.recordRateLimited()
 			statusCode = http.StatusTooManyRequests
 			http.Error(lw, "Rate limit exceeded", statusCode)
-			g.logRequest(r, statusCode, startTime, "", "", "", "", true, "rate limit exceeded", reqInfo, lw.LogInfo())
+			g.logRequest(r, statusCode, startTime, "", "", "", "", true, "rate limit exceeded", reqBody.LogInfo(), lw.LogInfo())
 			return
 		}
 	}
 
 	// Find matching route
+	span := startSpan(r, "route_match")
 	route := g.matchRoute(r)
+	if route != nil {
+		span.set("gateway.route.id", route.ID)
+	}
+	span.end()
+
+	// Inspect the request with the WAF before any route handling; unmatched requests are
+	// inspected too so that probes for unrouted paths count as attacks
+	if hit := g.inspectRequest(r, route); hit != nil {
+		g.recordWAFHit(hit)
+		r = withWAFHit(r, hit)
+		wafMatch = hit
+		if hit.blocked {
+			g.recordError()
+			observability := true
+			if route != nil {
+				matchedRoute = true
+				routeID = route.ID
+				routeName = route.Name
+				observability = g.isRouteObservabilityEnabled(route)
+			}
+			statusCode = http.StatusForbidden
+			http.Error(lw, "Forbidden", statusCode)
+			g.logRequest(r, statusCode, startTime, routeID, routeName, "", "", observability, "waf: rule "+hit.ruleID+" matched "+hit.target, reqBody.LogInfo(), lw.LogInfo())
+			return
+		}
+	}
+
 	if route == nil {
 		g.recordError()
 		statusCode = http.StatusNotFound
 		http.Error(lw, "Not Found", statusCode)
-		g.logRequest(r, statusCode, startTime, "", "", "", "", true, "no matching route", reqInfo, lw.LogInfo())
+		g.logRequest(r, statusCode, startTime, "", "", "", "", true, "no matching route", reqBody.LogInfo(), lw.LogInfo())
 		return
 	}
 	matchedRoute = true
 	routeID = route.ID
 	routeName = route.Name
 
+	// Per-route client access policy (IP lists, IP sets, countries), checked before auth
+	if !g.checkRouteAccess(lw, route, clientIP) {
+		g.recordError()
+		statusCode = http.StatusForbidden
+		g.logRequest(r, statusCode, startTime, routeID, routeName, "", "", g.isRouteObservabilityEnabled(route), "client denied by access policy", reqBody.LogInfo(), lw.LogInfo())
+		return
+	}
+
+	// Enforce the route's body limit: declared lengths up front, streamed bodies while read
+	if limit := route.MaxRequestBodyBytes; limit > 0 && r.Body != nil && r.Body != http.NoBody {
+		if r.ContentLength > limit {
+			g.recordError()
+			statusCode = http.StatusRequestEntityTooLarge
+			http.Error(lw, "Request Entity Too Large", statusCode)
+			g.logRequest(r, statusCode, startTime, routeID, routeName, "", "", g.isRouteObservabilityEnabled(route), "request body too large", reqBody.LogInfo(), lw.LogInfo())
+			return
+		}
+		r.Body = http.MaxBytesReader(lw, r.Body, limit)
+	}
+
 	// OPTIONS preflight: respond with route CORS headers and 204 without proxying
 	if r.Method == http.MethodOptions && route.CORS != nil && route.CORS.Enabled {
 		applyCORSHeaders(lw.Header(), r.Header.Get("Origin"), route.CORS)
 		lw.WriteHeader(http.StatusNoContent)
-		g.logRequest(r, http.StatusNoContent, startTime, routeID, routeName, "", "", g.isRouteObservabilityEnabled(route), "", reqInfo, lw.LogInfo())
+		g.logRequest(r, http.StatusNoContent, startTime, routeID, routeName, "", "", g.isRouteObservabilityEnabled(route), "", reqBody.LogInfo(), lw.LogInfo())
 		return
 	}
 
 	routeObservability := g.isRouteObservabilityEnabled(route)
 
-	// Check route-level rate limit
-	if route.RateLimitEnabled && route.RateLimitRequests > 0 {
-		routeLimiter := &rateLimiter{
-			clients:  make(map[string]*clientRateLimit),
-			requests: route.RateLimitRequests,
-			window:   time.Duration(route.RateLimitWindow) * time.Second,
-		}
-		if !g.checkRateLimit(routeLimiter, clientIP) {
+	// Check route-level rate limit; consumer and claim keys are checked once auth has run
+	routeLimiter := g.routeLimiterFor(route)
+	if routeLimiter != nil && !routeLimiter.needsIdentity() {
+		if !g.checkRouteRateLimit(lw, r, routeLimiter, clientIP) {
 			g.recordError()
-			g.recordRateLimited()
+			g.recordRouteRateLimited(routeID)
 			statusCode = http.StatusTooManyRequests
 			http.Error(lw, "Rate limit exceeded", statusCode)
-			g.logRequest(r, statusCode, startTime, routeID, routeName, "", "", routeObservability, "rate limit exceeded", reqInfo, lw.LogInfo())
+			g.logRequest(r, statusCode, startTime, routeID, routeName, "", "", routeObservability, "rate limit exceeded", reqBody.LogInfo(), lw.LogInfo())
 			return
 		}
 	}
 
 	// Check authentication if required
 	if route.AuthRequired {
-		if !g.checkAuth(r, route) {
+		span := startSpan(r, "auth")
+		auth, err := g.checkAuth(r, route)
+		if err != nil {
+			span.fail(err.Error())
+		} else if auth != nil && auth.consumer != "" {
+			span.set("gateway.consumer", auth.consumer)
+		}
+		span.end()
+		if err != nil {
 			g.recordError()
 			statusCode = http.StatusUnauthorized
-			http.Error(lw, "Unauthorized", statusCode)
-			g.logRequest(r, statusCode, startTime, routeID, routeName, "", "", routeObservability, "authentication failed", reqInfo, lw.LogInfo())
+			ae, _ := err.(*authError)
+			if ae != nil {
+				statusCode = ae.statusCode()
+				if challenge := ae.challenge(); challenge != "" {
+					lw.Header().Set("WWW-Authenticate", challenge)
+				}
+			}
+			if ae != nil && ae.response != nil {
+				// Login redirects and the forward auth service's answers go back as is
+				ae.response.write(lw)
+			} else {
+				http.Error(lw, http.StatusText(statusCode), statusCode)
+			}
+			g.logRequest(r, statusCode, startTime, routeID, routeName, "", "", routeObservability, "authentication failed: "+err.Error(), reqBody.LogInfo(), lw.LogInfo())
+			return
+		}
+		if auth != nil && auth.response != nil {
+			auth.response.write(lw)
+			statusCode = lw.StatusCode()
+			g.logRequest(r, statusCode, startTime, routeID, routeName, "", "", routeObservability, "", reqBody.LogInfo(), lw.LogInfo())
 			return
 		}
+		if auth != nil {
+			for _, cookie := range auth.cookies {
+				http.SetCookie(lw, cookie)
+			}
+		}
+		applyAuthResult(r, route, auth)
+		r = withAuthResult(r, auth)
 	}
 
-	// Get service
-	g.mu.RLock()
-	service := g.services[route.ServiceID]
-	g.mu.RUnlock()
+	if routeLimiter != nil && routeLimiter.needsIdentity() {
+		if !g.checkRouteRateLimit(lw, r, routeLimiter, clientIP) {
+			g.recordError()
+			g.recordRouteRateLimited(routeID)
+			statusCode = http.StatusTooManyRequests
+			http.Error(lw, "Rate limit exceeded", statusCode)
+			g.logRequest(r, statusCode, startTime, routeID, routeName, "", "", routeObservability, "rate limit exceeded", reqBody.LogInfo(), lw.LogInfo())
+			return
+		}
+	}
+
+	// Routes with an action are answered by the gateway itself
+	if g.serveRouteAction(lw, r, route) {
+		statusCode = lw.StatusCode()
+		g.logRequest(r, statusCode, startTime, routeID, routeName, "", "", routeObservability, "", reqBody.LogInfo(), lw.LogInfo())
+		g.recordLatency("", statusCode, startTime)
+		return
+	}
+
+	// Get service (one of the route's weighted backends when traffic is split)
+	service, stickyCookie := g.selectService(r, route)
 
 	if service == nil || !service.Enabled {
 		g.recordError()
 		statusCode = http.StatusServiceUnavailable
 		http.Error(lw, "Service Unavailable", statusCode)
-		g.logRequest(r, statusCode, startTime, routeID, routeName, route.ServiceID, serviceName, routeObservability, "service not available", reqInfo, lw.LogInfo())
+		g.logRequest(r, statusCode, startTime, routeID, routeName, route.ServiceID, serviceName, routeObservability, "service not available", reqBody.LogInfo(), lw.LogInfo())
 		return
 	}
 	serviceID = service.ID
 	serviceName = service.Name
+	if stickyCookie != nil {
+		http.SetCookie(lw, stickyCookie)
+	}
+
+	// Answer from the response cache; fresh and stale-while-revalidate entries skip the upstream
+	cacheSpan := startSpan(r, "cache_lookup")
+	lookup := g.lookupResponseCache(r, route)
+	if lookup != nil {
+		cacheSpan.set("gateway.cache.status", lookup.status)
+		cacheSpan.end()
+		r = withCacheLookup(r, lookup)
+		if lookup.served() {
+			g.serveCachedResponse(lw, r, route, service, lookup)
+			if lookup.status == cacheStatusStale {
+				g.revalidateInBackground(r, route, service, lookup)
+			}
+			lookup.finish()
+			statusCode = lw.StatusCode()
+			g.logRequest(r, statusCode, startTime, routeID, routeName, serviceID, serviceName, routeObservability, "", reqBody.LogInfo(), lw.LogInfo())
+			g.recordLatency("", statusCode, startTime)
+			return
+		}
+		lookup.prepareRevalidation(r)
+	}
 
 	// Check service health
 	g.mu.RLock()
@@ -803,7 +874,16 @@ func (g *Gateway) handleRequest(w http.ResponseWriter, r *http.Request) {
 		g.recordError()
 		statusCode = http.StatusServiceUnavailable
 		http.Error(lw, "Service Unavailable", statusCode)
-		g.logRequest(r, statusCode, startTime, routeID, routeName, serviceID, serviceName, routeObservability, "service unhealthy", reqInfo, lw.LogInfo())
+		g.logRequest(r, statusCode, startTime, routeID, routeName, serviceID, serviceName, routeObservability, "service unhealthy", reqBody.LogInfo(), lw.LogInfo())
+		return
+	}
+
+	// Fail fast while the circuit breaker has ejected every target
+	if g.circuitOpen(service) {
+		g.recordError()
+		statusCode = http.StatusServiceUnavailable
+		http.Error(lw, "Service Unavailable", statusCode)
+		g.logRequest(r, statusCode, startTime, routeID, routeName, serviceID, serviceName, routeObservability, "circuit breaker open", reqBody.LogInfo(), lw.LogInfo())
 		return
 	}
 
@@ -815,24 +895,37 @@ func (g *Gateway) handleRequest(w http.ResponseWriter, r *http.Request) {
 	g.stats.serviceStats[service.ID].requests++
 	g.stats.mu.Unlock()
 
+	g.mirrorRequest(r, route)
+
 	// Proxy the request
-	err = g.proxyRequest(lw, r, route, service)
+	r = withRetryCounter(r)
+	err := g.proxyRequest(lw, r, route, service)
 	statusCode = lw.StatusCode()
 	if err != nil {
 		g.recordServiceError(serviceID)
-		g.logRequest(r, statusCode, startTime, routeID, routeName, serviceID, serviceName, routeObservability, err.Error(), reqInfo, lw.LogInfo())
+		g.logRequest(r, statusCode, startTime, routeID, routeName, serviceID, serviceName, routeObservability, err.Error(), reqBody.LogInfo(), lw.LogInfo())
 	} else {
-		g.logRequest(r, statusCode, startTime, routeID, routeName, serviceID, serviceName, routeObservability, "", reqInfo, lw.LogInfo())
+		g.logRequest(r, statusCode, startTime, routeID, routeName, serviceID, serviceName, routeObservability, "", reqBody.LogInfo(), lw.LogInfo())
+	}
+	if lookup != nil {
+		lookup.finish()
 	}
 
-	// Record latency
+	g.recordLatency(serviceID, statusCode, startTime)
+}
+
+// recordLatency adds the request latency to the totals and, when serviceID is set, to the service
+func (g *Gateway) recordLatency(serviceID string, statusCode int, startTime time.Time) {
 	latency := time.Since(startTime).Milliseconds()
 	g.stats.mu.Lock()
+	defer g.stats.mu.Unlock()
 	g.stats.totalLatency += latency
 	if g.stats.serviceStats[serviceID] != nil {
 		g.stats.serviceStats[serviceID].totalLatency += latency
+		if statusCode >= http.StatusInternalServerError {
+			g.stats.serviceStats[serviceID].serverErrors++
+		}
 	}
-	g.stats.mu.Unlock()
 }
 
 // matchRoute finds the first matching route for the request
@@ -1111,96 +1204,88 @@ func applyResponseHeaders(h http.Header, headers map[string]string) {
 
 // proxyRequest forwards the request to the upstream service
 func (g *Gateway) proxyRequest(w http.ResponseWriter, r *http.Request, route *Route, service *Service) error {
-	// Build target URL
-	protocol := service.Protocol
-	if protocol == "" {
-		protocol = "http"
+	if service.ProxyProtocol != "" {
+		r = r.WithContext(withProxyProtocolEndpoints(r.Context(), requestProxyEndpoints(r)))
+	}
+
+	// Reuse the service's pooled transport so upstream connections are kept alive
+	transport, err := g.transportFor(service)
+	if err != nil {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return fmt.Errorf("upstream transport: %w", err)
 	}
 
-	targetURL := fmt.Sprintf("%s://%s:%d", protocol, service.Host, service.Port)
+	// Pick an upstream target; a half-open one is picked only while it has a probe slot left
+	lb := g.balancerFor(service)
+	upstream, probe := lb.reserve(r, getClientIP(r), g.targetFilter(service.ID, lb))
+	if upstream == nil {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return fmt.Errorf("no healthy target for service %s", service.ID)
+	}
+	r = r.WithContext(withCircuitProbe(r.Context(), probe))
+
+	// Build target URL
+	targetURL := fmt.Sprintf("%s://%s", service.upstreamScheme(), upstream.address)
 	target, err := url.Parse(targetURL)
 	if err != nil {
+		if probe {
+			upstream.breaker.abandon()
+		}
 		http.Error(w, "Bad Gateway", http.StatusBadGateway)
 		return err
 	}
 
-	// Create reverse proxy
-	proxy := httputil.NewSingleHostReverseProxy(target)
-
-	// Configure transport with default timeout if not specified
-	dialTimeout := time.Duration(service.Timeout) * time.Second
-	if dialTimeout <= 0 {
-		dialTimeout = 30 * time.Second
+	// Feed live results into the targets' circuit breakers
+	var base http.RoundTripper = transport
+	if lb.circuit != nil {
+		base = &circuitTransport{base: transport, lb: lb}
 	}
-	proxy.Transport = &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout:   dialTimeout,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
+	// Every attempt, retries included, gets its own client span
+	if trace := traceFromRequest(r); trace != nil && g.isRouteObservabilityEnabled(route) {
+		base = &tracingTransport{base: base, trace: trace}
 	}
 
-	// Determine the incoming protocol
-	incomingProto := "http"
-	if r.TLS != nil {
-		incomingProto = "https"
+	// Create reverse proxy
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	if policy := newRetryPolicy(service); policy != nil {
+		rt := &retryingTransport{
+			g:        g,
+			base:     base,
+			service:  service,
+			policy:   policy,
+			budget:   g.retryBudgetFor(service.ID),
+			lb:       lb,
+			target:   upstream,
+			clientIP: getClientIP(r),
+		}
+		lb.acquire(upstream)
+		// Retries may move the request to another target; release whichever was used last
+		defer func() { lb.release(rt.target) }()
+		proxy.Transport = rt
+	} else {
+		lb.acquire(upstream)
+		defer lb.release(upstream)
+		proxy.Transport = base
+	}
+	if service.isGRPC() {
+		// Stream gRPC messages as they arrive
+		proxy.FlushInterval = -1
 	}
 
 	// Modify the request
+	transformer := g.transformerFor(route)
 	proxy.Director = func(req *http.Request) {
-		req.URL.Scheme = target.Scheme
-		req.URL.Host = target.Host
-
-		// Handle path transformation
-		originalPath := req.URL.Path
-		if route.StripPath {
-			for _, p := range route.Paths {
-				stripped := strings.TrimSuffix(p, "*")
-				stripped = strings.TrimSuffix(stripped, "/")
-				if strings.HasPrefix(originalPath, stripped) {
-					originalPath = strings.TrimPrefix(originalPath, stripped)
-					if originalPath == "" {
-						originalPath = "/"
-					}
-					break
-				}
-			}
-		}
-
-		if service.Path != "" {
-			req.URL.Path = strings.TrimSuffix(service.Path, "/") + originalPath
-		} else {
-			req.URL.Path = originalPath
-		}
-
-		// Set host header
-		targetHost := target.Host
-		if route.HostRewrite != "" {
-			targetHost = route.HostRewrite
-		}
-		if !route.PreserveHost {
-			req.Host = targetHost
-		}
-
-		// Add service headers
-		for key, value := range service.Headers {
-			req.Header.Set(key, value)
-		}
-
-		// Add X-Forwarded headers
-		if clientIP := getClientIP(r); clientIP != "" {
-			req.Header.Set("X-Forwarded-For", clientIP)
-		}
-		req.Header.Set("X-Forwarded-Proto", incomingProto)
-		req.Header.Set("X-Forwarded-Host", r.Host)
+		directUpstreamRequest(req, r, route, service, target, transformer)
 	}
 
 	var proxyErr error
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
 		proxyErr = fmt.Errorf("proxy error: %w", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Bad Gateway", http.StatusBadGateway)
 	}
 
@@ -1208,9 +1293,17 @@ func (g *Gateway) proxyRequest(w http.ResponseWriter, r *http.Request, route *Ro
 	origin := r.Header.Get("Origin")
 	corsCfg := route.CORS
 	respHeaders := route.ResponseHeaders
+	lookup := cacheLookupFromRequest(r)
 	proxy.ModifyResponse = func(resp *http.Response) error {
+		if lookup != nil {
+			// Cache the upstream response before request-specific headers are added
+			lookup.cacheUpstreamResponse(resp)
+		}
 		applyCORSHeaders(resp.Header, origin, corsCfg)
 		applyResponseHeaders(resp.Header, respHeaders)
+		if transformer != nil {
+			transformer.applyResponse(resp, transformVars{r: r, route: route, service: service})
+		}
 		return nil
 	}
 
@@ -1218,6 +1311,74 @@ func (g *Gateway) proxyRequest(w http.ResponseWriter, r *http.Request, route *Ro
 	return proxyErr
 }
 
+// stripRoutePath removes the first matching route path prefix from a request path (strip_path)
+func stripRoutePath(route *Route, requestPath string) string {
+	for _, p := range route.Paths {
+		stripped := strings.TrimSuffix(p, "*")
+		stripped = strings.TrimSuffix(stripped, "/")
+		if strings.HasPrefix(requestPath, stripped) {
+			requestPath = strings.TrimPrefix(requestPath, stripped)
+			if requestPath == "" {
+				requestPath = "/"
+			}
+			break
+		}
+	}
+	return requestPath
+}
+
+// directUpstreamRequest rewrites out (the clone of the incoming request in) into the request sent to target
+func directUpstreamRequest(out, in *http.Request, route *Route, service *Service, target *url.URL, transformer *routeTransformer) {
+	out.URL.Scheme = target.Scheme
+	out.URL.Host = target.Host
+
+	// Handle path transformation
+	originalPath := out.URL.Path
+	if route.StripPath {
+		originalPath = stripRoutePath(route, originalPath)
+	}
+
+	// Set host header
+	targetHost := target.Host
+	if route.HostRewrite != "" {
+		targetHost = route.HostRewrite
+	}
+	if !route.PreserveHost {
+		out.Host = targetHost
+	}
+
+	// Add service headers
+	for key, value := range service.Headers {
+		out.Header.Set(key, value)
+	}
+
+	// Add X-Forwarded headers
+	incomingProto := "http"
+	if in.TLS != nil {
+		incomingProto = "https"
+	}
+	// Forwarded headers from untrusted peers are dropped; the reverse proxy then appends the
+	// peer address, so upstreams see a chain they can trust from its right end.
+	if info, ok := clientInfoFromRequest(in); !ok || !info.trustedPeer {
+		out.Header.Del("X-Forwarded-For")
+		out.Header.Del("X-Real-IP")
+		out.Header.Del("Forwarded")
+	}
+	out.Header.Set("X-Forwarded-Proto", incomingProto)
+	out.Header.Set("X-Forwarded-Host", in.Host)
+
+	// Route transforms run last so they can override anything set above
+	if transformer != nil {
+		originalPath = transformer.applyRequest(out, originalPath, transformVars{r: in, route: route, service: service})
+	}
+
+	if service.Path != "" {
+		out.URL.Path = strings.TrimSuffix(service.Path, "/") + originalPath
+	} else {
+		out.URL.Path = originalPath
+	}
+}
+
 // checkRateLimit checks if a client has exceeded the rate limit
 func (g *Gateway) checkRateLimit(limiter *rateLimiter, clientIP string) bool {
 	limiter.mu.Lock()
@@ -1242,30 +1403,100 @@ func (g *Gateway) checkRateLimit(limiter *rateLimiter, clientIP string) bool {
 	return true
 }
 
+// authResult describes the identity established by checkAuth
+type authResult struct {
+	consumer string            // matched consumer name (auth_type basic/api_key)
+	claims   jwt.MapClaims     // verified token claims (auth_type=jwt)
+	headers  map[string]string // identity headers to forward upstream
+	cookies  []*http.Cookie    // cookies for the client, such as a refreshed OIDC session
+	response *authResponse     // the auth check answered the request itself (OIDC callback and logout)
+}
+
+type authContextKey struct{}
+
+// withAuthResult stores the auth result on the request context for logging and later stages
+func withAuthResult(r *http.Request, auth *authResult) *http.Request {
+	if auth == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), authContextKey{}, auth))
+}
+
+// authResultFromRequest returns the auth result stored by withAuthResult, if any
+func authResultFromRequest(r *http.Request) *authResult {
+	auth, _ := r.Context().Value(authContextKey{}).(*authResult)
+	return auth
+}
+
+// authError is returned by checkAuth when a request must be rejected
+type authError struct {
+	status   int    // HTTP status (0 = 401)
+	scheme   string // WWW-Authenticate scheme (Basic, Bearer); empty = no challenge
+	code     string // RFC 6750 error code for Bearer challenges
+	reason   string
+	response *authResponse // returned to the client instead of an error page
+}
+
+// authResponse is a complete response of an auth check, such as the answer of a forward auth
+// service or a redirect to a login page
+type authResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// write sends the response to the client
+func (resp *authResponse) write(w http.ResponseWriter) {
+	h := w.Header()
+	for name, values := range resp.header {
+		h[name] = append([]string(nil), values...)
+	}
+	h.Set("Content-Length", strconv.Itoa(len(resp.body)))
+	w.WriteHeader(resp.status)
+	w.Write(resp.body)
+}
+
+func (e *authError) Error() string {
+	return e.reason
+}
+
+func (e *authError) statusCode() int {
+	if e.status == 0 {
+		return http.StatusUnauthorized
+	}
+	return e.status
+}
+
+// challenge builds the WWW-Authenticate header value for the error
+func (e *authError) challenge() string {
+	if e.scheme == "" {
+		return ""
+	}
+	value := e.scheme + ` realm="api_gateway"`
+	if e.code != "" {
+		value += fmt.Sprintf(`, error="%s", error_description="%s"`, e.code, strings.ReplaceAll(e.reason, `"`, `'`))
+	}
+	return value
+}
+
 // checkAuth verifies authentication for the request
-func (g *Gateway) checkAuth(r *http.Request, route *Route) bool {
+func (g *Gateway) checkAuth(r *http.Request, route *Route) (*authResult, error) {
 	switch route.AuthType {
-	case "basic":
-		username, password, ok := r.BasicAuth()
-		if !ok {
-			return false
-		}
-		return username != "" && password != ""
+	case "basic", "api_key":
+		return g.checkConsumerAuth(r, route)
 
 	case "jwt":
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			return false
-		}
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			return false
-		}
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		return token != ""
+		return g.checkJWT(r, route)
+
+	case "forward":
+		return g.checkForwardAuth(r, route)
+
+	case "oidc":
+		return g.checkOIDC(r, route)
 
 	case "header":
 		if len(route.AuthHeaders) == 0 {
-			return false
+			return nil, &authError{reason: "no auth headers configured"}
 		}
 		for _, h := range route.AuthHeaders {
 			key := strings.TrimSpace(h.Key)
@@ -1275,18 +1506,42 @@ func (g *Gateway) checkAuth(r *http.Request, route *Route) bool {
 			got := r.Header.Get(key)
 			if h.Value == "" {
 				if got == "" {
-					return false
+					return nil, &authError{reason: "missing header " + key}
 				}
 				continue
 			}
 			if got != h.Value {
-				return false
+				return nil, &authError{reason: "invalid header " + key}
 			}
 		}
-		return true
+		return &authResult{}, nil
 
 	default:
-		return true
+		return &authResult{}, nil
+	}
+}
+
+// applyAuthResult forwards identity headers upstream. Headers the gateway sets from
+// verified claims are always removed from the client request first so they cannot be spoofed.
+func applyAuthResult(r *http.Request, route *Route, auth *authResult) {
+	if route.JWT != nil {
+		for _, header := range route.JWT.ClaimHeaders {
+			r.Header.Del(header)
+		}
+	}
+	if route.ForwardAuth != nil {
+		for _, header := range route.ForwardAuth.ResponseHeaders {
+			r.Header.Del(header)
+		}
+	}
+	if route.OIDC != nil {
+		stripOIDCRequest(r, route.OIDC)
+	}
+	if auth == nil {
+		return
+	}
+	for key, value := range auth.headers {
+		r.Header.Set(key, value)
 	}
 }
 
@@ -1321,14 +1576,9 @@ func (g *Gateway) checkAllServices() {
 	}
 }
 
-// checkServiceHealth performs a health check on a single service
+// checkServiceHealth performs a health check on every target of a service
 func (g *Gateway) checkServiceHealth(service *Service) {
-	protocol := service.Protocol
-	if protocol == "" {
-		protocol = "http"
-	}
-
-	healthURL := fmt.Sprintf("%s://%s:%d%s", protocol, service.Host, service.Port, service.HealthCheck.Path)
+	protocol := service.upstreamScheme()
 
 	timeout := time.Duration(service.HealthCheck.Timeout) * time.Second
 	if timeout == 0 {
@@ -1336,10 +1586,35 @@ func (g *Gateway) checkServiceHealth(service *Service) {
 	}
 
 	client := &http.Client{Timeout: timeout}
-
-	startTime := time.Now()
-	resp, err := client.Get(healthURL)
-	responseTime := time.Since(startTime).Milliseconds()
+	if transport, err := g.transportFor(service); err == nil {
+		client.Transport = transport
+	}
+
+	type probeResult struct {
+		address      string
+		statusCode   int
+		responseTime int64
+		err          error
+	}
+
+	targets := service.upstreamTargets()
+	results := make([]probeResult, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+			healthURL := fmt.Sprintf("%s://%s%s", protocol, address, service.HealthCheck.Path)
+			startTime := time.Now()
+			resp, err := client.Get(healthURL)
+			results[i] = probeResult{address: address, responseTime: time.Since(startTime).Milliseconds(), err: err}
+			if err == nil {
+				results[i].statusCode = resp.StatusCode
+				resp.Body.Close()
+			}
+		}(i, targetAddress(t.Host, t.Port))
+	}
+	wg.Wait()
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
@@ -1352,48 +1627,105 @@ func (g *Gateway) checkServiceHealth(service *Service) {
 	}
 
 	health := g.serviceHealth[service.ID]
-	health.LastCheck = time.Now()
-	health.ResponseTime = responseTime
+	previous := make(map[string]TargetHealth, len(health.Targets))
+	for _, th := range health.Targets {
+		previous[th.Address] = th
+	}
 
+	now := time.Now()
+	health.Targets = make([]TargetHealth, 0, len(results))
+	for _, res := range results {
+		th, ok := previous[res.address]
+		if !ok {
+			th = TargetHealth{Address: res.address, Healthy: true}
+		}
+		th.LastCheck = now
+		th.ResponseTime = res.responseTime
+		applyHealthProbe(&th, service.HealthCheck, res.statusCode, res.err)
+		health.Targets = append(health.Targets, th)
+	}
+	summarizeServiceHealth(health, now)
+}
+
+// applyHealthProbe updates a target's counters and status from a single probe result
+func applyHealthProbe(th *TargetHealth, hc *HealthCheck, statusCode int, err error) {
 	if err != nil {
-		health.FailureCount++
-		health.SuccessCount = 0
-		health.LastError = err.Error()
-		if health.FailureCount >= service.HealthCheck.UnhealthyThreshold {
-			health.Healthy = false
+		th.FailureCount++
+		th.SuccessCount = 0
+		th.LastError = err.Error()
+		if th.FailureCount >= hc.UnhealthyThreshold {
+			th.Healthy = false
 		}
 		return
 	}
 
-	resp.Body.Close()
 	switch {
-	case resp.StatusCode >= 500:
-		health.FailureCount++
-		health.SuccessCount = 0
-		health.LastError = fmt.Sprintf("HTTP %d", resp.StatusCode)
-		if health.FailureCount >= service.HealthCheck.UnhealthyThreshold {
-			health.Healthy = false
-		}
-	case resp.StatusCode >= 400:
+	case statusCode >= 500:
+		th.FailureCount++
+		th.SuccessCount = 0
+		th.LastError = fmt.Sprintf("HTTP %d", statusCode)
+		if th.FailureCount >= hc.UnhealthyThreshold {
+			th.Healthy = false
+		}
+	case statusCode >= 400:
 		// Client errors still prove the service is reachable, so treat them as successes
-		health.SuccessCount++
-		health.FailureCount = 0
-		health.LastError = fmt.Sprintf("HTTP %d (client error)", resp.StatusCode)
-		if health.SuccessCount >= service.HealthCheck.HealthyThreshold {
-			health.Healthy = true
+		th.SuccessCount++
+		th.FailureCount = 0
+		th.LastError = fmt.Sprintf("HTTP %d (client error)", statusCode)
+		if th.SuccessCount >= hc.HealthyThreshold {
+			th.Healthy = true
 		}
 	default:
-		health.SuccessCount++
-		health.FailureCount = 0
-		health.LastError = ""
-		if health.SuccessCount >= service.HealthCheck.HealthyThreshold {
+		th.SuccessCount++
+		th.FailureCount = 0
+		th.LastError = ""
+		if th.SuccessCount >= hc.HealthyThreshold {
+			th.Healthy = true
+		}
+	}
+}
+
+// summarizeServiceHealth derives the service-level status from its targets.
+// A single-target service mirrors its target; with several targets the service
+// is healthy while any target is, and the counters hold healthy/unhealthy target counts.
+func summarizeServiceHealth(health *ServiceHealth, now time.Time) {
+	health.LastCheck = now
+	if len(health.Targets) == 1 {
+		th := health.Targets[0]
+		health.Healthy = th.Healthy
+		health.SuccessCount = th.SuccessCount
+		health.FailureCount = th.FailureCount
+		health.ResponseTime = th.ResponseTime
+		health.LastError = th.LastError
+		return
+	}
+
+	health.Healthy = false
+	health.SuccessCount = 0
+	health.FailureCount = 0
+	health.LastError = ""
+	var totalTime int64
+	for _, th := range health.Targets {
+		totalTime += th.ResponseTime
+		if th.Healthy {
 			health.Healthy = true
+			health.SuccessCount++
+			continue
 		}
+		health.FailureCount++
+		if health.LastError == "" && th.LastError != "" {
+			health.LastError = th.Address + ": " + th.LastError
+		}
+	}
+	if len(health.Targets) > 0 {
+		health.ResponseTime = totalTime / int64(len(health.Targets))
 	}
 }
 
 // logRequest logs an access log entry
 func (g *Gateway) logRequest(r *http.Request, statusCode int, startTime time.Time, routeID, routeName, serviceID, serviceName string, allowTelemetry bool, errMsg string, reqInfo bodyLogInfo, respInfo bodyLogInfo) {
+	observeRequest(routeID, serviceID, statusCode, startTime)
+
 	logEntry := RequestLog{
 		Timestamp:             startTime,
 		Method:                r.Method,
@@ -1415,6 +1747,16 @@ func (g *Gateway) logRequest(r *http.Request, statusCode int, startTime time.Tim
 		UserAgent:             r.UserAgent(),
 		Error:                 errMsg,
 	}
+	if auth := authResultFromRequest(r); auth != nil {
+		logEntry.Consumer = auth.consumer
+	}
+	logEntry.Retries = retryCountFromRequest(r)
+	logEntry.CacheStatus = cacheStatusFromRequest(r)
+	if hit := wafHitFromRequest(r); hit != nil {
+		logEntry.WAFRule = hit.ruleID
+	}
+	logEntry.TraceID = traceIDFromRequest(r)
+	finishTrace(r, statusCode, routeName, routeID, serviceID, errMsg, allowTelemetry)
 
 	// Log to console if enabled
 	if g.config.AccessLogEnabled {
@@ -1435,29 +1777,6 @@ func (g *Gateway) isRouteObservabilityEnabled(route *Route) bool {
 	return *route.ObservabilityEnabled
 }
 
-// getClientIP extracts the client IP from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-
-	// Use RemoteAddr
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
-	return ip
-}
-
 // recordError increments the error counter
 func (g *Gateway) recordError() {
 	g.stats.mu.Lock()
@@ -1475,6 +1794,24 @@ func (g *Gateway) recordServiceError(serviceID string) {
 	g.stats.mu.Unlock()
 }
 
+// recordServiceRetry increments the retry counter of a service
+func (g *Gateway) recordServiceRetry(serviceID string) {
+	g.stats.mu.Lock()
+	if g.stats.serviceStats[serviceID] != nil {
+		g.stats.serviceStats[serviceID].retries++
+	}
+	g.stats.mu.Unlock()
+}
+
+// recordRetryBudgetExhausted counts retries skipped because the service's retry budget was spent
+func (g *Gateway) recordRetryBudgetExhausted(serviceID string) {
+	g.stats.mu.Lock()
+	if g.stats.serviceStats[serviceID] != nil {
+		g.stats.serviceStats[serviceID].retryBudgetExhausted++
+	}
+	g.stats.mu.Unlock()
+}
+
 // recordRateLimited increments the rate limited counter
 func (g *Gateway) recordRateLimited() {
 	g.stats.mu.Lock()
@@ -1482,6 +1819,17 @@ func (g *Gateway) recordRateLimited() {
 	g.stats.mu.Unlock()
 }
 
+// recordRouteRateLimited increments the rate limited counters for a route
+func (g *Gateway) recordRouteRateLimited(routeID string) {
+	g.stats.mu.Lock()
+	g.stats.rateLimited++
+	if g.stats.routeRateLimited == nil {
+		g.stats.routeRateLimited = make(map[string]int64)
+	}
+	g.stats.routeRateLimited[routeID]++
+	g.stats.mu.Unlock()
+}
+
 func (g *Gateway) getClientSecurityConfig() *ClientSecurityConfig {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
@@ -1495,7 +1843,7 @@ func (g *Gateway) getClientSecurityConfig() *ClientSecurityConfig {
 	return &cfg
 }
 
-func (g *Gateway) trackClientActivity(ip, path, routeID string, statusCode int, matchedRoute bool) {
+func (g *Gateway) trackClientActivity(ip, path, routeID string, statusCode int, matchedRoute bool, waf *wafHit) {
 	cfg := g.getClientSecurityConfig()
 	if cfg == nil || !cfg.TrackingEnabled || ip == "" {
 		return
@@ -1514,20 +1862,45 @@ func (g *Gateway) trackClientActivity(ip, path, routeID string, statusCode int,
 		tracker.consecutiveMisses++
 		tracker.totalMisses++
 	}
+	if waf != nil {
+		tracker.wafHits++
+		tracker.totalWAFHits++
+	}
+	duration := defaultAutoBlockDuration
+	if cfg.AutoBlockDurationSec > 0 {
+		duration = time.Duration(cfg.AutoBlockDurationSec) * time.Second
+	}
 	var autoBlockReason string
-	if !matchedRoute && cfg.AutoBlockEnabled && cfg.NoRouteThreshold > 0 && tracker.consecutiveMisses >= cfg.NoRouteThreshold {
-		duration := defaultAutoBlockDuration
-		if cfg.AutoBlockDurationSec > 0 {
-			duration = time.Duration(cfg.AutoBlockDurationSec) * time.Second
+	var blockedUntil time.Time
+	if cfg.AutoBlockEnabled {
+		if !matchedRoute && cfg.NoRouteThreshold > 0 && tracker.consecutiveMisses >= cfg.NoRouteThreshold {
+			autoBlockReason = fmt.Sprintf("blocked after %d unmatched requests", tracker.consecutiveMisses)
+		} else if waf != nil && cfg.WAFHitThreshold > 0 && tracker.wafHits >= cfg.WAFHitThreshold {
+			autoBlockReason = fmt.Sprintf("blocked after %d requests matched by the WAF", tracker.wafHits)
+		}
+		if policy, count := evaluateAutoBlockPolicies(tracker, cfg.Policies, statusCode, waf, now); policy != nil && autoBlockReason == "" {
+			autoBlockReason = policy.reason(count)
+			if policy.DurationSec > 0 {
+				duration = time.Duration(policy.DurationSec) * time.Second
+			}
 		}
-		autoBlockReason = fmt.Sprintf("blocked after %d unmatched requests", tracker.consecutiveMisses)
-		if !g.autoBlockClientLocked(tracker, duration, autoBlockReason) {
-			autoBlockReason = ""
+		if autoBlockReason != "" {
+			if g.autoBlockClientLocked(tracker, cfg, duration, autoBlockReason) {
+				blockedUntil = tracker.blockedUntil
+				tracker.sharedWithDNS = cfg.ShareWithDNS
+			} else {
+				autoBlockReason = ""
+			}
 		}
 	}
 	g.clientStatsMu.Unlock()
 	if autoBlockReason != "" {
-		log.Printf("API Gateway: Auto-blocked client %s (%s)", ip, autoBlockReason)
+		log.Printf("API Gateway: Auto-blocked client %s until %s (%s)", ip, blockedUntil.Format(time.RFC3339), autoBlockReason)
+		if cfg.ShareWithDNS {
+			if err := shareDNSBan(ip, autoBlockReason, blockedUntil); err != nil {
+				log.Printf("API Gateway: failed to share block of %s with the DNS server: %v", ip, err)
+			}
+		}
 	}
 }
 
@@ -1559,7 +1932,9 @@ func (g *Gateway) evictOldestClientLocked() {
 	}
 }
 
-func (g *Gateway) autoBlockClientLocked(tracker *clientStatsTracker, duration time.Duration, reason string) bool {
+// autoBlockClientLocked blocks a client for the base duration, escalated for repeat
+// offenders. Manually blocked, already blocked and allow-listed clients are left alone.
+func (g *Gateway) autoBlockClientLocked(tracker *clientStatsTracker, cfg *ClientSecurityConfig, duration time.Duration, reason string) bool {
 	now := time.Now()
 	if tracker.manualBlocked {
 		return false
@@ -1567,13 +1942,29 @@ func (g *Gateway) autoBlockClientLocked(tracker *clientStatsTracker, duration ti
 	if !tracker.blockedUntil.IsZero() && tracker.blockedUntil.After(now) {
 		return false
 	}
+	tracker.consecutiveMisses = 0
+	tracker.wafHits = 0
+	tracker.policyWindows = nil
+	if !autoBlockAllowed(cfg, tracker.ip) {
+		return false
+	}
 	if duration <= 0 {
 		duration = defaultAutoBlockDuration
 	}
+	if now.After(tracker.offensesExpire) {
+		tracker.offenses = 0
+	}
+	tracker.offenses++
+	duration = escalatedBlockDuration(duration, tracker.offenses, cfg.Escalation)
+
+	forget := defaultEscalationForget
+	if cfg.Escalation != nil && cfg.Escalation.ForgetAfterSec > 0 {
+		forget = time.Duration(cfg.Escalation.ForgetAfterSec) * time.Second
+	}
 	tracker.blockedAt = now
 	tracker.blockedUntil = now.Add(duration)
 	tracker.blockReason = reason
-	tracker.consecutiveMisses = 0
+	tracker.offensesExpire = tracker.blockedUntil.Add(forget)
 	return true
 }
 
@@ -1673,6 +2064,7 @@ func (g *Gateway) ManualUnblockClient(ip string) error {
 	if changed {
 		g.applyManualBlocks()
 	}
+	sharedWithDNS := false
 	g.clientStatsMu.Lock()
 	if tracker, ok := g.clientStats[ip]; ok {
 		tracker.manualBlocked = false
@@ -1680,8 +2072,17 @@ func (g *Gateway) ManualUnblockClient(ip string) error {
 		tracker.blockedUntil = time.Time{}
 		tracker.blockedAt = time.Time{}
 		tracker.consecutiveMisses = 0
+		tracker.policyWindows = nil
+		tracker.offenses = 0
+		sharedWithDNS = tracker.sharedWithDNS
+		tracker.sharedWithDNS = false
 	}
 	g.clientStatsMu.Unlock()
+	if sharedWithDNS {
+		if err := liftDNSBan(ip); err != nil {
+			log.Printf("API Gateway: failed to lift DNS ban of %s: %v", ip, err)
+		}
+	}
 	return nil
 }
 
@@ -1707,6 +2108,8 @@ func (g *Gateway) getTopClients(limit int) []ClientStats {
 			LastStatus:        tracker.lastStatus,
 			ConsecutiveMisses: tracker.consecutiveMisses,
 			TotalMisses:       tracker.totalMisses,
+			WAFHits:           tracker.totalWAFHits,
+			Offenses:          tracker.offenses,
 			Blocked:           blocked,
 			BlockedUntil:      tracker.blockedUntil,
 			BlockedReason:     tracker.blockReason,
@@ -1786,10 +2189,15 @@ func (g *Gateway) GetStats() GatewayStats {
 			svcAvgLatency = float64(stats.totalLatency) / float64(stats.requests)
 		}
 		serviceStats = append(serviceStats, ServiceStats{
-			ServiceID:      serviceID,
-			Requests:       stats.requests,
-			Errors:         stats.errors,
-			AverageLatency: svcAvgLatency,
+			ServiceID:            serviceID,
+			Requests:             stats.requests,
+			Errors:               stats.errors,
+			Retries:              stats.retries,
+			ServerErrors:         stats.serverErrors,
+			MirroredRequests:     stats.mirrored,
+			MirrorErrors:         stats.mirrorErrors,
+			RetryBudgetExhausted: stats.retryBudgetExhausted,
+			AverageLatency:       svcAvgLatency,
 		})
 	}
 
@@ -1803,7 +2211,24 @@ func (g *Gateway) GetStats() GatewayStats {
 		RateLimitStats: RateLimitStats{
 			TotalLimited: g.stats.rateLimited,
 		},
+		CacheStats: g.cacheStats(),
+		WAFStats: WAFStats{
+			Detected: g.stats.wafDetected,
+			Blocked:  g.stats.wafBlocked,
+		},
 	}
+	for routeID, limited := range g.stats.routeRateLimited {
+		stats.RateLimitStats.Routes = append(stats.RateLimitStats.Routes, RouteRateLimitStats{
+			RouteID: routeID,
+			Limited: limited,
+		})
+	}
+	for ruleID, hits := range g.stats.wafRuleHits {
+		stats.WAFStats.Rules = append(stats.WAFStats.Rules, WAFRuleStats{RuleID: ruleID, Hits: hits})
+	}
+	sort.Slice(stats.WAFStats.Rules, func(i, j int) bool {
+		return stats.WAFStats.Rules[i].Hits > stats.WAFStats.Rules[j].Hits
+	})
 	if cfg := g.getClientSecurityConfig(); cfg != nil && cfg.TrackingEnabled {
 		stats.TopClients = g.getTopClients(cfg.TopClientLimit)
 		stats.BlockedClients = g.getBlockedClients()
@@ -1816,15 +2241,40 @@ func (g *Gateway) GetServiceHealth() []ServiceHealth {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 
+	now := time.Now()
 	health := make([]ServiceHealth, 0, len(g.serviceHealth))
 	for _, h := range g.serviceHealth {
-		health = append(health, *h)
+		entry := *h
+		entry.Targets = append([]TargetHealth(nil), h.Targets...)
+		if svc := g.services[h.ServiceID]; svc != nil {
+			entry.Circuit = g.balancerFor(svc).circuitStatus(now)
+		}
+		health = append(health, entry)
+	}
+	// Services without active health checks still report their circuit breaker
+	for id, svc := range g.services {
+		if g.serviceHealth[id] != nil || svc.CircuitBreaker == nil || !svc.CircuitBreaker.Enabled {
+			continue
+		}
+		circuit := g.balancerFor(svc).circuitStatus(now)
+		health = append(health, ServiceHealth{
+			ServiceID: id,
+			Healthy:   circuit == nil || circuit.State != circuitOpen,
+			Circuit:   circuit,
+		})
 	}
 	return health
 }
 
 // AddService adds a new service to the gateway
 func (g *Gateway) AddService(service Service) error {
+	if err := validateServiceProxyProtocol(&service); err != nil {
+		return err
+	}
+	if service.ReadOnly || service.Provider != "" {
+		return errDiscoveredEntry
+	}
+
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
@@ -1835,21 +2285,40 @@ func (g *Gateway) AddService(service Service) error {
 		}
 	}
 
-	g.config.Services = append(g.config.Services, service)
-	g.services[service.ID] = &g.config.Services[len(g.config.Services)-1]
+	if err := g.changeConfigLocked(func(c *GatewayConfig) { c.Services = append(c.Services, service) }); err != nil {
+		return err
+	}
+	g.publishServicesLocked()
+	g.resetBalancer(service.ID)
+	g.resetTransport(service.ID)
 
 	return g.saveConfigLocked()
 }
 
 // UpdateService updates an existing service
 func (g *Gateway) UpdateService(service Service) error {
+	if err := validateServiceProxyProtocol(&service); err != nil {
+		return err
+	}
+	if service.ReadOnly || service.Provider != "" {
+		return errDiscoveredEntry
+	}
+
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
 	for i, svc := range g.config.Services {
 		if svc.ID == service.ID {
-			g.config.Services[i] = service
-			g.services[service.ID] = &g.config.Services[i]
+			if svc.ReadOnly {
+				return fmt.Errorf("service %s is managed by the %s provider and is read-only", svc.ID, svc.Provider)
+			}
+			if err := g.changeConfigLocked(func(c *GatewayConfig) { c.Services[i] = service }); err != nil {
+				return err
+			}
+			previous := g.services
+			g.publishServicesLocked()
+			g.refreshBalancers(previous)
+			g.refreshTransports(previous)
 			return g.saveConfigLocked()
 		}
 	}
@@ -1864,9 +2333,17 @@ func (g *Gateway) DeleteService(serviceID string) error {
 
 	for i, svc := range g.config.Services {
 		if svc.ID == serviceID {
-			g.config.Services = append(g.config.Services[:i], g.config.Services[i+1:]...)
-			delete(g.services, serviceID)
+			if svc.ReadOnly {
+				return fmt.Errorf("service %s is managed by the %s provider and is read-only", svc.ID, svc.Provider)
+			}
+			if err := g.changeConfigLocked(func(c *GatewayConfig) { c.Services = slices.Delete(c.Services, i, i+1) }); err != nil {
+				return err
+			}
+			g.publishServicesLocked()
 			delete(g.serviceHealth, serviceID)
+			g.resetBalancer(serviceID)
+			g.resetTransport(serviceID)
+			g.dropRetryBudget(serviceID)
 			return g.saveConfigLocked()
 		}
 	}
@@ -1876,9 +2353,32 @@ func (g *Gateway) DeleteService(serviceID string) error {
 
 // AddRoute adds a new route to the gateway
 func (g *Gateway) AddRoute(route Route) error {
+	if err := validateRouteTransform(&route); err != nil {
+		return err
+	}
+	if err := validateRouteAction(&route); err != nil {
+		return err
+	}
+	if err := validateForwardAuth(&route); err != nil {
+		return err
+	}
+	if err := validateRouteOIDC(&route); err != nil {
+		return err
+	}
+	if err := validateRouteWAF(&route); err != nil {
+		return err
+	}
+	if route.ReadOnly || route.Provider != "" {
+		return errDiscoveredEntry
+	}
+
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	if err := g.validateRouteAccessLocked(&route); err != nil {
+		return err
+	}
+
 	// Check for duplicate ID
 	for _, r := range g.config.Routes {
 		if r.ID == route.ID {
@@ -1886,7 +2386,9 @@ func (g *Gateway) AddRoute(route Route) error {
 		}
 	}
 
-	g.config.Routes = append(g.config.Routes, route)
+	if err := g.changeConfigLocked(func(c *GatewayConfig) { c.Routes = append(c.Routes, route) }); err != nil {
+		return err
+	}
 	g.refreshRoutes()
 
 	return g.saveConfigLocked()
@@ -1894,14 +2396,42 @@ func (g *Gateway) AddRoute(route Route) error {
 
 // UpdateRoute updates an existing route
 func (g *Gateway) UpdateRoute(route Route) error {
+	if err := validateRouteTransform(&route); err != nil {
+		return err
+	}
+	if err := validateRouteAction(&route); err != nil {
+		return err
+	}
+	if err := validateForwardAuth(&route); err != nil {
+		return err
+	}
+	if err := validateRouteOIDC(&route); err != nil {
+		return err
+	}
+	if err := validateRouteWAF(&route); err != nil {
+		return err
+	}
+	if route.ReadOnly || route.Provider != "" {
+		return errDiscoveredEntry
+	}
+
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	if err := g.validateRouteAccessLocked(&route); err != nil {
+		return err
+	}
+
 	for i, r := range g.config.Routes {
 		if r.ID == route.ID {
-			g.config.Routes[i] = route
+			if r.ReadOnly {
+				return fmt.Errorf("route %s is managed by the %s provider and is read-only", r.ID, r.Provider)
+			}
+			if err := g.changeConfigLocked(func(c *GatewayConfig) { c.Routes[i] = route }); err != nil {
+				return err
+			}
 			g.refreshRoutes()
-			g.clearRouteCache()
+			g.PurgeCache(route.ID, "", "")
 			return g.saveConfigLocked()
 		}
 	}
@@ -1916,8 +2446,14 @@ func (g *Gateway) DeleteRoute(routeID string) error {
 
 	for i, r := range g.config.Routes {
 		if r.ID == routeID {
-			g.config.Routes = append(g.config.Routes[:i], g.config.Routes[i+1:]...)
+			if r.ReadOnly {
+				return fmt.Errorf("route %s is managed by the %s provider and is read-only", r.ID, r.Provider)
+			}
+			if err := g.changeConfigLocked(func(c *GatewayConfig) { c.Routes = slices.Delete(c.Routes, i, i+1) }); err != nil {
+				return err
+			}
 			g.refreshRoutes()
+			g.PurgeCache(routeID, "", "")
 			return g.saveConfigLocked()
 		}
 	}
@@ -1937,7 +2473,7 @@ func (g *Gateway) ListUDPRoutes() []UDPRoute {
 	return out
 }
 
-// AddUDPRoute adds a new UDP route and restarts the gateway if running.
+// AddUDPRoute adds a new UDP route; a running gateway starts its listener.
 func (g *Gateway) AddUDPRoute(route UDPRoute) error {
 	g.mu.RLock()
 	for _, r := range g.config.UDPRoutes {
@@ -1959,7 +2495,7 @@ func (g *Gateway) AddUDPRoute(route UDPRoute) error {
 	return g.UpdateConfig(&cfgCopy)
 }
 
-// RemoveUDPRoute removes a UDP route by ID and restarts the gateway if running.
+// RemoveUDPRoute removes a UDP route by ID and closes its listener.
 func (g *Gateway) RemoveUDPRoute(routeID string) error {
 	g.mu.RLock()
 	for i, r := range g.config.UDPRoutes {
@@ -1986,7 +2522,7 @@ func (g *Gateway) ListTCPRoutes() []TCPRoute {
 	return out
 }
 
-// AddTCPRoute adds a new TCP route and restarts the gateway if running.
+// AddTCPRoute adds a new TCP route; a running gateway starts its listener.
 func (g *Gateway) AddTCPRoute(route TCPRoute) error {
 	g.mu.RLock()
 	for _, r := range g.config.TCPRoutes {
@@ -2008,7 +2544,7 @@ func (g *Gateway) AddTCPRoute(route TCPRoute) error {
 	return g.UpdateConfig(&cfgCopy)
 }
 
-// RemoveTCPRoute removes a TCP route by ID and restarts the gateway if running.
+// RemoveTCPRoute removes a TCP route by ID and closes its listener.
 func (g *Gateway) RemoveTCPRoute(routeID string) error {
 	g.mu.RLock()
 	for i, r := range g.config.TCPRoutes {
@@ -2023,15 +2559,16 @@ func (g *Gateway) RemoveTCPRoute(routeID string) error {
 	return fmt.Errorf("TCP route with ID %s not found", routeID)
 }
 
-// refreshRoutes rebuilds and sorts the routes slice (must be called with lock held)
+// refreshRoutes publishes a new route snapshot and rebuilds the per-route state of routes that were
+// removed or changed (must be called with lock held)
 func (g *Gateway) refreshRoutes() {
-	g.routes = make([]*Route, len(g.config.Routes))
-	for i := range g.config.Routes {
-		g.routes[i] = &g.config.Routes[i]
-	}
-	sort.Slice(g.routes, func(i, j int) bool {
-		return g.routes[i].Priority > g.routes[j].Priority
-	})
+	g.publishRoutesLocked()
+	g.refreshJWTVerifiers()
+	g.refreshForwardAuths()
+	g.refreshOIDCProviders()
+	g.refreshTransformers()
+	g.refreshAccessPolicies()
+	g.rebuildRouteLimiters()
 }
 
 // StartAll starts the gateway if configured to be enabled
@@ -2047,6 +2584,9 @@ func (g *Gateway) StartAll() {
 		GetCertificateRenewer(g).Start()
 	}
 
+	// Watch Docker for labeled containers if discovery is enabled
+	g.reconcileDockerDiscovery()
+
 	// Start telemetry exporter if observability is enabled
 	if g.config.Observability != nil && g.config.Observability.Enabled {
 		exporter := GetTelemetryExporter()
@@ -2056,31 +2596,49 @@ func (g *Gateway) StartAll() {
 }
 
 // Validate validates a request manually for testing
-func (g *Gateway) Validate(method, path, host string, headers map[string]string) (*Route, *Service, error) {
+func (g *Gateway) Validate(method, path, host string, headers map[string]string) (*Route, *Service, *UpstreamRequest, error) {
 	// Create a mock request
 	req, err := http.NewRequest(method, "http://"+host+path, nil)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	req.Host = host
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
+	req = withRequestID(req)
 
 	route := g.matchRoute(req)
 	if route == nil {
-		return nil, nil, fmt.Errorf("no matching route")
+		return nil, nil, nil, fmt.Errorf("no matching route")
 	}
 
-	g.mu.RLock()
-	service := g.services[route.ServiceID]
-	g.mu.RUnlock()
+	if routeActionAnswers(route, req) {
+		// answered by the gateway, nothing is sent upstream
+		return route, nil, nil, nil
+	}
 
+	service, _ := g.selectService(req, route)
 	if service == nil {
-		return route, nil, fmt.Errorf("service not found")
+		return route, nil, nil, fmt.Errorf("service not found")
 	}
 
-	return route, service, nil
+	// Preview the upstream request against the first target without touching balancer state
+	targets := service.upstreamTargets()
+	target := &url.URL{Scheme: service.upstreamScheme(), Host: targetAddress(targets[0].Host, targets[0].Port)}
+	out := req.Clone(req.Context())
+	directUpstreamRequest(out, req, route, service, target, g.transformerFor(route))
+
+	upstream := &UpstreamRequest{
+		Method:  out.Method,
+		URL:     out.URL.String(),
+		Host:    out.Host,
+		Headers: make(map[string]string, len(out.Header)),
+	}
+	for name, values := range out.Header {
+		upstream.Headers[name] = strings.Join(values, ", ")
+	}
+	return route, service, upstream, nil
 }
 
 // HealthCheckNow triggers an immediate health check for a service
@@ -2141,48 +2699,116 @@ type bodyLogInfo struct {
 	size      int64
 }
 
-func captureRequestBody(r *http.Request, limit int) (bodyLogInfo, error) {
+// requestBodyTee streams the request body to the upstream unbuffered, keeping only the first
+// limit bytes for the access log. Only bytes the upstream actually read are logged.
+type requestBodyTee struct {
+	io.ReadCloser
+	limit         int
+	skip          bool
+	contentLength int64
+
+	mu   sync.Mutex
+	head bytes.Buffer
+	read int64
+}
+
+// teeRequestBody replaces r.Body with a tee; the returned tee also works for requests without a body
+func teeRequestBody(r *http.Request, limit int, skipTypes []string) *requestBodyTee {
+	t := &requestBodyTee{limit: limit, contentLength: r.ContentLength, skip: skipBodyLog(r.Header.Get("Content-Type"), skipTypes)}
 	if r.Body == nil || r.Body == http.NoBody {
-		return bodyLogInfo{}, nil
-	}
-	bodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
-		return bodyLogInfo{}, err
+		return t
 	}
-	_ = r.Body.Close()
-	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-	r.ContentLength = int64(len(bodyBytes))
-	if r.GetBody != nil {
-		copyBytes := append([]byte(nil), bodyBytes...)
-		r.GetBody = func() (io.ReadCloser, error) {
-			return io.NopCloser(bytes.NewReader(copyBytes)), nil
+	t.ReadCloser = r.Body
+	r.Body = t
+	return t
+}
+
+func (t *requestBodyTee) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.mu.Lock()
+		t.read += int64(n)
+		if !t.skip {
+			if remaining := t.limit - t.head.Len(); remaining > 0 {
+				t.head.Write(p[:min(n, remaining)])
+			}
 		}
+		t.mu.Unlock()
 	}
-	return bodyLogInfoFromBytes(bodyBytes, limit), nil
+	return n, err
 }
 
-func bodyLogInfoFromBytes(data []byte, limit int) bodyLogInfo {
-	if len(data) == 0 {
-		return bodyLogInfo{}
+// LogInfo returns what was seen of the body so far
+func (t *requestBodyTee) LogInfo() bodyLogInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	size := max(t.read, t.contentLength, 0)
+	return bodyLogInfo{
+		body:      t.head.String(),
+		truncated: !t.skip && size > int64(t.head.Len()) && t.head.Len() >= t.limit,
+		size:      size,
 	}
-	truncated := limit > 0 && len(data) > limit
-	snippet := data
-	if truncated {
-		snippet = data[:limit]
+}
+
+// skipBodyLog reports whether bodies of contentType are excluded from logging. Entries match
+// the media type exactly or, when ending in "/", as a prefix.
+func skipBodyLog(contentType string, skipTypes []string) bool {
+	if contentType == "" || len(skipTypes) == 0 {
+		return false
 	}
-	return bodyLogInfo{
-		body:      string(snippet),
-		truncated: truncated,
-		size:      int64(len(data)),
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	for _, t := range skipTypes {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == mediaType || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
 	}
+	return false
+}
+
+// bodyLogSkipTypes returns the content types whose bodies are not logged
+func (g *Gateway) bodyLogSkipTypes() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.config.BodyLogSkipTypes
 }
 
+// bufferBody reads up to limit bytes of body so the body can be replayed. When the whole body
+// fits it is closed and complete is true; otherwise rest yields the bytes read so far followed
+// by the remainder of the stream.
+func bufferBody(body io.ReadCloser, limit int64) (data []byte, rest io.ReadCloser, complete bool, err error) {
+	data, err = io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		body.Close()
+		return nil, nil, false, err
+	}
+	if int64(len(data)) > limit {
+		return nil, struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), body), body}, false, nil
+	}
+	body.Close()
+	return data, nil, true, nil
+}
+
+// errorBody is a request body that fails every read with err
+type errorBody struct {
+	err error
+}
+
+func (b errorBody) Read([]byte) (int, error) { return 0, b.err }
+func (b errorBody) Close() error             { return nil }
+
 type loggingResponseWriter struct {
 	http.ResponseWriter
 	body         bytes.Buffer
 	limit        int
 	statusCode   int
 	bytesWritten int64
+	skipTypes    []string
+	skipBody     bool
 }
 
 func newLoggingResponseWriter(w http.ResponseWriter, limit int) *loggingResponseWriter {
@@ -2190,17 +2816,24 @@ func newLoggingResponseWriter(w http.ResponseWriter, limit int) *loggingResponse
 }
 
 func (lrw *loggingResponseWriter) WriteHeader(code int) {
+	if lrw.statusCode == 0 {
+		lrw.skipBody = skipBodyLog(lrw.Header().Get("Content-Type"), lrw.skipTypes)
+	}
 	lrw.statusCode = code
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
 func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
 	if lrw.statusCode == 0 {
+		lrw.skipBody = skipBodyLog(lrw.Header().Get("Content-Type"), lrw.skipTypes)
 		lrw.statusCode = http.StatusOK
 	}
-	if lrw.limit <= 0 {
+	switch {
+	case lrw.skipBody:
+		// Counted only
+	case lrw.limit <= 0:
 		lrw.body.Write(b)
-	} else {
+	default:
 		remaining := lrw.limit - lrw.body.Len()
 		if remaining > 0 {
 			copyLen := remaining
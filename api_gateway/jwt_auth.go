@@ -0,0 +1,542 @@
+package api_gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	jwksCacheTTL          = 10 * time.Minute
+	jwksMinRefreshDelay   = 30 * time.Second
+	jwksFileCheckInterval = time.Second
+	jwksMaxBytes          = 1 << 20
+)
+
+var defaultJWTAlgorithms = []string{"HS256", "RS256", "ES256"}
+
+// jwtVerifier validates bearer tokens for a single route
+type jwtVerifier struct {
+	cfg       JWTAuthConfig
+	parser    *jwt.Parser
+	mu        sync.Mutex
+	pemKey    interface{}
+	pemMtime  time.Time
+	jwks      map[string]interface{} // kid -> public key
+	jwksAnon  []interface{}          // keys without kid
+	jwksMtime time.Time              // JWKSFile modification time
+	jwksFetch time.Time              // last JWKSURL fetch or JWKSFile check
+	jwksLoad  chan struct{}          // closed when the JWKS load in flight ends
+	jwksErr   error                  // result of the last JWKS load
+	client    *http.Client
+}
+
+func newJWTVerifier(cfg JWTAuthConfig) *jwtVerifier {
+	algs := cfg.Algorithms
+	if len(algs) == 0 {
+		algs = defaultJWTAlgorithms
+	}
+	opts := []jwt.ParserOption{jwt.WithValidMethods(algs)}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.LeewaySec > 0 {
+		opts = append(opts, jwt.WithLeeway(time.Duration(cfg.LeewaySec)*time.Second))
+	}
+	if !cfg.AllowMissingExp {
+		opts = append(opts, jwt.WithExpirationRequired())
+	}
+	return &jwtVerifier{
+		cfg:    cfg,
+		parser: jwt.NewParser(opts...),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// verify parses and validates the token, returning its claims.
+func (v *jwtVerifier) verify(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := v.parser.ParseWithClaims(tokenString, claims, v.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("token is invalid")
+	}
+	if len(v.cfg.Audience) > 0 {
+		aud, _ := claims.GetAudience()
+		if !audienceMatches(aud, v.cfg.Audience) {
+			return nil, errors.New("token has invalid audience")
+		}
+	}
+	return claims, nil
+}
+
+func audienceMatches(tokenAud, allowed []string) bool {
+	for _, a := range tokenAud {
+		for _, b := range allowed {
+			if a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keyFunc resolves the verification key for a token based on its alg and kid headers.
+func (v *jwtVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if v.cfg.Secret == "" {
+			return nil, errors.New("no HMAC secret configured")
+		}
+		return []byte(v.cfg.Secret), nil
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+	default:
+		return nil, fmt.Errorf("unsupported signing method %s", token.Method.Alg())
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if v.cfg.JWKSFile != "" || v.cfg.JWKSURL != "" {
+		key, err := v.jwksKey(kid, token.Method)
+		if err == nil || v.cfg.PublicKeyFile == "" {
+			return key, err
+		}
+	}
+	if v.cfg.PublicKeyFile != "" {
+		return v.pemPublicKey()
+	}
+	return nil, errors.New("no public key configured")
+}
+
+func (v *jwtVerifier) pemPublicKey() (interface{}, error) {
+	info, err := os.Stat(v.cfg.PublicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("public key file: %w", err)
+	}
+
+	v.mu.Lock()
+	key, mtime := v.pemKey, v.pemMtime
+	v.mu.Unlock()
+	if key != nil && info.ModTime().Equal(mtime) {
+		return key, nil
+	}
+
+	// The file is read without holding v.mu
+	data, err := os.ReadFile(v.cfg.PublicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("public key file: %w", err)
+	}
+	if key, err = parsePEMPublicKey(data); err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	v.pemKey, v.pemMtime = key, info.ModTime()
+	v.mu.Unlock()
+	return key, nil
+}
+
+// parsePEMPublicKey accepts PKIX public keys, PKCS#1 RSA public keys and certificates.
+func parsePEMPublicKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("public key file: no PEM block found")
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
+
+func (v *jwtVerifier) jwksKey(kid string, method jwt.SigningMethod) (interface{}, error) {
+	if err := v.refreshJWKS(false); err != nil && !v.hasJWKS() {
+		return nil, err
+	}
+	if key := v.lookupJWKS(kid, method); key != nil {
+		return key, nil
+	}
+	// Unknown kid: the issuer may have rotated keys, refetch once (rate limited)
+	if err := v.refreshJWKS(true); err != nil {
+		return nil, err
+	}
+	if key := v.lookupJWKS(kid, method); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no JWKS key found for kid %q", kid)
+}
+
+func (v *jwtVerifier) hasJWKS() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.jwks != nil
+}
+
+func (v *jwtVerifier) lookupJWKS(kid string, method jwt.SigningMethod) interface{} {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.lookupJWKSLocked(kid, method)
+}
+
+func (v *jwtVerifier) lookupJWKSLocked(kid string, method jwt.SigningMethod) interface{} {
+	if kid != "" {
+		if key, ok := v.jwks[kid]; ok && keyMatchesMethod(key, method) {
+			return key
+		}
+		return nil
+	}
+	for _, key := range v.jwksAnon {
+		if keyMatchesMethod(key, method) {
+			return key
+		}
+	}
+	for _, key := range v.jwks {
+		if keyMatchesMethod(key, method) {
+			return key
+		}
+	}
+	return nil
+}
+
+func keyMatchesMethod(key interface{}, method jwt.SigningMethod) bool {
+	switch method.(type) {
+	case *jwt.SigningMethodRSA:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		_, ok := key.(*ecdsa.PublicKey)
+		return ok
+	}
+	return false
+}
+
+// jwksStaleLocked reports whether the key set must be reloaded. A JWKSFile is checked for changes
+// at most every jwksFileCheckInterval; a JWKSURL is refetched after jwksCacheTTL, or after
+// jwksMinRefreshDelay when forced by an unknown kid.
+func (v *jwtVerifier) jwksStaleLocked(force bool, now time.Time) bool {
+	if v.jwks == nil {
+		return true
+	}
+	age := now.Sub(v.jwksFetch)
+	switch {
+	case v.cfg.JWKSFile != "":
+		return age >= jwksFileCheckInterval
+	case force:
+		return age >= jwksMinRefreshDelay
+	default:
+		return age >= jwksCacheTTL
+	}
+}
+
+// refreshJWKS reloads the key set when it is stale. The file is read or the URL fetched without
+// holding v.mu; requests arriving while a load is in flight wait for it and share its result.
+func (v *jwtVerifier) refreshJWKS(force bool) error {
+	now := time.Now()
+	v.mu.Lock()
+	if !v.jwksStaleLocked(force, now) {
+		v.mu.Unlock()
+		return nil
+	}
+	if load := v.jwksLoad; load != nil {
+		v.mu.Unlock()
+		<-load
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		return v.jwksErr
+	}
+	load := make(chan struct{})
+	v.jwksLoad = load
+	mtime := v.jwksMtime
+	if v.jwks == nil {
+		mtime = time.Time{}
+	}
+	v.mu.Unlock()
+
+	data, mtime, err := v.readJWKS(mtime)
+	var keys map[string]interface{}
+	var anon []interface{}
+	if err == nil && data != nil {
+		keys, anon, err = parseJWKS(data)
+	}
+
+	v.mu.Lock()
+	if err == nil {
+		if keys != nil {
+			v.jwks, v.jwksAnon = keys, anon
+		}
+		v.jwksMtime = mtime
+	}
+	if err == nil || v.cfg.JWKSFile != "" {
+		// File checks are rate limited even when they fail
+		v.jwksFetch = now
+	}
+	v.jwksErr = err
+	v.jwksLoad = nil
+	v.mu.Unlock()
+	close(load)
+	return err
+}
+
+// readJWKS returns the JWKS document from the file or URL. For a file whose modification time
+// is still mtime, data is nil.
+func (v *jwtVerifier) readJWKS(mtime time.Time) (data []byte, modTime time.Time, err error) {
+	if v.cfg.JWKSFile != "" {
+		info, err := os.Stat(v.cfg.JWKSFile)
+		if err != nil {
+			return nil, mtime, fmt.Errorf("jwks file: %w", err)
+		}
+		if info.ModTime().Equal(mtime) {
+			return nil, mtime, nil
+		}
+		data, err := os.ReadFile(v.cfg.JWKSFile)
+		if err != nil {
+			return nil, mtime, fmt.Errorf("jwks file: %w", err)
+		}
+		return data, info.ModTime(), nil
+	}
+
+	resp, err := v.client.Get(v.cfg.JWKSURL)
+	if err != nil {
+		return nil, mtime, fmt.Errorf("jwks fetch: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, mtime, fmt.Errorf("jwks fetch: %s", resp.Status)
+	}
+	data, err = io.ReadAll(io.LimitReader(resp.Body, jwksMaxBytes))
+	if err != nil {
+		return nil, mtime, fmt.Errorf("jwks fetch: %w", err)
+	}
+	return data, mtime, nil
+}
+
+type jwksDocument struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type jsonWebKey struct {
+	Kty string   `json:"kty"`
+	Kid string   `json:"kid"`
+	Use string   `json:"use"`
+	N   string   `json:"n"`
+	E   string   `json:"e"`
+	Crv string   `json:"crv"`
+	X   string   `json:"x"`
+	Y   string   `json:"y"`
+	X5c []string `json:"x5c"`
+}
+
+// parseJWKS returns the signing keys of a JWKS document by kid, and those without a kid
+func parseJWKS(data []byte) (map[string]interface{}, []interface{}, error) {
+	var doc jwksDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("jwks parse: %w", err)
+	}
+	keys := make(map[string]interface{})
+	var anon []interface{}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		if k.Kid == "" {
+			anon = append(anon, key)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, anon, nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	if len(k.X5c) > 0 {
+		der, err := base64.StdEncoding.DecodeString(k.X5c[0])
+		if err != nil {
+			return nil, err
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// jwtVerifierFor returns the cached verifier for a route, creating it on first use.
+func (g *Gateway) jwtVerifierFor(route *Route) *jwtVerifier {
+	g.jwtVerifiersMu.Lock()
+	defer g.jwtVerifiersMu.Unlock()
+	if g.jwtVerifiers == nil {
+		g.jwtVerifiers = make(map[string]*jwtVerifier)
+	}
+	v, ok := g.jwtVerifiers[route.ID]
+	if !ok {
+		cfg := JWTAuthConfig{}
+		if route.JWT != nil {
+			cfg = *route.JWT
+		}
+		v = newJWTVerifier(cfg)
+		g.jwtVerifiers[route.ID] = v
+	}
+	return v
+}
+
+// refreshJWTVerifiers drops the verifiers of routes that were removed or whose JWT settings changed;
+// the others keep their loaded keys (must be called with g.mu held after the routes are published)
+func (g *Gateway) refreshJWTVerifiers() {
+	g.jwtVerifiersMu.Lock()
+	defer g.jwtVerifiersMu.Unlock()
+
+	verifiers := make(map[string]*jwtVerifier)
+	for _, route := range g.routes {
+		if v, ok := g.jwtVerifiers[route.ID]; ok && route.JWT != nil && reflect.DeepEqual(v.cfg, *route.JWT) {
+			verifiers[route.ID] = v
+		}
+	}
+	g.jwtVerifiers = verifiers
+}
+
+// checkJWT validates the bearer token of the request against the route's JWT settings.
+func (g *Gateway) checkJWT(r *http.Request, route *Route) (*authResult, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, &authError{scheme: "Bearer", reason: "missing bearer token"}
+	}
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, &authError{scheme: "Bearer", code: "invalid_request", reason: "authorization header is not a bearer token"}
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+	if token == "" {
+		return nil, &authError{scheme: "Bearer", reason: "missing bearer token"}
+	}
+	if route.JWT == nil {
+		return nil, &authError{scheme: "Bearer", code: "invalid_token", reason: "no JWT verification configured for route"}
+	}
+
+	claims, err := g.jwtVerifierFor(route).verify(token)
+	if err != nil {
+		return nil, &authError{scheme: "Bearer", code: "invalid_token", reason: err.Error()}
+	}
+
+	result := &authResult{claims: claims}
+	if len(route.JWT.ClaimHeaders) > 0 {
+		result.headers = make(map[string]string, len(route.JWT.ClaimHeaders))
+		for claim, header := range route.JWT.ClaimHeaders {
+			if value, ok := lookupClaim(claims, claim); ok {
+				result.headers[header] = value
+			}
+		}
+	}
+	return result, nil
+}
+
+// lookupClaim resolves a claim by name; dotted names walk nested objects (e.g. "realm_access.roles").
+func lookupClaim(claims jwt.MapClaims, name string) (string, bool) {
+	var current interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(name, ".") {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		current, ok = obj[part]
+		if !ok {
+			return "", false
+		}
+	}
+	return claimString(current)
+}
+
+func claimString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := claimString(item); ok {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, ","), true
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(data), true
+	}
+}
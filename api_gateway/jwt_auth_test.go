@@ -0,0 +1,258 @@
+package api_gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signHS256(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	require.NoError(t, err)
+	return token
+}
+
+func TestJWTVerifierHS256Claims(t *testing.T) {
+	v := newJWTVerifier(JWTAuthConfig{Secret: "secret", Issuer: "redock", Audience: []string{"api"}})
+	now := time.Now()
+
+	valid := signHS256(t, "secret", jwt.MapClaims{"iss": "redock", "aud": "api", "exp": now.Add(time.Hour).Unix()})
+	_, err := v.verify(valid)
+	assert.NoError(t, err)
+
+	tests := map[string]jwt.MapClaims{
+		"expired":       {"iss": "redock", "aud": "api", "exp": now.Add(-time.Hour).Unix()},
+		"not yet valid": {"iss": "redock", "aud": "api", "nbf": now.Add(time.Hour).Unix()},
+		"wrong issuer":  {"iss": "other", "aud": "api", "exp": now.Add(time.Hour).Unix()},
+		"wrong aud":     {"iss": "redock", "aud": "web", "exp": now.Add(time.Hour).Unix()},
+		"no exp":        {"iss": "redock", "aud": "api"},
+	}
+	for name, claims := range tests {
+		_, err := v.verify(signHS256(t, "secret", claims))
+		assert.Error(t, err, name)
+	}
+
+	_, err = v.verify(signHS256(t, "wrong-secret", jwt.MapClaims{"iss": "redock", "aud": "api", "exp": now.Add(time.Hour).Unix()}))
+	assert.Error(t, err)
+
+	// tokens without exp only pass when the route allows them
+	lenient := newJWTVerifier(JWTAuthConfig{Secret: "secret", AllowMissingExp: true})
+	_, err = lenient.verify(signHS256(t, "secret", jwt.MapClaims{"sub": "1"}))
+	assert.NoError(t, err)
+	_, err = lenient.verify(signHS256(t, "secret", jwt.MapClaims{"sub": "1", "exp": now.Add(-time.Hour).Unix()}))
+	assert.Error(t, err)
+}
+
+func TestJWTVerifierRS256PEM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "pub.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "1", "exp": time.Now().Add(time.Hour).Unix()}).SignedString(key)
+	require.NoError(t, err)
+
+	_, err = newJWTVerifier(JWTAuthConfig{PublicKeyFile: path}).verify(token)
+	assert.NoError(t, err)
+
+	// RS256 is rejected when only HS256 is allowed
+	_, err = newJWTVerifier(JWTAuthConfig{PublicKeyFile: path, Algorithms: []string{"HS256"}}).verify(token)
+	assert.Error(t, err)
+}
+
+func TestJWTVerifierES256JWKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": "k1",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(key.PublicKey.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(key.PublicKey.Y.FillBytes(make([]byte, 32))),
+		}},
+	}
+	data, err := json.Marshal(jwks)
+	require.NoError(t, err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"sub": "1", "exp": time.Now().Add(time.Hour).Unix()})
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	_, err = newJWTVerifier(JWTAuthConfig{JWKSFile: path}).verify(signed)
+	assert.NoError(t, err)
+
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write(data)
+	}))
+	defer srv.Close()
+	v := newJWTVerifier(JWTAuthConfig{JWKSURL: srv.URL})
+	for i := 0; i < 3; i++ {
+		_, err = v.verify(signed)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, fetches)
+}
+
+func TestJWTVerifierJWKSLoads(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	jwks := func(kid string) []byte {
+		data, err := json.Marshal(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "EC",
+				"kid": kid,
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(key.PublicKey.X.FillBytes(make([]byte, 32))),
+				"y":   base64.RawURLEncoding.EncodeToString(key.PublicKey.Y.FillBytes(make([]byte, 32))),
+			}},
+		})
+		require.NoError(t, err)
+		return data
+	}
+	sign := func(kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"sub": "1", "exp": time.Now().Add(time.Hour).Unix()})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+
+	// concurrent requests share one fetch, which doesn't block other verifications
+	var fetches int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		w.Write(jwks("k1"))
+	}))
+	defer srv.Close()
+	v := newJWTVerifier(JWTAuthConfig{JWKSURL: srv.URL, Secret: "secret"})
+	errs := make(chan error, 5)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := v.verify(sign("k1"))
+			errs <- err
+		}()
+	}
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&fetches) == 1 }, time.Second, 5*time.Millisecond)
+	loaded := make(chan bool)
+	go func() { loaded <- v.hasJWKS() }()
+	select {
+	case has := <-loaded:
+		assert.False(t, has)
+	case <-time.After(time.Second):
+		t.Fatal("the verifier is locked during the fetch")
+	}
+	_, err = v.verify(signHS256(t, "secret", jwt.MapClaims{"sub": "1", "exp": time.Now().Add(time.Hour).Unix()}))
+	assert.NoError(t, err)
+	close(release)
+	for i := 0; i < cap(errs); i++ {
+		assert.NoError(t, <-errs)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// a JWKS file is checked for changes at most every jwksFileCheckInterval
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwks("k1"), 0600))
+	v = newJWTVerifier(JWTAuthConfig{JWKSFile: path})
+	_, err = v.verify(sign("k1"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, jwks("k2"), 0600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	_, err = v.verify(sign("k2"))
+	assert.ErrorContains(t, err, `no JWKS key found for kid "k2"`)
+	v.mu.Lock()
+	v.jwksFetch = v.jwksFetch.Add(-jwksFileCheckInterval)
+	v.mu.Unlock()
+	_, err = v.verify(sign("k2"))
+	assert.NoError(t, err)
+}
+
+func TestHandleRequestJWTRejectAndForwardClaims(t *testing.T) {
+	var gotUserID string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserID = r.Header.Get("X-User-Id")
+	}))
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+
+	route := &Route{
+		ID:           "r1",
+		ServiceID:    "backend",
+		Paths:        []string{"/"},
+		AuthRequired: true,
+		AuthType:     "jwt",
+		JWT:          &JWTAuthConfig{Secret: "secret", ClaimHeaders: map[string]string{"sub": "X-User-Id"}},
+		Enabled:      true,
+	}
+	g := &Gateway{
+		services: map[string]*Service{
+			"backend": {ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true},
+		},
+		routes:        []*Route{route},
+		serviceHealth: make(map[string]*ServiceHealth),
+		config:        &GatewayConfig{},
+		stats:         &gatewayStatsTracker{startTime: time.Now(), serviceStats: make(map[string]*serviceStatsTracker)},
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signHS256(t, "secret", jwt.MapClaims{"sub": "42", "exp": time.Now().Add(time.Hour).Unix()}))
+	req.Header.Set("X-User-Id", "spoofed")
+	rec = httptest.NewRecorder()
+	g.handleRequest(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "42", gotUserID)
+}
+
+func TestJWTVerifiersKeptForUnchangedRoutes(t *testing.T) {
+	g := NewGateway(t.TempDir())
+	require.NoError(t, g.AddService(Service{ID: "web", Host: "127.0.0.1", Port: 9000, Enabled: true}))
+	api := Route{ID: "api", ServiceID: "web", Paths: []string{"/api"}, AuthRequired: true, AuthType: "jwt", JWT: &JWTAuthConfig{Secret: "secret"}, Enabled: true}
+	require.NoError(t, g.AddRoute(api))
+	require.NoError(t, g.AddRoute(Route{ID: "other", ServiceID: "web", Paths: []string{"/other"}, Enabled: true}))
+
+	verifier := g.jwtVerifierFor(&api)
+	require.NoError(t, g.UpdateRoute(Route{ID: "other", ServiceID: "web", Paths: []string{"/other", "/more"}, Enabled: true}))
+	assert.Same(t, verifier, g.jwtVerifierFor(&api), "editing another route keeps the verifier")
+
+	api.JWT = &JWTAuthConfig{Secret: "rotated"}
+	require.NoError(t, g.UpdateRoute(api))
+	assert.NotSame(t, verifier, g.jwtVerifierFor(&api), "new JWT settings build a new verifier")
+
+	require.NoError(t, g.DeleteRoute("api"))
+	g.jwtVerifiersMu.Lock()
+	assert.NotContains(t, g.jwtVerifiers, "api")
+	g.jwtVerifiersMu.Unlock()
+}
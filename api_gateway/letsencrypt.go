@@ -160,18 +160,22 @@ func (r *CertificateRenewer) checkAndRenew() {
 		return
 	}
 
+	renewBeforeDays := config.LetsEncrypt.RenewBeforeDays
+	if renewBeforeDays <= 0 {
+		renewBeforeDays = 30 // Default: renew 30 days before expiry
+	}
+
+	if config.LetsEncrypt.PerDomain {
+		r.checkAndRenewPerDomain(config.LetsEncrypt, renewBeforeDays)
+		return
+	}
+
 	expiresAtStr := config.LetsEncrypt.ExpiresAt
 	if expiresAtStr == "" {
 		// Read expiry from cert file (e.g. after config load or restart)
-		certPath := config.TLSCertFile
-		if certPath != "" {
-			if data, err := os.ReadFile(certPath); err == nil {
-				block, _ := pem.Decode(data)
-				if block != nil {
-					if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
-						expiresAtStr = cert.NotAfter.Format(time.RFC3339)
-					}
-				}
+		if config.TLSCertFile != "" {
+			if notAfter, err := certificateExpiry(config.TLSCertFile); err == nil {
+				expiresAtStr = notAfter.Format(time.RFC3339)
 			}
 		}
 	}
@@ -185,11 +189,6 @@ func (r *CertificateRenewer) checkAndRenew() {
 		return
 	}
 
-	renewBeforeDays := config.LetsEncrypt.RenewBeforeDays
-	if renewBeforeDays <= 0 {
-		renewBeforeDays = 30 // Default: renew 30 days before expiry
-	}
-
 	renewAt := expiresAt.AddDate(0, 0, -renewBeforeDays)
 	if time.Now().Before(renewAt) {
 		log.Printf("API Gateway: Certificate valid until %s, renewal not needed yet", expiresAt.Format(time.RFC3339))
@@ -206,6 +205,24 @@ func (r *CertificateRenewer) checkAndRenew() {
 	}
 }
 
+// checkAndRenewPerDomain renews the per-domain certificates that are missing or due for renewal
+func (r *CertificateRenewer) checkAndRenewPerDomain(leConfig *LetsEncryptConfig, renewBeforeDays int) {
+	for _, domain := range leConfig.Domains {
+		domain = strings.TrimSpace(domain)
+		if domain == "" {
+			continue
+		}
+		certPath, _ := r.gateway.domainCertificatePaths(domain)
+		if expiresAt, err := certificateExpiry(certPath); err == nil && time.Now().Before(expiresAt.AddDate(0, 0, -renewBeforeDays)) {
+			continue
+		}
+		log.Printf("API Gateway: Certificate for %s is missing or due for renewal, requesting...", domain)
+		if err := r.gateway.RequestDomainCertificate(domain); err != nil {
+			log.Printf("API Gateway: Certificate renewal for %s failed: %v", domain, err)
+		}
+	}
+}
+
 // IsRunning returns whether the renewer is running
 func (r *CertificateRenewer) IsRunning() bool {
 	r.mu.Lock()
@@ -341,6 +358,10 @@ func (g *Gateway) requestCertificateWithLEConfig(leConfig *LetsEncryptConfig) er
 		return errors.New("email is required for Let's Encrypt")
 	}
 
+	if leConfig.PerDomain {
+		return g.requestPerDomainCertificates(leConfig)
+	}
+
 	log.Printf("API Gateway: Requesting Let's Encrypt certificate for domains: %v (production)", leConfig.Domains)
 
 	certPath := filepath.Join(g.workDir, "data", "tls.crt")
@@ -351,12 +372,8 @@ func (g *Gateway) requestCertificateWithLEConfig(leConfig *LetsEncryptConfig) er
 	}
 
 	expiresAt := time.Now().AddDate(0, 0, 90).Format(time.RFC3339)
-	if certData, err := os.ReadFile(certPath); err == nil {
-		if block, _ := pem.Decode(certData); block != nil {
-			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
-				expiresAt = cert.NotAfter.Format(time.RFC3339)
-			}
-		}
+	if notAfter, err := certificateExpiry(certPath); err == nil {
+		expiresAt = notAfter.Format(time.RFC3339)
 	}
 
 	g.mu.Lock()
@@ -373,15 +390,116 @@ func (g *Gateway) requestCertificateWithLEConfig(leConfig *LetsEncryptConfig) er
 	if err := g.SaveConfig(); err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
+	g.reloadCertificates(true)
 
 	log.Println("API Gateway: Let's Encrypt certificate obtained successfully")
 	return nil
 }
 
-// obtainCertificateViaACME runs the ACME flow (HTTP-01) and writes cert and key to the given paths.
-// Always uses Let's Encrypt production; staging is no longer configurable.
+// domainCertificatePaths returns where the per-domain certificate of a domain is stored
+func (g *Gateway) domainCertificatePaths(domain string) (string, string) {
+	name := strings.ReplaceAll(strings.ToLower(domain), "*", "_wildcard")
+	dir := g.certDir(certSourceLetsEncrypt)
+	return filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+}
+
+// requestPerDomainCertificates places one ACME order per configured domain. Failed domains
+// do not stop the others; their errors are returned together.
+func (g *Gateway) requestPerDomainCertificates(leConfig *LetsEncryptConfig) error {
+	var errs []error
+	for _, domain := range leConfig.Domains {
+		domain = strings.TrimSpace(domain)
+		if domain == "" {
+			continue
+		}
+		if err := g.obtainDomainCertificate(leConfig, domain); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", domain, err))
+		}
+	}
+	g.recordPerDomainCertificates(leConfig)
+	if err := g.SaveConfig(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to save config: %w", err))
+	}
+	g.reloadCertificates(true)
+	if len(errs) > 0 {
+		return fmt.Errorf("Let's Encrypt: %w", errors.Join(errs...))
+	}
+	log.Println("API Gateway: Let's Encrypt per-domain certificates obtained successfully")
+	return nil
+}
+
+// RequestDomainCertificate requests (or renews) the certificate of a single domain when
+// Let's Encrypt is configured with per-domain certificates.
+func (g *Gateway) RequestDomainCertificate(domain string) error {
+	config := g.GetConfig()
+	if config.LetsEncrypt == nil || !config.LetsEncrypt.Enabled {
+		return errors.New("Let's Encrypt is not enabled")
+	}
+	if !config.LetsEncrypt.PerDomain {
+		return errors.New("Let's Encrypt is not configured for per-domain certificates")
+	}
+	leConfig := *config.LetsEncrypt
+	if err := g.obtainDomainCertificate(&leConfig, domain); err != nil {
+		return fmt.Errorf("Let's Encrypt: %w", err)
+	}
+	g.recordPerDomainCertificates(&leConfig)
+	if err := g.SaveConfig(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	g.reloadCertificates(true)
+	return nil
+}
+
+func (g *Gateway) obtainDomainCertificate(leConfig *LetsEncryptConfig, domain string) error {
+	if leConfig.Email == "" {
+		return errors.New("email is required for Let's Encrypt")
+	}
+	log.Printf("API Gateway: Requesting Let's Encrypt certificate for %s (per-domain)", domain)
+	domainConfig := *leConfig
+	domainConfig.Domains = []string{domain}
+	certPath, keyPath := g.domainCertificatePaths(domain)
+	return obtainCertificateViaACME(g.workDir, &domainConfig, certPath, keyPath)
+}
+
+// recordPerDomainCertificates updates the Let's Encrypt status from the per-domain certificate files.
+// ExpiresAt is the earliest expiry so the status reflects the next certificate to renew.
+func (g *Gateway) recordPerDomainCertificates(leConfig *LetsEncryptConfig) {
+	var earliest time.Time
+	ready := false
+	for _, domain := range leConfig.Domains {
+		certPath, _ := g.domainCertificatePaths(strings.TrimSpace(domain))
+		notAfter, err := certificateExpiry(certPath)
+		if err != nil {
+			continue
+		}
+		ready = true
+		if earliest.IsZero() || notAfter.Before(earliest) {
+			earliest = notAfter
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if ready {
+		g.config.HTTPSEnabled = true
+	}
+	if g.config.LetsEncrypt != nil {
+		g.config.LetsEncrypt.CertificateReady = ready
+		g.config.LetsEncrypt.LastRenewAt = time.Now().Format(time.RFC3339)
+		if !earliest.IsZero() {
+			g.config.LetsEncrypt.ExpiresAt = earliest.Format(time.RFC3339)
+		}
+	}
+}
+
+// obtainCertificateViaACME runs the ACME flow (HTTP-01 or DNS-01) and writes cert and key to the given paths.
+// Uses Let's Encrypt production unless a directory URL (e.g. a local Pebble) is configured; staging is no longer configurable.
 func obtainCertificateViaACME(workDir string, cfg *LetsEncryptConfig, certPath, keyPath string) error {
 	dirURL := acme.LetsEncryptURL
+	if cfg.DirectoryURL != "" {
+		dirURL = cfg.DirectoryURL
+	}
+	challengeType := cfg.challengeType()
 
 	accountKey, err := loadOrCreateACMEAccountKey(workDir)
 	if err != nil {
@@ -408,12 +526,23 @@ func obtainCertificateViaACME(workDir string, cfg *LetsEncryptConfig, certPath,
 	domains := make([]string, 0, len(cfg.Domains))
 	for _, d := range cfg.Domains {
 		d = strings.TrimSpace(d)
-		if d != "" && !strings.Contains(d, "*") {
-			domains = append(domains, d)
+		if d == "" {
+			continue
 		}
+		if strings.Contains(d, "*") && challengeType != acmeChallengeDNS01 {
+			continue
+		}
+		domains = append(domains, d)
 	}
 	if len(domains) == 0 {
-		return errors.New("no valid non-wildcard domains (HTTP-01 does not support wildcards)")
+		return errors.New("no valid non-wildcard domains (HTTP-01 does not support wildcards; use dns-01)")
+	}
+
+	var solver dns01Solver
+	if challengeType == acmeChallengeDNS01 {
+		if solver, err = newDNS01Solver(cfg); err != nil {
+			return fmt.Errorf("dns-01 solver: %w", err)
+		}
 	}
 
 	// Create order
@@ -422,7 +551,7 @@ func obtainCertificateViaACME(workDir string, cfg *LetsEncryptConfig, certPath,
 		return fmt.Errorf("authorize order: %w", err)
 	}
 
-	// Fulfill HTTP-01 challenges for each authorization
+	// Fulfill the challenge of each authorization
 	for _, authURL := range order.AuthzURLs {
 		auth, err := acmeClient.GetAuthorization(ctx, authURL)
 		if err != nil {
@@ -431,30 +560,24 @@ func obtainCertificateViaACME(workDir string, cfg *LetsEncryptConfig, certPath,
 		if auth.Status == acme.StatusValid {
 			continue
 		}
-		var http01 *acme.Challenge
+		var challenge *acme.Challenge
 		for _, c := range auth.Challenges {
-			if c.Type == "http-01" {
-				http01 = c
+			if c.Type == challengeType {
+				challenge = c
 				break
 			}
 		}
-		if http01 == nil {
-			return fmt.Errorf("no http-01 challenge for %s", auth.Identifier.Value)
-		}
-		response, err := acmeClient.HTTP01ChallengeResponse(http01.Token)
-		if err != nil {
-			return fmt.Errorf("challenge response: %w", err)
+		if challenge == nil {
+			return fmt.Errorf("no %s challenge for %s", challengeType, auth.Identifier.Value)
 		}
-		SetACMEChallenge(http01.Token, response)
-		if _, err = acmeClient.Accept(ctx, http01); err != nil {
-			ClearACMEChallenge(http01.Token)
-			return fmt.Errorf("accept challenge: %w", err)
+		if challengeType == acmeChallengeDNS01 {
+			err = solveDNS01Challenge(ctx, acmeClient, cfg, solver, auth, challenge, authURL)
+		} else {
+			err = solveHTTP01Challenge(ctx, acmeClient, auth, challenge, authURL)
 		}
-		if _, err = acmeClient.WaitAuthorization(ctx, authURL); err != nil {
-			ClearACMEChallenge(http01.Token)
-			return fmt.Errorf("wait authorization %s: %w", auth.Identifier.Value, err)
+		if err != nil {
+			return err
 		}
-		ClearACMEChallenge(http01.Token)
 	}
 
 	// Wait for order to be ready
@@ -516,6 +639,47 @@ func obtainCertificateViaACME(workDir string, cfg *LetsEncryptConfig, certPath,
 	return keyFile.Close()
 }
 
+func solveHTTP01Challenge(ctx context.Context, acmeClient *acme.Client, auth *acme.Authorization, challenge *acme.Challenge, authURL string) error {
+	response, err := acmeClient.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return fmt.Errorf("challenge response: %w", err)
+	}
+	SetACMEChallenge(challenge.Token, response)
+	defer ClearACMEChallenge(challenge.Token)
+	if _, err = acmeClient.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("accept challenge: %w", err)
+	}
+	if _, err = acmeClient.WaitAuthorization(ctx, authURL); err != nil {
+		return fmt.Errorf("wait authorization %s: %w", auth.Identifier.Value, err)
+	}
+	return nil
+}
+
+// solveDNS01Challenge publishes the _acme-challenge TXT record, waits until the nameservers serve it
+// and removes it once the authorization is settled.
+func solveDNS01Challenge(ctx context.Context, acmeClient *acme.Client, cfg *LetsEncryptConfig, solver dns01Solver, auth *acme.Authorization, challenge *acme.Challenge, authURL string) error {
+	value, err := acmeClient.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return fmt.Errorf("challenge record: %w", err)
+	}
+	fqdn := challengeFQDN(auth.Identifier.Value)
+	if err := solver.Present(ctx, fqdn, value); err != nil {
+		return fmt.Errorf("create TXT record %s: %w", fqdn, err)
+	}
+	defer logDNS01CleanUp(solver, fqdn, value)
+
+	if err := waitForDNSPropagation(ctx, cfg, solver, fqdn, value); err != nil {
+		return fmt.Errorf("dns propagation: %w", err)
+	}
+	if _, err = acmeClient.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("accept challenge: %w", err)
+	}
+	if _, err = acmeClient.WaitAuthorization(ctx, authURL); err != nil {
+		return fmt.Errorf("wait authorization %s: %w", auth.Identifier.Value, err)
+	}
+	return nil
+}
+
 func loadOrCreateACMEAccountKey(workDir string) (crypto.Signer, error) {
 	keyPath := filepath.Join(workDir, "data", "acme_account.key")
 	if data, err := os.ReadFile(keyPath); err == nil {
@@ -640,6 +804,8 @@ func (g *Gateway) GetCertificateInfo() map[string]interface{} {
 		info["certificate_ready"] = config.LetsEncrypt.CertificateReady
 	}
 
+	info["certificates"] = g.ListCertificates()
+
 	// Check if certificate file exists and is valid
 	if config.TLSCertFile != "" {
 		if certData, err := os.ReadFile(config.TLSCertFile); err == nil {
@@ -0,0 +1,333 @@
+package api_gateway
+
+import (
+	"fmt"
+	"hash/crc32"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	lbStrategyRoundRobin       = "round_robin"
+	lbStrategyWeighted         = "weighted"
+	lbStrategyLeastConnections = "least_connections"
+	lbStrategyConsistentHash   = "consistent_hash"
+
+	lbHashOnClientIP = "client_ip"
+	lbHashOnHeader   = "header"
+
+	// hashRingReplicas is the number of virtual nodes per unit of target weight.
+	hashRingReplicas = 40
+)
+
+// upstreamTarget is the runtime view of a ServiceTarget
+type upstreamTarget struct {
+	host    string
+	port    int
+	weight  int
+	address string
+	active  int64           // in-flight requests (least_connections)
+	current int             // smooth weighted round-robin state
+	breaker *circuitBreaker // nil when the service has no circuit breaker
+}
+
+// hashRingEntry is a virtual node on the consistent hash ring
+type hashRingEntry struct {
+	hash   uint32
+	target *upstreamTarget
+}
+
+// loadBalancer picks a target for each request to a service
+type loadBalancer struct {
+	mu         sync.Mutex
+	strategy   string
+	hashOn     string
+	hashHeader string
+	targets    []*upstreamTarget
+	byAddress  map[string]*upstreamTarget
+	next       uint64
+	ring       []hashRingEntry
+	circuit    *circuitSettings
+}
+
+// upstreamTargets returns the configured targets, falling back to Host:Port for single-target services.
+func (s *Service) upstreamTargets() []ServiceTarget {
+	if len(s.Targets) > 0 {
+		return s.Targets
+	}
+	return []ServiceTarget{{Host: s.Host, Port: s.Port, Weight: 1}}
+}
+
+func targetAddress(host string, port int) string {
+	return net.JoinHostPort(host, fmtPort(port))
+}
+
+func newLoadBalancer(service *Service) *loadBalancer {
+	lb := &loadBalancer{
+		strategy:  lbStrategyRoundRobin,
+		hashOn:    lbHashOnClientIP,
+		byAddress: make(map[string]*upstreamTarget),
+		circuit:   newCircuitSettings(service.CircuitBreaker),
+	}
+	if cfg := service.LoadBalancer; cfg != nil {
+		if cfg.Strategy != "" {
+			lb.strategy = strings.ToLower(cfg.Strategy)
+		}
+		if cfg.HashOn != "" {
+			lb.hashOn = strings.ToLower(cfg.HashOn)
+		}
+		lb.hashHeader = cfg.HashHeader
+	}
+	for _, t := range service.upstreamTargets() {
+		if t.Host == "" || t.Port <= 0 {
+			continue
+		}
+		weight := t.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		target := &upstreamTarget{
+			host:    t.Host,
+			port:    t.Port,
+			weight:  weight,
+			address: targetAddress(t.Host, t.Port),
+		}
+		if lb.circuit != nil {
+			target.breaker = newCircuitBreaker(lb.circuit)
+		}
+		lb.targets = append(lb.targets, target)
+		lb.byAddress[target.address] = target
+	}
+	if lb.strategy == lbStrategyConsistentHash {
+		lb.buildRing()
+	}
+	return lb
+}
+
+func (lb *loadBalancer) buildRing() {
+	lb.ring = lb.ring[:0]
+	for _, t := range lb.targets {
+		for i := 0; i < t.weight*hashRingReplicas; i++ {
+			lb.ring = append(lb.ring, hashRingEntry{
+				hash:   crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s#%d", t.address, i))),
+				target: t,
+			})
+		}
+	}
+	sort.Slice(lb.ring, func(i, j int) bool {
+		return lb.ring[i].hash < lb.ring[j].hash
+	})
+}
+
+// pick selects a target among those for which healthy returns true.
+// It returns nil when no healthy target is available.
+func (lb *loadBalancer) pick(r *http.Request, clientIP string, healthy func(address string) bool) *upstreamTarget {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	candidates := make([]*upstreamTarget, 0, len(lb.targets))
+	for _, t := range lb.targets {
+		if healthy == nil || healthy(t.address) {
+			candidates = append(candidates, t)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	switch lb.strategy {
+	case lbStrategyWeighted:
+		return lb.pickWeighted(candidates)
+	case lbStrategyLeastConnections:
+		return lb.pickLeastConnections(candidates)
+	case lbStrategyConsistentHash:
+		return lb.pickHashed(lb.hashKey(r, clientIP), healthy)
+	default:
+		t := candidates[lb.next%uint64(len(candidates))]
+		lb.next++
+		return t
+	}
+}
+
+// pickWeighted implements smooth weighted round-robin (as in nginx).
+func (lb *loadBalancer) pickWeighted(candidates []*upstreamTarget) *upstreamTarget {
+	total := 0
+	var best *upstreamTarget
+	for _, t := range candidates {
+		t.current += t.weight
+		total += t.weight
+		if best == nil || t.current > best.current {
+			best = t
+		}
+	}
+	best.current -= total
+	return best
+}
+
+// pickLeastConnections picks the target with the fewest in-flight requests relative to its weight.
+func (lb *loadBalancer) pickLeastConnections(candidates []*upstreamTarget) *upstreamTarget {
+	offset := int(lb.next % uint64(len(candidates)))
+	lb.next++
+	var best *upstreamTarget
+	for i := range candidates {
+		t := candidates[(offset+i)%len(candidates)]
+		if best == nil || t.active*int64(best.weight) < best.active*int64(t.weight) {
+			best = t
+		}
+	}
+	return best
+}
+
+func (lb *loadBalancer) pickHashed(key string, healthy func(address string) bool) *upstreamTarget {
+	if len(lb.ring) == 0 {
+		return nil
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(lb.ring), func(i int) bool {
+		return lb.ring[i].hash >= h
+	})
+	for i := 0; i < len(lb.ring); i++ {
+		entry := lb.ring[(start+i)%len(lb.ring)]
+		if healthy == nil || healthy(entry.target.address) {
+			return entry.target
+		}
+	}
+	return nil
+}
+
+func (lb *loadBalancer) hashKey(r *http.Request, clientIP string) string {
+	if lb.hashOn == lbHashOnHeader && lb.hashHeader != "" && r != nil {
+		if v := r.Header.Get(lb.hashHeader); v != "" {
+			return v
+		}
+	}
+	return clientIP
+}
+
+func (lb *loadBalancer) acquire(t *upstreamTarget) {
+	lb.mu.Lock()
+	t.active++
+	lb.mu.Unlock()
+}
+
+func (lb *loadBalancer) release(t *upstreamTarget) {
+	lb.mu.Lock()
+	if t.active > 0 {
+		t.active--
+	}
+	lb.mu.Unlock()
+}
+
+// balancerFor returns the load balancer for a service, creating it on first use.
+func (g *Gateway) balancerFor(service *Service) *loadBalancer {
+	g.balancersMu.Lock()
+	defer g.balancersMu.Unlock()
+	if g.balancers == nil {
+		g.balancers = make(map[string]*loadBalancer)
+	}
+	lb, ok := g.balancers[service.ID]
+	if !ok {
+		lb = newLoadBalancer(service)
+		g.balancers[service.ID] = lb
+	}
+	return lb
+}
+
+// resetBalancer drops cached balancer state so the next request rebuilds it from config.
+// An empty serviceID resets all balancers.
+func (g *Gateway) resetBalancer(serviceID string) {
+	g.balancersMu.Lock()
+	defer g.balancersMu.Unlock()
+	if serviceID == "" || g.balancers == nil {
+		g.balancers = make(map[string]*loadBalancer)
+		return
+	}
+	delete(g.balancers, serviceID)
+}
+
+// refreshBalancers brings the balancers in line with the published services (must be called
+// with g.mu held). Balancers of removed services are dropped; those of services with other
+// targets or balancing settings are rebuilt and keep the breakers of the targets they still
+// have, unless the breaker settings changed too. Other balancers are left as they are.
+func (g *Gateway) refreshBalancers(previous map[string]*Service) {
+	g.balancersMu.Lock()
+	defer g.balancersMu.Unlock()
+	for id, lb := range g.balancers {
+		old, current := previous[id], g.services[id]
+		switch {
+		case old == nil || current == nil || !reflect.DeepEqual(old.CircuitBreaker, current.CircuitBreaker):
+			delete(g.balancers, id)
+		case !reflect.DeepEqual(old.upstreamTargets(), current.upstreamTargets()) || !reflect.DeepEqual(old.LoadBalancer, current.LoadBalancer):
+			next := newLoadBalancer(current)
+			for _, t := range next.targets {
+				if prev := lb.byAddress[t.address]; prev != nil && prev.breaker != nil {
+					t.breaker = prev.breaker
+				}
+			}
+			g.balancers[id] = next
+		}
+	}
+}
+
+// unhealthyTargets returns the addresses of a service's targets that active health checks marked unhealthy.
+func (g *Gateway) unhealthyTargets(serviceID string) map[string]bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	health := g.serviceHealth[serviceID]
+	if health == nil || len(health.Targets) == 0 {
+		return nil
+	}
+	unhealthy := make(map[string]bool)
+	for _, th := range health.Targets {
+		if !th.Healthy {
+			unhealthy[th.Address] = true
+		}
+	}
+	return unhealthy
+}
+
+// targetFilter returns the check used when picking targets: the target must not be marked
+// unhealthy by active health checks nor ejected by its circuit breaker.
+func (g *Gateway) targetFilter(serviceID string, lb *loadBalancer) func(address string) bool {
+	unhealthy := g.unhealthyTargets(serviceID)
+	now := time.Now()
+	return func(address string) bool {
+		return !unhealthy[address] && lb.breakerAllows(address, now)
+	}
+}
+
+// reserve picks a target like pick and takes a probe slot when its breaker is half-open, so no
+// more requests probe an ejected target than its breaker allows. Targets whose probe slots are
+// all taken are passed over. probe reports whether a slot was taken; the request gives it back
+// through the breaker's record or abandon.
+func (lb *loadBalancer) reserve(r *http.Request, clientIP string, healthy func(address string) bool) (target *upstreamTarget, probe bool) {
+	now := time.Now()
+	passed := make(map[string]bool)
+	for {
+		target = lb.pick(r, clientIP, func(address string) bool {
+			return !passed[address] && (healthy == nil || healthy(address))
+		})
+		if target == nil || target.breaker == nil {
+			return target, false
+		}
+		if ok, probe := target.breaker.reserve(now); ok {
+			return target, probe
+		}
+		passed[target.address] = true
+	}
+}
+
+// pickTarget selects a healthy target for the service, or nil if none is available.
+func (g *Gateway) pickTarget(service *Service, r *http.Request, clientIP string) (*loadBalancer, *upstreamTarget) {
+	lb := g.balancerFor(service)
+	target := lb.pick(r, clientIP, g.targetFilter(service.ID, lb))
+	return lb, target
+}
@@ -0,0 +1,131 @@
+package api_gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func multiTargetService(strategy string) *Service {
+	return &Service{
+		ID:       "svc",
+		Protocol: "http",
+		Targets: []ServiceTarget{
+			{Host: "10.0.0.1", Port: 80, Weight: 3},
+			{Host: "10.0.0.2", Port: 80, Weight: 1},
+		},
+		LoadBalancer: &LoadBalancerConfig{Strategy: strategy},
+		Enabled:      true,
+	}
+}
+
+func TestLoadBalancerRoundRobin(t *testing.T) {
+	lb := newLoadBalancer(multiTargetService(lbStrategyRoundRobin))
+	counts := map[string]int{}
+	for i := 0; i < 10; i++ {
+		counts[lb.pick(nil, "1.1.1.1", nil).address]++
+	}
+	assert.Equal(t, 5, counts["10.0.0.1:80"])
+	assert.Equal(t, 5, counts["10.0.0.2:80"])
+}
+
+func TestLoadBalancerWeighted(t *testing.T) {
+	lb := newLoadBalancer(multiTargetService(lbStrategyWeighted))
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		counts[lb.pick(nil, "1.1.1.1", nil).address]++
+	}
+	assert.Equal(t, 6, counts["10.0.0.1:80"])
+	assert.Equal(t, 2, counts["10.0.0.2:80"])
+}
+
+func TestLoadBalancerLeastConnections(t *testing.T) {
+	svc := multiTargetService(lbStrategyLeastConnections)
+	svc.Targets[0].Weight = 1
+	lb := newLoadBalancer(svc)
+	first := lb.pick(nil, "", nil)
+	lb.acquire(first)
+	second := lb.pick(nil, "", nil)
+	assert.NotEqual(t, first.address, second.address)
+	lb.release(first)
+}
+
+func TestLoadBalancerConsistentHash(t *testing.T) {
+	svc := multiTargetService(lbStrategyConsistentHash)
+	svc.LoadBalancer.HashOn = lbHashOnHeader
+	svc.LoadBalancer.HashHeader = "X-User"
+	lb := newLoadBalancer(svc)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-User", "alice")
+	picked := lb.pick(req, "1.1.1.1", nil)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, picked.address, lb.pick(req, fmt.Sprintf("2.2.2.%d", i), nil).address)
+	}
+
+	// An unhealthy target is skipped and its keys move to the next target on the ring
+	other := lb.pick(req, "", func(address string) bool { return address != picked.address })
+	assert.NotNil(t, other)
+	assert.NotEqual(t, picked.address, other.address)
+}
+
+func TestLoadBalancerSkipsUnhealthyTargets(t *testing.T) {
+	svc := multiTargetService(lbStrategyRoundRobin)
+	g := &Gateway{
+		serviceHealth: map[string]*ServiceHealth{
+			"svc": {
+				ServiceID: "svc",
+				Healthy:   true,
+				Targets: []TargetHealth{
+					{Address: "10.0.0.1:80", Healthy: false},
+					{Address: "10.0.0.2:80", Healthy: true},
+				},
+			},
+		},
+	}
+	for i := 0; i < 4; i++ {
+		_, target := g.pickTarget(svc, nil, "1.1.1.1")
+		assert.Equal(t, "10.0.0.2:80", target.address)
+	}
+
+	g.serviceHealth["svc"].Targets[1].Healthy = false
+	_, target := g.pickTarget(svc, nil, "1.1.1.1")
+	assert.Nil(t, target)
+}
+
+func TestCheckServiceHealthPerTarget(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	upHost := splitHostPort(up.Listener.Addr().String())
+	downHost := splitHostPort(down.Listener.Addr().String())
+	svc := &Service{
+		ID: "svc",
+		Targets: []ServiceTarget{
+			{Host: upHost[0], Port: mustParseInt(upHost[1])},
+			{Host: downHost[0], Port: mustParseInt(downHost[1])},
+		},
+		HealthCheck: &HealthCheck{Path: "/health", Timeout: 2, HealthyThreshold: 1, UnhealthyThreshold: 1},
+		Enabled:     true,
+	}
+	g := &Gateway{serviceHealth: make(map[string]*ServiceHealth)}
+	g.checkServiceHealth(svc)
+
+	health := g.GetServiceHealth()
+	assert.Len(t, health, 1)
+	assert.True(t, health[0].Healthy)
+	assert.Len(t, health[0].Targets, 2)
+	assert.True(t, health[0].Targets[0].Healthy)
+	assert.False(t, health[0].Targets[1].Healthy)
+	assert.WithinDuration(t, time.Now(), health[0].LastCheck, time.Minute)
+}
@@ -0,0 +1,75 @@
+package api_gateway
+
+import (
+	"strconv"
+	"time"
+
+	"redock/pkg/metrics"
+)
+
+var (
+	gatewayRequests = metrics.NewCounterVec("redock_gateway_requests_total",
+		"HTTP requests handled by the API gateway.", "route", "service", "code")
+	gatewayRequestDuration = metrics.NewHistogramVec("redock_gateway_request_duration_seconds",
+		"Latency of HTTP requests handled by the API gateway.", nil, "route", "service")
+)
+
+func init() {
+	metrics.Register(gatewayRequests, gatewayRequestDuration, metrics.CollectorFunc(collectGatewayMetrics))
+}
+
+// observeRequest records a finished request; route and service are empty when the request
+// was rejected before they were known.
+func observeRequest(routeID, serviceID string, statusCode int, startTime time.Time) {
+	gatewayRequests.With(routeID, serviceID, strconv.Itoa(statusCode)).Inc()
+	gatewayRequestDuration.With(routeID, serviceID).ObserveSince(startTime)
+}
+
+// collectGatewayMetrics exposes the gateway's running statistics at scrape time
+func collectGatewayMetrics() []*metrics.Family {
+	g := GetGateway()
+	if g == nil {
+		return nil
+	}
+	stats := g.GetStats()
+
+	errors := metrics.NewFamily("redock_gateway_service_errors_total", "Upstream errors per service.", metrics.TypeCounter)
+	retries := metrics.NewFamily("redock_gateway_service_retries_total", "Upstream retries per service.", metrics.TypeCounter)
+	mirrored := metrics.NewFamily("redock_gateway_service_mirrored_total", "Mirrored request copies per service.", metrics.TypeCounter)
+	for _, s := range stats.ServiceStats {
+		errors.Add(float64(s.Errors), "service", s.ServiceID)
+		retries.Add(float64(s.Retries), "service", s.ServiceID)
+		mirrored.Add(float64(s.MirroredRequests), "service", s.ServiceID)
+	}
+
+	limited := metrics.NewFamily("redock_gateway_rate_limited_total", "Requests rejected by route rate limits.", metrics.TypeCounter)
+	for _, r := range stats.RateLimitStats.Routes {
+		limited.Add(float64(r.Limited), "route", r.RouteID)
+	}
+
+	lookups := metrics.NewFamily("redock_gateway_cache_lookups_total", "Response cache lookups per route and result.", metrics.TypeCounter)
+	for _, r := range stats.CacheStats.Routes {
+		lookups.Add(float64(r.Hits), "route", r.RouteID, "result", cacheStatusHit)
+		lookups.Add(float64(r.Misses), "route", r.RouteID, "result", cacheStatusMiss)
+		lookups.Add(float64(r.Stale), "route", r.RouteID, "result", cacheStatusStale)
+		lookups.Add(float64(r.Revalidated), "route", r.RouteID, "result", cacheStatusRevalidated)
+	}
+	cacheBytes := metrics.NewFamily("redock_gateway_cache_size_bytes", "Approximate memory held by the response cache.", metrics.TypeGauge)
+	cacheBytes.Add(float64(stats.CacheStats.SizeBytes))
+
+	waf := metrics.NewFamily("redock_gateway_waf_matches_total", "Requests matched by a WAF rule, blocked or detected.", metrics.TypeCounter)
+	for _, r := range stats.WAFStats.Rules {
+		waf.Add(float64(r.Hits), "rule", r.RuleID)
+	}
+
+	healthy := metrics.NewFamily("redock_gateway_service_healthy", "Whether a health-checked service is healthy (1) or not (0).", metrics.TypeGauge)
+	for _, h := range g.GetServiceHealth() {
+		value := 0.0
+		if h.Healthy {
+			value = 1
+		}
+		healthy.Add(value, "service", h.ServiceID)
+	}
+
+	return []*metrics.Family{errors, retries, mirrored, limited, lookups, cacheBytes, waf, healthy}
+}
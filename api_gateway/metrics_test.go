@@ -0,0 +1,41 @@
+package api_gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"redock/pkg/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatewayRequestMetrics(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+	g := newProxyTestGateway(&Service{ID: "metrics-svc", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true})
+	g.routes[0].ID = "metrics-route"
+
+	before := gatewayRequests.With("metrics-route", "metrics-svc", "200").Value()
+	for i := 0; i < 3; i++ {
+		g.handleRequest(httptest.NewRecorder(), httptest.NewRequest("GET", "/ok", nil))
+	}
+	g.handleRequest(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+	assert.Equal(t, before+3, gatewayRequests.With("metrics-route", "metrics-svc", "200").Value())
+
+	var out strings.Builder
+	require.NoError(t, metrics.Default().WriteText(&out))
+	text := out.String()
+	assert.Contains(t, text, "# TYPE redock_gateway_requests_total counter\n")
+	assert.Contains(t, text, `redock_gateway_requests_total{route="metrics-route",service="metrics-svc",code="502"} 1`)
+	assert.Contains(t, text, "# TYPE redock_gateway_request_duration_seconds histogram\n")
+	assert.Contains(t, text, `redock_gateway_request_duration_seconds_bucket{route="metrics-route",service="metrics-svc",le="+Inf"} 4`)
+	assert.Contains(t, text, `redock_gateway_request_duration_seconds_count{route="metrics-route",service="metrics-svc"} 4`)
+}
@@ -0,0 +1,380 @@
+package api_gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// mmdbMetadataMarker precedes the metadata map at the end of a MaxMind DB file
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// mmdbReader looks up records in a MaxMind DB (.mmdb) file held in memory.
+// Only what the gateway needs is implemented: the search tree and the data
+// section decoder; see https://maxmind.github.io/MaxMind-DB/.
+type mmdbReader struct {
+	buf        []byte
+	data       []byte // data section
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint // node reached after 96 zero bits in IPv6 trees
+}
+
+// mmdbMaxMetadataSize bounds the metadata section at the end of a MaxMind DB file
+const mmdbMaxMetadataSize = 128 * 1024
+
+// openMMDB reads and parses a MaxMind DB file
+func openMMDB(path string) (*mmdbReader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newMMDBReader(buf)
+}
+
+// checkMMDB reports whether path is a MaxMind DB file the reader supports. Only the metadata
+// at the end of the file is read.
+func checkMMDB(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	tail := make([]byte, min(info.Size(), mmdbMaxMetadataSize))
+	offset := info.Size() - int64(len(tail))
+	if _, err := f.ReadAt(tail, offset); err != nil {
+		return err
+	}
+	meta, err := parseMMDBMetadata(tail)
+	if err != nil {
+		return err
+	}
+	if meta.treeSize()+16 > uint(offset)+meta.start {
+		return errors.New("mmdb: search tree exceeds file size")
+	}
+	return nil
+}
+
+// mmdbMetadata holds the metadata fields the reader needs
+type mmdbMetadata struct {
+	start      uint // offset of the metadata marker
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+}
+
+func (m mmdbMetadata) treeSize() uint {
+	return m.nodeCount * m.recordSize / 4
+}
+
+// parseMMDBMetadata decodes the metadata at the end of buf
+func parseMMDBMetadata(buf []byte) (mmdbMetadata, error) {
+	start := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if start < 0 {
+		return mmdbMetadata{}, errors.New("mmdb: metadata marker not found")
+	}
+	meta := mmdbDecoder{buf: buf[start+len(mmdbMetadataMarker):]}
+	value, _, err := meta.decode(0)
+	if err != nil {
+		return mmdbMetadata{}, fmt.Errorf("mmdb: invalid metadata: %w", err)
+	}
+	m, ok := value.(map[string]any)
+	if !ok {
+		return mmdbMetadata{}, errors.New("mmdb: metadata is not a map")
+	}
+	md := mmdbMetadata{
+		start:      uint(start),
+		nodeCount:  uint(mmdbUint(m["node_count"])),
+		recordSize: uint(mmdbUint(m["record_size"])),
+		ipVersion:  uint(mmdbUint(m["ip_version"])),
+	}
+	switch md.recordSize {
+	case 24, 28, 32:
+	default:
+		return mmdbMetadata{}, fmt.Errorf("mmdb: unsupported record size %d", md.recordSize)
+	}
+	return md, nil
+}
+
+func newMMDBReader(buf []byte) (*mmdbReader, error) {
+	meta, err := parseMMDBMetadata(buf)
+	if err != nil {
+		return nil, err
+	}
+	r := &mmdbReader{
+		buf:        buf,
+		nodeCount:  meta.nodeCount,
+		recordSize: meta.recordSize,
+		ipVersion:  meta.ipVersion,
+	}
+	treeSize := meta.treeSize()
+	if treeSize+16 > meta.start {
+		return nil, errors.New("mmdb: search tree exceeds file size")
+	}
+	r.data = buf[treeSize+16 : meta.start]
+
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.readRecord(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// readRecord returns the left (bit 0) or right (bit 1) record of a node
+func (r *mmdbReader) readRecord(node uint, bit uint) uint {
+	switch r.recordSize {
+	case 24:
+		off := node*6 + bit*3
+		b := r.buf[off : off+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		off := node * 7
+		b := r.buf[off : off+7]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		off := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(r.buf[off : off+4]))
+	}
+}
+
+// lookup returns the decoded record for an address, or nil when the address is not in the database
+func (r *mmdbReader) lookup(addr netip.Addr) (any, error) {
+	addr = addr.Unmap()
+	node := uint(0)
+	if addr.Is4() && r.ipVersion == 6 {
+		node = r.ipv4Start
+	} else if addr.Is6() && r.ipVersion == 4 {
+		return nil, nil
+	}
+	ip := addr.AsSlice()
+	for i := 0; i < len(ip)*8 && node < r.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = r.readRecord(node, bit)
+	}
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, errors.New("mmdb: search tree deeper than the address")
+	}
+	offset := node - r.nodeCount - 16
+	if offset >= uint(len(r.data)) {
+		return nil, errors.New("mmdb: record points outside the data section")
+	}
+	d := mmdbDecoder{buf: r.data}
+	value, _, err := d.decode(offset)
+	return value, err
+}
+
+// country returns the ISO 3166 country code of an address; registered_country is used
+// for addresses without a physical location (e.g. anycast ranges).
+func (r *mmdbReader) country(addr netip.Addr) string {
+	record, err := r.lookup(addr)
+	if err != nil || record == nil {
+		return ""
+	}
+	m, _ := record.(map[string]any)
+	for _, key := range []string{"country", "registered_country"} {
+		if c, ok := m[key].(map[string]any); ok {
+			if code, ok := c["iso_code"].(string); ok && code != "" {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+// mmdbDecoder decodes values from a data section; pointers are offsets into buf
+type mmdbDecoder struct {
+	buf []byte
+}
+
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+var errMMDBTruncated = errors.New("unexpected end of data")
+
+func (d *mmdbDecoder) take(offset, n uint) ([]byte, error) {
+	if offset+n > uint(len(d.buf)) || offset+n < offset {
+		return nil, errMMDBTruncated
+	}
+	return d.buf[offset : offset+n], nil
+}
+
+// mmdbMaxDepth bounds nesting and pointer chains so a corrupt file cannot recurse forever
+const mmdbMaxDepth = 64
+
+// decode returns the value at offset and the offset just past it
+func (d *mmdbDecoder) decode(offset uint) (any, uint, error) {
+	return d.decodeAt(offset, 0)
+}
+
+func (d *mmdbDecoder) decodeAt(offset uint, depth int) (any, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+	ctrl, err := d.take(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+	typ := uint(ctrl[0] >> 5)
+
+	if typ == mmdbPointer {
+		ss := uint(ctrl[0]>>3) & 0x3
+		b, err := d.take(offset, ss+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += ss + 1
+		var ptr uint
+		vvv := uint(ctrl[0] & 0x7)
+		switch ss {
+		case 0:
+			ptr = vvv<<8 | uint(b[0])
+		case 1:
+			ptr = (vvv<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			ptr = (vvv<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			ptr = uint(binary.BigEndian.Uint32(b))
+		}
+		value, _, err := d.decodeAt(ptr, depth+1)
+		return value, offset, err
+	}
+
+	if typ == mmdbExtended {
+		b, err := d.take(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset++
+		typ = 7 + uint(b[0])
+	}
+
+	size := uint(ctrl[0] & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.take(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+		switch size {
+		case 29:
+			size = 29 + uint(b[0])
+		case 30:
+			size = 285 + (uint(b[0])<<8 | uint(b[1]))
+		default:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+	}
+
+	switch typ {
+	case mmdbMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decodeAt(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			value, next, err := d.decodeAt(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+			offset = next
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decodeAt(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	case mmdbEndMarker, mmdbContainer:
+		return nil, offset, nil
+	}
+
+	b, err := d.take(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += size
+	switch typ {
+	case mmdbString:
+		return string(b), offset, nil
+	case mmdbBytes, mmdbUint128:
+		return append([]byte(nil), b...), offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset, nil
+	case mmdbInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), offset, nil
+	}
+	return nil, 0, fmt.Errorf("unknown data type %d", typ)
+}
+
+func mmdbUint(v any) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
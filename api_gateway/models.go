@@ -1,26 +1,83 @@
 package api_gateway
 
 import (
-	"crypto/tls"
-	"net"
 	"net/http"
+	"net/netip"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Service represents an upstream service that the gateway routes to
 type Service struct {
-	ID          string            `json:"id"`
-	Name        string            `json:"name"`
-	Host        string            `json:"host"`
-	Port        int               `json:"port"`
-	Protocol    string            `json:"protocol"` // http, https, grpc
-	Path        string            `json:"path"`     // base path for the service
-	Retries     int               `json:"retries"`
-	Timeout     int               `json:"timeout"` // in seconds
-	HealthCheck *HealthCheck      `json:"health_check,omitempty"`
-	Headers     map[string]string `json:"headers,omitempty"` // headers to add to requests
-	Enabled     bool              `json:"enabled"`
+	ID             string                `json:"id"`
+	Name           string                `json:"name"`
+	Host           string                `json:"host"`
+	Port           int                   `json:"port"`
+	Protocol       string                `json:"protocol"`               // http, https, h2c, grpc (h2c), grpcs (TLS)
+	Path           string                `json:"path"`                   // base path for the service
+	Retries        int                   `json:"retries"`                // extra attempts after a failed request (0 = no retries)
+	RetryPolicy    *RetryPolicy          `json:"retry_policy,omitempty"` // when Retries applies; nil = defaults
+	Timeout        int                   `json:"timeout"`                // in seconds
+	HealthCheck    *HealthCheck          `json:"health_check,omitempty"`
+	Headers        map[string]string     `json:"headers,omitempty"`         // headers to add to requests
+	Targets        []ServiceTarget       `json:"targets,omitempty"`         // upstream instances; empty = Host:Port only
+	LoadBalancer   *LoadBalancerConfig   `json:"load_balancer,omitempty"`   // target selection when Targets has more than one entry
+	TLS            *UpstreamTLSConfig    `json:"tls,omitempty"`             // TLS settings for https/grpcs upstreams
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit_breaker,omitempty"` // passive outlier detection from live proxy results
+	ProxyProtocol  string                `json:"proxy_protocol,omitempty"`  // v1 or v2: start upstream connections with a PROXY protocol header
+	Provider       string                `json:"provider,omitempty"`        // discovery provider managing the service (docker); empty = manual
+	ReadOnly       bool                  `json:"read_only,omitempty"`       // discovered: changed by its provider only
+	Enabled        bool                  `json:"enabled"`
+}
+
+// ServiceTarget is a single upstream instance of a Service
+type ServiceTarget struct {
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+	Weight int    `json:"weight"` // relative weight (0 = 1)
+}
+
+// LoadBalancerConfig selects how requests are spread across a service's targets
+type LoadBalancerConfig struct {
+	Strategy   string `json:"strategy"`              // round_robin (default), weighted, least_connections, consistent_hash
+	HashOn     string `json:"hash_on,omitempty"`     // consistent_hash key: client_ip (default) or header
+	HashHeader string `json:"hash_header,omitempty"` // header name when hash_on=header
+}
+
+// RetryPolicy controls which failed requests to a service are retried
+type RetryPolicy struct {
+	RetryOn            []string `json:"retry_on,omitempty"`              // connect_error, timeout and/or status codes such as "503" (default connect_error, timeout)
+	Methods            []string `json:"methods,omitempty"`               // methods that may be retried (default GET, HEAD, OPTIONS, PUT, DELETE, TRACE)
+	MaxBodyBytes       int64    `json:"max_body_bytes,omitempty"`        // bodies up to this size are buffered for replay; larger ones are not retried (default 64 KiB)
+	BackoffBaseMs      int      `json:"backoff_base_ms,omitempty"`       // first backoff, doubled per retry with full jitter (default 25)
+	BackoffMaxMs       int      `json:"backoff_max_ms,omitempty"`        // backoff cap (default 1000)
+	BudgetPercent      int      `json:"budget_percent,omitempty"`        // retries allowed as a share of requests over the last 10s (default 20)
+	BudgetMinPerSecond int      `json:"budget_min_per_second,omitempty"` // retries always allowed regardless of traffic (default 3)
+}
+
+// CircuitBreakerConfig ejects targets that fail live requests (5xx responses or connection errors).
+// A target's breaker opens on consecutive failures or a high error rate, stays open for the
+// ejection time (doubled per repeated ejection), then lets probe requests through half-open.
+// The service fails fast with 503 while every target is ejected.
+type CircuitBreakerConfig struct {
+	Enabled             bool `json:"enabled"`
+	ConsecutiveFailures int  `json:"consecutive_failures,omitempty"` // failures in a row that open the breaker (default 5)
+	ErrorRatePercent    int  `json:"error_rate_percent,omitempty"`   // failure share over the window that opens the breaker (0 = off)
+	MinRequests         int  `json:"min_requests,omitempty"`         // requests in the window before the error rate applies (default 20)
+	WindowSeconds       int  `json:"window_seconds,omitempty"`       // error rate window (default 10)
+	EjectionSeconds     int  `json:"ejection_seconds,omitempty"`     // base open time (default 30)
+	MaxEjectionSeconds  int  `json:"max_ejection_seconds,omitempty"` // cap for the growing open time (default 300)
+	HalfOpenRequests    int  `json:"half_open_requests,omitempty"`   // successful probes needed to close again (default 1)
+}
+
+// UpstreamTLSConfig configures TLS from the gateway to a service
+type UpstreamTLSConfig struct {
+	CAFile             string `json:"ca_file,omitempty"`              // PEM bundle used instead of the system roots
+	CertFile           string `json:"cert_file,omitempty"`            // client certificate for mTLS
+	KeyFile            string `json:"key_file,omitempty"`             // client key for mTLS
+	ServerName         string `json:"server_name,omitempty"`          // SNI and verification name override
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"` // skip verification (development only)
 }
 
 // AuthHeader defines a required request header for auth type "header" (key must match value).
@@ -31,27 +88,259 @@ type AuthHeader struct {
 
 // Route represents a routing rule that maps incoming requests to services
 type Route struct {
-	ID                   string            `json:"id"`
-	Name                 string            `json:"name"`
-	ServiceID            string            `json:"service_id"`
-	Paths                []string          `json:"paths"`                  // URL paths to match
-	Methods              []string          `json:"methods,omitempty"`      // HTTP methods to match (empty = all)
-	Hosts                []string          `json:"hosts,omitempty"`        // Host headers to match (empty = all)
-	Headers              map[string]string `json:"headers,omitempty"`      // Required headers to match
-	StripPath            bool              `json:"strip_path"`             // Strip the matched path before forwarding
-	PreserveHost         bool              `json:"preserve_host"`          // Forward original Host header
-	HostRewrite          string            `json:"host_rewrite,omitempty"` // Override Host header when proxying
-	Priority             int               `json:"priority"`               // Higher priority routes are matched first
-	RateLimitEnabled     bool              `json:"rate_limit_enabled"`
-	RateLimitRequests    int               `json:"rate_limit_requests"` // requests per window
-	RateLimitWindow      int               `json:"rate_limit_window"`   // window in seconds
-	AuthRequired         bool              `json:"auth_required"`
-	AuthType             string            `json:"auth_type,omitempty"`     // basic, jwt, header
-	AuthHeaders          []AuthHeader      `json:"auth_headers,omitempty"`   // required header key-value pairs when auth_type=header
-	ObservabilityEnabled *bool             `json:"observability_enabled,omitempty"`
-	CORS                 *CORSConfig       `json:"cors,omitempty"`           // CORS response headers for this route (incl. WebSocket)
-	ResponseHeaders      map[string]string `json:"response_headers,omitempty"` // extra response headers for this route
-	Enabled              bool              `json:"enabled"`
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	ServiceID            string             `json:"service_id"`
+	Paths                []string           `json:"paths"`                  // URL paths to match
+	Methods              []string           `json:"methods,omitempty"`      // HTTP methods to match (empty = all)
+	Hosts                []string           `json:"hosts,omitempty"`        // Host headers to match (empty = all)
+	Headers              map[string]string  `json:"headers,omitempty"`      // Required headers to match
+	StripPath            bool               `json:"strip_path"`             // Strip the matched path before forwarding
+	PreserveHost         bool               `json:"preserve_host"`          // Forward original Host header
+	HostRewrite          string             `json:"host_rewrite,omitempty"` // Override Host header when proxying
+	Priority             int                `json:"priority"`               // Higher priority routes are matched first
+	RateLimitEnabled     bool               `json:"rate_limit_enabled"`
+	RateLimitRequests    int                `json:"rate_limit_requests"`           // requests per window
+	RateLimitWindow      int                `json:"rate_limit_window"`             // window in seconds
+	RateLimitBurst       int                `json:"rate_limit_burst,omitempty"`    // bucket size (default = rate_limit_requests)
+	RateLimitKeyBy       string             `json:"rate_limit_key_by,omitempty"`   // ip (default), header, consumer, jwt_claim
+	RateLimitKeyName     string             `json:"rate_limit_key_name,omitempty"` // header name or claim path for key_by header/jwt_claim
+	AuthRequired         bool               `json:"auth_required"`
+	AuthType             string             `json:"auth_type,omitempty"`       // basic, api_key, jwt, header, forward, oidc
+	AuthHeaders          []AuthHeader       `json:"auth_headers,omitempty"`    // required header key-value pairs when auth_type=header
+	JWT                  *JWTAuthConfig     `json:"jwt,omitempty"`             // token verification settings when auth_type=jwt
+	ForwardAuth          *ForwardAuthConfig `json:"forward_auth,omitempty"`    // external authorization service when auth_type=forward
+	OIDC                 *OIDCAuthConfig    `json:"oidc,omitempty"`            // single sign-on login when auth_type=oidc
+	Consumers            []string           `json:"consumers,omitempty"`       // allowed consumer names (auth_type basic/api_key)
+	ConsumerGroups       []string           `json:"consumer_groups,omitempty"` // allowed consumer groups; both empty = any consumer
+	APIKeyHeader         string             `json:"api_key_header,omitempty"`  // header carrying the key for auth_type=api_key (default X-API-Key)
+	ObservabilityEnabled *bool              `json:"observability_enabled,omitempty"`
+	CORS                 *CORSConfig        `json:"cors,omitempty"`                   // CORS response headers for this route (incl. WebSocket)
+	ResponseHeaders      map[string]string  `json:"response_headers,omitempty"`       // extra response headers for this route
+	Transform            *RouteTransform    `json:"transform,omitempty"`              // request/response rewrites applied while proxying
+	Split                *TrafficSplit      `json:"split,omitempty"`                  // weighted backends (canary releases); nil = ServiceID only
+	Mirror               *MirrorConfig      `json:"mirror,omitempty"`                 // fire-and-forget copy of each request
+	Cache                *RouteCacheConfig  `json:"cache,omitempty"`                  // in-memory response cache for this route
+	MaxRequestBodyBytes  int64              `json:"max_request_body_bytes,omitempty"` // larger request bodies are rejected with 413 (0 = unlimited)
+	WAF                  *RouteWAFConfig    `json:"waf,omitempty"`                    // per-route WAF mode and rule exclusions
+	Access               *AccessPolicy      `json:"access,omitempty"`                 // client IP / country allow and deny lists
+	Action               *RouteAction       `json:"action,omitempty"`                 // answer in the gateway instead of proxying; service_id is then optional
+	Provider             string             `json:"provider,omitempty"`               // discovery provider managing the route (docker); empty = manual
+	ReadOnly             bool               `json:"read_only,omitempty"`              // discovered: changed by its provider only
+	Enabled              bool               `json:"enabled"`
+}
+
+// TrafficSplit spreads a route's requests over several services by weight.
+// Backends whose matcher fits the request are chosen first (e.g. to force a canary);
+// otherwise a backend is picked by weight, optionally kept sticky per client.
+type TrafficSplit struct {
+	Backends     []RouteBackend `json:"backends"`
+	StickyBy     string         `json:"sticky_by,omitempty"`      // cookie, client_ip or header; empty = no stickiness
+	StickyCookie string         `json:"sticky_cookie,omitempty"`  // cookie name for sticky_by=cookie (default gw_backend)
+	StickyHeader string         `json:"sticky_header,omitempty"`  // header hashed for sticky_by=header
+	CookieMaxAge int            `json:"cookie_max_age,omitempty"` // sticky cookie lifetime in seconds (0 = session)
+}
+
+// RouteBackend is one weighted service of a TrafficSplit
+type RouteBackend struct {
+	ServiceID string          `json:"service_id"`
+	Weight    int             `json:"weight"`          // relative share of traffic; 0 = only via Match
+	Match     *BackendMatcher `json:"match,omitempty"` // requests matching are always sent to this backend
+}
+
+// BackendMatcher selects requests by header or cookie value
+type BackendMatcher struct {
+	Header string `json:"header,omitempty"`
+	Cookie string `json:"cookie,omitempty"`
+	Value  string `json:"value,omitempty"` // required value; empty = present with any value
+}
+
+// MirrorConfig sends a copy of requests to another service without waiting for it
+type MirrorConfig struct {
+	ServiceID    string `json:"service_id"`
+	Percent      int    `json:"percent,omitempty"`        // share of requests mirrored (0 = 100)
+	MaxBodyBytes int64  `json:"max_body_bytes,omitempty"` // requests with larger bodies are not mirrored (default 1 MiB)
+}
+
+// RouteCacheConfig enables the shared in-memory response cache for a route.
+// Freshness comes from Cache-Control (s-maxage, max-age) or Expires; responses marked
+// no-store/private or setting cookies are never stored. Cache keys have the form
+// "<route_id>|<method>|<host>|<path>?<query>|<headers>".
+type RouteCacheConfig struct {
+	Enabled              bool     `json:"enabled"`
+	Methods              []string `json:"methods,omitempty"`                // cached methods (default GET, HEAD)
+	StatusCodes          []int    `json:"status_codes,omitempty"`           // cached statuses (default 200, 203, 204, 301, 404, 410)
+	DefaultTTL           int      `json:"default_ttl,omitempty"`            // seconds for responses without freshness headers (0 = do not cache them)
+	MaxTTL               int      `json:"max_ttl,omitempty"`                // upper bound for freshness in seconds (0 = none)
+	StaleWhileRevalidate int      `json:"stale_while_revalidate,omitempty"` // seconds a stale entry is served while refreshed in the background, unless the response sets it
+	MaxEntryBytes        int64    `json:"max_entry_bytes,omitempty"`        // larger bodies are not cached (default 1 MiB)
+	KeyIgnoreHost        bool     `json:"key_ignore_host,omitempty"`        // leave the Host out of the key
+	KeyQueryParams       []string `json:"key_query_params,omitempty"`       // query parameters in the key (empty = whole query string)
+	KeyHeaders           []string `json:"key_headers,omitempty"`            // request headers added to the key
+}
+
+// RouteTransform declares rewrites of the upstream request and the returned response.
+// Header and query values may use templates: ${client_ip}, ${request_id}, ${route_id},
+// ${route_name}, ${service_id}, ${host}, ${method}, ${path}, ${query} (raw query string),
+// ${request_uri} (path and query), ${scheme}, ${consumer}, ${jwt.<claim>}, ${header.<name>}
+// and ${query.<name>}.
+type RouteTransform struct {
+	PathRewrite     *PathRewrite     `json:"path_rewrite,omitempty"`
+	Query           *QueryTransform  `json:"query,omitempty"`
+	RequestHeaders  *HeaderTransform `json:"request_headers,omitempty"`
+	ResponseHeaders *HeaderTransform `json:"response_headers,omitempty"`
+	MethodOverride  string           `json:"method_override,omitempty"` // method sent upstream
+}
+
+// PathRewrite replaces the upstream path (after strip_path, before the service base path)
+type PathRewrite struct {
+	Pattern     string `json:"pattern"`     // regular expression, e.g. ^/users/(\d+)$
+	Replacement string `json:"replacement"` // may reference capture groups, e.g. /v2/accounts/$1
+}
+
+// HeaderTransform removes, renames and then adds headers
+type HeaderTransform struct {
+	Add    map[string]string `json:"add,omitempty"`    // header -> value (templates allowed); replaces existing values
+	Remove []string          `json:"remove,omitempty"` // headers to drop
+	Rename map[string]string `json:"rename,omitempty"` // old name -> new name
+}
+
+// QueryTransform removes, renames and then adds query parameters
+type QueryTransform struct {
+	Add    map[string]string `json:"add,omitempty"`    // parameter -> value (templates allowed)
+	Remove []string          `json:"remove,omitempty"` // parameters to drop
+	Rename map[string]string `json:"rename,omitempty"` // old name -> new name
+}
+
+// RouteAction answers a route's requests in the gateway. Access, auth, rate limits, CORS
+// and response headers apply as for proxied routes; transforms, caching and mirroring do not.
+type RouteAction struct {
+	Type     string          `json:"type"` // redirect, static, respond or mock
+	Redirect *RedirectAction `json:"redirect,omitempty"`
+	Static   *StaticAction   `json:"static,omitempty"`
+	Respond  *FixedResponse  `json:"respond,omitempty"`
+	Mock     *MockAction     `json:"mock,omitempty"`
+}
+
+// RedirectAction redirects to a target built from the request with the transform templates,
+// e.g. https://${host}${request_uri}.
+type RedirectAction struct {
+	Target     string `json:"target"`
+	StatusCode int    `json:"status_code,omitempty"` // 301, 302, 303, 307 or 308 (default 302)
+}
+
+// StaticAction serves files from a directory. The request path, after strip_path, is resolved
+// inside Root; paths escaping it and hidden files are not served. Range and conditional
+// requests are answered from the file's size and modification time.
+type StaticAction struct {
+	Root         string   `json:"root"`
+	IndexFiles   []string `json:"index_files,omitempty"`   // tried for directory requests (default index.html)
+	SPAFallback  bool     `json:"spa_fallback,omitempty"`  // serve the root index file for missing paths (single-page apps)
+	CacheControl string   `json:"cache_control,omitempty"` // Cache-Control header of served files
+}
+
+// FixedResponse is a response served as configured. Header values may use the transform templates.
+type FixedResponse struct {
+	StatusCode int               `json:"status_code,omitempty"` // default 200
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"` // served as text/plain unless Headers set Content-Type
+}
+
+// MockAction serves canned responses, for example while the real API is still being built.
+// The first response matching the request is served; unmatched requests are proxied to the
+// route's service when it has one and answered with 404 otherwise.
+type MockAction struct {
+	Responses []MockResponse `json:"responses"`
+}
+
+// MockResponse is a canned response and the requests it answers
+type MockResponse struct {
+	Method string            `json:"method,omitempty"` // empty = any method
+	Path   string            `json:"path,omitempty"`   // full request path, e.g. /api/users/{id} or /api/files/*; {name} matches one segment, a trailing * the rest; empty = any path
+	Query  map[string]string `json:"query,omitempty"`  // required query parameters; an empty value only requires presence
+	FixedResponse
+	DelayMs int `json:"delay_ms,omitempty"` // simulated latency
+}
+
+// UpstreamRequest describes the request the gateway would send upstream (see Validate)
+type UpstreamRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Host    string            `json:"host"`
+	Headers map[string]string `json:"headers"`
+}
+
+// JWTAuthConfig configures JWT verification for routes with auth_type "jwt".
+// Keys come from Secret (HS256), PublicKeyFile (PEM, RS256/ES256) or a JWKS file/URL.
+type JWTAuthConfig struct {
+	Algorithms      []string          `json:"algorithms,omitempty"`        // allowed algs (empty = HS256, RS256, ES256)
+	Secret          string            `json:"secret,omitempty"`            // HMAC secret for HS256
+	PublicKeyFile   string            `json:"public_key_file,omitempty"`   // PEM public key or certificate
+	JWKSFile        string            `json:"jwks_file,omitempty"`         // local JWKS document
+	JWKSURL         string            `json:"jwks_url,omitempty"`          // remote JWKS document (cached)
+	Issuer          string            `json:"issuer,omitempty"`            // required iss (empty = any)
+	Audience        []string          `json:"audience,omitempty"`          // token aud must contain one of these (empty = any)
+	LeewaySec       int               `json:"leeway_seconds,omitempty"`    // clock skew allowed for exp/nbf
+	AllowMissingExp bool              `json:"allow_missing_exp,omitempty"` // accept tokens without an exp claim
+	ClaimHeaders    map[string]string `json:"claim_headers,omitempty"`     // claim -> upstream header, e.g. {"sub": "X-User-Id"}
+}
+
+// ForwardAuthConfig delegates authorization to an external HTTP service, like Traefik
+// ForwardAuth or nginx auth_request. The subrequest has the original method, the selected
+// client headers and X-Forwarded-Method, -Proto, -Host, -Uri and -For; X-Original-URI carries
+// the URI too. A 2xx answer allows the request, any other answer is returned to the client as is.
+// Redock's own API can decide with GET /api/v1/auth/verify (optionally ?role=admin).
+type ForwardAuthConfig struct {
+	URL             string   `json:"url"`
+	RequestHeaders  []string `json:"request_headers,omitempty"`  // client headers sent to the auth service (default Authorization, Cookie)
+	ResponseHeaders []string `json:"response_headers,omitempty"` // headers of an allowing answer copied to the upstream request
+	TimeoutMs       int      `json:"timeout_ms,omitempty"`       // subrequest timeout (default 5000)
+	CacheTTL        int      `json:"cache_ttl,omitempty"`        // seconds a decision is reused for the same URI and request headers (0 = no caching)
+}
+
+// OIDCAuthConfig puts a route behind an OpenID Connect login. Browsers without a session are
+// sent through the authorization code flow with PKCE; after login an encrypted session cookie
+// identifies the user and its tokens are refreshed when they expire. Other clients get 401.
+// Upstreams receive X-Auth-Request-User, X-Auth-Request-Email and X-Auth-Request-Groups.
+type OIDCAuthConfig struct {
+	Issuer         string            `json:"issuer"` // discovered at <issuer>/.well-known/openid-configuration
+	ClientID       string            `json:"client_id"`
+	ClientSecret   string            `json:"client_secret,omitempty"` // empty = public client
+	Scopes         []string          `json:"scopes,omitempty"`        // default openid, email, profile
+	RedirectPath   string            `json:"redirect_path,omitempty"` // callback matched by the route's paths (default /oauth2/callback)
+	LogoutPath     string            `json:"logout_path,omitempty"`   // clears the session (default /oauth2/logout)
+	CookieName     string            `json:"cookie_name,omitempty"`   // session cookie (default gw_session)
+	CookieSecret   string            `json:"cookie_secret"`           // encrypts session cookies; at least 32 characters
+	SessionTTL     int               `json:"session_ttl,omitempty"`   // seconds until a new login is required (default 8 hours)
+	AllowedEmails  []string          `json:"allowed_emails,omitempty"`
+	AllowedDomains []string          `json:"allowed_domains,omitempty"` // email domains, e.g. example.com
+	AllowedGroups  []string          `json:"allowed_groups,omitempty"`  // users need one of these groups
+	GroupsClaim    string            `json:"groups_claim,omitempty"`    // ID token claim with the groups (default groups)
+	ClaimHeaders   map[string]string `json:"claim_headers,omitempty"`   // more ID token claims for upstream, e.g. {"preferred_username": "X-WEBAUTH-USER"}
+}
+
+// Consumer is a registered API client that can authenticate with basic credentials or API keys
+type Consumer struct {
+	ID        string             `json:"id"`
+	Name      string             `json:"name"`
+	Groups    []string           `json:"groups,omitempty"`
+	BasicAuth *ConsumerBasicAuth `json:"basic_auth,omitempty"`
+	APIKeys   []ConsumerAPIKey   `json:"api_keys,omitempty"`
+	Enabled   bool               `json:"enabled"`
+}
+
+// ConsumerBasicAuth holds a consumer's basic auth username and bcrypt password hash
+type ConsumerBasicAuth struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+}
+
+// ConsumerAPIKey is a hashed API key; the plain key is only returned when it is created
+type ConsumerAPIKey struct {
+	ID        string `json:"id"`
+	Prefix    string `json:"prefix"`   // first characters of the key, for identification in the UI
+	KeyHash   string `json:"key_hash"` // hex SHA-256 of the key
+	CreatedAt string `json:"created_at"`
 }
 
 // HealthCheck represents health check configuration for a service
@@ -65,51 +354,77 @@ type HealthCheck struct {
 
 // UDPRoute maps a UDP listen port to a backend service (for UDP proxying).
 type UDPRoute struct {
-	ID         string `json:"id"`
-	Name       string `json:"name,omitempty"`
-	ListenPort int    `json:"listen_port"` // UDP port the gateway listens on
-	ServiceID  string `json:"service_id"`  // ID of the backend service (Host:Port, Protocol=udp)
-	Enabled    bool   `json:"enabled"`
+	ID         string        `json:"id"`
+	Name       string        `json:"name,omitempty"`
+	ListenPort int           `json:"listen_port"` // UDP port the gateway listens on
+	ServiceID  string        `json:"service_id"`  // ID of the backend service (Host:Port, Protocol=udp)
+	Access     *AccessPolicy `json:"access,omitempty"`
+	Enabled    bool          `json:"enabled"`
 }
 
 // TCPRoute maps a TCP listen port to a backend service (raw TCP forwarding, e.g. for tunnel).
 type TCPRoute struct {
-	ID         string `json:"id"`
-	Name       string `json:"name,omitempty"`
-	ListenPort int    `json:"listen_port"` // TCP port the gateway listens on
-	ServiceID  string `json:"service_id"`  // ID of the backend service (Host:Port)
-	Enabled    bool   `json:"enabled"`
+	ID            string        `json:"id"`
+	Name          string        `json:"name,omitempty"`
+	ListenPort    int           `json:"listen_port"` // TCP port the gateway listens on
+	ServiceID     string        `json:"service_id"`  // ID of the backend service (Host:Port)
+	Access        *AccessPolicy `json:"access,omitempty"`
+	ProxyProtocol bool          `json:"proxy_protocol,omitempty"` // accept PROXY protocol v1/v2 from trusted proxies
+	Enabled       bool          `json:"enabled"`
 }
 
 // CORSConfig holds CORS response header settings for the gateway
 type CORSConfig struct {
 	Enabled          bool     `json:"enabled"`
-	AllowOrigins     []string `json:"allow_origins,omitempty"`     // e.g. ["*"] or ["https://app.example.com"]
-	AllowMethods     []string `json:"allow_methods,omitempty"`     // e.g. ["GET","POST","PUT","DELETE","OPTIONS"]
-	AllowHeaders     []string `json:"allow_headers,omitempty"`     // e.g. ["Content-Type","Authorization"]
-	ExposeHeaders    []string `json:"expose_headers,omitempty"`   // headers exposed to the browser
-	AllowCredentials bool     `json:"allow_credentials"`         // Access-Control-Allow-Credentials
-	MaxAge           int      `json:"max_age"`                    // preflight cache in seconds (0 = no cache)
+	AllowOrigins     []string `json:"allow_origins,omitempty"`  // e.g. ["*"] or ["https://app.example.com"]
+	AllowMethods     []string `json:"allow_methods,omitempty"`  // e.g. ["GET","POST","PUT","DELETE","OPTIONS"]
+	AllowHeaders     []string `json:"allow_headers,omitempty"`  // e.g. ["Content-Type","Authorization"]
+	ExposeHeaders    []string `json:"expose_headers,omitempty"` // headers exposed to the browser
+	AllowCredentials bool     `json:"allow_credentials"`        // Access-Control-Allow-Credentials
+	MaxAge           int      `json:"max_age"`                  // preflight cache in seconds (0 = no cache)
 }
 
 // GatewayConfig represents the overall gateway configuration
 type GatewayConfig struct {
-	HTTPPort         int                   `json:"http_port"`
-	HTTPSPort        int                   `json:"https_port"`
-	HTTPSEnabled     bool                  `json:"https_enabled"`
-	TLSCertFile      string                `json:"tls_cert_file,omitempty"`
-	TLSKeyFile       string                `json:"tls_key_file,omitempty"`
-	LetsEncrypt      *LetsEncryptConfig    `json:"lets_encrypt,omitempty"`
-	Services         []Service             `json:"services"`
-	Routes           []Route               `json:"routes"`
-	UDPRoutes        []UDPRoute            `json:"udp_routes,omitempty"`
-	TCPRoutes        []TCPRoute            `json:"tcp_routes,omitempty"`
-	GlobalRateLimit  *RateLimitConfig      `json:"global_rate_limit,omitempty"`
-	LogLevel         string                `json:"log_level"`
-	AccessLogEnabled bool                  `json:"access_log_enabled"`
-	Observability    *ObservabilityConfig  `json:"observability,omitempty"`
-	ClientSecurity   *ClientSecurityConfig `json:"client_security,omitempty"`
-	Enabled          bool                  `json:"enabled"`
+	HTTPPort         int                    `json:"http_port"`
+	HTTPSPort        int                    `json:"https_port"`
+	HTTPSEnabled     bool                   `json:"https_enabled"`
+	TLSCertFile      string                 `json:"tls_cert_file,omitempty"`
+	TLSKeyFile       string                 `json:"tls_key_file,omitempty"`
+	Certificates     []TLSCertificate       `json:"certificates,omitempty"`    // uploaded certificates, selected by SNI
+	CertificateDir   string                 `json:"certificate_dir,omitempty"` // watched directory of <name>.crt/<name>.key pairs
+	CacheMaxBytes    int64                  `json:"cache_max_bytes,omitempty"` // response cache memory bound (default 64 MiB)
+	LetsEncrypt      *LetsEncryptConfig     `json:"lets_encrypt,omitempty"`
+	Services         []Service              `json:"services"`
+	Routes           []Route                `json:"routes"`
+	UDPRoutes        []UDPRoute             `json:"udp_routes,omitempty"`
+	TCPRoutes        []TCPRoute             `json:"tcp_routes,omitempty"`
+	Consumers        []Consumer             `json:"consumers,omitempty"`
+	GlobalRateLimit  *RateLimitConfig       `json:"global_rate_limit,omitempty"`
+	LogLevel         string                 `json:"log_level"`
+	AccessLogEnabled bool                   `json:"access_log_enabled"`
+	BodyLogSkipTypes []string               `json:"body_log_skip_types,omitempty"` // content types (or prefixes like "multipart/") whose bodies are not logged
+	Observability    *ObservabilityConfig   `json:"observability,omitempty"`
+	ClientSecurity   *ClientSecurityConfig  `json:"client_security,omitempty"`
+	WAF              *WAFConfig             `json:"waf,omitempty"`
+	IPSets           []IPSet                `json:"ip_sets,omitempty"`               // named address lists shared by route access policies
+	GeoIPDatabase    string                 `json:"geoip_database,omitempty"`        // MaxMind-format .mmdb file for country rules
+	TrustedProxies   []string               `json:"trusted_proxies,omitempty"`       // CIDRs whose forwarded headers and PROXY protocol headers are believed
+	ProxyProtocol    *ProxyProtocolConfig   `json:"proxy_protocol,omitempty"`        // accept PROXY protocol on the HTTP/HTTPS listeners
+	DrainTimeoutSec  int                    `json:"drain_timeout_seconds,omitempty"` // how long replaced or stopped listeners wait for open requests (default 10)
+	DockerDiscovery  *DockerDiscoveryConfig `json:"docker_discovery,omitempty"`      // services and routes from container labels
+	Enabled          bool                   `json:"enabled"`
+}
+
+// DockerDiscoveryConfig creates read-only services and routes for running containers that carry
+// gateway labels, e.g. redock.gateway.host=api.local and redock.gateway.port=8080. Further labels:
+// path (comma-separated, default /), protocol, strip_path, priority, network, enable=false to opt
+// out and service to group replicas under one name (default: the compose service).
+type DockerDiscoveryConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Endpoint    string `json:"endpoint,omitempty"`     // Docker API address, e.g. unix:///var/run/docker.sock (default from DOCKER_HOST)
+	Network     string `json:"network,omitempty"`      // network whose container IP is used (default: the compose project's network)
+	LabelPrefix string `json:"label_prefix,omitempty"` // default redock.gateway
 }
 
 // ClientSecurityConfig toggles request tracking and auto-blocking behaviour
@@ -119,9 +434,120 @@ type ClientSecurityConfig struct {
 	AutoBlockEnabled     bool                `json:"auto_block_enabled"`
 	NoRouteThreshold     int                 `json:"no_route_threshold"`
 	AutoBlockDurationSec int                 `json:"auto_block_duration_seconds"`
+	WAFHitThreshold      int                 `json:"waf_hit_threshold"`    // requests matched by the WAF (blocked or detected) before a client is auto-blocked
+	Policies             []AutoBlockPolicy   `json:"policies,omitempty"`   // additional triggers counted over sliding windows
+	Escalation           *BlockEscalation    `json:"escalation,omitempty"` // lengthen auto-blocks for repeat offenders
+	AllowList            []string            `json:"allow_list,omitempty"` // addresses or CIDR ranges that are never auto-blocked
+	ShareWithDNS         bool                `json:"share_with_dns"`       // mirror auto-blocks into the DNS server's client ban list
 	ManualBlocks         []ManualBlockConfig `json:"manual_blocks,omitempty"`
 }
 
+// AutoBlockPolicy blocks a client once Threshold matching requests were seen within the window
+type AutoBlockPolicy struct {
+	Trigger     string `json:"trigger"`                    // auth_failure (401/403), rate_limited (429), waf, server_error (5xx) or request_rate
+	Threshold   int    `json:"threshold"`                  // matching requests within the window
+	WindowSec   int    `json:"window_seconds"`             // sliding window length
+	DurationSec int    `json:"duration_seconds,omitempty"` // base block duration (default auto_block_duration_seconds)
+}
+
+// BlockEscalation multiplies the block duration for every auto-block of a client that
+// follows an earlier one within ForgetAfterSec, up to MaxDurationSec.
+type BlockEscalation struct {
+	Multiplier     float64 `json:"multiplier,omitempty"`           // default 2
+	MaxDurationSec int     `json:"max_duration_seconds,omitempty"` // default 1 day
+	ForgetAfterSec int     `json:"forget_after_seconds,omitempty"` // offenses older than this are forgotten (default 1 day)
+}
+
+// ConfigRevision is a saved version of the gateway configuration
+type ConfigRevision struct {
+	Revision  int            `json:"revision"`
+	Author    string         `json:"author"`
+	Message   string         `json:"message"` // what changed, or e.g. "rollback to revision 3"
+	CreatedAt time.Time      `json:"created_at"`
+	Config    *GatewayConfig `json:"config,omitempty"` // only set when a single revision is requested
+}
+
+const (
+	configChangeAdded   = "added"
+	configChangeRemoved = "removed"
+	configChangeChanged = "changed"
+)
+
+// ConfigChange is one difference between two configurations. Path addresses the value in
+// the config JSON; list entries with an ID are addressed by it, e.g. routes[api].paths[0].
+type ConfigChange struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"` // added, removed or changed
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+// ConfigValidation is the result of a dry run of a configuration
+type ConfigValidation struct {
+	Valid    bool           `json:"valid"`
+	Errors   []string       `json:"errors,omitempty"`
+	Warnings []string       `json:"warnings,omitempty"`
+	Changes  []ConfigChange `json:"changes"` // against the current configuration
+}
+
+// ProxyProtocolConfig enables PROXY protocol v1/v2 on the HTTP listeners. Headers are only
+// accepted from TrustedProxies; other peers are served as plain connections.
+type ProxyProtocolConfig struct {
+	HTTP  bool `json:"http"`
+	HTTPS bool `json:"https"` // read before the TLS handshake
+}
+
+// IPSet is a named list of addresses and CIDR ranges that access policies refer to
+type IPSet struct {
+	Name  string   `json:"name"`
+	CIDRs []string `json:"cidrs"` // e.g. 10.0.0.0/8, 2001:db8::/32 or 203.0.113.7
+}
+
+// AccessPolicy restricts which clients may use a route. Deny rules win; when any allow
+// rule is set, clients must match at least one of them.
+type AccessPolicy struct {
+	Allow           []string `json:"allow,omitempty"`             // addresses or CIDR ranges
+	Deny            []string `json:"deny,omitempty"`              // addresses or CIDR ranges
+	AllowSets       []string `json:"allow_sets,omitempty"`        // names of IP sets
+	DenySets        []string `json:"deny_sets,omitempty"`         // names of IP sets
+	AllowCountries  []string `json:"allow_countries,omitempty"`   // ISO 3166 codes, resolved with the GeoIP database
+	DenyCountries   []string `json:"deny_countries,omitempty"`    // ISO 3166 codes, resolved with the GeoIP database
+	DenyBody        string   `json:"deny_body,omitempty"`         // body of the 403 response (HTTP routes, default "Forbidden")
+	DenyContentType string   `json:"deny_content_type,omitempty"` // content type of DenyBody (default text/plain)
+}
+
+// WAFConfig configures the web application firewall that inspects HTTP requests
+// before they are routed. Routes can override the mode and exclude rules.
+type WAFConfig struct {
+	Enabled          bool      `json:"enabled"`
+	Mode             string    `json:"mode,omitempty"`               // block (default) or detect (match and log only; matches still count towards client auto-blocking)
+	DisableCoreRules bool      `json:"disable_core_rules,omitempty"` // skip the shipped SQLi/XSS/traversal/scanner rules
+	Rules            []WAFRule `json:"rules,omitempty"`              // custom rules, checked after the core rule set
+	DisabledRules    []string  `json:"disabled_rules,omitempty"`     // rule IDs switched off on every route
+	MaxBodyBytes     int64     `json:"max_body_bytes,omitempty"`     // request body bytes inspected (default 64 KiB)
+}
+
+// WAFRule matches a regular expression against parts of a request
+type WAFRule struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description,omitempty"`
+	Targets     []string `json:"targets"` // path, query, headers, header:<name> or body
+	Pattern     string   `json:"pattern"`
+}
+
+// RouteWAFConfig overrides the gateway WAF for a single route
+type RouteWAFConfig struct {
+	Mode       string         `json:"mode,omitempty"` // off, detect or block; empty = gateway mode
+	Exclusions []WAFExclusion `json:"exclusions,omitempty"`
+}
+
+// WAFExclusion switches a rule off on a route, optionally only below some paths or for some targets
+type WAFExclusion struct {
+	RuleID  string   `json:"rule_id"`
+	Paths   []string `json:"paths,omitempty"`   // path prefixes; empty = the whole route
+	Targets []string `json:"targets,omitempty"` // e.g. body or header:Cookie; empty = every target
+}
+
 // ManualBlockConfig persists manually blocked clients in configuration
 type ManualBlockConfig struct {
 	IP        string `json:"ip"`
@@ -150,6 +576,19 @@ type ObservabilityConfig struct {
 	ClickHousePassword string                    `json:"clickhouse_password,omitempty"`
 	BatchSize          int                       `json:"batch_size"`
 	FlushInterval      int                       `json:"flush_interval"` // in seconds
+	Tracing            *TracingConfig            `json:"tracing,omitempty"`
+}
+
+// TracingConfig controls distributed tracing of proxied requests
+type TracingConfig struct {
+	Enabled            bool              `json:"enabled"`
+	Endpoint           string            `json:"endpoint,omitempty"`       // OTLP/HTTP collector base URL (default: the OTLP endpoint)
+	Headers            map[string]string `json:"headers,omitempty"`        // sent with every export (default: the OTLP headers)
+	ServiceName        string            `json:"service_name,omitempty"`   // resource service.name (default "api_gateway")
+	SampleRatio        *float64          `json:"sample_ratio,omitempty"`   // share of new traces kept, 0-1 (default 1)
+	AlwaysSampleErrors bool              `json:"always_sample_errors"`     // keep traces of 5xx responses whatever the ratio
+	BatchSize          int               `json:"batch_size,omitempty"`     // spans per export (default 512)
+	FlushInterval      int               `json:"flush_interval,omitempty"` // in seconds (default 5)
 }
 
 // LokiDatasourceConfig holds Loki datasource details
@@ -179,15 +618,47 @@ type GraylogConfig struct {
 
 // LetsEncryptConfig represents Let's Encrypt certificate configuration
 type LetsEncryptConfig struct {
-	Enabled          bool     `json:"enabled"`
-	Email            string   `json:"email"`
-	Domains          []string `json:"domains"`
-	Staging          bool     `json:"staging"`           // Use staging server for testing
-	AutoRenew        bool     `json:"auto_renew"`        // Auto-renew before expiry
-	RenewBeforeDays  int      `json:"renew_before_days"` // Days before expiry to renew
-	LastRenewAt      string   `json:"last_renew_at,omitempty"`
-	ExpiresAt        string   `json:"expires_at,omitempty"`
-	CertificateReady bool     `json:"certificate_ready"`
+	Enabled               bool     `json:"enabled"`
+	Email                 string   `json:"email"`
+	Domains               []string `json:"domains"`
+	Staging               bool     `json:"staging"`                           // Use staging server for testing
+	AutoRenew             bool     `json:"auto_renew"`                        // Auto-renew before expiry
+	RenewBeforeDays       int      `json:"renew_before_days"`                 // Days before expiry to renew
+	PerDomain             bool     `json:"per_domain"`                        // One order/certificate per domain instead of a single SAN certificate
+	ChallengeType         string   `json:"challenge_type"`                    // http-01 (default) or dns-01 (required for wildcards)
+	DNSProvider           string   `json:"dns_provider"`                      // dns-01 record provider: cloudflare (default) or dns_server
+	DNSResolvers          []string `json:"dns_resolvers,omitempty"`           // nameservers polled for propagation (default: authoritative NS)
+	DNSPropagationTimeout int      `json:"dns_propagation_timeout,omitempty"` // seconds to wait for TXT propagation (default 120)
+	DirectoryURL          string   `json:"directory_url,omitempty"`           // ACME directory override, e.g. a local Pebble (trust its CA via SSL_CERT_FILE)
+	LastRenewAt           string   `json:"last_renew_at,omitempty"`
+	ExpiresAt             string   `json:"expires_at,omitempty"`
+	CertificateReady      bool     `json:"certificate_ready"`
+}
+
+// TLSCertificate represents an uploaded certificate served by SNI
+type TLSCertificate struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	CertFile  string   `json:"cert_file"`
+	KeyFile   string   `json:"key_file"`
+	DNSNames  []string `json:"dns_names,omitempty"`
+	NotAfter  string   `json:"not_after,omitempty"`
+	CreatedAt string   `json:"created_at,omitempty"`
+}
+
+// CertificateInfo describes a certificate loaded in the SNI certificate store
+type CertificateInfo struct {
+	ID        string    `json:"id"`
+	Source    string    `json:"source"` // default, upload, directory, letsencrypt
+	CertFile  string    `json:"cert_file"`
+	KeyFile   string    `json:"key_file"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	DNSNames  []string  `json:"dns_names"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	Valid     bool      `json:"valid"`
+	Default   bool      `json:"default"` // served when no name matches
 }
 
 // RateLimitConfig represents global rate limiting configuration
@@ -199,7 +670,37 @@ type RateLimitConfig struct {
 
 // ServiceHealth represents the health status of a service
 type ServiceHealth struct {
-	ServiceID    string    `json:"service_id"`
+	ServiceID    string         `json:"service_id"`
+	Healthy      bool           `json:"healthy"`
+	LastCheck    time.Time      `json:"last_check"`
+	SuccessCount int            `json:"success_count"`
+	FailureCount int            `json:"failure_count"`
+	ResponseTime int64          `json:"response_time_ms"`
+	LastError    string         `json:"last_error,omitempty"`
+	Targets      []TargetHealth `json:"targets,omitempty"` // per-target results; service is healthy while any target is
+	Circuit      *CircuitStatus `json:"circuit,omitempty"` // circuit breaker state when enabled for the service
+}
+
+// CircuitStatus is the circuit breaker state of a service and its targets
+type CircuitStatus struct {
+	State   string                `json:"state"` // closed, open (every target ejected), half_open
+	Targets []TargetCircuitStatus `json:"targets"`
+}
+
+// TargetCircuitStatus is the circuit breaker state of a single target
+type TargetCircuitStatus struct {
+	Address             string    `json:"address"`
+	State               string    `json:"state"` // closed, open, half_open
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Requests            int64     `json:"requests"` // live requests in the error rate window
+	Failures            int64     `json:"failures"`
+	Ejections           int       `json:"ejections"`
+	OpenUntil           time.Time `json:"open_until,omitempty"`
+}
+
+// TargetHealth represents the health status of a single service target
+type TargetHealth struct {
+	Address      string    `json:"address"`
 	Healthy      bool      `json:"healthy"`
 	LastCheck    time.Time `json:"last_check"`
 	SuccessCount int       `json:"success_count"`
@@ -228,6 +729,11 @@ type RequestLog struct {
 	RequestBodyTruncated  bool      `json:"request_body_truncated,omitempty"`
 	ResponseBodyTruncated bool      `json:"response_body_truncated,omitempty"`
 	UserAgent             string    `json:"user_agent"`
+	Consumer              string    `json:"consumer,omitempty"`
+	Retries               int       `json:"retries,omitempty"`      // upstream retries made for the request
+	CacheStatus           string    `json:"cache_status,omitempty"` // HIT, MISS, STALE or REVALIDATED on cached routes
+	WAFRule               string    `json:"waf_rule,omitempty"`     // WAF rule that matched, in detect or block mode
+	TraceID               string    `json:"trace_id,omitempty"`     // W3C trace ID when tracing is enabled
 	Error                 string    `json:"error,omitempty"`
 }
 
@@ -240,22 +746,72 @@ type GatewayStats struct {
 	AverageLatency float64         `json:"average_latency_ms"`
 	ServiceStats   []ServiceStats  `json:"service_stats"`
 	RateLimitStats RateLimitStats  `json:"rate_limit_stats"`
+	CacheStats     CacheStats      `json:"cache_stats"`
+	WAFStats       WAFStats        `json:"waf_stats"`
 	TopClients     []ClientStats   `json:"top_clients,omitempty"`
 	BlockedClients []BlockedClient `json:"blocked_clients,omitempty"`
 }
 
 // ServiceStats represents per-service statistics
 type ServiceStats struct {
-	ServiceID      string  `json:"service_id"`
-	Requests       int64   `json:"requests"`
-	Errors         int64   `json:"errors"`
-	AverageLatency float64 `json:"average_latency_ms"`
+	ServiceID            string  `json:"service_id"`
+	Requests             int64   `json:"requests"`
+	Errors               int64   `json:"errors"`
+	Retries              int64   `json:"retries"`
+	ServerErrors         int64   `json:"server_errors"`          // 5xx responses returned by the service
+	MirroredRequests     int64   `json:"mirrored_requests"`      // copies received as a mirror target
+	MirrorErrors         int64   `json:"mirror_errors"`          // mirrored copies that failed or returned 5xx
+	RetryBudgetExhausted int64   `json:"retry_budget_exhausted"` // retries skipped because the retry budget was spent
+	AverageLatency       float64 `json:"average_latency_ms"`
+}
+
+// CacheStats represents response cache statistics
+type CacheStats struct {
+	Hits        int64             `json:"hits"`
+	Misses      int64             `json:"misses"`
+	Stale       int64             `json:"stale"`
+	Revalidated int64             `json:"revalidated"`
+	HitRatio    float64           `json:"hit_ratio"` // share of lookups answered from the cache (hit, stale, revalidated)
+	Entries     int               `json:"entries"`
+	SizeBytes   int64             `json:"size_bytes"`
+	MaxBytes    int64             `json:"max_bytes"`
+	Routes      []RouteCacheStats `json:"routes,omitempty"`
+}
+
+// RouteCacheStats represents response cache statistics of a single route
+type RouteCacheStats struct {
+	RouteID     string  `json:"route_id"`
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	Stale       int64   `json:"stale"`
+	Revalidated int64   `json:"revalidated"`
+	HitRatio    float64 `json:"hit_ratio"`
 }
 
 // RateLimitStats represents rate limiting statistics
 type RateLimitStats struct {
-	TotalLimited int64 `json:"total_limited"`
-	CurrentUsage int   `json:"current_usage"`
+	TotalLimited int64                 `json:"total_limited"`
+	CurrentUsage int                   `json:"current_usage"`
+	Routes       []RouteRateLimitStats `json:"routes,omitempty"` // per-route rejections
+}
+
+// RouteRateLimitStats represents rate limit rejections of a single route
+type RouteRateLimitStats struct {
+	RouteID string `json:"route_id"`
+	Limited int64  `json:"limited"`
+}
+
+// WAFStats represents web application firewall matches
+type WAFStats struct {
+	Detected int64          `json:"detected"` // matches let through in detect mode
+	Blocked  int64          `json:"blocked"`
+	Rules    []WAFRuleStats `json:"rules,omitempty"`
+}
+
+// WAFRuleStats represents the matches of a single WAF rule
+type WAFRuleStats struct {
+	RuleID string `json:"rule_id"`
+	Hits   int64  `json:"hits"`
 }
 
 // ClientStats represents tracked metrics for an individual client IP
@@ -268,6 +824,8 @@ type ClientStats struct {
 	LastStatus        int       `json:"last_status"`
 	ConsecutiveMisses int       `json:"consecutive_misses"`
 	TotalMisses       int64     `json:"total_misses"`
+	WAFHits           int64     `json:"waf_hits"`
+	Offenses          int       `json:"offenses"` // auto-blocks counted towards escalation
 	Blocked           bool      `json:"blocked"`
 	BlockedUntil      time.Time `json:"blocked_until,omitempty"`
 	BlockedReason     string    `json:"blocked_reason,omitempty"`
@@ -300,13 +858,46 @@ type clientRateLimit struct {
 // Gateway represents the API gateway server
 type Gateway struct {
 	config           *GatewayConfig
-	httpServer       *http.Server
-	httpsServer      *http.Server
-	httpListener     net.Listener
-	httpsListener    net.Listener
-	services         map[string]*Service
-	routes           []*Route
+	httpListener     *serverListener
+	httpsListener    *serverListener
+	streamListeners  map[string]*streamListener // TCP and UDP route listeners by "tcp:<id>" / "udp:<id>"
+	services         map[string]*Service        // routing snapshot: replaced as a whole, never modified in place
+	routes           []*Route                   // routing snapshot, sorted by priority
 	serviceHealth    map[string]*ServiceHealth
+	balancers        map[string]*loadBalancer
+	balancersMu      sync.Mutex
+	transports       map[string]*http.Transport
+	transportsMu     sync.Mutex
+	retryBudgets     map[string]*retryBudget
+	retryBudgetsMu   sync.Mutex
+	mirrorsInFlight  atomic.Int64
+	responseCache    *responseCache
+	responseCacheMu  sync.Mutex
+	jwtVerifiers     map[string]*jwtVerifier
+	jwtVerifiersMu   sync.Mutex
+	forwardAuths     map[string]*forwardAuthenticator
+	forwardAuthsMu   sync.Mutex
+	oidcProviders    map[string]*oidcProvider
+	oidcProvidersMu  sync.Mutex
+	docker           *dockerDiscovery // running Docker label provider, nil when off
+	dockerMu         sync.Mutex
+	transformers     map[string]*routeTransformer
+	transformersMu   sync.Mutex
+	waf              *wafEngine
+	wafMu            sync.RWMutex
+	accessPolicies   map[string]*accessPolicy
+	accessPoliciesMu sync.Mutex
+	geoIP            *mmdbReader
+	geoIPFile        geoIPFile
+	geoIPMu          sync.RWMutex
+	tracer           *tracer
+	tracerMu         sync.RWMutex
+	trustedProxies   []netip.Prefix
+	trustedProxiesMu sync.RWMutex
+	consumers        *consumerIndex
+	consumersMu      sync.RWMutex
+	routeLimiters    map[string]*routeRateLimiter
+	routeLimitersMu  sync.Mutex
 	rateLimiter      *rateLimiter
 	globalLimiter    *rateLimiter
 	stats            *gatewayStatsTracker
@@ -315,7 +906,7 @@ type Gateway struct {
 	stopChan         chan struct{}
 	workDir          string
 	httpClient       *http.Client
-	tlsConfig        *tls.Config
+	certs            certStore
 	routeCache       map[string]*cachedRoute
 	routeCacheOrder  []string
 	routeCacheLimit  int
@@ -326,24 +917,37 @@ type Gateway struct {
 	clientStatsMu    sync.RWMutex
 	persistentBlocks map[string]BlockedClient
 	blockListMu      sync.Mutex
+	revisions        []configRevision
+	revisionsMu      sync.Mutex
+	editor           configEditor // guarded by revisionsMu
+	editMu           sync.Mutex   // serializes EditAs and RollbackConfig
 }
 
 // gatewayStatsTracker tracks gateway statistics
 type gatewayStatsTracker struct {
-	mu            sync.RWMutex
-	startTime     time.Time
-	totalRequests int64
-	totalErrors   int64
-	totalLatency  int64
-	serviceStats  map[string]*serviceStatsTracker
-	rateLimited   int64
+	mu               sync.RWMutex
+	startTime        time.Time
+	totalRequests    int64
+	totalErrors      int64
+	totalLatency     int64
+	serviceStats     map[string]*serviceStatsTracker
+	rateLimited      int64
+	routeRateLimited map[string]int64
+	wafDetected      int64
+	wafBlocked       int64
+	wafRuleHits      map[string]int64
 }
 
 // serviceStatsTracker tracks per-service statistics
 type serviceStatsTracker struct {
-	requests     int64
-	errors       int64
-	totalLatency int64
+	requests             int64
+	errors               int64
+	retries              int64
+	retryBudgetExhausted int64
+	serverErrors         int64
+	mirrored             int64
+	mirrorErrors         int64
+	totalLatency         int64
 }
 
 // clientStatsTracker keeps in-memory metrics per client IP
@@ -356,6 +960,12 @@ type clientStatsTracker struct {
 	lastStatus        int
 	consecutiveMisses int
 	totalMisses       int64
+	wafHits           int // WAF-blocked requests since the last auto-block
+	totalWAFHits      int64
+	policyWindows     []slidingWindow // one per ClientSecurityConfig.Policies entry
+	offenses          int             // auto-blocks within the escalation memory
+	offensesExpire    time.Time       // offenses are forgotten after this
+	sharedWithDNS     bool            // the current block was copied to the DNS ban list
 	blockedUntil      time.Time
 	blockedAt         time.Time
 	manualBlocked     bool
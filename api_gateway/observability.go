@@ -226,11 +226,15 @@ func (e *TelemetryExporter) sendToLoki(lokiCfg *LokiDatasourceConfig, data []Req
 	streams := make([]map[string]interface{}, 0)
 
 	for _, entry := range data {
+		line := fmt.Sprintf("method=%s path=%s status=%d duration=%dms service=%s",
+			entry.Method, entry.Path, entry.StatusCode, entry.Duration, entry.ServiceID)
+		if entry.TraceID != "" {
+			line += " trace_id=" + entry.TraceID
+		}
 		values := [][]interface{}{
 			{
 				fmt.Sprintf("%d", entry.Timestamp.UnixNano()),
-				fmt.Sprintf("method=%s path=%s status=%d duration=%dms service=%s",
-					entry.Method, entry.Path, entry.StatusCode, entry.Duration, entry.ServiceID),
+				line,
 			},
 		}
 
@@ -377,6 +381,9 @@ func (e *TelemetryExporter) sendToGraylog(graylogCfg *GraylogConfig, data []Requ
 		if entry.Error != "" {
 			payload["_error"] = entry.Error
 		}
+		if entry.TraceID != "" {
+			payload["_trace_id"] = entry.TraceID
+		}
 		if graylogCfg.StreamID != "" {
 			payload["_stream_id"] = graylogCfg.StreamID
 		}
@@ -0,0 +1,733 @@
+package api_gateway
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultOIDCRedirectPath = "/oauth2/callback"
+	defaultOIDCLogoutPath   = "/oauth2/logout"
+	defaultOIDCCookieName   = "gw_session"
+	defaultOIDCGroupsClaim  = "groups"
+	defaultOIDCSessionTTL   = 8 * time.Hour
+	oidcLoginTTL            = 10 * time.Minute
+	oidcDiscoveryTTL        = time.Hour
+	oidcDiscoveryRetryDelay = 30 * time.Second
+	oidcMaxResponseBytes    = 1 << 20
+	oidcMaxCookieBytes      = 4000
+)
+
+var (
+	defaultOIDCScopes   = []string{"openid", "email", "profile"}
+	oidcAlgorithms      = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+	oidcIdentityHeaders = []string{"X-Auth-Request-User", "X-Auth-Request-Email", "X-Auth-Request-Groups"}
+)
+
+// oidcNow is the clock of OIDC sessions (replaced in tests)
+var oidcNow = time.Now
+
+func (c *OIDCAuthConfig) redirectPath() string {
+	if c.RedirectPath != "" {
+		return c.RedirectPath
+	}
+	return defaultOIDCRedirectPath
+}
+
+func (c *OIDCAuthConfig) logoutPath() string {
+	if c.LogoutPath != "" {
+		return c.LogoutPath
+	}
+	return defaultOIDCLogoutPath
+}
+
+func (c *OIDCAuthConfig) cookieName() string {
+	if c.CookieName != "" {
+		return c.CookieName
+	}
+	return defaultOIDCCookieName
+}
+
+// validateRouteOIDC checks the OIDC settings of a route before it is saved
+func validateRouteOIDC(route *Route) error {
+	if route.AuthType != "oidc" {
+		return nil
+	}
+	c := route.OIDC
+	if c == nil || c.Issuer == "" || c.ClientID == "" {
+		return fmt.Errorf("oidc auth requires an issuer and a client_id")
+	}
+	u, err := url.Parse(c.Issuer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid oidc issuer %q", c.Issuer)
+	}
+	if len(c.CookieSecret) < 32 {
+		return fmt.Errorf("oidc cookie_secret must have at least 32 characters")
+	}
+	if c.SessionTTL < 0 {
+		return fmt.Errorf("oidc session_ttl must not be negative")
+	}
+	for _, p := range []string{c.redirectPath(), c.logoutPath()} {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("oidc path %q must start with /", p)
+		}
+		if pathMatchScore(route.Paths, p) < 0 {
+			return fmt.Errorf("oidc path %s is not matched by the route's paths", p)
+		}
+	}
+	return nil
+}
+
+// oidcDiscovery is the part of the provider metadata the login flow needs
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcTokens is a token endpoint response
+type oidcTokens struct {
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Error        string `json:"error"`
+}
+
+// oidcSession is the content of the encrypted session cookie
+type oidcSession struct {
+	Issuer       string            `json:"iss"`
+	ClientID     string            `json:"aud"`
+	Subject      string            `json:"sub"`
+	Email        string            `json:"email,omitempty"` // only verified addresses
+	Groups       []string          `json:"groups,omitempty"`
+	Claims       map[string]string `json:"claims,omitempty"` // values for claim_headers
+	RefreshToken string            `json:"rt,omitempty"`
+	RefreshAt    int64             `json:"rat,omitempty"` // tokens expire and are refreshed (0 = no refresh token)
+	Expires      int64             `json:"exp"`           // a new login is required
+}
+
+// oidcLogin is a login in progress, kept in a short-lived cookie until the callback
+type oidcLogin struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier"` // PKCE code verifier
+	Nonce    string `json:"nonce"`
+	Target   string `json:"target"` // URI the user asked for
+	Expires  int64  `json:"exp"`
+}
+
+// oidcProvider runs the login flow of a route against its issuer
+type oidcProvider struct {
+	cfg      OIDCAuthConfig
+	aead     cipher.AEAD
+	client   *http.Client
+	mu       sync.Mutex
+	meta     *oidcDiscovery
+	fetched  time.Time
+	verifier *jwtVerifier
+
+	discoverLoad chan struct{} // closed when the fetch in flight finishes
+	discoverErr  error         // result of the last fetch
+	attempted    time.Time     // when the last fetch finished
+}
+
+func newOIDCProvider(cfg OIDCAuthConfig) (*oidcProvider, error) {
+	key := sha256.Sum256([]byte(cfg.CookieSecret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &oidcProvider{cfg: cfg, aead: aead, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// discover returns the provider metadata and the ID token verifier, fetching the metadata
+// again once an hour. The metadata is fetched without holding p.mu; requests arriving while a
+// fetch is in flight wait for it and share its result. Stale metadata is used while the issuer
+// cannot be reached, and a failed fetch is not retried for oidcDiscoveryRetryDelay.
+func (p *oidcProvider) discover() (*oidcDiscovery, *jwtVerifier, error) {
+	p.mu.Lock()
+	if !p.discoveryStaleLocked(time.Now()) {
+		defer p.mu.Unlock()
+		return p.discoveredLocked()
+	}
+	if load := p.discoverLoad; load != nil {
+		p.mu.Unlock()
+		<-load
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.discoveredLocked()
+	}
+	load := make(chan struct{})
+	p.discoverLoad = load
+	p.mu.Unlock()
+
+	meta, err := p.fetchDiscovery()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		if p.verifier == nil || p.verifier.cfg.JWKSURL != meta.JWKSURI || p.verifier.cfg.Issuer != meta.Issuer {
+			p.verifier = newJWTVerifier(JWTAuthConfig{
+				Algorithms: oidcAlgorithms,
+				JWKSURL:    meta.JWKSURI,
+				Issuer:     meta.Issuer,
+				Audience:   []string{p.cfg.ClientID},
+				LeewaySec:  60,
+			})
+		}
+		p.meta, p.fetched = meta, time.Now()
+	}
+	p.discoverErr, p.attempted = err, time.Now()
+	p.discoverLoad = nil
+	close(load)
+	return p.discoveredLocked()
+}
+
+// discoveryStaleLocked reports whether the metadata should be fetched (must be called with p.mu held)
+func (p *oidcProvider) discoveryStaleLocked(now time.Time) bool {
+	if p.discoverErr != nil && now.Sub(p.attempted) < oidcDiscoveryRetryDelay {
+		return false
+	}
+	return p.meta == nil || now.Sub(p.fetched) >= oidcDiscoveryTTL
+}
+
+// discoveredLocked returns the cached metadata, or the error of the last fetch when there is
+// none (must be called with p.mu held)
+func (p *oidcProvider) discoveredLocked() (*oidcDiscovery, *jwtVerifier, error) {
+	if p.meta == nil {
+		return nil, nil, fmt.Errorf("oidc discovery: %w", p.discoverErr)
+	}
+	return p.meta, p.verifier, nil
+}
+
+func (p *oidcProvider) fetchDiscovery() (*oidcDiscovery, error) {
+	issuer := strings.TrimSuffix(p.cfg.Issuer, "/")
+	resp, err := p.client.Get(issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	var meta oidcDiscovery
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(&meta); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("issuer %q does not match %q", meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("metadata lacks authorization, token or jwks endpoint")
+	}
+	return &meta, nil
+}
+
+// seal encrypts v for the cookie name; a cookie cannot be replayed under another name
+func (p *oidcProvider) seal(name string, v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(p.aead.Seal(nonce, nonce, data, []byte(name))), nil
+}
+
+// open decrypts a cookie value sealed for name into v
+func (p *oidcProvider) open(name, value string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return err
+	}
+	size := p.aead.NonceSize()
+	if len(data) < size {
+		return errors.New("cookie too short")
+	}
+	plain, err := p.aead.Open(nil, data[:size], data[size:], []byte(name))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plain, v)
+}
+
+func (p *oidcProvider) loginCookieName() string {
+	return p.cfg.cookieName() + "_login"
+}
+
+// cookie returns a gateway cookie for the request's scheme; maxAge < 0 deletes it
+func (p *oidcProvider) cookie(r *http.Request, name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   externalScheme(r) == "https",
+		// Lax so that the cookie comes along with the provider's redirect back to the callback
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// sessionCookie seals a session. A refresh token that does not fit into the cookie is dropped;
+// the session then lasts until it expires.
+func (p *oidcProvider) sessionCookie(r *http.Request, s *oidcSession) (*http.Cookie, error) {
+	name := p.cfg.cookieName()
+	value, err := p.seal(name, s)
+	if err == nil && len(value) > oidcMaxCookieBytes && s.RefreshToken != "" {
+		s.RefreshToken, s.RefreshAt = "", 0
+		value, err = p.seal(name, s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(value) > oidcMaxCookieBytes {
+		return nil, fmt.Errorf("session cookie exceeds %d bytes", oidcMaxCookieBytes)
+	}
+	return p.cookie(r, name, value, int(time.Until(time.Unix(s.Expires, 0)).Seconds())), nil
+}
+
+// externalScheme is the scheme the client used, as told by a trusted proxy when there is one
+func externalScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if info, ok := clientInfoFromRequest(r); ok && info.trustedPeer && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		return "https"
+	}
+	return "http"
+}
+
+func (p *oidcProvider) redirectURI(r *http.Request) string {
+	return externalScheme(r) + "://" + r.Host + p.cfg.redirectPath()
+}
+
+// redirectResponse answers with a redirect that must not be cached
+func redirectResponse(location string, cookies ...*http.Cookie) *authResponse {
+	header := http.Header{}
+	header.Set("Location", location)
+	header.Set("Cache-Control", "no-store")
+	for _, c := range cookies {
+		header.Add("Set-Cookie", c.String())
+	}
+	return &authResponse{status: http.StatusFound, header: header}
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// login starts the authorization code flow for a browser; other clients get 401
+func (p *oidcProvider) login(r *http.Request) error {
+	if (r.Method != http.MethodGet && r.Method != http.MethodHead) || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return &authError{reason: "no oidc session"}
+	}
+	meta, _, err := p.discover()
+	if err != nil {
+		return &authError{status: http.StatusBadGateway, reason: err.Error()}
+	}
+
+	login := oidcLogin{Target: r.URL.RequestURI(), Expires: oidcNow().Add(oidcLoginTTL).Unix()}
+	// A target like //host would send the user elsewhere after login
+	if !strings.HasPrefix(login.Target, "/") || strings.HasPrefix(login.Target, "//") || strings.HasPrefix(login.Target, "/\\") {
+		login.Target = "/"
+	}
+	for _, field := range []*string{&login.State, &login.Verifier, &login.Nonce} {
+		if *field, err = randomToken(); err != nil {
+			return &authError{status: http.StatusInternalServerError, reason: err.Error()}
+		}
+	}
+	value, err := p.seal(p.loginCookieName(), login)
+	if err != nil {
+		return &authError{status: http.StatusInternalServerError, reason: err.Error()}
+	}
+
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultOIDCScopes
+	}
+	challenge := sha256.Sum256([]byte(login.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.redirectURI(r)},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {login.State},
+		"nonce":                 {login.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	cookie := p.cookie(r, p.loginCookieName(), value, int(oidcLoginTTL.Seconds()))
+	return &authError{status: http.StatusFound, reason: "oidc login required", response: redirectResponse(meta.AuthorizationEndpoint+sep+query.Encode(), cookie)}
+}
+
+// callback completes a login: it checks the state, redeems the code and sets the session
+func (p *oidcProvider) callback(r *http.Request) (*authResult, error) {
+	var login oidcLogin
+	c, err := r.Cookie(p.loginCookieName())
+	if err != nil || p.open(p.loginCookieName(), c.Value, &login) != nil || oidcNow().Unix() >= login.Expires {
+		return nil, &authError{status: http.StatusBadRequest, reason: "oidc callback without a login in progress"}
+	}
+	query := r.URL.Query()
+	if query.Get("state") != login.State {
+		return nil, &authError{status: http.StatusBadRequest, reason: "oidc state mismatch"}
+	}
+	if e := query.Get("error"); e != "" {
+		return nil, &authError{status: http.StatusForbidden, reason: "oidc login failed: " + strings.TrimSpace(e+" "+query.Get("error_description"))}
+	}
+	if query.Get("code") == "" {
+		return nil, &authError{status: http.StatusBadRequest, reason: "oidc callback without a code"}
+	}
+
+	tokens, err := p.exchange(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {query.Get("code")},
+		"redirect_uri":  {p.redirectURI(r)},
+		"code_verifier": {login.Verifier},
+	})
+	if err != nil {
+		return nil, &authError{status: http.StatusBadGateway, reason: err.Error()}
+	}
+	session, err := p.newSession(tokens, login.Nonce, nil)
+	if err != nil {
+		return nil, &authError{reason: err.Error()}
+	}
+	if reason := p.authorize(session); reason != "" {
+		return nil, &authError{status: http.StatusForbidden, reason: reason}
+	}
+	sessionCookie, err := p.sessionCookie(r, session)
+	if err != nil {
+		return nil, &authError{status: http.StatusInternalServerError, reason: err.Error()}
+	}
+	return &authResult{response: redirectResponse(login.Target, sessionCookie, p.cookie(r, p.loginCookieName(), "", -1))}, nil
+}
+
+// exchange posts a grant to the token endpoint
+func (p *oidcProvider) exchange(form url.Values) (*oidcTokens, error) {
+	meta, _, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	form.Set("client_id", p.cfg.ClientID)
+	req, err := http.NewRequest(http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	var tokens oidcTokens
+	decodeErr := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(&tokens)
+	if resp.StatusCode != http.StatusOK {
+		if tokens.Error != "" {
+			return nil, fmt.Errorf("oidc token endpoint: %s", tokens.Error)
+		}
+		return nil, fmt.Errorf("oidc token endpoint: %s", resp.Status)
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("oidc token endpoint: %w", decodeErr)
+	}
+	return &tokens, nil
+}
+
+// newSession builds a session from a token response. On refresh, previous is the current
+// session: the identity is kept when no new ID token comes back, and must not change when one does.
+func (p *oidcProvider) newSession(tokens *oidcTokens, nonce string, previous *oidcSession) (*oidcSession, error) {
+	now := oidcNow()
+	s := &oidcSession{}
+	if previous != nil {
+		*s = *previous
+	}
+	s.Issuer, s.ClientID = p.cfg.Issuer, p.cfg.ClientID
+
+	if tokens.IDToken == "" && previous == nil {
+		return nil, errors.New("oidc token response without id_token")
+	}
+	if tokens.IDToken != "" {
+		_, verifier, err := p.discover()
+		if err != nil {
+			return nil, err
+		}
+		claims, err := verifier.verify(tokens.IDToken)
+		if err != nil {
+			return nil, fmt.Errorf("oidc id_token: %w", err)
+		}
+		sub, _ := claims["sub"].(string)
+		switch {
+		case sub == "":
+			return nil, errors.New("oidc id_token without subject")
+		case previous == nil && claims["nonce"] != nonce:
+			return nil, errors.New("oidc id_token nonce mismatch")
+		case previous != nil && sub != previous.Subject:
+			return nil, errors.New("oidc id_token subject changed on refresh")
+		}
+		s.Subject = sub
+		s.Email = ""
+		if email, _ := claims["email"].(string); email != "" && claims["email_verified"] != false {
+			s.Email = email
+		}
+		s.Groups = claimList(claims, p.groupsClaim())
+		s.Claims = nil
+		for claim := range p.cfg.ClaimHeaders {
+			if value, ok := lookupClaim(claims, claim); ok {
+				if s.Claims == nil {
+					s.Claims = make(map[string]string)
+				}
+				s.Claims[claim] = value
+			}
+		}
+	}
+
+	if tokens.RefreshToken != "" {
+		s.RefreshToken = tokens.RefreshToken
+	}
+	s.RefreshAt = 0
+	if s.RefreshToken != "" {
+		expiresIn := time.Duration(tokens.ExpiresIn) * time.Second
+		if expiresIn <= 0 {
+			expiresIn = 5 * time.Minute
+		}
+		s.RefreshAt = now.Add(expiresIn).Unix()
+	}
+	if previous == nil {
+		ttl := defaultOIDCSessionTTL
+		if p.cfg.SessionTTL > 0 {
+			ttl = time.Duration(p.cfg.SessionTTL) * time.Second
+		}
+		s.Expires = now.Add(ttl).Unix()
+	}
+	return s, nil
+}
+
+func (p *oidcProvider) groupsClaim() string {
+	if p.cfg.GroupsClaim != "" {
+		return p.cfg.GroupsClaim
+	}
+	return defaultOIDCGroupsClaim
+}
+
+// claimList returns a list or string claim (dotted names reach into objects) as strings
+func claimList(claims jwt.MapClaims, name string) []string {
+	var current any = map[string]any(claims)
+	for _, part := range strings.Split(name, ".") {
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = obj[part]
+	}
+	switch v := current.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// session returns the request's valid session, refreshing its tokens when they expired.
+// refreshed reports that the session changed and its cookie has to be set again.
+func (p *oidcProvider) session(r *http.Request) (s *oidcSession, refreshed bool, err error) {
+	c, err := r.Cookie(p.cfg.cookieName())
+	if err != nil {
+		return nil, false, nil
+	}
+	var current oidcSession
+	if p.open(p.cfg.cookieName(), c.Value, &current) != nil {
+		return nil, false, nil
+	}
+	now := oidcNow().Unix()
+	if current.Issuer != p.cfg.Issuer || current.ClientID != p.cfg.ClientID || now >= current.Expires {
+		return nil, false, nil
+	}
+	if current.RefreshAt == 0 || now < current.RefreshAt {
+		return &current, false, nil
+	}
+
+	// A refresh the provider refuses (revoked user, rotated token) ends the session
+	tokens, err := p.exchange(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {current.RefreshToken}})
+	if err != nil {
+		return nil, false, err
+	}
+	if s, err = p.newSession(tokens, "", &current); err != nil {
+		return nil, false, err
+	}
+	return s, true, nil
+}
+
+// authorize returns why a session's user may not use the route, or "" when it may
+func (p *oidcProvider) authorize(s *oidcSession) string {
+	c := p.cfg
+	if len(c.AllowedEmails) > 0 || len(c.AllowedDomains) > 0 {
+		if s.Email == "" {
+			return "oidc user has no verified email"
+		}
+		_, domain, _ := strings.Cut(s.Email, "@")
+		allowed := slices.ContainsFunc(c.AllowedEmails, func(e string) bool { return strings.EqualFold(e, s.Email) }) ||
+			slices.ContainsFunc(c.AllowedDomains, func(d string) bool { return strings.EqualFold(strings.TrimPrefix(d, "@"), domain) })
+		if !allowed {
+			return "oidc user " + s.Email + " is not allowed"
+		}
+	}
+	if len(c.AllowedGroups) > 0 && !slices.ContainsFunc(s.Groups, func(g string) bool { return slices.Contains(c.AllowedGroups, g) }) {
+		return "oidc user is not in an allowed group"
+	}
+	return ""
+}
+
+// identityHeaders are the upstream headers of a session's user
+func (p *oidcProvider) identityHeaders(s *oidcSession) map[string]string {
+	headers := map[string]string{"X-Auth-Request-User": s.Subject}
+	if s.Email != "" {
+		headers["X-Auth-Request-Email"] = s.Email
+	}
+	if len(s.Groups) > 0 {
+		headers["X-Auth-Request-Groups"] = strings.Join(s.Groups, ",")
+	}
+	for claim, header := range p.cfg.ClaimHeaders {
+		if value, ok := s.Claims[claim]; ok {
+			headers[header] = value
+		}
+	}
+	return headers
+}
+
+// stripOIDCRequest removes identity headers a client may have sent and the gateway's own
+// cookies from a request before it goes upstream
+func stripOIDCRequest(r *http.Request, cfg *OIDCAuthConfig) {
+	for _, header := range oidcIdentityHeaders {
+		r.Header.Del(header)
+	}
+	for _, header := range cfg.ClaimHeaders {
+		r.Header.Del(header)
+	}
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != cfg.cookieName() && c.Name != cfg.cookieName()+"_login" {
+			r.AddCookie(c)
+		}
+	}
+}
+
+// oidcProviderFor returns the cached provider of a route, creating it on first use
+func (g *Gateway) oidcProviderFor(route *Route) (*oidcProvider, error) {
+	g.oidcProvidersMu.Lock()
+	defer g.oidcProvidersMu.Unlock()
+	if g.oidcProviders == nil {
+		g.oidcProviders = make(map[string]*oidcProvider)
+	}
+	if p, ok := g.oidcProviders[route.ID]; ok {
+		return p, nil
+	}
+	p, err := newOIDCProvider(*route.OIDC)
+	if err != nil {
+		return nil, err
+	}
+	g.oidcProviders[route.ID] = p
+	return p, nil
+}
+
+// refreshOIDCProviders drops the providers of routes that were removed or whose OIDC settings
+// changed; the others keep their discovery metadata and keys (must be called with g.mu held after
+// the routes are published)
+func (g *Gateway) refreshOIDCProviders() {
+	g.oidcProvidersMu.Lock()
+	defer g.oidcProvidersMu.Unlock()
+
+	providers := make(map[string]*oidcProvider)
+	for _, route := range g.routes {
+		if p, ok := g.oidcProviders[route.ID]; ok && route.OIDC != nil && reflect.DeepEqual(p.cfg, *route.OIDC) {
+			providers[route.ID] = p
+		}
+	}
+	g.oidcProviders = providers
+}
+
+// checkOIDC authenticates the request with the route's OIDC session, handling the callback
+// and logout paths and sending browsers without a session to the provider's login.
+func (g *Gateway) checkOIDC(r *http.Request, route *Route) (*authResult, error) {
+	if route.OIDC == nil {
+		return nil, &authError{reason: "no oidc provider configured for route"}
+	}
+	p, err := g.oidcProviderFor(route)
+	if err != nil {
+		return nil, &authError{status: http.StatusInternalServerError, reason: err.Error()}
+	}
+
+	switch r.URL.Path {
+	case p.cfg.redirectPath():
+		return p.callback(r)
+	case p.cfg.logoutPath():
+		expired := []*http.Cookie{p.cookie(r, p.cfg.cookieName(), "", -1), p.cookie(r, p.loginCookieName(), "", -1)}
+		return &authResult{response: redirectResponse("/", expired...)}, nil
+	}
+
+	s, refreshed, err := p.session(r)
+	if s == nil {
+		if err != nil {
+			log.Printf("API Gateway: oidc session of route %s ended: %v", route.ID, err)
+		}
+		return nil, p.login(r)
+	}
+	if reason := p.authorize(s); reason != "" {
+		return nil, &authError{status: http.StatusForbidden, reason: reason}
+	}
+
+	result := &authResult{headers: p.identityHeaders(s), consumer: s.Email}
+	if result.consumer == "" {
+		result.consumer = s.Subject
+	}
+	if refreshed {
+		cookie, err := p.sessionCookie(r, s)
+		if err != nil {
+			return nil, &authError{status: http.StatusInternalServerError, reason: err.Error()}
+		}
+		result.cookies = []*http.Cookie{cookie}
+	}
+	return result, nil
+}
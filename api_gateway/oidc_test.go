@@ -0,0 +1,327 @@
+package api_gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockOIDCProvider is a minimal OpenID provider: discovery, JWKS, authorization with PKCE,
+// and the authorization_code and refresh_token grants for a single confidential client
+type mockOIDCProvider struct {
+	*httptest.Server
+	t         *testing.T
+	key       *ecdsa.PrivateKey
+	mu        sync.Mutex
+	identity  jwt.MapClaims // claims of the user logging in next
+	codes     map[string]url.Values
+	refresh   map[string]jwt.MapClaims
+	refreshes int
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p := &mockOIDCProvider{t: t, key: key, codes: map[string]url.Values{}, refresh: map[string]jwt.MapClaims{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": "k1",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(key.PublicKey.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(key.PublicKey.Y.FillBytes(make([]byte, 32))),
+		}}})
+	})
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *mockOIDCProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	assert.Equal(p.t, "code", q.Get("response_type"))
+	assert.Equal(p.t, "grafana", q.Get("client_id"))
+	assert.Equal(p.t, "S256", q.Get("code_challenge_method"))
+	assert.Equal(p.t, "openid email profile", q.Get("scope"))
+	code := rand.Text()
+	p.mu.Lock()
+	p.codes[code] = q
+	p.mu.Unlock()
+	http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{"code": {code}, "state": {q.Get("state")}}.Encode(), http.StatusFound)
+}
+
+func (p *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	if id, secret, ok := r.BasicAuth(); !ok || id != "grafana" || secret != "s3cret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	claims := jwt.MapClaims{}
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		auth, ok := p.codes[r.PostFormValue("code")]
+		delete(p.codes, r.PostFormValue("code"))
+		challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || auth.Get("redirect_uri") != r.PostFormValue("redirect_uri") ||
+			auth.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		for name, value := range p.identity {
+			claims[name] = value
+		}
+		claims["nonce"] = auth.Get("nonce")
+	case "refresh_token":
+		identity, ok := p.refresh[r.PostFormValue("refresh_token")]
+		delete(p.refresh, r.PostFormValue("refresh_token"))
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		p.refreshes++
+		claims = identity
+	}
+	claims["iss"] = p.URL
+	claims["aud"] = "grafana"
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = "k1"
+	idToken, err := token.SignedString(p.key)
+	require.NoError(p.t, err)
+	refreshToken := rand.Text()
+	p.refresh[refreshToken] = jwt.MapClaims{"sub": claims["sub"], "email": claims["email"], "groups": claims["groups"], "preferred_username": claims["preferred_username"]}
+	json.NewEncoder(w).Encode(map[string]any{"id_token": idToken, "refresh_token": refreshToken, "expires_in": 300, "token_type": "Bearer"})
+}
+
+func TestValidateRouteOIDC(t *testing.T) {
+	secret := strings.Repeat("x", 32)
+	assert.NoError(t, validateRouteOIDC(&Route{AuthType: "jwt"}))
+	assert.NoError(t, validateRouteOIDC(&Route{AuthType: "oidc", Paths: []string{"/*"}, OIDC: &OIDCAuthConfig{Issuer: "https://sso.example.com/realms/dev", ClientID: "grafana", CookieSecret: secret}}))
+	assert.EqualError(t, validateRouteOIDC(&Route{AuthType: "oidc"}), "oidc auth requires an issuer and a client_id")
+	assert.EqualError(t, validateRouteOIDC(&Route{AuthType: "oidc", OIDC: &OIDCAuthConfig{Issuer: "sso.example.com", ClientID: "grafana", CookieSecret: secret}}), `invalid oidc issuer "sso.example.com"`)
+	assert.EqualError(t, validateRouteOIDC(&Route{AuthType: "oidc", OIDC: &OIDCAuthConfig{Issuer: "https://sso.example.com", ClientID: "grafana", CookieSecret: "short"}}), "oidc cookie_secret must have at least 32 characters")
+	assert.EqualError(t, validateRouteOIDC(&Route{AuthType: "oidc", Paths: []string{"/grafana/*"}, OIDC: &OIDCAuthConfig{Issuer: "https://sso.example.com", ClientID: "grafana", CookieSecret: secret}}), "oidc path /oauth2/callback is not matched by the route's paths")
+	assert.NoError(t, validateRouteOIDC(&Route{AuthType: "oidc", Paths: []string{"/grafana/*"}, OIDC: &OIDCAuthConfig{Issuer: "https://sso.example.com", ClientID: "grafana", CookieSecret: secret, RedirectPath: "/grafana/callback", LogoutPath: "/grafana/logout"}}))
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := newMockOIDCProvider(t)
+	provider.identity = jwt.MapClaims{"sub": "u-1", "email": "Ann@Example.com", "email_verified": true, "groups": []string{"admins", "dev"}, "preferred_username": "ann"}
+
+	var upstream http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.Header.Clone()
+		fmt.Fprint(w, "dashboard")
+	}))
+	defer backend.Close()
+	hostParts := splitHostPort(strings.TrimPrefix(backend.URL, "http://"))
+	g := newProxyTestGateway(&Service{ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true})
+	route := g.routes[0]
+	route.AuthRequired = true
+	route.AuthType = "oidc"
+	route.OIDC = &OIDCAuthConfig{
+		Issuer:         provider.URL,
+		ClientID:       "grafana",
+		ClientSecret:   "s3cret",
+		CookieSecret:   strings.Repeat("k", 32),
+		AllowedDomains: []string{"example.com"},
+		AllowedGroups:  []string{"admins"},
+		ClaimHeaders:   map[string]string{"preferred_username": "X-WEBAUTH-USER"},
+	}
+	require.NoError(t, validateRouteOIDC(route))
+
+	send := func(method, target string, cookies []*http.Cookie, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, req)
+		return rec
+	}
+	browser := http.Header{"Accept": {"text/html,application/xhtml+xml"}}
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	// login runs the browser's round trip through the provider and returns the callback answer
+	login := func(target string) *httptest.ResponseRecorder {
+		rec := send("GET", target, nil, browser)
+		require.Equal(t, http.StatusFound, rec.Code)
+		location := rec.Header().Get("Location")
+		require.True(t, strings.HasPrefix(location, provider.URL+"/authorize?"), location)
+		resp, err := noRedirects.Get(location)
+		require.NoError(t, err)
+		resp.Body.Close()
+		callback := resp.Header.Get("Location")
+		require.True(t, strings.HasPrefix(callback, "http://grafana.example.com/oauth2/callback?"), callback)
+		return send("GET", callback, rec.Result().Cookies(), nil)
+	}
+
+	// API clients are not redirected
+	assert.Equal(t, http.StatusUnauthorized, send("GET", "http://grafana.example.com/api/health", nil, nil).Code)
+
+	rec := login("http://grafana.example.com/d/home?orgId=1")
+	require.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/d/home?orgId=1", rec.Header().Get("Location"))
+	var session *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "gw_session" {
+			session = c
+		}
+	}
+	require.NotNil(t, session)
+	assert.True(t, session.HttpOnly)
+
+	// the session reaches the upstream as identity headers; spoofed ones and the gateway's cookie don't
+	theme := &http.Cookie{Name: "theme", Value: "dark"}
+	rec = send("GET", "http://grafana.example.com/d/home", []*http.Cookie{session, theme}, http.Header{"X-Auth-Request-Email": {"boss@example.com"}, "X-Webauth-User": {"admin"}})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "dashboard", rec.Body.String())
+	assert.Equal(t, "u-1", upstream.Get("X-Auth-Request-User"))
+	assert.Equal(t, "Ann@Example.com", upstream.Get("X-Auth-Request-Email"))
+	assert.Equal(t, "admins,dev", upstream.Get("X-Auth-Request-Groups"))
+	assert.Equal(t, "ann", upstream.Get("X-WEBAUTH-USER"))
+	assert.Equal(t, "theme=dark", upstream.Get("Cookie"))
+
+	// a callback replayed without its login cookie is refused
+	assert.Equal(t, http.StatusBadRequest, send("GET", "http://grafana.example.com/oauth2/callback?code=x&state=y", nil, nil).Code)
+	// a tampered session is no session
+	tampered := &http.Cookie{Name: "gw_session", Value: session.Value[:len(session.Value)-2] + "AA"}
+	assert.Equal(t, http.StatusUnauthorized, send("GET", "http://grafana.example.com/d/home", []*http.Cookie{tampered}, nil).Code)
+
+	// expired tokens are refreshed and the new session is sent back
+	oidcNow = func() time.Time { return time.Now().Add(10 * time.Minute) }
+	defer func() { oidcNow = time.Now }()
+	rec = send("GET", "http://grafana.example.com/d/home", []*http.Cookie{session}, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, provider.refreshes)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.NotEqual(t, session.Value, cookies[0].Value)
+	// the old refresh token was rotated away, so the old session is over
+	assert.Equal(t, http.StatusUnauthorized, send("GET", "http://grafana.example.com/d/home", []*http.Cookie{session}, nil).Code)
+	session = cookies[0]
+	require.Equal(t, http.StatusOK, send("GET", "http://grafana.example.com/d/home", []*http.Cookie{session}, nil).Code)
+	oidcNow = time.Now
+
+	// logout clears the session cookie
+	rec = send("GET", "http://grafana.example.com/oauth2/logout", []*http.Cookie{session}, nil)
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/", rec.Header().Get("Location"))
+	assert.Contains(t, rec.Header().Values("Set-Cookie"), "gw_session=; Path=/; Max-Age=0; HttpOnly; SameSite=Lax")
+
+	// users outside the allowed domains and groups are refused
+	provider.identity = jwt.MapClaims{"sub": "u-2", "email": "eve@other.org", "email_verified": true, "groups": []string{"admins"}}
+	assert.Equal(t, http.StatusForbidden, login("http://grafana.example.com/").Code)
+	provider.identity = jwt.MapClaims{"sub": "u-3", "email": "bob@example.com", "email_verified": false, "groups": []string{"admins"}}
+	assert.Equal(t, http.StatusForbidden, login("http://grafana.example.com/").Code)
+	provider.identity = jwt.MapClaims{"sub": "u-4", "email": "joe@example.com", "email_verified": true, "groups": []string{"dev"}}
+	assert.Equal(t, http.StatusForbidden, login("http://grafana.example.com/").Code)
+}
+
+func TestOIDCProvidersKeptForUnchangedRoutes(t *testing.T) {
+	g := NewGateway(t.TempDir())
+	require.NoError(t, g.AddService(Service{ID: "web", Host: "127.0.0.1", Port: 9000, Enabled: true}))
+	app := Route{ID: "app", ServiceID: "web", Paths: []string{"/*"}, AuthRequired: true, AuthType: "oidc", Enabled: true,
+		OIDC: &OIDCAuthConfig{Issuer: "https://sso.example.com", ClientID: "grafana", CookieSecret: strings.Repeat("k", 32)}}
+	require.NoError(t, g.AddRoute(app))
+	require.NoError(t, g.AddRoute(Route{ID: "other", ServiceID: "web", Paths: []string{"/other"}, Priority: 1, Enabled: true}))
+
+	provider, err := g.oidcProviderFor(&app)
+	require.NoError(t, err)
+	require.NoError(t, g.UpdateRoute(Route{ID: "other", ServiceID: "web", Paths: []string{"/other", "/more"}, Priority: 1, Enabled: true}))
+	kept, err := g.oidcProviderFor(&app)
+	require.NoError(t, err)
+	assert.Same(t, provider, kept, "editing another route keeps the provider")
+
+	app.OIDC = &OIDCAuthConfig{Issuer: "https://sso.example.com", ClientID: "wiki", CookieSecret: strings.Repeat("k", 32)}
+	require.NoError(t, g.UpdateRoute(app))
+	rebuilt, err := g.oidcProviderFor(&app)
+	require.NoError(t, err)
+	assert.NotSame(t, provider, rebuilt, "new OIDC settings build a new provider")
+}
+
+func TestOIDCDiscoveryCoalescedAndStale(t *testing.T) {
+	var fetches atomic.Int32
+	var failing atomic.Bool
+	release := make(chan struct{})
+	var issuer string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": issuer + "/authorize",
+			"token_endpoint":         issuer + "/token",
+			"jwks_uri":               issuer + "/jwks",
+		})
+	}))
+	defer server.Close()
+	issuer = server.URL
+	p, err := newOIDCProvider(OIDCAuthConfig{Issuer: issuer, ClientID: "grafana", CookieSecret: strings.Repeat("k", 32)})
+	require.NoError(t, err)
+
+	// concurrent logins share one fetch
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			meta, _, err := p.discover()
+			assert.NoError(t, err)
+			assert.Equal(t, issuer+"/token", meta.TokenEndpoint)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// an unreachable issuer leaves the stale metadata in use and is not asked again right away
+	failing.Store(true)
+	p.mu.Lock()
+	p.fetched = time.Now().Add(-oidcDiscoveryTTL)
+	p.mu.Unlock()
+	for range 3 {
+		meta, _, err := p.discover()
+		require.NoError(t, err)
+		assert.Equal(t, issuer+"/token", meta.TokenEndpoint)
+	}
+	assert.Equal(t, int32(2), fetches.Load())
+}
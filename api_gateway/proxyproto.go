@@ -0,0 +1,291 @@
+package api_gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	proxyProtocolV1 = "v1"
+	proxyProtocolV2 = "v2"
+
+	proxyHeaderTimeout = 5 * time.Second
+	proxyV1MaxLength   = 107 // longest v1 line including CRLF
+)
+
+// proxyV2Signature starts every PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var errInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+
+// proxyProtocolListener accepts connections that may start with a PROXY protocol v1 or v2
+// header. Headers are only parsed on connections from trusted peers; anything else is
+// passed through untouched, so untrusted clients cannot spoof their address.
+type proxyProtocolListener struct {
+	net.Listener
+	trusted func(netip.Addr) bool
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return newProxyProtocolConn(conn, l.trusted), nil
+}
+
+// proxyProtocolConn reads the PROXY header lazily, on the first Read or address lookup,
+// so a slow peer only holds up its own connection and not the accept loop.
+type proxyProtocolConn struct {
+	net.Conn
+	trusted func(netip.Addr) bool
+	reader  *bufio.Reader
+	once    sync.Once
+	remote  net.Addr
+	local   net.Addr
+	err     error
+}
+
+func newProxyProtocolConn(conn net.Conn, trusted func(netip.Addr) bool) *proxyProtocolConn {
+	return &proxyProtocolConn{Conn: conn, trusted: trusted, reader: bufio.NewReader(conn)}
+}
+
+// handshake reads the PROXY header if the peer sent one
+func (c *proxyProtocolConn) handshake() error {
+	c.once.Do(c.readHeader)
+	return c.err
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	if err := c.handshake(); err != nil {
+		return 0, err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtocolConn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *proxyProtocolConn) readHeader() {
+	peer, ok := c.Conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || c.trusted == nil || !c.trusted(peer.AddrPort().Addr().Unmap()) {
+		return
+	}
+	c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	first, err := c.reader.Peek(1)
+	if err != nil {
+		// Nothing to read (or the peer is silent); let the caller see that on its own Read
+		return
+	}
+	switch first[0] {
+	case 'P':
+		if prefix, err := c.reader.Peek(6); err == nil && string(prefix) == "PROXY " {
+			c.remote, c.local, c.err = readProxyV1(c.reader)
+		}
+	case '\r':
+		if prefix, err := c.reader.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(prefix, proxyV2Signature) {
+			c.remote, c.local, c.err = readProxyV2(c.reader)
+		}
+	}
+	if c.err != nil {
+		c.Conn.Close()
+	}
+}
+
+// readProxyV1 parses "PROXY TCP4|TCP6|UNKNOWN src dst sport dport\r\n"
+func readProxyV1(r *bufio.Reader) (remote, local net.Addr, err error) {
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, errInvalidProxyHeader
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, errInvalidProxyHeader
+	}
+	src, err1 := netip.ParseAddr(fields[2])
+	dst, err2 := netip.ParseAddr(fields[3])
+	sport, err3 := strconv.ParseUint(fields[4], 10, 16)
+	dport, err4 := strconv.ParseUint(fields[5], 10, 16)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || src.Is4() != (fields[1] == "TCP4") {
+		return nil, nil, errInvalidProxyHeader
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, uint16(sport))),
+		net.TCPAddrFromAddrPort(netip.AddrPortFrom(dst, uint16(dport))), nil
+}
+
+// readProxyV2 parses the binary v2 header; LOCAL commands and non-TCP families keep the
+// connection's own addresses.
+func readProxyV2(r *bufio.Reader) (remote, local net.Addr, err error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, nil, errInvalidProxyHeader
+	}
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+	command := header[12] & 0x0f
+	if command == 0 { // LOCAL: health checks from the proxy itself
+		return nil, nil, nil
+	}
+	if command != 1 {
+		return nil, nil, errInvalidProxyHeader
+	}
+
+	var addrLen int
+	switch header[13] {
+	case 0x11: // TCP over IPv4
+		addrLen = 4
+	case 0x21: // TCP over IPv6
+		addrLen = 16
+	default:
+		return nil, nil, nil
+	}
+	if length < 2*addrLen+4 {
+		return nil, nil, errInvalidProxyHeader
+	}
+	src, _ := netip.AddrFromSlice(payload[:addrLen])
+	dst, _ := netip.AddrFromSlice(payload[addrLen : 2*addrLen])
+	sport := binary.BigEndian.Uint16(payload[2*addrLen:])
+	dport := binary.BigEndian.Uint16(payload[2*addrLen+2:])
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, sport)),
+		net.TCPAddrFromAddrPort(netip.AddrPortFrom(dst, dport)), nil
+}
+
+// proxyProtocolHeader builds the header announcing src connecting to dst. Addresses that
+// cannot be expressed (unknown or mixed families) produce UNKNOWN / LOCAL headers.
+func proxyProtocolHeader(version string, src, dst netip.AddrPort) []byte {
+	src = netip.AddrPortFrom(src.Addr().Unmap(), src.Port())
+	dst = netip.AddrPortFrom(dst.Addr().Unmap(), dst.Port())
+	known := src.IsValid() && dst.IsValid() && src.Addr().Is4() == dst.Addr().Is4()
+
+	if version == proxyProtocolV2 {
+		var buf bytes.Buffer
+		buf.Write(proxyV2Signature)
+		if !known {
+			buf.Write([]byte{0x20, 0x00, 0x00, 0x00})
+			return buf.Bytes()
+		}
+		family, length := byte(0x11), uint16(12)
+		if src.Addr().Is6() {
+			family, length = 0x21, 36
+		}
+		buf.Write([]byte{0x21, family})
+		binary.Write(&buf, binary.BigEndian, length)
+		buf.Write(src.Addr().AsSlice())
+		buf.Write(dst.Addr().AsSlice())
+		binary.Write(&buf, binary.BigEndian, src.Port())
+		binary.Write(&buf, binary.BigEndian, dst.Port())
+		return buf.Bytes()
+	}
+
+	if !known {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+	family := "TCP4"
+	if src.Addr().Is6() {
+		family = "TCP6"
+	}
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, src.Addr(), dst.Addr(), src.Port(), dst.Port()))
+}
+
+// addrPortOf converts a connection address to an AddrPort; the zero value when it is not TCP
+func addrPortOf(addr net.Addr) netip.AddrPort {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.AddrPort()
+	}
+	if addr != nil {
+		if ap, err := netip.ParseAddrPort(addr.String()); err == nil {
+			return ap
+		}
+	}
+	return netip.AddrPort{}
+}
+
+// proxyProtocolEndpoints carries the addresses announced to upstreams that expect PROXY protocol
+type proxyProtocolEndpoints struct {
+	src, dst netip.AddrPort
+}
+
+type proxyProtocolEndpointsKey struct{}
+
+func withProxyProtocolEndpoints(ctx context.Context, e proxyProtocolEndpoints) context.Context {
+	return context.WithValue(ctx, proxyProtocolEndpointsKey{}, e)
+}
+
+// proxyProtocolDialer wraps a dial function so each new upstream connection starts with a
+// PROXY header for the client the dial was made for.
+func proxyProtocolDialer(version string, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		e, _ := ctx.Value(proxyProtocolEndpointsKey{}).(proxyProtocolEndpoints)
+		if _, err := conn.Write(proxyProtocolHeader(version, e.src, e.dst)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// requestProxyEndpoints returns the resolved client and the local listener address of a request
+func requestProxyEndpoints(r *http.Request) proxyProtocolEndpoints {
+	var e proxyProtocolEndpoints
+	if addr, err := netip.ParseAddr(getClientIP(r)); err == nil {
+		port := uint16(0)
+		if peer, err := netip.ParseAddrPort(r.RemoteAddr); err == nil && peer.Addr().Unmap() == addr.Unmap() {
+			port = peer.Port()
+		}
+		e.src = netip.AddrPortFrom(addr, port)
+	}
+	if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		e.dst = addrPortOf(local)
+	}
+	return e
+}
@@ -0,0 +1,117 @@
+package api_gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyProtocolHeaderRoundTrip(t *testing.T) {
+	src := netip.MustParseAddrPort("198.51.100.7:5555")
+	dst := netip.MustParseAddrPort("192.0.2.1:443")
+	assert.Equal(t, "PROXY TCP4 198.51.100.7 192.0.2.1 5555 443\r\n", string(proxyProtocolHeader(proxyProtocolV1, src, dst)))
+
+	for _, version := range []string{proxyProtocolV1, proxyProtocolV2} {
+		for _, pair := range [][2]netip.AddrPort{
+			{src, dst},
+			{netip.MustParseAddrPort("[2001:db8::7]:5555"), netip.MustParseAddrPort("[2001:db8::1]:443")},
+		} {
+			r := bufio.NewReader(bytes.NewReader(append(proxyProtocolHeader(version, pair[0], pair[1]), "GET /"...)))
+			var remote, local net.Addr
+			var err error
+			if version == proxyProtocolV1 {
+				remote, local, err = readProxyV1(r)
+			} else {
+				remote, local, err = readProxyV2(r)
+			}
+			require.NoError(t, err, version)
+			assert.Equal(t, pair[0], addrPortOf(remote), version)
+			assert.Equal(t, pair[1], addrPortOf(local), version)
+			rest, _ := io.ReadAll(r)
+			assert.Equal(t, "GET /", string(rest))
+		}
+	}
+
+	// unknown endpoints fall back to UNKNOWN / LOCAL, which keep the connection's own addresses
+	remote, _, err := readProxyV1(bufio.NewReader(bytes.NewReader(proxyProtocolHeader(proxyProtocolV1, netip.AddrPort{}, dst))))
+	assert.NoError(t, err)
+	assert.Nil(t, remote)
+	remote, _, err = readProxyV2(bufio.NewReader(bytes.NewReader(proxyProtocolHeader(proxyProtocolV2, src, netip.AddrPort{}))))
+	assert.NoError(t, err)
+	assert.Nil(t, remote)
+
+	_, _, err = readProxyV1(bufio.NewReader(bytes.NewReader([]byte("PROXY TCP4 1.2.3.4\r\n"))))
+	assert.Error(t, err)
+}
+
+// serveEchoRemoteAddr serves HTTP on a PROXY protocol listener and answers with the client address
+func serveEchoRemoteAddr(t *testing.T, trusted func(netip.Addr) bool) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	})}
+	go srv.Serve(&proxyProtocolListener{Listener: ln, trusted: trusted})
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	send := func(addr string, payload []byte) string {
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.Write(payload)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			return resp.Status
+		}
+		return string(body)
+	}
+	request := []byte("GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n")
+	v1 := append([]byte("PROXY TCP4 203.0.113.9 192.0.2.1 40000 80\r\n"), request...)
+	v2 := append(proxyProtocolHeader(proxyProtocolV2, netip.MustParseAddrPort("[2001:db8::9]:40000"), netip.MustParseAddrPort("[2001:db8::1]:80")), request...)
+
+	trusted := serveEchoRemoteAddr(t, func(netip.Addr) bool { return true })
+	assert.Equal(t, "203.0.113.9:40000", send(trusted, v1))
+	assert.Equal(t, "[2001:db8::9]:40000", send(trusted, v2))
+	// plain requests from a trusted peer are still served
+	assert.Contains(t, send(trusted, request), "127.0.0.1:")
+
+	// untrusted peers cannot announce another address
+	untrusted := serveEchoRemoteAddr(t, func(netip.Addr) bool { return false })
+	assert.Contains(t, send(untrusted, v1), "400")
+}
+
+func TestSendProxyProtocolUpstream(t *testing.T) {
+	for _, version := range []string{proxyProtocolV1, proxyProtocolV2} {
+		backend := serveEchoRemoteAddr(t, func(netip.Addr) bool { return true })
+		hostParts := splitHostPort(backend)
+		g := newProxyTestGateway(&Service{ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), ProxyProtocol: version, Enabled: true})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "198.51.100.7:5555"
+		req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 80}))
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, version)
+		assert.Equal(t, "198.51.100.7:5555", rec.Body.String(), version)
+	}
+
+	assert.Error(t, validateServiceProxyProtocol(&Service{ID: "s", ProxyProtocol: "v3"}))
+	assert.Error(t, validateClientAddressConfig(&GatewayConfig{ProxyProtocol: &ProxyProtocolConfig{HTTP: true}}))
+	assert.NoError(t, validateClientAddressConfig(&GatewayConfig{ProxyProtocol: &ProxyProtocolConfig{HTTP: true}, TrustedProxies: []string{"127.0.0.1"}}))
+}
@@ -0,0 +1,238 @@
+package api_gateway
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rateLimitKeyIP       = "ip"
+	rateLimitKeyHeader   = "header"
+	rateLimitKeyConsumer = "consumer"
+	rateLimitKeyJWTClaim = "jwt_claim"
+
+	// rateLimitSweepInterval is how often idle (fully refilled) buckets are dropped.
+	rateLimitSweepInterval = time.Minute
+)
+
+// tokenBucket is the state of a single limit key
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimitDecision is the outcome of a limiter check, used for RateLimit-* headers
+type rateLimitDecision struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration // until the bucket is full again
+	retryAfter time.Duration // until the next request is allowed (rejections only)
+}
+
+// routeRateLimiter is a token-bucket limiter kept per route for the lifetime of its config
+type routeRateLimiter struct {
+	mu        sync.Mutex
+	requests  int
+	window    time.Duration
+	burst     float64
+	rate      float64 // tokens per second
+	keyBy     string
+	keyName   string
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRouteRateLimiter(route *Route) *routeRateLimiter {
+	window := time.Duration(route.RateLimitWindow) * time.Second
+	if window <= 0 {
+		window = time.Second
+	}
+	burst := route.RateLimitBurst
+	if burst <= 0 {
+		burst = route.RateLimitRequests
+	}
+	keyBy := strings.ToLower(route.RateLimitKeyBy)
+	if keyBy == "" {
+		keyBy = rateLimitKeyIP
+	}
+	return &routeRateLimiter{
+		requests:  route.RateLimitRequests,
+		window:    window,
+		burst:     float64(burst),
+		rate:      float64(route.RateLimitRequests) / window.Seconds(),
+		keyBy:     keyBy,
+		keyName:   route.RateLimitKeyName,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// sameSettings reports whether the limiter was built from equivalent route settings,
+// so state can be kept across route refreshes.
+func (l *routeRateLimiter) sameSettings(other *routeRateLimiter) bool {
+	return l.requests == other.requests && l.window == other.window && l.burst == other.burst &&
+		l.keyBy == other.keyBy && l.keyName == other.keyName
+}
+
+// needsIdentity reports whether the key depends on the authenticated consumer or token.
+func (l *routeRateLimiter) needsIdentity() bool {
+	return l.keyBy == rateLimitKeyConsumer || l.keyBy == rateLimitKeyJWTClaim
+}
+
+// key derives the limit key for a request, falling back to the client IP when the
+// configured source is missing.
+func (l *routeRateLimiter) key(r *http.Request, clientIP string, auth *authResult) string {
+	switch l.keyBy {
+	case rateLimitKeyHeader:
+		if v := r.Header.Get(l.keyName); v != "" {
+			return "header:" + v
+		}
+	case rateLimitKeyConsumer:
+		if auth != nil && auth.consumer != "" {
+			return "consumer:" + auth.consumer
+		}
+	case rateLimitKeyJWTClaim:
+		if auth != nil && auth.claims != nil {
+			if v, ok := lookupClaim(auth.claims, l.keyName); ok && v != "" {
+				return "claim:" + v
+			}
+		}
+	}
+	return "ip:" + clientIP
+}
+
+// allow takes one token from the bucket for key.
+func (l *routeRateLimiter) allow(key string, now time.Time) rateLimitDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweepLocked(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	} else if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+
+	d := rateLimitDecision{limit: l.requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.allowed = true
+	} else {
+		d.retryAfter = l.durationFor(1 - b.tokens)
+	}
+	d.remaining = int(math.Floor(b.tokens))
+	d.reset = l.durationFor(l.burst - b.tokens)
+	return d
+}
+
+func (l *routeRateLimiter) durationFor(tokens float64) time.Duration {
+	if l.rate <= 0 || tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// sweepLocked drops buckets that have refilled completely; they are equivalent to new ones.
+func (l *routeRateLimiter) sweepLocked(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// setHeaders writes the RateLimit-* headers (draft-ietf-httpapi-ratelimit-headers) and Retry-After.
+func (d rateLimitDecision) setHeaders(h http.Header, window time.Duration) {
+	h.Set("RateLimit-Limit", strconv.Itoa(d.limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.reset)))
+	h.Set("RateLimit-Policy", strconv.Itoa(d.limit)+";w="+strconv.Itoa(ceilSeconds(window)))
+	if !d.allowed {
+		h.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(d.retryAfter))))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// rebuildGlobalLimiter creates the global limiter, keeping its state when the global limit
+// settings did not change (must be called with g.mu held).
+func (g *Gateway) rebuildGlobalLimiter() {
+	cfg := g.config.GlobalRateLimit
+	if cfg == nil || !cfg.Enabled {
+		g.globalLimiter = nil
+		return
+	}
+	window := time.Duration(cfg.Window) * time.Second
+	if existing := g.globalLimiter; existing != nil && existing.requests == cfg.Requests && existing.window == window {
+		return
+	}
+	g.globalLimiter = &rateLimiter{
+		clients:  make(map[string]*clientRateLimit),
+		requests: cfg.Requests,
+		window:   window,
+	}
+}
+
+// rebuildRouteLimiters creates limiters for rate-limited routes, keeping the state of
+// routes whose limit settings did not change (must be called with g.mu held).
+func (g *Gateway) rebuildRouteLimiters() {
+	g.routeLimitersMu.Lock()
+	defer g.routeLimitersMu.Unlock()
+
+	limiters := make(map[string]*routeRateLimiter)
+	for _, route := range g.routes {
+		if !route.RateLimitEnabled || route.RateLimitRequests <= 0 {
+			continue
+		}
+		limiter := newRouteRateLimiter(route)
+		if existing, ok := g.routeLimiters[route.ID]; ok && existing.sameSettings(limiter) {
+			limiter = existing
+		}
+		limiters[route.ID] = limiter
+	}
+	g.routeLimiters = limiters
+}
+
+// routeLimiterFor returns the limiter of a route, or nil if the route is not rate limited.
+func (g *Gateway) routeLimiterFor(route *Route) *routeRateLimiter {
+	if !route.RateLimitEnabled || route.RateLimitRequests <= 0 {
+		return nil
+	}
+	g.routeLimitersMu.Lock()
+	defer g.routeLimitersMu.Unlock()
+	if g.routeLimiters == nil {
+		g.routeLimiters = make(map[string]*routeRateLimiter)
+	}
+	limiter, ok := g.routeLimiters[route.ID]
+	if !ok {
+		limiter = newRouteRateLimiter(route)
+		g.routeLimiters[route.ID] = limiter
+	}
+	return limiter
+}
+
+// checkRouteRateLimit applies the route limiter and sets the rate limit response headers.
+// It returns false when the request must be rejected with 429.
+func (g *Gateway) checkRouteRateLimit(w http.ResponseWriter, r *http.Request, limiter *routeRateLimiter, clientIP string) bool {
+	span := startSpan(r, "rate_limit")
+	d := limiter.allow(limiter.key(r, clientIP, authResultFromRequest(r)), time.Now())
+	d.setHeaders(w.Header(), limiter.window)
+	span.set("gateway.rate_limit.scope", "route")
+	span.set("gateway.rate_limit.limited", !d.allowed)
+	span.end()
+	return d.allowed
+}
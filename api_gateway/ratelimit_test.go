@@ -0,0 +1,142 @@
+package api_gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteRateLimiterTokenBucket(t *testing.T) {
+	l := newRouteRateLimiter(&Route{RateLimitEnabled: true, RateLimitRequests: 2, RateLimitWindow: 1, RateLimitBurst: 3})
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		d := l.allow("k", now)
+		assert.True(t, d.allowed, "burst request %d", i)
+		assert.Equal(t, 2-i, d.remaining)
+	}
+	d := l.allow("k", now)
+	assert.False(t, d.allowed)
+	assert.Equal(t, 500*time.Millisecond, d.retryAfter)
+
+	// other keys have their own bucket
+	assert.True(t, l.allow("other", now).allowed)
+
+	// refills at 2 tokens/second
+	assert.True(t, l.allow("k", now.Add(500*time.Millisecond)).allowed)
+	assert.False(t, l.allow("k", now.Add(500*time.Millisecond)).allowed)
+
+	// idle full buckets are swept
+	l.allow("k", now.Add(rateLimitSweepInterval+time.Second))
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestRouteRateLimiterKey(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Tenant", "acme")
+	auth := &authResult{consumer: "alice", claims: jwt.MapClaims{"org": map[string]interface{}{"id": "o1"}}}
+
+	tests := []struct {
+		route    *Route
+		expected string
+	}{
+		{&Route{}, "ip:1.2.3.4"},
+		{&Route{RateLimitKeyBy: "header", RateLimitKeyName: "X-Tenant"}, "header:acme"},
+		{&Route{RateLimitKeyBy: "header", RateLimitKeyName: "X-Missing"}, "ip:1.2.3.4"},
+		{&Route{RateLimitKeyBy: "consumer"}, "consumer:alice"},
+		{&Route{RateLimitKeyBy: "jwt_claim", RateLimitKeyName: "org.id"}, "claim:o1"},
+	}
+	for _, test := range tests {
+		l := newRouteRateLimiter(test.route)
+		assert.Equal(t, test.expected, l.key(req, "1.2.3.4", auth))
+	}
+	assert.Equal(t, "ip:1.2.3.4", newRouteRateLimiter(&Route{RateLimitKeyBy: "consumer"}).key(req, "1.2.3.4", nil))
+}
+
+func TestHandleRequestRouteRateLimit(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+
+	g := &Gateway{
+		services: map[string]*Service{
+			"backend": {ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true},
+		},
+		serviceHealth: make(map[string]*ServiceHealth),
+		config: &GatewayConfig{Routes: []Route{{
+			ID:                "limited",
+			ServiceID:         "backend",
+			Paths:             []string{"/"},
+			RateLimitEnabled:  true,
+			RateLimitRequests: 2,
+			RateLimitWindow:   60,
+			Enabled:           true,
+		}}},
+		stats: &gatewayStatsTracker{startTime: time.Now(), serviceStats: make(map[string]*serviceStatsTracker)},
+	}
+	g.refreshRoutes()
+
+	codes := make([]int, 0, 3)
+	var last *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		last = httptest.NewRecorder()
+		g.handleRequest(last, httptest.NewRequest("GET", "/", nil))
+		codes = append(codes, last.Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+	assert.Equal(t, "2", last.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", last.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", last.Header().Get("Retry-After"))
+
+	// limiter state survives a refresh when the limit settings are unchanged
+	g.refreshRoutes()
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	stats := g.GetStats()
+	assert.Equal(t, int64(2), stats.RateLimitStats.TotalLimited)
+	assert.Equal(t, []RouteRateLimitStats{{RouteID: "limited", Limited: 2}}, stats.RateLimitStats.Routes)
+
+	// changed settings rebuild the limiter
+	g.config.Routes[0].RateLimitRequests = 5
+	g.refreshRoutes()
+	rec = httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestGlobalRateLimitSurvivesConfigChanges(t *testing.T) {
+	g := NewGateway(t.TempDir())
+	config := g.GetConfigCopy()
+	config.GlobalRateLimit = &RateLimitConfig{Enabled: true, Requests: 1, Window: 60}
+	require.NoError(t, g.UpdateConfig(config))
+	limiter := func() *rateLimiter {
+		g.mu.RLock()
+		defer g.mu.RUnlock()
+		return g.globalLimiter
+	}
+	assert.True(t, g.checkRateLimit(limiter(), "1.1.1.1"))
+
+	// unrelated changes keep the client counts
+	config = g.GetConfigCopy()
+	config.Services = append(config.Services, Service{ID: "backend", Host: "127.0.0.1", Port: 9000, Enabled: true})
+	require.NoError(t, g.UpdateConfig(config))
+	assert.False(t, g.checkRateLimit(limiter(), "1.1.1.1"))
+
+	// changed settings start over
+	config = g.GetConfigCopy()
+	config.GlobalRateLimit.Requests = 2
+	require.NoError(t, g.UpdateConfig(config))
+	assert.True(t, g.checkRateLimit(limiter(), "1.1.1.1"))
+
+	config = g.GetConfigCopy()
+	config.GlobalRateLimit.Enabled = false
+	require.NoError(t, g.UpdateConfig(config))
+	assert.Nil(t, limiter())
+}
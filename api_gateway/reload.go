@@ -0,0 +1,276 @@
+package api_gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultDrainTimeout = 10 * time.Second
+
+// listenerSettings are the settings a running HTTP or HTTPS listener cannot pick up; routes,
+// services and certificates are read per request and need no new listener.
+type listenerSettings struct {
+	port          int
+	proxyProtocol bool
+}
+
+// serverListener is a running HTTP or HTTPS server and the settings it was started with
+type serverListener struct {
+	server   *http.Server
+	listener net.Listener
+	settings listenerSettings
+	stop     chan struct{} // closed when the server is replaced or stopped
+}
+
+// streamListener is a running TCP or UDP route listener
+type streamListener struct {
+	route    any // the TCPRoute or UDPRoute it was started with
+	listener io.Closer
+}
+
+// publishServicesLocked replaces the service snapshot with copies of the configured services
+// (must be called with g.mu held). Snapshots are never modified afterwards, so a request keeps
+// the service it picked while the configuration changes underneath it.
+func (g *Gateway) publishServicesLocked() {
+	services := make(map[string]*Service, len(g.config.Services))
+	for _, svc := range g.config.Services {
+		services[svc.ID] = &svc
+	}
+	g.services = services
+}
+
+// publishRoutesLocked replaces the route snapshot with priority-sorted copies of the configured
+// routes (must be called with g.mu held)
+func (g *Gateway) publishRoutesLocked() {
+	routes := make([]*Route, len(g.config.Routes))
+	for i, route := range g.config.Routes {
+		routes[i] = &route
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].Priority > routes[j].Priority
+	})
+	g.routes = routes
+	g.clearRouteCache()
+}
+
+// drainTimeout is how long stopped and replaced servers wait for open requests
+func (g *Gateway) drainTimeout() time.Duration {
+	if g.config.DrainTimeoutSec > 0 {
+		return time.Duration(g.config.DrainTimeoutSec) * time.Second
+	}
+	return defaultDrainTimeout
+}
+
+// httpSettings returns the settings of the HTTP listener
+func (g *Gateway) httpSettings() *listenerSettings {
+	pp := g.config.ProxyProtocol
+	return &listenerSettings{port: g.config.HTTPPort, proxyProtocol: pp != nil && pp.HTTP}
+}
+
+// httpsSettings returns the settings of the HTTPS listener, or nil when HTTPS is off
+func (g *Gateway) httpsSettings() *listenerSettings {
+	if !g.httpsConfigured() {
+		return nil
+	}
+	pp := g.config.ProxyProtocol
+	return &listenerSettings{port: g.config.HTTPSPort, proxyProtocol: pp != nil && pp.HTTPS}
+}
+
+// reconcileListenersLocked makes the running listeners match the configuration (must be called
+// with gatewayLock held). Listeners whose settings did not change keep running with all their
+// connections; only an HTTP listener that cannot be opened is an error.
+func (g *Gateway) reconcileListenersLocked() error {
+	next, err := g.reconcileServer("HTTP", g.httpListener, g.httpSettings(), false)
+	g.httpListener = next
+	if err != nil {
+		return err
+	}
+
+	if g.httpsConfigured() {
+		// Certificates come from the SNI store, which is reloaded when files change
+		g.reloadCertificates(true)
+	}
+	next, err = g.reconcileServer("HTTPS", g.httpsListener, g.httpsSettings(), true)
+	g.httpsListener = next
+	if err != nil {
+		log.Printf("API Gateway: %v", err)
+	}
+
+	g.reconcileStreamRoutesLocked()
+	return nil
+}
+
+// reconcileServer returns the server to run with the wanted settings (nil = none). A server
+// whose settings are unchanged is kept. A replacement on another port listens before the old
+// server stops accepting; on the same port the old listener has to close first. Replaced
+// servers drain their open requests in the background.
+func (g *Gateway) reconcileServer(name string, current *serverListener, want *listenerSettings, useTLS bool) (*serverListener, error) {
+	if current != nil && want != nil && current.settings == *want {
+		return current, nil
+	}
+	if want == nil {
+		if current != nil {
+			g.drainServer(name, current)
+		}
+		return nil, nil
+	}
+
+	samePort := current != nil && current.settings.port == want.port
+	if samePort {
+		current.listener.Close()
+	}
+	next, err := g.startServer(name, *want, useTLS)
+	if err != nil {
+		if samePort {
+			g.drainServer(name, current)
+			return nil, err
+		}
+		return current, err
+	}
+	if current != nil {
+		g.drainServer(name, current)
+	}
+	return next, nil
+}
+
+// startServer listens with the given settings and serves the gateway on it
+func (g *Gateway) startServer(name string, settings listenerSettings, useTLS bool) (*serverListener, error) {
+	addr := fmt.Sprintf(":%d", settings.port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	if settings.proxyProtocol {
+		// PROXY headers come before the TLS handshake
+		listener = &proxyProtocolListener{Listener: listener, trusted: g.isTrustedProxy}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", g.handleRequest)
+	server := &http.Server{
+		Handler:      mux,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+	s := &serverListener{server: server, settings: settings, stop: make(chan struct{})}
+	if useTLS {
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: g.getCertificate,
+			NextProtos:     []string{"h2", "http/1.1"},
+		}
+		listener = tls.NewListener(listener, server.TLSConfig)
+		go g.watchCertificates(s.stop)
+	} else {
+		// Accept HTTP/2 with prior knowledge (h2c) next to HTTP/1.1 so gRPC clients can use the plain listener
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+	s.listener = listener
+
+	go func() {
+		log.Printf("API Gateway: %s server listening on %s", name, addr)
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed && !errors.Is(err, net.ErrClosed) {
+			log.Printf("API Gateway: %s server error: %v", name, err)
+		}
+	}()
+	return s, nil
+}
+
+// drainServer shuts a replaced or disabled server down in the background
+func (g *Gateway) drainServer(name string, s *serverListener) {
+	timeout := g.drainTimeout()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		shutdownServer(ctx, name, s)
+	}()
+}
+
+// shutdownServer stops a server from accepting and waits until its open requests finish or ctx
+// ends, then closes what is left. Upgraded connections such as WebSockets are not tracked by
+// the server and stay open.
+func shutdownServer(ctx context.Context, name string, s *serverListener) {
+	close(s.stop)
+	// the listener may already be closed when a replacement took over its port
+	if err := s.server.Shutdown(ctx); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("API Gateway: %s server shutdown error: %v", name, err)
+		s.server.Close()
+	}
+}
+
+// reconcileStreamRoutesLocked closes the listeners of removed or changed TCP and UDP routes and
+// starts those of new or changed ones. Connections and sessions already accepted stay open.
+func (g *Gateway) reconcileStreamRoutesLocked() {
+	want := make(map[string]any)
+	for _, r := range g.config.TCPRoutes {
+		if r.Enabled {
+			want["tcp:"+r.ID] = r
+		}
+	}
+	for _, r := range g.config.UDPRoutes {
+		if r.Enabled {
+			want["udp:"+r.ID] = r
+		}
+	}
+
+	if g.streamListeners == nil {
+		g.streamListeners = make(map[string]*streamListener)
+	}
+	// Close first so that a route moving to a port another route gave up finds it free
+	for key, l := range g.streamListeners {
+		if route, ok := want[key]; !ok || !reflect.DeepEqual(route, l.route) {
+			l.listener.Close()
+			delete(g.streamListeners, key)
+		}
+	}
+	for key, route := range want {
+		if _, ok := g.streamListeners[key]; ok {
+			continue
+		}
+		var listener io.Closer
+		var err error
+		switch r := route.(type) {
+		case TCPRoute:
+			listener, err = g.startTCPRoute(r)
+		case UDPRoute:
+			listener, err = g.startUDPRoute(r)
+		}
+		if err != nil {
+			log.Printf("API Gateway %s: route %s: %v", strings.ToUpper(key[:3]), key[4:], err)
+			continue
+		}
+		g.streamListeners[key] = &streamListener{route: route, listener: listener}
+	}
+}
+
+// closeListenersLocked stops every listener, waiting up to the drain timeout for open requests
+func (g *Gateway) closeListenersLocked() {
+	ctx, cancel := context.WithTimeout(context.Background(), g.drainTimeout())
+	defer cancel()
+
+	if g.httpListener != nil {
+		shutdownServer(ctx, "HTTP", g.httpListener)
+		g.httpListener = nil
+	}
+	if g.httpsListener != nil {
+		shutdownServer(ctx, "HTTPS", g.httpsListener)
+		g.httpsListener = nil
+	}
+	for key, l := range g.streamListeners {
+		l.listener.Close()
+		delete(g.streamListeners, key)
+	}
+}
@@ -0,0 +1,123 @@
+package api_gateway
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func getStatus(t *testing.T, port int, path string) int {
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, path))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode
+}
+
+func TestUpdateConfigKeepsListeners(t *testing.T) {
+	arrived, release := make(chan struct{}), make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(arrived)
+			<-release
+		}
+	}))
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+
+	g := NewGateway(t.TempDir())
+	config := g.GetConfigCopy()
+	config.HTTPPort = freePort(t)
+	config.Services = []Service{{ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true}}
+	config.Routes = []Route{{ID: "a", ServiceID: "backend", Paths: []string{"/a", "/slow"}, Enabled: true}}
+	config.TCPRoutes = []TCPRoute{{ID: "raw", ListenPort: freePort(t), ServiceID: "backend", Enabled: true}}
+	require.NoError(t, g.UpdateConfig(config))
+	require.NoError(t, g.Start())
+	defer g.Stop()
+	assert.Equal(t, http.StatusOK, getStatus(t, config.HTTPPort, "/a"))
+
+	slow := make(chan int)
+	go func() {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/slow", config.HTTPPort))
+		if err != nil {
+			slow <- 0
+			return
+		}
+		resp.Body.Close()
+		slow <- resp.StatusCode
+	}()
+	<-arrived
+
+	// route changes are swapped in while the listeners keep running
+	httpListener, tcpListener := g.httpListener, g.streamListeners["tcp:raw"]
+	config = g.GetConfigCopy()
+	config.Routes = append(config.Routes, Route{ID: "b", ServiceID: "backend", Paths: []string{"/b"}, Enabled: true})
+	require.NoError(t, g.UpdateConfig(config))
+	assert.Same(t, httpListener, g.httpListener)
+	assert.Same(t, tcpListener, g.streamListeners["tcp:raw"])
+	assert.Equal(t, http.StatusOK, getStatus(t, config.HTTPPort, "/b"))
+
+	// a new port gets a new listener while the old one drains
+	oldPort := config.HTTPPort
+	config = g.GetConfigCopy()
+	config.HTTPPort = freePort(t)
+	config.TCPRoutes[0].ListenPort = freePort(t)
+	require.NoError(t, g.UpdateConfig(config))
+	assert.NotSame(t, httpListener, g.httpListener)
+	assert.NotSame(t, tcpListener, g.streamListeners["tcp:raw"])
+	assert.Equal(t, http.StatusOK, getStatus(t, config.HTTPPort, "/a"))
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", oldPort))
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-slow, "in-flight request survives the reload")
+
+	// disabling the gateway through the config stops it
+	config = g.GetConfigCopy()
+	config.Enabled = false
+	require.NoError(t, g.UpdateConfig(config))
+	assert.False(t, g.IsRunning())
+	assert.Nil(t, g.httpListener)
+	assert.Empty(t, g.streamListeners)
+}
+
+func TestPublishedRoutesAreSnapshots(t *testing.T) {
+	g := NewGateway(t.TempDir())
+	require.NoError(t, g.AddService(Service{ID: "web", Host: "127.0.0.1", Port: 8000, Enabled: true}))
+	require.NoError(t, g.AddRoute(Route{ID: "site", ServiceID: "web", Paths: []string{"/"}, Enabled: true}))
+
+	route := g.matchRoute(httptest.NewRequest("GET", "/", nil))
+	require.NotNil(t, route)
+	service, _ := g.selectService(httptest.NewRequest("GET", "/", nil), route)
+	require.NotNil(t, service)
+
+	require.NoError(t, g.UpdateRoute(Route{ID: "site", ServiceID: "web", Paths: []string{"/new"}, Enabled: true}))
+	require.NoError(t, g.UpdateService(Service{ID: "web", Host: "127.0.0.2", Port: 9000, Enabled: true}))
+	assert.Equal(t, []string{"/"}, route.Paths, "a matched route is not changed by later updates")
+	assert.Equal(t, 8000, service.Port)
+
+	assert.Nil(t, g.matchRoute(httptest.NewRequest("GET", "/other", nil)))
+	updated := g.matchRoute(httptest.NewRequest("GET", "/new", nil))
+	require.NotNil(t, updated)
+	service, _ = g.selectService(httptest.NewRequest("GET", "/new", nil), updated)
+	assert.Equal(t, 9000, service.Port)
+}
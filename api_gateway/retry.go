@@ -0,0 +1,334 @@
+package api_gateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	retryOnConnectError = "connect_error"
+	retryOnTimeout      = "timeout"
+
+	defaultRetryMaxBodyBytes     = 64 << 10
+	defaultRetryBackoffBase      = 25 * time.Millisecond
+	defaultRetryBackoffMax       = time.Second
+	defaultRetryBudgetPercent    = 20
+	defaultRetryBudgetMinPerSec  = 3
+	retryBudgetWindowSeconds     = 10
+	maxDrainedRetryResponseBytes = 4096
+)
+
+// defaultRetryMethods are the idempotent methods retried when the policy does not list any
+var defaultRetryMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace}
+
+// retryPolicy is the resolved RetryPolicy of a service
+type retryPolicy struct {
+	retries        int
+	onConnectError bool
+	onTimeout      bool
+	statusCodes    map[int]bool
+	methods        map[string]bool
+	maxBodyBytes   int64
+	backoffBase    time.Duration
+	backoffMax     time.Duration
+	budgetPercent  int
+	budgetMin      int
+}
+
+// newRetryPolicy resolves the retry settings of a service; nil means requests are not retried
+func newRetryPolicy(service *Service) *retryPolicy {
+	if service.Retries <= 0 {
+		return nil
+	}
+	p := &retryPolicy{
+		retries:       service.Retries,
+		statusCodes:   make(map[int]bool),
+		methods:       make(map[string]bool),
+		maxBodyBytes:  defaultRetryMaxBodyBytes,
+		backoffBase:   defaultRetryBackoffBase,
+		backoffMax:    defaultRetryBackoffMax,
+		budgetPercent: defaultRetryBudgetPercent,
+		budgetMin:     defaultRetryBudgetMinPerSec,
+	}
+	cfg := service.RetryPolicy
+	if cfg == nil {
+		cfg = &RetryPolicy{}
+	}
+
+	retryOn := cfg.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = []string{retryOnConnectError, retryOnTimeout}
+	}
+	for _, cond := range retryOn {
+		cond = strings.ToLower(strings.TrimSpace(cond))
+		switch cond {
+		case retryOnConnectError:
+			p.onConnectError = true
+		case retryOnTimeout:
+			p.onTimeout = true
+		default:
+			if code, err := strconv.Atoi(cond); err == nil {
+				p.statusCodes[code] = true
+			}
+		}
+	}
+
+	methods := cfg.Methods
+	if len(methods) == 0 {
+		methods = defaultRetryMethods
+	}
+	for _, m := range methods {
+		p.methods[strings.ToUpper(m)] = true
+	}
+
+	if cfg.MaxBodyBytes > 0 {
+		p.maxBodyBytes = cfg.MaxBodyBytes
+	}
+	if cfg.BackoffBaseMs > 0 {
+		p.backoffBase = time.Duration(cfg.BackoffBaseMs) * time.Millisecond
+	}
+	if cfg.BackoffMaxMs > 0 {
+		p.backoffMax = time.Duration(cfg.BackoffMaxMs) * time.Millisecond
+	}
+	if p.backoffMax < p.backoffBase {
+		p.backoffMax = p.backoffBase
+	}
+	if cfg.BudgetPercent > 0 {
+		p.budgetPercent = cfg.BudgetPercent
+	}
+	if cfg.BudgetMinPerSecond > 0 {
+		p.budgetMin = cfg.BudgetMinPerSecond
+	}
+	return p
+}
+
+// retryableError reports whether a transport error matches the policy
+func (p *retryPolicy) retryableError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var opErr *net.OpError
+	if p.onConnectError && errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var netErr net.Error
+	if p.onTimeout && (errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())) {
+		return true
+	}
+	return false
+}
+
+// backoff returns the full-jitter delay before the given retry (1-based)
+func (p *retryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.backoffMax
+	if shift := retry - 1; shift < 30 {
+		if d := p.backoffBase << shift; d < ceiling {
+			ceiling = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// retryBudget caps retries to a share of recent requests so failing upstreams are not flooded
+type retryBudget struct {
+	mu      sync.Mutex
+	buckets [retryBudgetWindowSeconds]retryBudgetBucket
+}
+
+type retryBudgetBucket struct {
+	second   int64
+	requests int64
+	retries  int64
+}
+
+func (b *retryBudget) bucketLocked(now time.Time) *retryBudgetBucket {
+	sec := now.Unix()
+	bucket := &b.buckets[sec%retryBudgetWindowSeconds]
+	if bucket.second != sec {
+		*bucket = retryBudgetBucket{second: sec}
+	}
+	return bucket
+}
+
+func (b *retryBudget) recordRequest(now time.Time) {
+	b.mu.Lock()
+	b.bucketLocked(now).requests++
+	b.mu.Unlock()
+}
+
+// tryRetry reserves a retry if the budget allows it
+func (b *retryBudget) tryRetry(now time.Time, percent, minPerSec int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var requests, retries int64
+	oldest := now.Unix() - retryBudgetWindowSeconds
+	for _, bucket := range b.buckets {
+		if bucket.second > oldest {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+	allowed := max(requests*int64(percent)/100, int64(minPerSec*retryBudgetWindowSeconds))
+	if retries >= allowed {
+		return false
+	}
+	b.bucketLocked(now).retries++
+	return true
+}
+
+// retryBudgetFor returns the retry budget of a service, creating it on first use.
+func (g *Gateway) retryBudgetFor(serviceID string) *retryBudget {
+	g.retryBudgetsMu.Lock()
+	defer g.retryBudgetsMu.Unlock()
+	if g.retryBudgets == nil {
+		g.retryBudgets = make(map[string]*retryBudget)
+	}
+	b, ok := g.retryBudgets[serviceID]
+	if !ok {
+		b = &retryBudget{}
+		g.retryBudgets[serviceID] = b
+	}
+	return b
+}
+
+// dropRetryBudget forgets the retry budget of a deleted service
+func (g *Gateway) dropRetryBudget(serviceID string) {
+	g.retryBudgetsMu.Lock()
+	delete(g.retryBudgets, serviceID)
+	g.retryBudgetsMu.Unlock()
+}
+
+type retryCountKey struct{}
+
+// withRetryCounter attaches a retry counter to the request so the access log can report retries
+func withRetryCounter(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), retryCountKey{}, new(int32)))
+}
+
+// retryCountFromRequest returns the number of upstream retries made for the request
+func retryCountFromRequest(r *http.Request) int {
+	if counter, ok := r.Context().Value(retryCountKey{}).(*int32); ok {
+		return int(atomic.LoadInt32(counter))
+	}
+	return 0
+}
+
+// retryingTransport replays a proxied request according to the service's retry policy,
+// moving to another target of the service on each attempt when one is available.
+type retryingTransport struct {
+	g        *Gateway
+	base     http.RoundTripper
+	service  *Service
+	policy   *retryPolicy
+	budget   *retryBudget
+	lb       *loadBalancer
+	target   *upstreamTarget // current target; acquired for the duration of the request
+	clientIP string
+}
+
+func (t *retryingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.budget.recordRequest(time.Now())
+
+	var body []byte
+	retryable := t.policy.methods[req.Method]
+	if retryable && req.Body != nil && req.Body != http.NoBody {
+		buffered, rest, complete, err := bufferBody(req.Body, t.policy.maxBodyBytes)
+		if err != nil {
+			return nil, err
+		}
+		if complete {
+			body = buffered
+		} else {
+			// Too large to replay: send it once, unbuffered
+			retryable = false
+			req.Body = rest
+		}
+	}
+	if !retryable {
+		return t.base.RoundTrip(req)
+	}
+
+	tried := map[string]bool{t.target.address: true}
+	for attempt := 0; ; attempt++ {
+		outreq := req
+		if attempt > 0 {
+			outreq = t.nextAttempt(req, tried)
+		}
+		if body != nil {
+			outreq.Body = io.NopCloser(bytes.NewReader(body))
+			outreq.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
+			}
+		}
+
+		resp, err := t.base.RoundTrip(outreq)
+		retry := false
+		if err != nil {
+			retry = t.policy.retryableError(err)
+		} else {
+			retry = t.policy.statusCodes[resp.StatusCode]
+		}
+		if !retry || attempt >= t.policy.retries || req.Context().Err() != nil {
+			return resp, err
+		}
+		if !t.budget.tryRetry(time.Now(), t.policy.budgetPercent, t.policy.budgetMin) {
+			t.g.recordRetryBudgetExhausted(t.service.ID)
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainedRetryResponseBytes))
+			resp.Body.Close()
+		}
+		t.g.recordServiceRetry(t.service.ID)
+		if counter, ok := req.Context().Value(retryCountKey{}).(*int32); ok {
+			atomic.AddInt32(counter, 1)
+		}
+
+		timer := time.NewTimer(t.policy.backoff(attempt + 1))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// nextAttempt moves to an untried healthy target (or any healthy one once all were tried)
+// and returns a copy of req addressed to it.
+func (t *retryingTransport) nextAttempt(req *http.Request, tried map[string]bool) *http.Request {
+	available := t.g.targetFilter(t.service.ID, t.lb)
+	next, probe := t.lb.reserve(req, t.clientIP, func(address string) bool {
+		return available(address) && !tried[address]
+	})
+	if next == nil {
+		next, probe = t.lb.reserve(req, t.clientIP, available)
+	}
+
+	outreq := req.Clone(withCircuitProbe(req.Context(), probe))
+	if next == nil || next == t.target {
+		return outreq
+	}
+	previous := t.target.address
+	t.lb.release(t.target)
+	t.lb.acquire(next)
+	t.target = next
+	tried[next.address] = true
+
+	outreq.URL.Host = next.address
+	if outreq.Host == previous {
+		outreq.Host = next.address
+	}
+	return outreq
+}
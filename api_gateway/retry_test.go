@@ -0,0 +1,142 @@
+package api_gateway
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func targetOf(t *testing.T, addr string) ServiceTarget {
+	t.Helper()
+	parts := splitHostPort(addr)
+	return ServiceTarget{Host: parts[0], Port: mustParseInt(parts[1]), Weight: 1}
+}
+
+func TestRetryMovesToAnotherTarget(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+
+	// a port nothing listens on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := ln.Addr().String()
+	ln.Close()
+
+	service := &Service{
+		ID:          "svc",
+		Targets:     []ServiceTarget{targetOf(t, failing.Listener.Addr().String()), targetOf(t, closedAddr), targetOf(t, healthy.Listener.Addr().String())},
+		Retries:     2,
+		RetryPolicy: &RetryPolicy{RetryOn: []string{"connect_error", "503"}, BackoffBaseMs: 1},
+		Enabled:     true,
+	}
+	g := newProxyTestGateway(service)
+	for i := 0; i < 6; i++ {
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+	stats := g.GetStats()
+	require.Len(t, stats.ServiceStats, 1)
+	assert.Positive(t, stats.ServiceStats[0].Retries)
+	assert.Zero(t, stats.ServiceStats[0].Errors)
+}
+
+func TestRetryMethodsAndBodies(t *testing.T) {
+	var attempts int32
+	var lastBody string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		lastBody = string(data)
+		if atomic.AddInt32(&attempts, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+
+	service := &Service{
+		ID:          "svc",
+		Host:        hostParts[0],
+		Port:        mustParseInt(hostParts[1]),
+		Retries:     1,
+		RetryPolicy: &RetryPolicy{RetryOn: []string{"503"}, BackoffBaseMs: 1, MaxBodyBytes: 16},
+		Enabled:     true,
+	}
+	g := newProxyTestGateway(service)
+
+	// POST is not idempotent and is not retried by default
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("POST", "/", strings.NewReader("payload")))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+
+	// once allowed, the buffered body is replayed on the retry
+	service.RetryPolicy.Methods = []string{"POST"}
+	atomic.StoreInt32(&attempts, 0)
+	rec = httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("POST", "/", strings.NewReader("payload")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	assert.Equal(t, "payload", lastBody)
+
+	// bodies over the limit are streamed once and not retried
+	atomic.StoreInt32(&attempts, 0)
+	rec = httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("x", 32))))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+	assert.Equal(t, strings.Repeat("x", 32), lastBody)
+}
+
+func TestRetryBudget(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := &retryBudget{}
+
+	// with no traffic only the per-second minimum is available
+	for i := 0; i < retryBudgetWindowSeconds; i++ {
+		assert.True(t, b.tryRetry(now, 20, 1))
+	}
+	assert.False(t, b.tryRetry(now, 20, 1))
+
+	// traffic raises the budget to the configured share
+	for i := 0; i < 100; i++ {
+		b.recordRequest(now)
+	}
+	for i := 0; i < 10; i++ {
+		assert.True(t, b.tryRetry(now, 20, 1))
+	}
+	assert.False(t, b.tryRetry(now, 20, 1))
+
+	// the window slides
+	assert.True(t, b.tryRetry(now.Add(retryBudgetWindowSeconds*time.Second), 20, 1))
+}
+
+func TestRetryPolicyDefaults(t *testing.T) {
+	assert.Nil(t, newRetryPolicy(&Service{}))
+
+	p := newRetryPolicy(&Service{Retries: 3})
+	require.NotNil(t, p)
+	assert.True(t, p.onConnectError)
+	assert.True(t, p.onTimeout)
+	assert.Empty(t, p.statusCodes)
+	assert.True(t, p.methods[http.MethodGet])
+	assert.False(t, p.methods[http.MethodPost])
+	for retry := 1; retry <= 10; retry++ {
+		d := p.backoff(retry)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.LessOrEqual(t, d, defaultRetryBackoffMax)
+	}
+	assert.LessOrEqual(t, p.backoff(1), defaultRetryBackoffBase)
+}
@@ -0,0 +1,393 @@
+package api_gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"redock/platform/memory"
+)
+
+const (
+	maxConfigRevisions = 100
+	systemAuthor       = "system"
+)
+
+// configEditor describes who is changing the configuration
+type configEditor struct {
+	author  string
+	message string
+}
+
+// configRevision is a stored revision; data is its normalized config JSON
+type configRevision struct {
+	ConfigRevision
+	data []byte
+}
+
+// EditAs runs fn, which changes the configuration through the Gateway's methods, on behalf of
+// author so that the revisions it saves record who made them. Edits made this way are
+// serialized.
+func (g *Gateway) EditAs(author string, fn func() error) error {
+	g.editMu.Lock()
+	defer g.editMu.Unlock()
+	g.setEditor(configEditor{author: author})
+	defer g.setEditor(configEditor{})
+	return fn()
+}
+
+func (g *Gateway) setEditor(editor configEditor) {
+	g.revisionsMu.Lock()
+	g.editor = editor
+	g.revisionsMu.Unlock()
+}
+
+// revisionJSON normalizes a config document for storage and comparison. The enabled flag
+// only reflects whether the gateway runs, so starting or stopping it is not a revision.
+func revisionJSON(data []byte) ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	delete(doc, "enabled")
+	return json.Marshal(doc)
+}
+
+// recordConfigRevision stores the saved config as a new revision unless it equals the latest one
+func (g *Gateway) recordConfigRevision(data []byte) {
+	normalized, err := revisionJSON(data)
+	if err != nil {
+		log.Printf("API Gateway: failed to record config revision: %v", err)
+		return
+	}
+
+	g.revisionsMu.Lock()
+	defer g.revisionsMu.Unlock()
+	var previous []byte
+	number := 1
+	if n := len(g.revisions); n > 0 {
+		previous = g.revisions[n-1].data
+		if bytes.Equal(previous, normalized) {
+			return
+		}
+		number = g.revisions[n-1].Revision + 1
+	}
+
+	rev := configRevision{
+		ConfigRevision: ConfigRevision{
+			Revision:  number,
+			Author:    g.editor.author,
+			Message:   g.editor.message,
+			CreatedAt: time.Now(),
+		},
+		data: normalized,
+	}
+	if rev.Author == "" {
+		rev.Author = systemAuthor
+	}
+	if rev.Message == "" {
+		if previous == nil {
+			rev.Message = "initial configuration"
+		} else if changes, err := diffConfigJSON(previous, normalized); err == nil {
+			rev.Message = summarizeConfigChanges(changes)
+		}
+	}
+	g.revisions = append(g.revisions, rev)
+
+	var dropped []configRevision
+	if len(g.revisions) > maxConfigRevisions {
+		dropped = g.revisions[:len(g.revisions)-maxConfigRevisions]
+		g.revisions = append([]configRevision(nil), g.revisions[len(dropped):]...)
+	}
+
+	db := g.db()
+	if db == nil {
+		return
+	}
+	entity := &ApiGatewayConfigRevisionEntity{
+		Revision:   rev.Revision,
+		Author:     rev.Author,
+		Message:    rev.Message,
+		ConfigJSON: string(normalized),
+	}
+	if err := memory.Create(db, tableApiGatewayConfigRevisions, entity); err != nil {
+		log.Printf("API Gateway: failed to persist config revision %d: %v", rev.Revision, err)
+	}
+	for _, old := range dropped {
+		for _, e := range memory.Where[*ApiGatewayConfigRevisionEntity](db, tableApiGatewayConfigRevisions, "Revision", old.Revision) {
+			_ = memory.Delete[*ApiGatewayConfigRevisionEntity](db, tableApiGatewayConfigRevisions, e.GetID())
+		}
+	}
+}
+
+// loadConfigRevisions reads the revision history and records the loaded config when it has none
+func (g *Gateway) loadConfigRevisions() {
+	var revisions []configRevision
+	if db := g.db(); db != nil {
+		for _, e := range memory.FindAll[*ApiGatewayConfigRevisionEntity](db, tableApiGatewayConfigRevisions) {
+			revisions = append(revisions, configRevision{
+				ConfigRevision: ConfigRevision{
+					Revision:  e.Revision,
+					Author:    e.Author,
+					Message:   e.Message,
+					CreatedAt: e.CreatedAt,
+				},
+				data: []byte(e.ConfigJSON),
+			})
+		}
+		sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+	}
+	g.revisionsMu.Lock()
+	g.revisions = revisions
+	g.revisionsMu.Unlock()
+
+	g.mu.RLock()
+	data, err := json.Marshal(g.config)
+	g.mu.RUnlock()
+	if err == nil {
+		g.recordConfigRevision(data)
+	}
+}
+
+// ListConfigRevisions returns the revision history, newest first, without the configs
+func (g *Gateway) ListConfigRevisions() []ConfigRevision {
+	g.revisionsMu.Lock()
+	defer g.revisionsMu.Unlock()
+	list := make([]ConfigRevision, 0, len(g.revisions))
+	for i := len(g.revisions) - 1; i >= 0; i-- {
+		list = append(list, g.revisions[i].ConfigRevision)
+	}
+	return list
+}
+
+func (g *Gateway) findRevision(number int) (configRevision, error) {
+	g.revisionsMu.Lock()
+	defer g.revisionsMu.Unlock()
+	for _, rev := range g.revisions {
+		if rev.Revision == number {
+			return rev, nil
+		}
+	}
+	return configRevision{}, fmt.Errorf("config revision %d not found", number)
+}
+
+// GetConfigRevision returns a revision together with its configuration
+func (g *Gateway) GetConfigRevision(number int) (*ConfigRevision, error) {
+	rev, err := g.findRevision(number)
+	if err != nil {
+		return nil, err
+	}
+	var config GatewayConfig
+	if err := json.Unmarshal(rev.data, &config); err != nil {
+		return nil, fmt.Errorf("config revision %d is unreadable: %w", number, err)
+	}
+	result := rev.ConfigRevision
+	result.Config = &config
+	return &result, nil
+}
+
+// DiffConfigRevisions lists the changes from one revision to another; to = 0 compares
+// against the current configuration.
+func (g *Gateway) DiffConfigRevisions(from, to int) ([]ConfigChange, error) {
+	fromRev, err := g.findRevision(from)
+	if err != nil {
+		return nil, err
+	}
+	var toData []byte
+	if to == 0 {
+		g.mu.RLock()
+		data, err := json.Marshal(withoutDiscovered(g.config))
+		g.mu.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		if toData, err = revisionJSON(data); err != nil {
+			return nil, err
+		}
+	} else {
+		toRev, err := g.findRevision(to)
+		if err != nil {
+			return nil, err
+		}
+		toData = toRev.data
+	}
+	return diffConfigJSON(fromRev.data, toData)
+}
+
+// RollbackConfig applies an earlier revision as a new revision. Whether the gateway is
+// running is kept as it is.
+func (g *Gateway) RollbackConfig(number int, author string) error {
+	rev, err := g.GetConfigRevision(number)
+	if err != nil {
+		return err
+	}
+	config := rev.Config
+	g.mu.RLock()
+	config.Enabled = g.config.Enabled
+	g.mu.RUnlock()
+
+	g.editMu.Lock()
+	defer g.editMu.Unlock()
+	g.setEditor(configEditor{author: author, message: fmt.Sprintf("rollback to revision %d", number)})
+	defer g.setEditor(configEditor{})
+	return g.UpdateConfig(config)
+}
+
+// diffConfigJSON compares two config documents. Lists of objects with an "id" field (services,
+// routes, consumers, ...) are matched by ID, so reordering them is not reported.
+func diffConfigJSON(from, to []byte) ([]ConfigChange, error) {
+	var a, b any
+	if len(from) > 0 {
+		if err := json.Unmarshal(from, &a); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(to, &b); err != nil {
+		return nil, err
+	}
+	changes := []ConfigChange{}
+	diffConfigValues("", a, b, &changes)
+	return changes, nil
+}
+
+func diffConfigValues(path string, a, b any, changes *[]ConfigChange) {
+	switch {
+	case a == nil && b == nil:
+		return
+	case a == nil:
+		*changes = append(*changes, ConfigChange{Path: path, Kind: configChangeAdded, New: b})
+		return
+	case b == nil:
+		*changes = append(*changes, ConfigChange{Path: path, Kind: configChangeRemoved, Old: a})
+		return
+	}
+
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			diffConfigValues(child, av[k], bv[k], changes)
+		}
+		return
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		aIDs, aKeyed := listIDs(av)
+		bIDs, bKeyed := listIDs(bv)
+		if aKeyed && bKeyed {
+			byID := make(map[string]any, len(bv))
+			for i, id := range bIDs {
+				byID[id] = bv[i]
+			}
+			seen := make(map[string]bool, len(av))
+			for i, id := range aIDs {
+				seen[id] = true
+				diffConfigValues(fmt.Sprintf("%s[%s]", path, id), av[i], byID[id], changes)
+			}
+			for i, id := range bIDs {
+				if !seen[id] {
+					diffConfigValues(fmt.Sprintf("%s[%s]", path, id), nil, bv[i], changes)
+				}
+			}
+			return
+		}
+		for i := 0; i < max(len(av), len(bv)); i++ {
+			var x, y any
+			if i < len(av) {
+				x = av[i]
+			}
+			if i < len(bv) {
+				y = bv[i]
+			}
+			diffConfigValues(fmt.Sprintf("%s[%d]", path, i), x, y, changes)
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, ConfigChange{Path: path, Kind: configChangeChanged, Old: a, New: b})
+	}
+}
+
+// listIDs returns the "id" of every element when all elements are objects with a unique string ID
+func listIDs(list []any) ([]string, bool) {
+	ids := make([]string, len(list))
+	seen := make(map[string]bool, len(list))
+	for i, item := range list {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		id, ok := obj["id"].(string)
+		if !ok || id == "" || seen[id] {
+			return nil, false
+		}
+		ids[i] = id
+		seen[id] = true
+	}
+	return ids, true
+}
+
+// summarizeConfigChanges describes changes per top-level entry, e.g.
+// "changed routes[api], added services[billing]"
+func summarizeConfigChanges(changes []ConfigChange) string {
+	if len(changes) == 0 {
+		return "no changes"
+	}
+	var order []string
+	kinds := make(map[string]string)
+	for _, c := range changes {
+		entry := c.Path
+		if i := strings.IndexAny(entry, ".["); i >= 0 {
+			if entry[i] == '[' {
+				if j := strings.IndexByte(entry, ']'); j > i {
+					i = j + 1
+				}
+			}
+			entry = entry[:i]
+		}
+		kind, ok := kinds[entry]
+		if !ok {
+			order = append(order, entry)
+			kind = c.Kind
+		}
+		if kind != c.Kind || entry != c.Path {
+			// a nested change or a mix of kinds modifies the entry
+			kind = configChangeChanged
+		}
+		kinds[entry] = kind
+	}
+	const shown = 5
+	parts := make([]string, 0, shown+1)
+	for i, entry := range order {
+		if i == shown {
+			parts = append(parts, fmt.Sprintf("%d more", len(order)-shown))
+			break
+		}
+		parts = append(parts, kinds[entry]+" "+entry)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,163 @@
+package api_gateway
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigRevisionsAndRollback(t *testing.T) {
+	g := NewGateway(t.TempDir())
+	revisions := g.ListConfigRevisions()
+	require.Len(t, revisions, 1)
+	assert.Equal(t, "initial configuration", revisions[0].Message)
+	assert.Equal(t, systemAuthor, revisions[0].Author)
+
+	require.NoError(t, g.EditAs("alice@example.com", func() error {
+		return g.AddService(Service{ID: "web", Host: "127.0.0.1", Port: 8000, Enabled: true})
+	}))
+	require.NoError(t, g.EditAs("bob@example.com", func() error {
+		return g.AddRoute(Route{ID: "site", ServiceID: "web", Paths: []string{"/"}, Enabled: true})
+	}))
+	// starting or stopping only flips enabled, which is not a revision
+	g.mu.Lock()
+	g.config.Enabled = true
+	g.mu.Unlock()
+	require.NoError(t, g.SaveConfig())
+
+	revisions = g.ListConfigRevisions()
+	require.Len(t, revisions, 3)
+	assert.Equal(t, 3, revisions[0].Revision)
+	assert.Equal(t, "bob@example.com", revisions[0].Author)
+	assert.Equal(t, "added routes[site]", revisions[0].Message)
+	assert.Equal(t, "alice@example.com", revisions[1].Author)
+	assert.Equal(t, "added services[web]", revisions[1].Message)
+
+	changes, err := g.DiffConfigRevisions(2, 3)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "routes[site]", changes[0].Path)
+	assert.Equal(t, configChangeAdded, changes[0].Kind)
+
+	require.NoError(t, g.RollbackConfig(1, "carol@example.com"))
+	assert.Empty(t, g.GetConfig().Services)
+	assert.Empty(t, g.GetConfig().Routes)
+	assert.True(t, g.GetConfig().Enabled, "rollback keeps the running state")
+
+	latest := g.ListConfigRevisions()[0]
+	assert.Equal(t, 4, latest.Revision)
+	assert.Equal(t, "carol@example.com", latest.Author)
+	assert.Equal(t, "rollback to revision 1", latest.Message)
+	changes, err = g.DiffConfigRevisions(1, 0)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// discovered entries are not saved, so they are no difference either
+	g.applyDiscovered(providerDocker, []Service{{ID: "docker-app", Host: "10.0.0.2", Port: 80, Enabled: true, Provider: providerDocker, ReadOnly: true}}, nil)
+	require.Len(t, g.GetConfig().Services, 1)
+	changes, err = g.DiffConfigRevisions(4, 0)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	rev, err := g.GetConfigRevision(3)
+	require.NoError(t, err)
+	require.Len(t, rev.Config.Routes, 1)
+	_, err = g.GetConfigRevision(42)
+	assert.ErrorContains(t, err, "config revision 42 not found")
+}
+
+func TestDiffConfigJSON(t *testing.T) {
+	from := []byte(`{"http_port":8080,"routes":[{"id":"a","paths":["/a"]},{"id":"b","paths":["/b"]}],"ip_sets":[{"name":"x","cidrs":["10.0.0.0/8"]}]}`)
+	to := []byte(`{"http_port":9090,"routes":[{"id":"b","paths":["/b"]},{"id":"a","paths":["/a","/a2"]}],"ip_sets":[{"name":"x","cidrs":["10.0.0.0/16"]}]}`)
+	changes, err := diffConfigJSON(from, to)
+	require.NoError(t, err)
+	paths := make([]string, len(changes))
+	for i, c := range changes {
+		paths[i] = c.Kind + " " + c.Path
+	}
+	// reordering routes is not a change; lists without IDs are compared by position
+	assert.Equal(t, []string{
+		"changed http_port",
+		"changed ip_sets[0].cidrs[0]",
+		"added routes[a].paths[1]",
+	}, paths)
+	assert.Equal(t, "changed http_port, changed ip_sets[0], changed routes[a]", summarizeConfigChanges(changes))
+}
+
+func TestValidateConfigDryRun(t *testing.T) {
+	g := newProxyTestGateway(&Service{ID: "svc", Enabled: true})
+	config := &GatewayConfig{
+		HTTPPort:     8080,
+		HTTPSPort:    8080,
+		HTTPSEnabled: true,
+		Services:     []Service{{ID: "web", Enabled: true}, {ID: "old", Enabled: false}},
+		Routes: []Route{
+			{ID: "site", ServiceID: "web", Paths: []string{"/"}, Enabled: true},
+			{ID: "site-copy", ServiceID: "web", Paths: []string{"/"}, Methods: []string{"get"}, Enabled: true},
+			{ID: "api", ServiceID: "missing", Paths: []string{"/api"}, Hosts: []string{"api.example.com"}, Enabled: true},
+			{ID: "api-v2", ServiceID: "old", Paths: []string{"/api"}, Hosts: []string{"API.example.com"}, Methods: []string{"GET"}, Priority: -1, Enabled: true},
+		},
+		TCPRoutes: []TCPRoute{{ID: "ssh", ListenPort: 2222, ServiceID: "web", Enabled: true}},
+		UDPRoutes: []UDPRoute{{ID: "dns", ListenPort: 2222, ServiceID: "web", Enabled: true}},
+	}
+
+	result := g.ValidateConfig(config)
+	assert.False(t, result.Valid)
+	assert.Equal(t, []string{
+		"route api: service with ID missing not found",
+		"HTTPS listener: TCP port 8080 is already used by HTTP listener",
+	}, result.Errors)
+	assert.Equal(t, []string{
+		"route api-v2: service old is disabled",
+		"route api-v2 is shadowed by route api on path /api",
+	}, result.Warnings)
+	assert.NotEmpty(t, result.Changes)
+
+	// identical matchers with the same priority are ambiguous
+	config.HTTPSEnabled = false
+	config.Routes[0].Methods = []string{"GET"}
+	config.Routes[2].ServiceID = "web"
+	result = g.ValidateConfig(config)
+	assert.Equal(t, []string{"routes site and site-copy both match path / with the same priority"}, result.Errors)
+}
+
+func TestUpdateConfigRejectsInvalidConfig(t *testing.T) {
+	g := NewGateway(t.TempDir())
+	revisions := len(g.ListConfigRevisions())
+	config := g.GetConfigCopy()
+	config.Services = []Service{{ID: "web", Enabled: true}}
+	config.Routes = []Route{{ID: "api", ServiceID: "missing", Paths: []string{"/api"}, Enabled: true}}
+	assert.EqualError(t, g.UpdateConfig(config), "invalid config: route api: service with ID missing not found")
+
+	config.Routes = []Route{{ID: "api", ServiceID: "web", Paths: []string{"/api"}, Action: &RouteAction{Type: "proxy"}, Enabled: true}}
+	assert.EqualError(t, g.UpdateConfig(config), `invalid config: route api: unknown route action type "proxy"`)
+	assert.Empty(t, g.GetConfigCopy().Routes)
+	assert.Len(t, g.ListConfigRevisions(), revisions)
+
+	config.Routes[0].Action = nil
+	assert.NoError(t, g.UpdateConfig(config))
+}
+
+func TestConfigChangesRejectInvalidConfig(t *testing.T) {
+	g := NewGateway(t.TempDir())
+	require.NoError(t, g.AddService(Service{ID: "web", Host: "127.0.0.1", Port: 9000, Enabled: true}))
+	require.NoError(t, g.AddRoute(Route{ID: "api", ServiceID: "web", Paths: []string{"/api"}, Enabled: true}))
+
+	// a service still used by a route can't be deleted
+	assert.EqualError(t, g.DeleteService("web"), "invalid config: route api: service with ID web not found")
+	assert.Len(t, g.GetConfigCopy().Services, 1)
+
+	assert.EqualError(t, g.AddRoute(Route{ID: "other", ServiceID: "missing", Paths: []string{"/other"}, Enabled: true}),
+		"invalid config: route other: service with ID missing not found")
+	assert.EqualError(t, g.AddRoute(Route{ID: "copy", ServiceID: "web", Paths: []string{"/api"}, Enabled: true}),
+		"invalid config: routes api and copy both match path /api with the same priority")
+	assert.Error(t, g.UpdateRoute(Route{ID: "api", ServiceID: "missing", Paths: []string{"/api"}, Enabled: true}))
+	assert.Len(t, g.GetConfigCopy().Routes, 1)
+
+	// the saved config stays valid, so changes through UpdateConfig still work
+	require.NoError(t, g.AddTCPRoute(TCPRoute{ID: "db", ServiceID: "web", ListenPort: freePort(t), Enabled: true}))
+	require.NoError(t, g.DeleteRoute("api"))
+	require.NoError(t, g.RemoveTCPRoute("db"))
+	assert.NoError(t, g.DeleteService("web"))
+}
@@ -0,0 +1,221 @@
+package api_gateway
+
+import (
+	"bytes"
+	"context"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	stickyByCookie   = "cookie"
+	stickyByClientIP = "client_ip"
+	stickyByHeader   = "header"
+
+	defaultStickyCookie       = "gw_backend"
+	defaultMirrorMaxBodyBytes = 1 << 20
+	maxMirrorsInFlight        = 256
+	mirrorTimeout             = 30 * time.Second
+)
+
+// hopHeaders are connection-specific headers not forwarded on mirrored copies
+var hopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authenticate", "Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// matches reports whether the request carries the matcher's header or cookie
+func (m *BackendMatcher) matches(r *http.Request) bool {
+	var value string
+	var found bool
+	switch {
+	case m.Header != "":
+		value = r.Header.Get(m.Header)
+		found = value != ""
+	case m.Cookie != "":
+		if c, err := r.Cookie(m.Cookie); err == nil {
+			value, found = c.Value, true
+		}
+	}
+	return found && (m.Value == "" || value == m.Value)
+}
+
+// selectService picks the service for a request on route. With a traffic split the returned
+// cookie, when non-nil, must be set on the response to keep the client on the chosen backend.
+func (g *Gateway) selectService(r *http.Request, route *Route) (*Service, *http.Cookie) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	split := route.Split
+	if split == nil || len(split.Backends) == 0 {
+		return g.services[route.ServiceID], nil
+	}
+
+	// Matchers force a backend regardless of weights
+	for _, b := range split.Backends {
+		if b.Match != nil && b.Match.matches(r) {
+			if svc := g.services[b.ServiceID]; svc != nil {
+				return svc, nil
+			}
+		}
+	}
+
+	type weightedService struct {
+		service *Service
+		weight  int
+	}
+	candidates := make([]weightedService, 0, len(split.Backends))
+	total := 0
+	for _, b := range split.Backends {
+		svc := g.services[b.ServiceID]
+		if svc == nil || !svc.Enabled || b.Weight <= 0 {
+			continue
+		}
+		candidates = append(candidates, weightedService{service: svc, weight: b.Weight})
+		total += b.Weight
+	}
+	if len(candidates) == 0 {
+		return g.services[route.ServiceID], nil
+	}
+
+	point := -1
+	cookieName := split.StickyCookie
+	if cookieName == "" {
+		cookieName = defaultStickyCookie
+	}
+	switch strings.ToLower(split.StickyBy) {
+	case stickyByCookie:
+		if c, err := r.Cookie(cookieName); err == nil {
+			for _, cand := range candidates {
+				if cand.service.ID == c.Value {
+					return cand.service, nil
+				}
+			}
+		}
+	case stickyByClientIP:
+		point = int(crc32.ChecksumIEEE([]byte(getClientIP(r))) % uint32(total))
+	case stickyByHeader:
+		if key := r.Header.Get(split.StickyHeader); key != "" {
+			point = int(crc32.ChecksumIEEE([]byte(key)) % uint32(total))
+		}
+	}
+	if point < 0 {
+		point = rand.Intn(total)
+	}
+
+	chosen := candidates[len(candidates)-1].service
+	for _, cand := range candidates {
+		if point < cand.weight {
+			chosen = cand.service
+			break
+		}
+		point -= cand.weight
+	}
+
+	if strings.EqualFold(split.StickyBy, stickyByCookie) {
+		return chosen, &http.Cookie{
+			Name:     cookieName,
+			Value:    chosen.ID,
+			Path:     "/",
+			MaxAge:   split.CookieMaxAge,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		}
+	}
+	return chosen, nil
+}
+
+// mirrorRequest sends a copy of r to the route's mirror service in the background.
+// The mirror's response is discarded; copies are dropped when too many are in flight.
+func (g *Gateway) mirrorRequest(r *http.Request, route *Route) {
+	m := route.Mirror
+	if m == nil || m.ServiceID == "" || r.Header.Get("Upgrade") != "" {
+		return
+	}
+	if m.Percent > 0 && m.Percent < 100 && rand.Intn(100) >= m.Percent {
+		return
+	}
+	g.mu.RLock()
+	service := g.services[m.ServiceID]
+	g.mu.RUnlock()
+	if service == nil || !service.Enabled {
+		return
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		limit := m.MaxBodyBytes
+		if limit <= 0 {
+			limit = defaultMirrorMaxBodyBytes
+		}
+		data, rest, complete, err := bufferBody(r.Body, limit)
+		if err != nil {
+			// Let the primary request fail with the same error (e.g. a body over the route limit)
+			r.Body = errorBody{err}
+			return
+		}
+		if !complete {
+			r.Body = rest
+			return
+		}
+		body = data
+		r.Body = io.NopCloser(bytes.NewReader(data))
+	}
+
+	if g.mirrorsInFlight.Add(1) > maxMirrorsInFlight {
+		g.mirrorsInFlight.Add(-1)
+		return
+	}
+	_, target := g.pickTarget(service, r, getClientIP(r))
+	if target == nil {
+		g.mirrorsInFlight.Add(-1)
+		g.recordMirror(service.ID, true)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+	out := r.Clone(ctx)
+	out.RequestURI = ""
+	out.Body = http.NoBody
+	out.ContentLength = int64(len(body))
+	if len(body) > 0 {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	directUpstreamRequest(out, r, route, service, &url.URL{Scheme: service.upstreamScheme(), Host: target.address}, g.transformerFor(route))
+
+	go func() {
+		defer g.mirrorsInFlight.Add(-1)
+		defer cancel()
+		transport, err := g.transportFor(service)
+		if err != nil {
+			g.recordMirror(service.ID, true)
+			return
+		}
+		resp, err := transport.RoundTrip(out)
+		if err != nil {
+			g.recordMirror(service.ID, true)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		g.recordMirror(service.ID, resp.StatusCode >= http.StatusInternalServerError)
+	}()
+}
+
+// recordMirror counts a mirrored copy received by a service
+func (g *Gateway) recordMirror(serviceID string, failed bool) {
+	g.stats.mu.Lock()
+	defer g.stats.mu.Unlock()
+	if g.stats.serviceStats[serviceID] == nil {
+		g.stats.serviceStats[serviceID] = &serviceStatsTracker{}
+	}
+	g.stats.serviceStats[serviceID].mirrored++
+	if failed {
+		g.stats.serviceStats[serviceID].mirrorErrors++
+	}
+}
@@ -0,0 +1,162 @@
+package api_gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSplitTestGateway(t *testing.T, handlers map[string]http.HandlerFunc) *Gateway {
+	t.Helper()
+	g := &Gateway{
+		services:      make(map[string]*Service),
+		serviceHealth: make(map[string]*ServiceHealth),
+		config:        &GatewayConfig{},
+		stats:         &gatewayStatsTracker{startTime: time.Now(), serviceStats: make(map[string]*serviceStatsTracker)},
+	}
+	for id, h := range handlers {
+		backend := httptest.NewServer(h)
+		t.Cleanup(backend.Close)
+		hostParts := splitHostPort(backend.Listener.Addr().String())
+		g.services[id] = &Service{ID: id, Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true}
+	}
+	return g
+}
+
+func namedBackend(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	}
+}
+
+func TestTrafficSplitWeightsAndCanaryMatch(t *testing.T) {
+	g := newSplitTestGateway(t, map[string]http.HandlerFunc{"stable": namedBackend("stable"), "canary": namedBackend("canary")})
+	g.routes = []*Route{{
+		ID:        "r1",
+		ServiceID: "stable",
+		Paths:     []string{"/"},
+		Enabled:   true,
+		Split: &TrafficSplit{Backends: []RouteBackend{
+			{ServiceID: "stable", Weight: 90},
+			{ServiceID: "canary", Weight: 10, Match: &BackendMatcher{Header: "X-Canary", Value: "1"}},
+		}},
+	}}
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, httptest.NewRequest("GET", "/", nil))
+		counts[rec.Body.String()]++
+	}
+	assert.InDelta(t, 900, counts["stable"], 60)
+	assert.InDelta(t, 100, counts["canary"], 60)
+
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Canary", "1")
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, req)
+		assert.Equal(t, "canary", rec.Body.String())
+	}
+
+	stats := map[string]ServiceStats{}
+	for _, s := range g.GetStats().ServiceStats {
+		stats[s.ServiceID] = s
+	}
+	assert.Equal(t, int64(counts["stable"]), stats["stable"].Requests)
+	assert.Equal(t, int64(counts["canary"]+20), stats["canary"].Requests)
+}
+
+func TestTrafficSplitSticky(t *testing.T) {
+	g := newSplitTestGateway(t, map[string]http.HandlerFunc{"a": namedBackend("a"), "b": namedBackend("b")})
+	route := &Route{
+		ID:      "r1",
+		Paths:   []string{"/"},
+		Enabled: true,
+		Split: &TrafficSplit{
+			Backends: []RouteBackend{{ServiceID: "a", Weight: 1}, {ServiceID: "b", Weight: 1}},
+			StickyBy: stickyByCookie,
+		},
+	}
+	g.routes = []*Route{route}
+
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("GET", "/", nil))
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, defaultStickyCookie, cookies[0].Name)
+	assert.Equal(t, rec.Body.String(), cookies[0].Value)
+
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookies[0])
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, req)
+		assert.Equal(t, cookies[0].Value, rec.Body.String())
+		assert.Empty(t, rec.Result().Cookies())
+	}
+
+	// client_ip stickiness is a stable hash
+	route.Split.StickyBy = stickyByClientIP
+	req := httptest.NewRequest("GET", "/", nil)
+	first, _ := g.selectService(req, route)
+	for i := 0; i < 20; i++ {
+		svc, cookie := g.selectService(req, route)
+		assert.Same(t, first, svc)
+		assert.Nil(t, cookie)
+	}
+
+	// disabled backends drop out of the split
+	g.services["a"].Enabled = false
+	route.Split.StickyBy = ""
+	for i := 0; i < 20; i++ {
+		svc, _ := g.selectService(req, route)
+		assert.Equal(t, "b", svc.ID)
+	}
+}
+
+func TestRequestMirroring(t *testing.T) {
+	mirrored := make(chan string, 1)
+	g := newSplitTestGateway(t, map[string]http.HandlerFunc{
+		"primary": namedBackend("primary"),
+		"shadow": func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			mirrored <- r.Method + " " + r.URL.Path + " " + string(body)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("ignored"))
+		},
+	})
+	g.routes = []*Route{{
+		ID:        "r1",
+		ServiceID: "primary",
+		Paths:     []string{"/"},
+		Enabled:   true,
+		Mirror:    &MirrorConfig{ServiceID: "shadow"},
+	}}
+
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("POST", "/orders", strings.NewReader("payload")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "primary", rec.Body.String())
+
+	select {
+	case got := <-mirrored:
+		assert.Equal(t, "POST /orders payload", got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("mirror did not receive the request")
+	}
+	require.Eventually(t, func() bool {
+		for _, s := range g.GetStats().ServiceStats {
+			if s.ServiceID == "shadow" {
+				return s.MirroredRequests == 1 && s.MirrorErrors == 1 && s.Requests == 0
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -1,6 +1,7 @@
 package api_gateway
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -8,57 +9,84 @@ import (
 	"time"
 )
 
-// runTCPRoute listens on route.ListenPort (TCP) and forwards raw TCP to the backend service.
-func (g *Gateway) runTCPRoute(route TCPRoute, stopChan <-chan struct{}) {
-	if !route.Enabled {
-		return
-	}
+// startTCPRoute listens on route.ListenPort (TCP) and forwards raw TCP to the backend service.
+// Closing the returned listener stops the route; accepted connections stay open.
+func (g *Gateway) startTCPRoute(route TCPRoute) (net.Listener, error) {
 	g.mu.RLock()
 	svc, ok := g.services[route.ServiceID]
 	g.mu.RUnlock()
 	if !ok || svc == nil {
-		log.Printf("API Gateway TCP: route %s: service %s not found", route.ID, route.ServiceID)
-		return
+		return nil, fmt.Errorf("service %s not found", route.ServiceID)
 	}
-	backendAddr := net.JoinHostPort(svc.Host, fmt.Sprintf("%d", svc.Port))
 
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", route.ListenPort))
 	if err != nil {
-		log.Printf("API Gateway TCP: route %s: failed to listen on port %d: %v", route.ID, route.ListenPort, err)
-		return
+		return nil, fmt.Errorf("failed to listen on port %d: %w", route.ListenPort, err)
 	}
-	defer listener.Close()
-
-	go func() {
-		<-stopChan
-		listener.Close()
-	}()
-
-	log.Printf("API Gateway TCP: route %s listening on 0.0.0.0:%d -> %s", route.ID, route.ListenPort, backendAddr)
+	log.Printf("API Gateway TCP: route %s listening on 0.0.0.0:%d -> service %s", route.ID, route.ListenPort, svc.ID)
+	go g.serveTCPRoute(route, listener)
+	return listener, nil
+}
 
+func (g *Gateway) serveTCPRoute(route TCPRoute, listener net.Listener) {
+	defer listener.Close()
 	for {
 		clientConn, err := listener.Accept()
 		if err != nil {
-			if netErr, ok := err.(*net.OpError); ok && netErr.Err != nil {
-				if netErr.Err.Error() == "use of closed network connection" {
-					return
-				}
+			if errors.Is(err, net.ErrClosed) {
+				return
 			}
 			log.Printf("API Gateway TCP: route %s accept: %v", route.ID, err)
 			continue
 		}
-		go g.proxyTCPConnection(route.ID, clientConn, backendAddr)
+		go g.proxyTCPConnection(route, clientConn)
 	}
 }
 
-func (g *Gateway) proxyTCPConnection(routeID string, clientConn net.Conn, backendAddr string) {
+func (g *Gateway) proxyTCPConnection(route TCPRoute, clientConn net.Conn) {
 	defer clientConn.Close()
+	routeID := route.ID
+	// The service is looked up per connection so that its changes apply without a new listener
+	g.mu.RLock()
+	svc := g.services[route.ServiceID]
+	g.mu.RUnlock()
+	if svc == nil {
+		log.Printf("API Gateway TCP: route %s: service %s not found", routeID, route.ServiceID)
+		return
+	}
+	if route.ProxyProtocol {
+		pc := newProxyProtocolConn(clientConn, g.isTrustedProxy)
+		if err := pc.handshake(); err != nil {
+			log.Printf("API Gateway TCP: route %s: %v from %s", routeID, err, clientConn.RemoteAddr())
+			return
+		}
+		clientConn = pc
+	}
+	clientIP, _, _ := net.SplitHostPort(clientConn.RemoteAddr().String())
+	if !g.clientAllowed(g.accessPolicyFor("tcp:"+routeID, route.Access), clientIP) {
+		return
+	}
+	lb, target := g.pickTarget(svc, nil, clientIP)
+	if target == nil {
+		log.Printf("API Gateway TCP: route %s: no healthy target for service %s", routeID, svc.ID)
+		return
+	}
+	lb.acquire(target)
+	defer lb.release(target)
+	backendAddr := target.address
 	backendConn, err := net.DialTimeout("tcp", backendAddr, 30*time.Second)
 	if err != nil {
 		log.Printf("API Gateway TCP: route %s dial backend %s: %v", routeID, backendAddr, err)
 		return
 	}
 	defer backendConn.Close()
+	if svc.ProxyProtocol != "" {
+		header := proxyProtocolHeader(svc.ProxyProtocol, addrPortOf(clientConn.RemoteAddr()), addrPortOf(clientConn.LocalAddr()))
+		if _, err := backendConn.Write(header); err != nil {
+			log.Printf("API Gateway TCP: route %s write PROXY header to %s: %v", routeID, backendAddr, err)
+			return
+		}
+	}
 	go io.Copy(backendConn, clientConn)
 	io.Copy(clientConn, backendConn)
 }
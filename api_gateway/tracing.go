@@ -0,0 +1,520 @@
+package api_gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	spanKindServer = 2
+	spanKindClient = 3
+
+	spanStatusUnset = 0
+	spanStatusError = 2
+
+	defaultTraceBatchSize     = 512
+	defaultTraceFlushInterval = 5 * time.Second
+	maxQueuedSpans            = 8192
+)
+
+// otlpSpan is a span in the OTLP/JSON encoding
+type otlpSpan struct {
+	TraceID      string           `json:"traceId"`
+	SpanID       string           `json:"spanId"`
+	ParentSpanID string           `json:"parentSpanId,omitempty"`
+	TraceState   string           `json:"traceState,omitempty"`
+	Name         string           `json:"name"`
+	Kind         int              `json:"kind"`
+	Start        string           `json:"startTimeUnixNano"`
+	End          string           `json:"endTimeUnixNano"`
+	Attributes   []map[string]any `json:"attributes,omitempty"`
+	Status       otlpSpanStatus   `json:"status"`
+}
+
+type otlpSpanStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// otlpAttribute encodes a span attribute; integers are strings in OTLP/JSON
+func otlpAttribute(key string, value any) map[string]any {
+	var v map[string]any
+	switch value := value.(type) {
+	case int:
+		v = map[string]any{"intValue": strconv.Itoa(value)}
+	case int64:
+		v = map[string]any{"intValue": strconv.FormatInt(value, 10)}
+	case bool:
+		v = map[string]any{"boolValue": value}
+	default:
+		v = map[string]any{"stringValue": fmt.Sprint(value)}
+	}
+	return map[string]any{"key": key, "value": v}
+}
+
+// tracer samples request traces and exports their spans in batches to an OTLP/HTTP collector
+type tracer struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	ratio       float64
+	keepErrors  bool
+	batchSize   int
+	interval    time.Duration
+	client      *http.Client
+
+	mu      sync.Mutex
+	queue   []otlpSpan
+	dropped int64
+	stop    chan struct{}
+}
+
+func newTracer(obs *ObservabilityConfig) *tracer {
+	if obs == nil || !obs.Enabled || obs.Tracing == nil || !obs.Tracing.Enabled {
+		return nil
+	}
+	cfg := obs.Tracing
+	t := &tracer{
+		endpoint:    cfg.Endpoint,
+		headers:     cfg.Headers,
+		serviceName: cfg.ServiceName,
+		ratio:       1,
+		keepErrors:  cfg.AlwaysSampleErrors,
+		batchSize:   cfg.BatchSize,
+		interval:    defaultTraceFlushInterval,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		stop:        make(chan struct{}),
+	}
+	if t.endpoint == "" {
+		t.endpoint = obs.OTLPEndpoint
+	}
+	if t.headers == nil {
+		t.headers = obs.OTLPHeaders
+	}
+	if t.serviceName == "" {
+		t.serviceName = "api_gateway"
+	}
+	if cfg.SampleRatio != nil {
+		t.ratio = *cfg.SampleRatio
+	}
+	if t.batchSize <= 0 {
+		t.batchSize = defaultTraceBatchSize
+	}
+	if cfg.FlushInterval > 0 {
+		t.interval = time.Duration(cfg.FlushInterval) * time.Second
+	}
+	return t
+}
+
+// sameSettings reports whether two tracers export the same way, so the running one can stay
+func (t *tracer) sameSettings(other *tracer) bool {
+	return t.endpoint == other.endpoint && maps.Equal(t.headers, other.headers) && t.serviceName == other.serviceName &&
+		t.ratio == other.ratio && t.keepErrors == other.keepErrors && t.batchSize == other.batchSize && t.interval == other.interval
+}
+
+// validateTracingConfig checks the tracing settings before they are saved
+func validateTracingConfig(obs *ObservabilityConfig) error {
+	if obs == nil || obs.Tracing == nil || !obs.Tracing.Enabled {
+		return nil
+	}
+	cfg := obs.Tracing
+	if cfg.Endpoint == "" && obs.OTLPEndpoint == "" {
+		return fmt.Errorf("tracing requires an OTLP endpoint")
+	}
+	if cfg.SampleRatio != nil && (*cfg.SampleRatio < 0 || *cfg.SampleRatio > 1) {
+		return fmt.Errorf("tracing sample_ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// refreshTracer replaces the tracer when the tracing settings changed; the old one sends what it
+// has queued
+func (g *Gateway) refreshTracer() {
+	t := newTracer(g.config.Observability)
+	g.tracerMu.Lock()
+	old := g.tracer
+	if old != nil && t != nil && old.sameSettings(t) {
+		g.tracerMu.Unlock()
+		return
+	}
+	g.tracer = t
+	g.tracerMu.Unlock()
+	if t != nil {
+		go t.flushLoop()
+	}
+	if old != nil {
+		close(old.stop)
+	}
+}
+
+func (g *Gateway) currentTracer() *tracer {
+	g.tracerMu.RLock()
+	defer g.tracerMu.RUnlock()
+	return g.tracer
+}
+
+// sampled makes the head sampling decision for a trace that starts at the gateway. The
+// decision is derived from the trace ID so that every hop using the same ratio agrees.
+func (t *tracer) sampled(traceID [16]byte) bool {
+	switch {
+	case t.ratio >= 1:
+		return true
+	case t.ratio <= 0:
+		return false
+	}
+	return binary.BigEndian.Uint64(traceID[8:]) < uint64(t.ratio*math.MaxUint64)
+}
+
+// enqueue adds a finished trace's spans to the export queue
+func (t *tracer) enqueue(spans []otlpSpan) {
+	t.mu.Lock()
+	if len(t.queue)+len(spans) > maxQueuedSpans {
+		// The collector is not keeping up; drop rather than grow without bound
+		t.dropped += int64(len(spans))
+		t.mu.Unlock()
+		return
+	}
+	t.queue = append(t.queue, spans...)
+	full := len(t.queue) >= t.batchSize
+	t.mu.Unlock()
+	if full {
+		go t.flush()
+	}
+}
+
+func (t *tracer) flushLoop() {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			t.flush()
+			return
+		case <-ticker.C:
+			t.flush()
+		}
+	}
+}
+
+// flush exports the queued spans in batches
+func (t *tracer) flush() {
+	t.mu.Lock()
+	spans := t.queue
+	t.queue = nil
+	dropped := t.dropped
+	t.dropped = 0
+	t.mu.Unlock()
+
+	if dropped > 0 {
+		log.Printf("API Gateway Tracing: dropped %d spans, export queue full", dropped)
+	}
+	for len(spans) > 0 {
+		n := min(len(spans), t.batchSize)
+		t.export(spans[:n])
+		spans = spans[n:]
+	}
+}
+
+func (t *tracer) export(spans []otlpSpan) {
+	payload := map[string]any{
+		"resourceSpans": []map[string]any{
+			{
+				"resource": map[string]any{
+					"attributes": []map[string]any{otlpAttribute("service.name", t.serviceName)},
+				},
+				"scopeSpans": []map[string]any{
+					{
+						"scope": map[string]any{"name": "redock/api_gateway"},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	}
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("API Gateway Tracing: Failed to marshal spans: %v", err)
+		return
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(t.endpoint, "/")+"/v1/traces", bytes.NewReader(jsonData))
+	if err != nil {
+		log.Printf("API Gateway Tracing: Failed to create OTLP request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		log.Printf("API Gateway Tracing: Failed to send spans: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		log.Printf("API Gateway Tracing: OTLP returned status %d", resp.StatusCode)
+	}
+}
+
+// requestTrace collects the spans of one request. The gateway's server span is the parent of
+// every span it records and of the upstream request.
+type requestTrace struct {
+	tracer   *tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte // caller's span from traceparent; zero when the trace starts here
+	state    string  // tracestate, passed on unchanged
+	sampled  bool    // head decision, propagated upstream
+	start    time.Time
+
+	mu       sync.Mutex
+	spans    []otlpSpan
+	finished bool
+}
+
+// traceSpan is a span being timed
+type traceSpan struct {
+	trace  *requestTrace
+	id     [8]byte
+	name   string
+	kind   int
+	start  time.Time
+	attrs  []map[string]any
+	status otlpSpanStatus
+}
+
+type requestTraceKey struct{}
+
+// parseTraceparent reads a W3C traceparent header ("00-<trace-id>-<parent-id>-<flags>")
+func parseTraceparent(value string) (traceID [16]byte, parentID [8]byte, sampled, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, parentID, false, false
+	}
+	// Version 00 has exactly four fields; later versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return traceID, parentID, false, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == [16]byte{} {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil || parentID == [8]byte{} {
+		return traceID, parentID, false, false
+	}
+	return traceID, parentID, flags[0]&1 == 1, true
+}
+
+// startTrace joins the caller's trace from traceparent/tracestate, or starts a new one, when
+// tracing is enabled
+func (g *Gateway) startTrace(r *http.Request) *http.Request {
+	t := g.currentTracer()
+	if t == nil {
+		return r
+	}
+	trace := &requestTrace{tracer: t, start: time.Now()}
+	if traceID, parentID, sampled, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+		trace.traceID, trace.parentID, trace.sampled = traceID, parentID, sampled
+		trace.state = r.Header.Get("tracestate")
+	} else {
+		rand.Read(trace.traceID[:])
+		trace.sampled = t.sampled(trace.traceID)
+	}
+	rand.Read(trace.spanID[:])
+	return r.WithContext(context.WithValue(r.Context(), requestTraceKey{}, trace))
+}
+
+func traceFromRequest(r *http.Request) *requestTrace {
+	trace, _ := r.Context().Value(requestTraceKey{}).(*requestTrace)
+	return trace
+}
+
+// traceIDFromRequest returns the request's trace ID in hex, empty without tracing
+func traceIDFromRequest(r *http.Request) string {
+	if trace := traceFromRequest(r); trace != nil {
+		return hex.EncodeToString(trace.traceID[:])
+	}
+	return ""
+}
+
+// traceparent returns the header that makes spanID the parent of the next hop
+func (t *requestTrace) traceparent(spanID [8]byte) string {
+	flags := "00"
+	if t.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(t.traceID[:]) + "-" + hex.EncodeToString(spanID[:]) + "-" + flags
+}
+
+// startSpan starts a child span of the request's server span; without tracing it returns nil,
+// which every traceSpan method accepts
+func startSpan(r *http.Request, name string) *traceSpan {
+	if trace := traceFromRequest(r); trace != nil {
+		return trace.startSpan(name, 0)
+	}
+	return nil
+}
+
+func (t *requestTrace) startSpan(name string, kind int) *traceSpan {
+	s := &traceSpan{trace: t, name: name, kind: kind, start: time.Now()}
+	rand.Read(s.id[:])
+	return s
+}
+
+// set adds an attribute to the span
+func (s *traceSpan) set(key string, value any) {
+	if s != nil {
+		s.attrs = append(s.attrs, otlpAttribute(key, value))
+	}
+}
+
+// fail marks the span as failed
+func (s *traceSpan) fail(message string) {
+	if s != nil {
+		s.status = otlpSpanStatus{Code: spanStatusError, Message: message}
+	}
+}
+
+// end records the span in its trace
+func (s *traceSpan) end() {
+	if s == nil {
+		return
+	}
+	t := s.trace
+	span := t.otlpSpan(s.id, s.name, s.kind, s.start, time.Now(), s.attrs, s.status)
+	span.ParentSpanID = hex.EncodeToString(t.spanID[:])
+	t.mu.Lock()
+	if !t.finished {
+		t.spans = append(t.spans, span)
+	}
+	t.mu.Unlock()
+}
+
+func (t *requestTrace) otlpSpan(id [8]byte, name string, kind int, start, end time.Time, attrs []map[string]any, status otlpSpanStatus) otlpSpan {
+	if kind == 0 {
+		kind = 1 // SPAN_KIND_INTERNAL
+	}
+	return otlpSpan{
+		TraceID:    hex.EncodeToString(t.traceID[:]),
+		SpanID:     hex.EncodeToString(id[:]),
+		TraceState: t.state,
+		Name:       name,
+		Kind:       kind,
+		Start:      strconv.FormatInt(start.UnixNano(), 10),
+		End:        strconv.FormatInt(end.UnixNano(), 10),
+		Attributes: attrs,
+		Status:     status,
+	}
+}
+
+// finishTrace ends the request's server span and queues the trace for export when it is
+// sampled, or when it failed and errors are always kept. Spans ended later are ignored.
+func finishTrace(r *http.Request, statusCode int, routeName, routeID, serviceID, errMsg string, export bool) {
+	t := traceFromRequest(r)
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	if t.finished {
+		t.mu.Unlock()
+		return
+	}
+	t.finished = true
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+
+	failed := statusCode >= http.StatusInternalServerError
+	if !export || !(t.sampled || (failed && t.tracer.keepErrors)) {
+		return
+	}
+
+	name := r.Method
+	if routeName == "" {
+		routeName = routeID
+	}
+	if routeName != "" {
+		name += " " + routeName
+	}
+	attrs := []map[string]any{
+		otlpAttribute("http.request.method", r.Method),
+		otlpAttribute("url.path", r.URL.Path),
+		otlpAttribute("server.address", r.Host),
+		otlpAttribute("http.response.status_code", statusCode),
+		otlpAttribute("client.address", getClientIP(r)),
+		otlpAttribute("user_agent.original", r.UserAgent()),
+	}
+	if id := requestIDFromRequest(r); id != "" {
+		attrs = append(attrs, otlpAttribute("gateway.request_id", id))
+	}
+	if routeID != "" {
+		attrs = append(attrs, otlpAttribute("gateway.route.id", routeID))
+	}
+	if serviceID != "" {
+		attrs = append(attrs, otlpAttribute("gateway.service.id", serviceID))
+	}
+	status := otlpSpanStatus{Code: spanStatusUnset}
+	if failed {
+		status = otlpSpanStatus{Code: spanStatusError, Message: errMsg}
+	}
+	root := t.otlpSpan(t.spanID, name, spanKindServer, t.start, time.Now(), attrs, status)
+	if t.parentID != [8]byte{} {
+		root.ParentSpanID = hex.EncodeToString(t.parentID[:])
+	}
+	t.tracer.enqueue(append(spans, root))
+}
+
+// tracingTransport records a client span for every upstream attempt and passes the trace on
+// to the upstream in traceparent/tracestate
+type tracingTransport struct {
+	base     http.RoundTripper
+	trace    *requestTrace
+	attempts int
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	span := t.trace.startSpan("upstream "+req.Method, spanKindClient)
+	span.set("http.request.method", req.Method)
+	span.set("server.address", req.URL.Host)
+	span.set("url.full", req.URL.String())
+	if t.attempts > 0 {
+		span.set("http.request.resend_count", t.attempts)
+	}
+	t.attempts++
+
+	out := req.Clone(req.Context())
+	out.Header.Set("traceparent", t.trace.traceparent(span.id))
+	if t.trace.state != "" {
+		out.Header.Set("tracestate", t.trace.state)
+	} else {
+		out.Header.Del("tracestate")
+	}
+
+	resp, err := t.base.RoundTrip(out)
+	if err != nil {
+		span.fail(err.Error())
+	} else {
+		span.set("http.response.status_code", resp.StatusCode)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.fail(http.StatusText(resp.StatusCode))
+		}
+	}
+	span.end()
+	return resp, err
+}
@@ -0,0 +1,186 @@
+package api_gateway
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, parentID, sampled, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", hex.EncodeToString(traceID[:]))
+	assert.Equal(t, byte(0xb7), parentID[7])
+	assert.True(t, sampled)
+
+	_, _, sampled, ok = parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.True(t, ok)
+	assert.False(t, sampled)
+	// later versions may carry more fields
+	_, _, _, ok = parseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.True(t, ok)
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		_, _, _, ok := parseTraceparent(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestTracerSampling(t *testing.T) {
+	var low, high [16]byte
+	high[8] = 0xf0
+	half := &tracer{ratio: 0.5}
+	assert.True(t, half.sampled(low))
+	assert.False(t, half.sampled(high))
+	assert.False(t, (&tracer{ratio: 0}).sampled(low))
+	assert.True(t, (&tracer{ratio: 1}).sampled(high))
+}
+
+// spanCollector is an OTLP/HTTP endpoint that keeps the spans it receives
+type spanCollector struct {
+	mu    sync.Mutex
+	spans []otlpSpan
+}
+
+func (c *spanCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if r.URL.Path != "/v1/traces" || json.NewDecoder(r.Body).Decode(&payload) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range payload.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+}
+
+func (c *spanCollector) byName() map[string]otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	spans := make(map[string]otlpSpan, len(c.spans))
+	for _, s := range c.spans {
+		spans[s.Name] = s
+	}
+	return spans
+}
+
+func newTracingTestGateway(t *testing.T, backendURL string, tracing *TracingConfig) (*Gateway, *spanCollector) {
+	collector := &spanCollector{}
+	server := httptest.NewServer(collector)
+	t.Cleanup(server.Close)
+
+	hostParts := splitHostPort(strings.TrimPrefix(backendURL, "http://"))
+	g := newProxyTestGateway(&Service{ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true})
+	tracing.Enabled = true
+	tracing.Endpoint = server.URL
+	g.config.Observability = &ObservabilityConfig{Enabled: true, Tracing: tracing}
+	g.refreshTracer()
+	t.Cleanup(func() {
+		g.config.Observability = nil
+		g.refreshTracer()
+	})
+	return g, collector
+}
+
+func TestRequestTracing(t *testing.T) {
+	var upstreamParent string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamParent = r.Header.Get("traceparent")
+		assert.Equal(t, "vendor=abc", r.Header.Get("tracestate"))
+	}))
+	defer backend.Close()
+	g, collector := newTracingTestGateway(t, backend.URL, &TracingConfig{})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=abc")
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// the caller's trace continues upstream with the gateway's client span as parent
+	require.True(t, strings.HasPrefix(upstreamParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-"), upstreamParent)
+	assert.True(t, strings.HasSuffix(upstreamParent, "-01"))
+
+	g.currentTracer().flush()
+	spans := collector.byName()
+	root, ok := spans["GET r1"]
+	require.True(t, ok, "server span exported")
+	assert.Equal(t, spanKindServer, root.Kind)
+	assert.Equal(t, "00f067aa0ba902b7", root.ParentSpanID)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", root.TraceID)
+
+	upstream, ok := spans["upstream GET"]
+	require.True(t, ok, "client span exported")
+	assert.Equal(t, spanKindClient, upstream.Kind)
+	assert.Equal(t, root.SpanID, upstream.ParentSpanID)
+	assert.Equal(t, upstream.SpanID, strings.Split(upstreamParent, "-")[2])
+	assert.Contains(t, spans, "route_match")
+}
+
+func TestTracingSamplesErrors(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer backend.Close()
+	none := 0.0
+	g, collector := newTracingTestGateway(t, backend.URL, &TracingConfig{SampleRatio: &none, AlwaysSampleErrors: true})
+	g.routes[0].Paths = []string{"/ok", "/fail"}
+
+	g.handleRequest(httptest.NewRecorder(), httptest.NewRequest("GET", "/ok", nil))
+	g.currentTracer().flush()
+	assert.Empty(t, collector.byName(), "unsampled traces are not exported")
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/fail", nil)
+	g.handleRequest(rec, req)
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	g.currentTracer().flush()
+	spans := collector.byName()
+	require.Contains(t, spans, "GET r1")
+	assert.Equal(t, spanStatusError, spans["GET r1"].Status.Code)
+	assert.Empty(t, spans["GET r1"].ParentSpanID)
+}
+
+func TestTracerKeptWhenTracingUnchanged(t *testing.T) {
+	g, _ := newTracingTestGateway(t, "http://127.0.0.1:1", &TracingConfig{ServiceName: "edge"})
+	current := g.currentTracer()
+	require.NotNil(t, current)
+
+	// other observability settings and a copied tracing config keep the running tracer
+	tracing := *g.config.Observability.Tracing
+	g.config.Observability = &ObservabilityConfig{Enabled: true, LokiEnabled: true, Tracing: &tracing}
+	g.refreshTracer()
+	assert.Same(t, current, g.currentTracer())
+
+	half := 0.5
+	g.config.Observability = &ObservabilityConfig{Enabled: true, Tracing: &TracingConfig{Enabled: true, Endpoint: tracing.Endpoint, ServiceName: "edge", SampleRatio: &half}}
+	g.refreshTracer()
+	assert.NotSame(t, current, g.currentTracer())
+	assert.Equal(t, 0.5, g.currentTracer().ratio)
+}
@@ -0,0 +1,223 @@
+package api_gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// templatePattern matches ${name} placeholders in transform values
+var templatePattern = regexp.MustCompile(`\$\{([A-Za-z0-9_.\-]+)\}`)
+
+// routeTransformer is the compiled RouteTransform of a route
+type routeTransformer struct {
+	cfg         *RouteTransform
+	pathPattern *regexp.Regexp
+}
+
+// newRouteTransformer compiles the transform of a route; nil means the route has none
+func newRouteTransformer(route *Route) (*routeTransformer, error) {
+	if route.Transform == nil {
+		return nil, nil
+	}
+	t := &routeTransformer{cfg: route.Transform}
+	if pr := route.Transform.PathRewrite; pr != nil && pr.Pattern != "" {
+		re, err := regexp.Compile(pr.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path rewrite pattern: %w", err)
+		}
+		t.pathPattern = re
+	}
+	return t, nil
+}
+
+// validateRouteTransform checks a route's transform before it is saved
+func validateRouteTransform(route *Route) error {
+	_, err := newRouteTransformer(route)
+	return err
+}
+
+// transformerFor returns the cached transformer of a route, compiling it on first use.
+func (g *Gateway) transformerFor(route *Route) *routeTransformer {
+	if route.Transform == nil {
+		return nil
+	}
+	g.transformersMu.Lock()
+	defer g.transformersMu.Unlock()
+	if g.transformers == nil {
+		g.transformers = make(map[string]*routeTransformer)
+	}
+	t, ok := g.transformers[route.ID]
+	if !ok {
+		var err error
+		if t, err = newRouteTransformer(route); err != nil {
+			// Rejected on save; an invalid pattern loaded from disk disables the path rewrite only
+			t = &routeTransformer{cfg: route.Transform}
+		}
+		g.transformers[route.ID] = t
+	}
+	return t
+}
+
+// refreshTransformers drops the compiled transforms of routes that were removed or whose transform
+// changed (must be called with g.mu held after the routes are published)
+func (g *Gateway) refreshTransformers() {
+	g.transformersMu.Lock()
+	defer g.transformersMu.Unlock()
+
+	transformers := make(map[string]*routeTransformer)
+	for _, route := range g.routes {
+		if t, ok := g.transformers[route.ID]; ok && route.Transform != nil && reflect.DeepEqual(t.cfg, route.Transform) {
+			transformers[route.ID] = t
+		}
+	}
+	g.transformers = transformers
+}
+
+// transformVars resolves template placeholders for a single request
+type transformVars struct {
+	r       *http.Request // incoming request
+	route   *Route
+	service *Service
+}
+
+func (v transformVars) lookup(name string) string {
+	switch {
+	case name == "client_ip":
+		return getClientIP(v.r)
+	case name == "request_id":
+		return requestIDFromRequest(v.r)
+	case name == "route_id":
+		return v.route.ID
+	case name == "route_name":
+		return v.route.Name
+	case name == "service_id":
+		if v.service != nil {
+			return v.service.ID
+		}
+	case name == "host":
+		return v.r.Host
+	case name == "method":
+		return v.r.Method
+	case name == "path":
+		return v.r.URL.Path
+	case name == "query":
+		return v.r.URL.RawQuery
+	case name == "request_uri":
+		return v.r.URL.RequestURI()
+	case name == "scheme":
+		if v.r.TLS != nil {
+			return "https"
+		}
+		return "http"
+	case name == "consumer":
+		if auth := authResultFromRequest(v.r); auth != nil {
+			return auth.consumer
+		}
+	case strings.HasPrefix(name, "jwt."):
+		if auth := authResultFromRequest(v.r); auth != nil && auth.claims != nil {
+			value, _ := lookupClaim(auth.claims, strings.TrimPrefix(name, "jwt."))
+			return value
+		}
+	case strings.HasPrefix(name, "header."):
+		return v.r.Header.Get(strings.TrimPrefix(name, "header."))
+	case strings.HasPrefix(name, "query."):
+		return v.r.URL.Query().Get(strings.TrimPrefix(name, "query."))
+	}
+	return ""
+}
+
+// expand replaces ${name} placeholders; unknown names expand to an empty string
+func (v transformVars) expand(value string) string {
+	if !strings.Contains(value, "${") {
+		return value
+	}
+	return templatePattern.ReplaceAllStringFunc(value, func(match string) string {
+		return v.lookup(match[2 : len(match)-1])
+	})
+}
+
+// applyHeaderTransform removes, renames and then adds headers
+func applyHeaderTransform(h http.Header, ht *HeaderTransform, vars transformVars) {
+	if ht == nil {
+		return
+	}
+	for _, name := range ht.Remove {
+		h.Del(name)
+	}
+	for from, to := range ht.Rename {
+		if values := h.Values(from); len(values) > 0 {
+			h.Del(from)
+			h.Del(to)
+			for _, value := range values {
+				h.Add(to, value)
+			}
+		}
+	}
+	for name, value := range ht.Add {
+		h.Set(name, vars.expand(value))
+	}
+}
+
+// applyRequest rewrites the outgoing upstream request. path is the upstream path before the
+// service base path is prepended; the rewritten path is returned.
+func (t *routeTransformer) applyRequest(out *http.Request, path string, vars transformVars) string {
+	cfg := t.cfg
+	if t.pathPattern != nil && t.pathPattern.MatchString(path) {
+		path = t.pathPattern.ReplaceAllString(path, cfg.PathRewrite.Replacement)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+
+	if q := cfg.Query; q != nil {
+		query := out.URL.Query()
+		for _, name := range q.Remove {
+			query.Del(name)
+		}
+		for from, to := range q.Rename {
+			if values, ok := query[from]; ok {
+				query.Del(from)
+				query[to] = values
+			}
+		}
+		for name, value := range q.Add {
+			query.Set(name, vars.expand(value))
+		}
+		out.URL.RawQuery = query.Encode()
+	}
+
+	applyHeaderTransform(out.Header, cfg.RequestHeaders, vars)
+
+	if cfg.MethodOverride != "" {
+		out.Method = strings.ToUpper(cfg.MethodOverride)
+	}
+	return path
+}
+
+// applyResponse rewrites the headers of the upstream response
+func (t *routeTransformer) applyResponse(resp *http.Response, vars transformVars) {
+	applyHeaderTransform(resp.Header, t.cfg.ResponseHeaders, vars)
+}
+
+type requestIDKey struct{}
+
+// withRequestID assigns the request its ID: the incoming X-Request-Id header or a new UUID
+func withRequestID(r *http.Request) *http.Request {
+	id := strings.TrimSpace(r.Header.Get("X-Request-Id"))
+	if id == "" {
+		id = uuid.New().String()
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
+
+// requestIDFromRequest returns the ID assigned by withRequestID
+func requestIDFromRequest(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,137 @@
+package api_gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleRequestTransforms(t *testing.T) {
+	var upstream *http.Request
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.Clone(r.Context())
+		w.Header().Set("X-Internal", "secret")
+		w.Header().Set("X-Upstream-Version", "7")
+	}))
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+
+	service := &Service{ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Path: "/base", Enabled: true}
+	g := newProxyTestGateway(service)
+	g.routes[0].Paths = []string{"/api/*"}
+	g.routes[0].StripPath = true
+	g.routes[0].Transform = &RouteTransform{
+		PathRewrite: &PathRewrite{Pattern: `^/users/(\d+)$`, Replacement: "/accounts/$1/profile"},
+		Query: &QueryTransform{
+			Add:    map[string]string{"source": "${route_id}"},
+			Remove: []string{"debug"},
+			Rename: map[string]string{"q": "search"},
+		},
+		RequestHeaders: &HeaderTransform{
+			Add:    map[string]string{"X-Client": "${client_ip}", "X-Request-Id": "${request_id}", "X-Trace": "${header.X-Old}/${unknown}"},
+			Remove: []string{"Cookie"},
+			Rename: map[string]string{"X-Old": "X-New"},
+		},
+		ResponseHeaders: &HeaderTransform{
+			Add:    map[string]string{"X-Route": "${route_id}"},
+			Remove: []string{"X-Internal"},
+			Rename: map[string]string{"X-Upstream-Version": "X-Version"},
+		},
+		MethodOverride: "post",
+	}
+
+	req := httptest.NewRequest("GET", "/api/users/42?q=go&debug=1", nil)
+	req.RemoteAddr = "10.0.0.9:5000"
+	req.Header.Set("Cookie", "session=1")
+	req.Header.Set("X-Old", "legacy")
+	req.Header.Set("X-Request-Id", "req-123")
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, upstream)
+
+	assert.Equal(t, "POST", upstream.Method)
+	assert.Equal(t, "/base/accounts/42/profile", upstream.URL.Path)
+	assert.Equal(t, "go", upstream.URL.Query().Get("search"))
+	assert.Equal(t, "r1", upstream.URL.Query().Get("source"))
+	assert.False(t, upstream.URL.Query().Has("debug"))
+	assert.False(t, upstream.URL.Query().Has("q"))
+	assert.Equal(t, "10.0.0.9", upstream.Header.Get("X-Client"))
+	assert.Equal(t, "req-123", upstream.Header.Get("X-Request-Id"))
+	assert.Equal(t, "legacy/", upstream.Header.Get("X-Trace")) // templates read the incoming request
+	assert.Equal(t, "legacy", upstream.Header.Get("X-New"))
+	assert.Empty(t, upstream.Header.Get("Cookie"))
+
+	assert.Equal(t, "r1", rec.Header().Get("X-Route"))
+	assert.Empty(t, rec.Header().Get("X-Internal"))
+	assert.Equal(t, "7", rec.Header().Get("X-Version"))
+}
+
+func TestTransformTemplates(t *testing.T) {
+	r := httptest.NewRequest("GET", "https://api.example.com/x?tenant=acme", nil)
+	r = withRequestID(r)
+	r = withAuthResult(r, &authResult{claims: jwt.MapClaims{"sub": "user-1", "org": map[string]interface{}{"id": "o1"}}})
+	vars := transformVars{r: r, route: &Route{ID: "r1", Name: "users"}, service: &Service{ID: "s1"}}
+
+	assert.Equal(t, "user-1|o1|acme|s1|users", vars.expand("${jwt.sub}|${jwt.org.id}|${query.tenant}|${service_id}|${route_name}"))
+	assert.Len(t, vars.expand("${request_id}"), 36)
+	assert.Equal(t, vars.expand("${request_id}"), requestIDFromRequest(r))
+	assert.Equal(t, "https GET api.example.com", vars.expand("${scheme} ${method} ${host}"))
+	assert.Equal(t, "plain", vars.expand("plain"))
+}
+
+func TestRouteTransformValidation(t *testing.T) {
+	tmpDir := t.TempDir()
+	g := &Gateway{
+		services: map[string]*Service{},
+		config:   &GatewayConfig{},
+		workDir:  tmpDir,
+		stats:    &gatewayStatsTracker{startTime: time.Now(), serviceStats: make(map[string]*serviceStatsTracker)},
+	}
+	err := g.AddRoute(Route{ID: "bad", Paths: []string{"/"}, Transform: &RouteTransform{PathRewrite: &PathRewrite{Pattern: "("}}})
+	assert.ErrorContains(t, err, "invalid path rewrite pattern")
+	assert.Empty(t, g.config.Routes)
+}
+
+func TestValidateShowsTransformedRequest(t *testing.T) {
+	service := &Service{ID: "backend", Host: "10.1.2.3", Port: 8080, Headers: map[string]string{"X-Service": "1"}, Enabled: true}
+	g := newProxyTestGateway(service)
+	g.routes[0].Transform = &RouteTransform{
+		PathRewrite:    &PathRewrite{Pattern: `^/old/(.*)$`, Replacement: "/new/$1"},
+		RequestHeaders: &HeaderTransform{Add: map[string]string{"X-Route": "${route_id}"}},
+		MethodOverride: "PUT",
+	}
+
+	_, _, upstream, err := g.Validate("GET", "/old/items?x=1", "gw.local", map[string]string{"X-Test": "yes"})
+	require.NoError(t, err)
+	assert.Equal(t, "PUT", upstream.Method)
+	assert.Equal(t, "http://10.1.2.3:8080/new/items?x=1", upstream.URL)
+	assert.Equal(t, "10.1.2.3:8080", upstream.Host)
+	assert.Equal(t, "r1", upstream.Headers["X-Route"])
+	assert.Equal(t, "1", upstream.Headers["X-Service"])
+	assert.Equal(t, "yes", upstream.Headers["X-Test"])
+}
+
+func TestTransformersKeptForUnchangedRoutes(t *testing.T) {
+	g := NewGateway(t.TempDir())
+	require.NoError(t, g.AddService(Service{ID: "web", Host: "127.0.0.1", Port: 9000, Enabled: true}))
+	api := Route{ID: "api", ServiceID: "web", Paths: []string{"/api/*"}, Enabled: true,
+		Transform: &RouteTransform{PathRewrite: &PathRewrite{Pattern: `^/users/(\d+)$`, Replacement: "/accounts/$1"}}}
+	require.NoError(t, g.AddRoute(api))
+	require.NoError(t, g.AddRoute(Route{ID: "other", ServiceID: "web", Paths: []string{"/other"}, Enabled: true}))
+
+	transformer := g.transformerFor(&api)
+	require.NoError(t, g.UpdateRoute(Route{ID: "other", ServiceID: "web", Paths: []string{"/other", "/more"}, Enabled: true}))
+	assert.Same(t, transformer, g.transformerFor(&api), "editing another route keeps the compiled transform")
+
+	api.Transform = &RouteTransform{PathRewrite: &PathRewrite{Pattern: `^/people/(\d+)$`, Replacement: "/accounts/$1"}}
+	require.NoError(t, g.UpdateRoute(api))
+	rebuilt := g.transformerFor(&api)
+	assert.NotSame(t, transformer, rebuilt, "a new transform is compiled again")
+	assert.Equal(t, `^/people/(\d+)$`, rebuilt.pathPattern.String())
+}
@@ -0,0 +1,163 @@
+package api_gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	protocolHTTP  = "http"
+	protocolHTTPS = "https"
+	protocolH2C   = "h2c"   // HTTP/2 over cleartext
+	protocolGRPC  = "grpc"  // gRPC over h2c
+	protocolGRPCS = "grpcs" // gRPC over TLS
+)
+
+// upstreamScheme returns the URL scheme used to reach the service
+func (s *Service) upstreamScheme() string {
+	switch strings.ToLower(s.Protocol) {
+	case protocolHTTPS, protocolGRPCS:
+		return "https"
+	default:
+		return "http"
+	}
+}
+
+// cleartextHTTP2 reports whether the service speaks HTTP/2 without TLS (prior knowledge)
+func (s *Service) cleartextHTTP2() bool {
+	switch strings.ToLower(s.Protocol) {
+	case protocolH2C, protocolGRPC:
+		return true
+	}
+	return false
+}
+
+// isGRPC reports whether the service is a gRPC upstream
+func (s *Service) isGRPC() bool {
+	switch strings.ToLower(s.Protocol) {
+	case protocolGRPC, protocolGRPCS:
+		return true
+	}
+	return false
+}
+
+// buildUpstreamTLSConfig returns the client TLS config for a service (nil = Go defaults)
+func buildUpstreamTLSConfig(cfg *UpstreamTLSConfig) (*tls.Config, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// newServiceTransport builds the pooled transport for a service
+func newServiceTransport(service *Service) (*http.Transport, error) {
+	dialTimeout := time.Duration(service.Timeout) * time.Second
+	if dialTimeout <= 0 {
+		dialTimeout = 30 * time.Second
+	}
+	tlsConfig, err := buildUpstreamTLSConfig(service.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   32,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true, // negotiated via ALPN for https upstreams
+	}
+	if service.ProxyProtocol != "" {
+		// The PROXY header names one client per connection, so connections are not shared
+		if err := validateServiceProxyProtocol(service); err != nil {
+			return nil, err
+		}
+		transport.DialContext = proxyProtocolDialer(service.ProxyProtocol, transport.DialContext)
+		transport.DisableKeepAlives = true
+		transport.ForceAttemptHTTP2 = false
+	}
+	if service.cleartextHTTP2() {
+		protocols := new(http.Protocols)
+		protocols.SetUnencryptedHTTP2(true)
+		transport.Protocols = protocols
+	}
+	return transport, nil
+}
+
+// transportFor returns the cached transport of a service, creating it on first use.
+func (g *Gateway) transportFor(service *Service) (*http.Transport, error) {
+	g.transportsMu.Lock()
+	defer g.transportsMu.Unlock()
+	if g.transports == nil {
+		g.transports = make(map[string]*http.Transport)
+	}
+	if t, ok := g.transports[service.ID]; ok {
+		return t, nil
+	}
+	t, err := newServiceTransport(service)
+	if err != nil {
+		return nil, err
+	}
+	g.transports[service.ID] = t
+	return t, nil
+}
+
+// refreshTransports drops the transports of services that were removed or changed since
+// previous, so pooled connections of unchanged services survive config changes (must be called
+// with g.mu held after the services were published)
+func (g *Gateway) refreshTransports(previous map[string]*Service) {
+	for id, old := range previous {
+		if current, ok := g.services[id]; !ok || !reflect.DeepEqual(old, current) {
+			g.resetTransport(id)
+		}
+	}
+}
+
+// resetTransport drops the cached transport of a service and closes its idle connections.
+// An empty serviceID resets all transports.
+func (g *Gateway) resetTransport(serviceID string) {
+	g.transportsMu.Lock()
+	defer g.transportsMu.Unlock()
+	for id, t := range g.transports {
+		if serviceID == "" || id == serviceID {
+			t.CloseIdleConnections()
+			delete(g.transports, id)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package api_gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newProxyTestGateway(service *Service) *Gateway {
+	return &Gateway{
+		services: map[string]*Service{service.ID: service},
+		routes: []*Route{{
+			ID:        "r1",
+			ServiceID: service.ID,
+			Paths:     []string{"/"},
+			Enabled:   true,
+		}},
+		serviceHealth: make(map[string]*ServiceHealth),
+		config:        &GatewayConfig{},
+		stats:         &gatewayStatsTracker{startTime: time.Now(), serviceStats: make(map[string]*serviceStatsTracker)},
+	}
+}
+
+// writeClientCert creates a self-signed client certificate and returns its pool and file paths
+func writeClientCert(t *testing.T, dir string) (*x509.CertPool, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gateway"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return pool, certFile, keyFile
+}
+
+func TestServiceTransportReusesConnections(t *testing.T) {
+	var newConns int32
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	backend.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&newConns, 1)
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+
+	service := &Service{ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true}
+	g := newProxyTestGateway(service)
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&newConns))
+
+	first, err := g.transportFor(service)
+	require.NoError(t, err)
+	g.resetTransport(service.ID)
+	second, err := g.transportFor(service)
+	require.NoError(t, err)
+	assert.NotSame(t, first, second)
+}
+
+func TestServiceTransportSurvivesConfigChanges(t *testing.T) {
+	g := NewGateway(t.TempDir())
+	require.NoError(t, g.AddService(Service{ID: "a", Host: "10.0.0.1", Port: 80, Enabled: true}))
+	require.NoError(t, g.AddService(Service{ID: "b", Host: "10.0.0.2", Port: 80, Enabled: true}))
+	transport := func(id string) *http.Transport {
+		g.mu.RLock()
+		service := g.services[id]
+		g.mu.RUnlock()
+		transport, err := g.transportFor(service)
+		require.NoError(t, err)
+		return transport
+	}
+	a, b := transport("a"), transport("b")
+
+	// only the transport of the changed service is dropped
+	config := g.GetConfigCopy()
+	config.Services[1].Timeout = 5
+	require.NoError(t, g.UpdateConfig(config))
+	assert.Same(t, a, transport("a"))
+	assert.NotSame(t, b, transport("b"))
+
+	// and those of removed services
+	config = g.GetConfigCopy()
+	config.Services = config.Services[1:]
+	require.NoError(t, g.UpdateConfig(config))
+	g.transportsMu.Lock()
+	assert.NotContains(t, g.transports, "a")
+	g.transportsMu.Unlock()
+}
+
+func TestServiceTransportMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientPool, clientCert, clientKey := writeClientCert(t, dir)
+
+	var sawClientCert bool
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sawClientCert = len(r.TLS.PeerCertificates) > 0
+	}))
+	backend.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientPool}
+	backend.StartTLS()
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw}), 0600))
+
+	service := &Service{
+		ID:       "secure",
+		Host:     hostParts[0],
+		Port:     mustParseInt(hostParts[1]),
+		Protocol: "https",
+		TLS:      &UpstreamTLSConfig{CAFile: caFile, CertFile: clientCert, KeyFile: clientKey, ServerName: "example.com"},
+		Enabled:  true,
+	}
+	g := newProxyTestGateway(service)
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, sawClientCert)
+
+	// without the client certificate the upstream handshake fails
+	service.TLS = &UpstreamTLSConfig{CAFile: caFile, ServerName: "example.com"}
+	g.resetTransport(service.ID)
+	rec = httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+
+	_, err := buildUpstreamTLSConfig(&UpstreamTLSConfig{CAFile: filepath.Join(dir, "missing.pem")})
+	assert.Error(t, err)
+}
+
+func TestServiceTransportH2C(t *testing.T) {
+	var protoMajor int32
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.StoreInt32(&protoMajor, int32(r.ProtoMajor))
+	}))
+	backend.Config.Protocols = new(http.Protocols)
+	backend.Config.Protocols.SetUnencryptedHTTP2(true)
+	backend.Start()
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+
+	service := &Service{ID: "grpc", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Protocol: "grpc", Enabled: true}
+	g := newProxyTestGateway(service)
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("POST", "/pkg.Service/Method", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&protoMajor))
+}
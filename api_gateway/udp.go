@@ -1,6 +1,7 @@
 package api_gateway
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -11,39 +12,27 @@ import (
 const udpBufferSize = 64 * 1024
 const udpSessionIdleTimeout = 2 * time.Minute
 
-// runUDPRoute listens on route.ListenPort (UDP) and forwards packets to the backend service.
+// startUDPRoute listens on route.ListenPort (UDP) and forwards packets to the backend service.
 // Client address is preserved: responses from backend are sent back to the originating client.
-func (g *Gateway) runUDPRoute(route UDPRoute, stopChan <-chan struct{}) {
-	if !route.Enabled {
-		return
-	}
+// Closing the returned connection stops the route.
+func (g *Gateway) startUDPRoute(route UDPRoute) (*net.UDPConn, error) {
 	g.mu.RLock()
 	svc, ok := g.services[route.ServiceID]
 	g.mu.RUnlock()
 	if !ok || svc == nil {
-		log.Printf("API Gateway UDP: route %s: service %s not found", route.ID, route.ServiceID)
-		return
-	}
-	backendAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(svc.Host, fmtPort(svc.Port)))
-	if err != nil {
-		log.Printf("API Gateway UDP: route %s: invalid backend %s:%d: %v", route.ID, svc.Host, svc.Port, err)
-		return
+		return nil, fmt.Errorf("service %s not found", route.ServiceID)
 	}
-
 	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: route.ListenPort})
 	if err != nil {
-		log.Printf("API Gateway UDP: route %s: failed to listen on port %d: %v", route.ID, route.ListenPort, err)
-		return
+		return nil, fmt.Errorf("failed to listen on port %d: %w", route.ListenPort, err)
 	}
-	defer listener.Close()
-
-	// Close listener when stop is requested so ReadFromUDP unblocks
-	go func() {
-		<-stopChan
-		listener.Close()
-	}()
+	log.Printf("API Gateway UDP: route %s listening on 0.0.0.0:%d -> service %s", route.ID, route.ListenPort, svc.ID)
+	go g.serveUDPRoute(route, listener)
+	return listener, nil
+}
 
-	log.Printf("API Gateway UDP: route %s listening on 0.0.0.0:%d -> %s", route.ID, route.ListenPort, backendAddr)
+func (g *Gateway) serveUDPRoute(route UDPRoute, listener *net.UDPConn) {
+	defer listener.Close()
 
 	type udpSession struct {
 		conn       *net.UDPConn
@@ -56,10 +45,8 @@ func (g *Gateway) runUDPRoute(route UDPRoute, stopChan <-chan struct{}) {
 	for {
 		n, clientAddr, err := listener.ReadFromUDP(readBuf)
 		if err != nil {
-			if netErr, ok := err.(*net.OpError); ok && netErr.Err != nil {
-				if netErr.Err.Error() == "use of closed network connection" {
-					return
-				}
+			if errors.Is(err, net.ErrClosed) {
+				return
 			}
 			log.Printf("API Gateway UDP: route %s read error: %v", route.ID, err)
 			continue
@@ -74,6 +61,32 @@ func (g *Gateway) runUDPRoute(route UDPRoute, stopChan <-chan struct{}) {
 		sessionsMu.Lock()
 		sess, exists := sessions[key]
 		if !exists {
+			// Packets from clients the access policy rejects are dropped before a session starts
+			if !g.clientAllowed(g.accessPolicyFor("udp:"+route.ID, route.Access), clientAddr.IP.String()) {
+				sessionsMu.Unlock()
+				continue
+			}
+			// Each client session sticks to the service and target picked when it starts
+			g.mu.RLock()
+			svc := g.services[route.ServiceID]
+			g.mu.RUnlock()
+			if svc == nil {
+				sessionsMu.Unlock()
+				log.Printf("API Gateway UDP: route %s: service %s not found", route.ID, route.ServiceID)
+				continue
+			}
+			_, target := g.pickTarget(svc, nil, clientAddr.IP.String())
+			if target == nil {
+				sessionsMu.Unlock()
+				log.Printf("API Gateway UDP: route %s: no healthy target for service %s", route.ID, svc.ID)
+				continue
+			}
+			backendAddr, err := net.ResolveUDPAddr("udp", target.address)
+			if err != nil {
+				sessionsMu.Unlock()
+				log.Printf("API Gateway UDP: route %s: invalid backend %s: %v", route.ID, target.address, err)
+				continue
+			}
 			backendConn, err := net.DialUDP("udp", nil, backendAddr)
 			if err != nil {
 				sessionsMu.Unlock()
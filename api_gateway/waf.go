@@ -0,0 +1,401 @@
+package api_gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	wafModeOff    = "off"
+	wafModeDetect = "detect"
+	wafModeBlock  = "block"
+
+	defaultWAFMaxBodyBytes = 64 << 10
+	wafTargetPath          = "path"
+	wafTargetQuery         = "query"
+	wafTargetHeaders       = "headers"
+	wafTargetBody          = "body"
+	wafTargetHeaderPrefix  = "header:"
+)
+
+// coreWAFRules is the shipped rule set, checked before any custom rules. The patterns aim at
+// the probes and payloads automated scanners send rather than at every conceivable attack,
+// so that enabling the WAF in block mode does not break ordinary traffic.
+var coreWAFRules = []WAFRule{
+	{
+		ID:          "core-scanner-probe",
+		Description: "Requests for secrets, VCS metadata and admin panels probed by scanners",
+		Targets:     []string{wafTargetPath},
+		Pattern:     `(?i)(^|/)(\.env($|[./])|\.git($|/)|\.svn/|\.hg/|\.htaccess|\.htpasswd|\.ds_store|\.aws/|wp-admin|wp-login\.php|xmlrpc\.php|phpmyadmin|server-status|cgi-bin/)`,
+	},
+	{
+		ID:          "core-path-traversal",
+		Description: "Directory traversal sequences and well-known system files",
+		Targets:     []string{wafTargetPath, wafTargetQuery},
+		Pattern:     `(?i)(\.\.[/\\]|%2e%2e|\.\.%2f|\.\.%5c|/etc/(passwd|shadow|hosts)\b|c:\\windows|boot\.ini)`,
+	},
+	{
+		ID:          "core-sqli",
+		Description: "SQL injection payloads",
+		Targets:     []string{wafTargetQuery, wafTargetBody},
+		Pattern:     `(?i)(\bunion(\s|/\*.*?\*/)+(all\s+)?select\b|'\s*(or|and)\s+'?\w*'?\s*(=|like)|\b(or|and)\s+\d+\s*=\s*\d+|;\s*(drop|truncate|alter)\s+table\b|\b(sleep|benchmark|pg_sleep|load_file)\s*\(|\bwaitfor\s+delay\s+'|\binformation_schema\b|\bxp_cmdshell\b|'\s*(--|#)\s*$)`,
+	},
+	{
+		ID:          "core-xss",
+		Description: "Cross-site scripting payloads",
+		Targets:     []string{wafTargetPath, wafTargetQuery, wafTargetBody},
+		Pattern:     `(?i)(<\s*/?\s*script\b|javascript\s*:|\bon(error|load|mouseover|focus|click|submit)\s*=|<\s*(iframe|object|embed)\b|document\.(cookie|domain)\b)`,
+	},
+	{
+		ID:          "core-scanner-user-agent",
+		Description: "User agents of well-known vulnerability scanners",
+		Targets:     []string{wafTargetHeaderPrefix + "User-Agent"},
+		Pattern:     `(?i)(sqlmap|nikto|nmap|masscan|zgrab|nuclei|wpscan|acunetix|dirbuster|gobuster|feroxbuster|ffuf|wfuzz|hydra|netsparker|jorgee|havij|whatweb)`,
+	},
+	{
+		ID:          "core-shellshock",
+		Description: "Bash function definitions smuggled in headers (CVE-2014-6271)",
+		Targets:     []string{wafTargetHeaders},
+		Pattern:     `\(\s*\)\s*\{[^}]*;\s*\}\s*;`,
+	},
+}
+
+// wafRule is a compiled WAFRule
+type wafRule struct {
+	id      string
+	targets []string
+	pattern *regexp.Regexp
+}
+
+// wafEngine is the compiled gateway WAF configuration
+type wafEngine struct {
+	mode         string
+	rules        []*wafRule
+	maxBodyBytes int64
+	inspectsBody bool
+}
+
+// wafHit describes the first rule that matched a request
+type wafHit struct {
+	ruleID  string
+	target  string
+	blocked bool
+}
+
+// newWAFEngine compiles the gateway WAF; nil means the WAF is disabled
+func newWAFEngine(cfg *WAFConfig) (*wafEngine, error) {
+	if cfg == nil || !cfg.Enabled {
+		return nil, nil
+	}
+	mode := cfg.Mode
+	if mode == "" {
+		mode = wafModeBlock
+	}
+	if mode != wafModeDetect && mode != wafModeBlock {
+		return nil, fmt.Errorf("invalid WAF mode %q", cfg.Mode)
+	}
+	e := &wafEngine{mode: mode, maxBodyBytes: cfg.MaxBodyBytes}
+	if e.maxBodyBytes <= 0 {
+		e.maxBodyBytes = defaultWAFMaxBodyBytes
+	}
+
+	disabled := make(map[string]bool, len(cfg.DisabledRules))
+	for _, id := range cfg.DisabledRules {
+		disabled[id] = true
+	}
+	var rules []WAFRule
+	if !cfg.DisableCoreRules {
+		rules = append(rules, coreWAFRules...)
+	}
+	rules = append(rules, cfg.Rules...)
+
+	seen := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if rule.ID == "" {
+			return nil, fmt.Errorf("WAF rule with pattern %q has no ID", rule.Pattern)
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("WAF rule with ID %s already exists", rule.ID)
+		}
+		seen[rule.ID] = true
+		if len(rule.Targets) == 0 {
+			return nil, fmt.Errorf("WAF rule %s has no targets", rule.ID)
+		}
+		targets := make([]string, len(rule.Targets))
+		for i, target := range rule.Targets {
+			t, err := normalizeWAFTarget(target)
+			if err != nil {
+				return nil, fmt.Errorf("WAF rule %s: %w", rule.ID, err)
+			}
+			targets[i] = t
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("WAF rule %s: invalid pattern: %w", rule.ID, err)
+		}
+		if disabled[rule.ID] {
+			continue
+		}
+		for _, t := range targets {
+			if t == wafTargetBody {
+				e.inspectsBody = true
+			}
+		}
+		e.rules = append(e.rules, &wafRule{id: rule.ID, targets: targets, pattern: re})
+	}
+	return e, nil
+}
+
+// normalizeWAFTarget validates a rule or exclusion target and canonicalizes header names
+func normalizeWAFTarget(target string) (string, error) {
+	switch t := strings.ToLower(strings.TrimSpace(target)); t {
+	case wafTargetPath, wafTargetQuery, wafTargetHeaders, wafTargetBody:
+		return t, nil
+	}
+	if len(target) > len(wafTargetHeaderPrefix) && strings.EqualFold(target[:len(wafTargetHeaderPrefix)], wafTargetHeaderPrefix) {
+		return wafTargetHeaderPrefix + http.CanonicalHeaderKey(strings.TrimSpace(target[len(wafTargetHeaderPrefix):])), nil
+	}
+	return "", fmt.Errorf("invalid WAF target %q (use path, query, headers, header:<name> or body)", target)
+}
+
+// validateWAFConfig checks the gateway WAF configuration before it is saved
+func validateWAFConfig(cfg *WAFConfig) error {
+	_, err := newWAFEngine(cfg)
+	return err
+}
+
+// validateRouteWAF checks a route's WAF override before it is saved
+func validateRouteWAF(route *Route) error {
+	if route.WAF == nil {
+		return nil
+	}
+	switch route.WAF.Mode {
+	case "", wafModeOff, wafModeDetect, wafModeBlock:
+	default:
+		return fmt.Errorf("invalid WAF mode %q", route.WAF.Mode)
+	}
+	for _, ex := range route.WAF.Exclusions {
+		if ex.RuleID == "" {
+			return fmt.Errorf("WAF exclusion requires a rule_id")
+		}
+		for _, target := range ex.Targets {
+			if _, err := normalizeWAFTarget(target); err != nil {
+				return fmt.Errorf("WAF exclusion for %s: %w", ex.RuleID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// rebuildWAF compiles the gateway WAF from the current config (must be called with g.mu held)
+func (g *Gateway) rebuildWAF() {
+	e, err := newWAFEngine(g.config.WAF)
+	if err != nil {
+		// Rejected on save; a broken config loaded from disk leaves the WAF off
+		log.Printf("API Gateway: WAF disabled: %v", err)
+		e = nil
+	}
+	g.wafMu.Lock()
+	g.waf = e
+	g.wafMu.Unlock()
+}
+
+// wafEngineFor returns the compiled gateway WAF, nil when it is disabled
+func (g *Gateway) wafEngineFor() *wafEngine {
+	g.wafMu.RLock()
+	defer g.wafMu.RUnlock()
+	return g.waf
+}
+
+// inspectRequest runs the WAF over a request. route may be nil for requests that matched no
+// route; those are inspected with the gateway mode so scanners probing for unrouted paths are
+// caught too. It returns the first matching rule, or nil.
+func (g *Gateway) inspectRequest(r *http.Request, route *Route) *wafHit {
+	e := g.wafEngineFor()
+	if e == nil {
+		return nil
+	}
+	mode := e.mode
+	var exclusions []WAFExclusion
+	if route != nil && route.WAF != nil {
+		if route.WAF.Mode != "" {
+			mode = route.WAF.Mode
+		}
+		exclusions = route.WAF.Exclusions
+	}
+	if mode == wafModeOff {
+		return nil
+	}
+
+	in := wafInput{r: r}
+	if e.inspectsBody {
+		in.body = wafInspectableBody(r, e.maxBodyBytes)
+	}
+	for _, rule := range e.rules {
+		if target := in.match(rule, exclusions); target != "" {
+			return &wafHit{ruleID: rule.id, target: target, blocked: mode == wafModeBlock}
+		}
+	}
+	return nil
+}
+
+// wafInput holds the decoded parts of a request the rules are matched against
+type wafInput struct {
+	r    *http.Request
+	body string
+}
+
+// match returns the target a rule matched, skipping targets excluded on the route
+func (in wafInput) match(rule *wafRule, exclusions []WAFExclusion) string {
+	for _, target := range rule.targets {
+		switch target {
+		case wafTargetPath:
+			if in.check(rule, target, exclusions, in.r.URL.Path, in.r.URL.EscapedPath()) {
+				return target
+			}
+		case wafTargetQuery:
+			query := in.r.URL.RawQuery
+			if query == "" {
+				continue
+			}
+			decoded, err := url.QueryUnescape(query)
+			if err != nil {
+				decoded = query
+			}
+			if in.check(rule, target, exclusions, decoded, query) {
+				return target
+			}
+		case wafTargetBody:
+			if in.body != "" && in.check(rule, target, exclusions, in.body) {
+				return target
+			}
+		case wafTargetHeaders:
+			for name, values := range in.r.Header {
+				if in.check(rule, wafTargetHeaderPrefix+name, exclusions, values...) {
+					return wafTargetHeaderPrefix + name
+				}
+			}
+		default:
+			name := strings.TrimPrefix(target, wafTargetHeaderPrefix)
+			if in.check(rule, target, exclusions, in.r.Header.Values(name)...) {
+				return target
+			}
+		}
+	}
+	return ""
+}
+
+func (in wafInput) check(rule *wafRule, target string, exclusions []WAFExclusion, values ...string) bool {
+	if wafExcluded(exclusions, rule.id, target, in.r.URL.Path) {
+		return false
+	}
+	for _, v := range values {
+		if v != "" && rule.pattern.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// wafExcluded reports whether a route exclusion switches a rule off for a target and path
+func wafExcluded(exclusions []WAFExclusion, ruleID, target, path string) bool {
+	for _, ex := range exclusions {
+		if ex.RuleID != ruleID {
+			continue
+		}
+		if len(ex.Paths) > 0 && !hasAnyPrefix(path, ex.Paths) {
+			continue
+		}
+		if len(ex.Targets) == 0 {
+			return true
+		}
+		for _, t := range ex.Targets {
+			nt, err := normalizeWAFTarget(t)
+			if err != nil {
+				continue
+			}
+			if nt == target || (nt == wafTargetHeaders && strings.HasPrefix(target, wafTargetHeaderPrefix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// wafInspectableBody returns the first limit bytes of a textual request body, decoded for
+// form posts, and puts them back in front of the rest of the stream. Binary and multipart
+// bodies are not inspected.
+func wafInspectableBody(r *http.Request, limit int64) string {
+	if r.Body == nil || r.Body == http.NoBody {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	textual := mediaType == "" || strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" || mediaType == "application/xml" ||
+		mediaType == "application/x-www-form-urlencoded" || mediaType == "application/graphql" ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+	if !textual {
+		return ""
+	}
+
+	body := r.Body
+	data, err := io.ReadAll(io.LimitReader(body, limit))
+	var tail io.Reader = body
+	if err != nil {
+		tail = errorBody{err}
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), tail), body}
+
+	if mediaType == "application/x-www-form-urlencoded" {
+		if decoded, err := url.QueryUnescape(string(data)); err == nil {
+			return decoded
+		}
+	}
+	return string(data)
+}
+
+// recordWAFHit counts a WAF match in the gateway statistics
+func (g *Gateway) recordWAFHit(hit *wafHit) {
+	g.stats.mu.Lock()
+	if hit.blocked {
+		g.stats.wafBlocked++
+	} else {
+		g.stats.wafDetected++
+	}
+	if g.stats.wafRuleHits == nil {
+		g.stats.wafRuleHits = make(map[string]int64)
+	}
+	g.stats.wafRuleHits[hit.ruleID]++
+	g.stats.mu.Unlock()
+}
+
+type wafHitKey struct{}
+
+func withWAFHit(r *http.Request, hit *wafHit) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), wafHitKey{}, hit))
+}
+
+func wafHitFromRequest(r *http.Request) *wafHit {
+	hit, _ := r.Context().Value(wafHitKey{}).(*wafHit)
+	return hit
+}
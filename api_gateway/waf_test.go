@@ -0,0 +1,209 @@
+package api_gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWAFTestGateway(t *testing.T, cfg *WAFConfig) (*Gateway, *int32) {
+	t.Helper()
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	t.Cleanup(backend.Close)
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+	g := newProxyTestGateway(&Service{ID: "backend", Host: hostParts[0], Port: mustParseInt(hostParts[1]), Enabled: true})
+	g.config.WAF = cfg
+	g.rebuildWAF()
+	return g, &hits
+}
+
+func TestWAFCoreRules(t *testing.T) {
+	g, _ := newWAFTestGateway(t, &WAFConfig{Enabled: true})
+	cases := []struct {
+		name   string
+		req    func() *http.Request
+		ruleID string
+	}{
+		{"env probe", func() *http.Request { return httptest.NewRequest("GET", "/.env", nil) }, "core-scanner-probe"},
+		{"wp-admin", func() *http.Request { return httptest.NewRequest("GET", "/blog/wp-admin/setup.php", nil) }, "core-scanner-probe"},
+		{"traversal", func() *http.Request { return httptest.NewRequest("GET", "/files?name=..%2F..%2Fetc%2Fpasswd", nil) }, "core-path-traversal"},
+		{"union select", func() *http.Request {
+			return httptest.NewRequest("GET", "/items?id=1+UNION+SELECT+password+FROM+users", nil)
+		}, "core-sqli"},
+		{"tautology", func() *http.Request { return httptest.NewRequest("GET", "/login?user=admin'+or+'1'='1", nil) }, "core-sqli"},
+		{"xss", func() *http.Request {
+			return httptest.NewRequest("GET", "/search?q=%3Cscript%3Ealert(1)%3C/script%3E", nil)
+		}, "core-xss"},
+		{"form body", func() *http.Request {
+			r := httptest.NewRequest("POST", "/comments", strings.NewReader("text=%3Cimg+src%3Dx+onerror%3Dalert(1)%3E"))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			return r
+		}, "core-xss"},
+		{"scanner ua", func() *http.Request {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("User-Agent", "sqlmap/1.7.2#stable (https://sqlmap.org)")
+			return r
+		}, "core-scanner-user-agent"},
+		{"shellshock", func() *http.Request {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Referer", "() { :; }; /bin/bash -c 'id'")
+			return r
+		}, "core-shellshock"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hit := g.inspectRequest(tc.req(), g.routes[0])
+			require.NotNil(t, hit)
+			assert.Equal(t, tc.ruleID, hit.ruleID)
+			assert.True(t, hit.blocked)
+		})
+	}
+
+	for _, target := range []string{"/", "/api/users?page=2&sort=name", "/docs/getting-started", "/search?q=select+a+plan"} {
+		assert.Nil(t, g.inspectRequest(httptest.NewRequest("GET", target, nil), g.routes[0]), target)
+	}
+	r := httptest.NewRequest("POST", "/api/orders", strings.NewReader(`{"note":"leave at the door","qty":2}`))
+	r.Header.Set("Content-Type", "application/json")
+	assert.Nil(t, g.inspectRequest(r, g.routes[0]))
+}
+
+func TestWAFBlocksBeforeProxying(t *testing.T) {
+	g, hits := newWAFTestGateway(t, &WAFConfig{Enabled: true})
+
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("GET", "/items?id=1;DROP+TABLE+users", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, int32(0), atomic.LoadInt32(hits))
+
+	// the inspected body is still delivered upstream in full
+	var received string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received = string(data)
+	}))
+	defer backend.Close()
+	hostParts := splitHostPort(backend.Listener.Addr().String())
+	g.services["backend"].Host, g.services["backend"].Port = hostParts[0], mustParseInt(hostParts[1])
+	g.config.WAF.MaxBodyBytes = 16
+	g.rebuildWAF()
+	body := `{"comment":"` + strings.Repeat("a", 100) + `"}`
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	g.handleRequest(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, body, received)
+
+	stats := g.GetStats().WAFStats
+	assert.Equal(t, int64(1), stats.Blocked)
+	require.Len(t, stats.Rules, 1)
+	assert.Equal(t, "core-sqli", stats.Rules[0].RuleID)
+}
+
+func TestWAFRouteModesAndExclusions(t *testing.T) {
+	g, hits := newWAFTestGateway(t, &WAFConfig{
+		Enabled:       true,
+		DisabledRules: []string{"core-scanner-user-agent"},
+		Rules: []WAFRule{{
+			ID:      "no-debug",
+			Targets: []string{"header:x-debug"},
+			Pattern: `^1$`,
+		}},
+	})
+	route := g.routes[0]
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Debug", "1")
+	req.Header.Set("User-Agent", "nikto")
+	hit := g.inspectRequest(req, route)
+	require.NotNil(t, hit)
+	assert.Equal(t, "no-debug", hit.ruleID)
+	assert.Equal(t, "header:X-Debug", hit.target)
+
+	// detect mode lets the request through and records the rule
+	route.WAF = &RouteWAFConfig{Mode: wafModeDetect}
+	rec := httptest.NewRecorder()
+	g.handleRequest(rec, httptest.NewRequest("GET", "/.git/config", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(hits))
+	assert.Equal(t, int64(1), g.GetStats().WAFStats.Detected)
+
+	route.WAF = &RouteWAFConfig{Mode: wafModeOff}
+	assert.Nil(t, g.inspectRequest(httptest.NewRequest("GET", "/.env", nil), route))
+
+	// exclusions by rule, path prefix and target
+	route.WAF = &RouteWAFConfig{Exclusions: []WAFExclusion{
+		{RuleID: "core-xss", Paths: []string{"/cms/"}, Targets: []string{"body"}},
+	}}
+	post := func(path string) *http.Request {
+		r := httptest.NewRequest("POST", path, strings.NewReader(`<p onclick="toggle()">faq</p>`))
+		r.Header.Set("Content-Type", "text/html")
+		return r
+	}
+	assert.Nil(t, g.inspectRequest(post("/cms/pages/1"), route))
+	assert.NotNil(t, g.inspectRequest(post("/api/pages/1"), route))
+	assert.NotNil(t, g.inspectRequest(httptest.NewRequest("GET", "/cms/pages?x=<script>", nil), route))
+
+	assert.Error(t, validateRouteWAF(&Route{WAF: &RouteWAFConfig{Mode: "monitor"}}))
+	assert.Error(t, validateRouteWAF(&Route{WAF: &RouteWAFConfig{Exclusions: []WAFExclusion{{RuleID: "x", Targets: []string{"cookie"}}}}}))
+	assert.Error(t, validateWAFConfig(&WAFConfig{Enabled: true, Rules: []WAFRule{{ID: "bad", Targets: []string{"path"}, Pattern: "("}}}))
+	assert.Error(t, validateWAFConfig(&WAFConfig{Enabled: true, Rules: []WAFRule{{ID: "core-sqli", Targets: []string{"path"}, Pattern: "x"}}}))
+}
+
+func TestWAFHitsAutoBlockClient(t *testing.T) {
+	g, _ := newWAFTestGateway(t, &WAFConfig{Enabled: true})
+	g.config.ClientSecurity = defaultClientSecurityConfig()
+	g.config.ClientSecurity.WAFHitThreshold = 2
+	g.clientStats = make(map[string]*clientStatsTracker)
+
+	attack := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/search?q=<script>alert(1)</script>", nil)
+		req.RemoteAddr = "203.0.113.7:4000"
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, req)
+		return rec
+	}
+	assert.Equal(t, http.StatusForbidden, attack().Code)
+	blocked, _ := g.isClientBlocked("203.0.113.7")
+	assert.False(t, blocked)
+
+	attack()
+	blocked, reason := g.isClientBlocked("203.0.113.7")
+	assert.True(t, blocked)
+	assert.Contains(t, reason, "WAF")
+
+	clients := g.GetStats().TopClients
+	require.Len(t, clients, 1)
+	assert.Equal(t, int64(2), clients[0].WAFHits)
+	assert.Zero(t, clients[0].TotalMisses)
+}
+
+func TestWAFDetectHitsAutoBlockClient(t *testing.T) {
+	g, _ := newWAFTestGateway(t, &WAFConfig{Enabled: true, Mode: "detect"})
+	g.config.ClientSecurity = defaultClientSecurityConfig()
+	g.config.ClientSecurity.WAFHitThreshold = 2
+	g.clientStats = make(map[string]*clientStatsTracker)
+
+	attack := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/search?q=<script>alert(1)</script>", nil)
+		req.RemoteAddr = "203.0.113.7:4000"
+		rec := httptest.NewRecorder()
+		g.handleRequest(rec, req)
+		return rec
+	}
+	// detected requests go through but count towards the threshold
+	assert.Equal(t, http.StatusOK, attack().Code)
+	assert.Equal(t, http.StatusOK, attack().Code)
+	blocked, reason := g.isClientBlocked("203.0.113.7")
+	assert.True(t, blocked)
+	assert.Contains(t, reason, "WAF")
+}
@@ -1,7 +1,13 @@
 package controllers
 
 import (
+	"fmt"
 	"redock/api_gateway"
+	"redock/app/models"
+	"redock/pkg/utils"
+	"redock/platform/database"
+	"redock/platform/memory"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -58,7 +64,7 @@ func APIGatewayUpdateConfig(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := gw.UpdateConfig(config); err != nil {
+	if err := apiGatewayEdit(c, gw, func() error { return gw.UpdateConfig(config) }); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": true,
 			"msg":   err.Error(),
@@ -267,7 +273,7 @@ func APIGatewayAddService(c *fiber.Ctx) error {
 		service.ID = uuid.New().String()
 	}
 
-	if err := gw.AddService(*service); err != nil {
+	if err := apiGatewayEdit(c, gw, func() error { return gw.AddService(*service) }); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": true,
 			"msg":   err.Error(),
@@ -314,7 +320,7 @@ func APIGatewayUpdateService(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := gw.UpdateService(*service); err != nil {
+	if err := apiGatewayEdit(c, gw, func() error { return gw.UpdateService(*service) }); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": true,
 			"msg":   err.Error(),
@@ -365,7 +371,7 @@ func APIGatewayDeleteService(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := gw.DeleteService(req.ID); err != nil {
+	if err := apiGatewayEdit(c, gw, func() error { return gw.DeleteService(req.ID) }); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": true,
 			"msg":   err.Error(),
@@ -409,7 +415,7 @@ func APIGatewayBlockClient(c *fiber.Ctx) error {
 		})
 	}
 	duration := time.Duration(req.DurationSeconds) * time.Second
-	if err := gw.ManualBlockClient(req.IP, duration, req.Reason); err != nil {
+	if err := apiGatewayEdit(c, gw, func() error { return gw.ManualBlockClient(req.IP, duration, req.Reason) }); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": true,
 			"msg":   err.Error(),
@@ -449,7 +455,7 @@ func APIGatewayUnblockClient(c *fiber.Ctx) error {
 			"msg":   "ip is required",
 		})
 	}
-	if err := gw.ManualUnblockClient(req.IP); err != nil {
+	if err := apiGatewayEdit(c, gw, func() error { return gw.ManualUnblockClient(req.IP) }); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": true,
 			"msg":   err.Error(),
@@ -517,7 +523,7 @@ func APIGatewayAddRoute(c *fiber.Ctx) error {
 		route.ID = uuid.New().String()
 	}
 
-	if err := gw.AddRoute(*route); err != nil {
+	if err := apiGatewayEdit(c, gw, func() error { return gw.AddRoute(*route) }); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": true,
 			"msg":   err.Error(),
@@ -564,7 +570,7 @@ func APIGatewayUpdateRoute(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := gw.UpdateRoute(*route); err != nil {
+	if err := apiGatewayEdit(c, gw, func() error { return gw.UpdateRoute(*route) }); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": true,
 			"msg":   err.Error(),
@@ -615,7 +621,7 @@ func APIGatewayDeleteRoute(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := gw.DeleteRoute(req.ID); err != nil {
+	if err := apiGatewayEdit(c, gw, func() error { return gw.DeleteRoute(req.ID) }); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": true,
 			"msg":   err.Error(),
@@ -647,7 +653,7 @@ func APIGatewayListUDPRoutes(c *fiber.Ctx) error {
 	})
 }
 
-// APIGatewayAddUDPRoute adds a new UDP route (gateway restarts if running)
+// APIGatewayAddUDPRoute adds a new UDP route (a running gateway starts its listener)
 func APIGatewayAddUDPRoute(c *fiber.Ctx) error {
 	gw := api_gateway.GetGateway()
 	if gw == nil {
@@ -666,7 +672,7 @@ func APIGatewayAddUDPRoute(c *fiber.Ctx) error {
 	if route.ID == "" {
 		route.ID = uuid.New().String()
 	}
-	if err := gw.AddUDPRoute(*route); err != nil {
+	if err := apiGatewayEdit(c, gw, func() error { return gw.AddUDPRoute(*route) }); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": true,
 			"msg":   err.Error(),
@@ -679,7 +685,7 @@ func APIGatewayAddUDPRoute(c *fiber.Ctx) error {
 	})
 }
 
-// APIGatewayRemoveUDPRoute removes a UDP route by ID (gateway restarts if running)
+// APIGatewayRemoveUDPRoute removes a UDP route by ID (its listener is closed)
 func APIGatewayRemoveUDPRoute(c *fiber.Ctx) error {
 	gw := api_gateway.GetGateway()
 	if gw == nil {
@@ -695,7 +701,7 @@ func APIGatewayRemoveUDPRoute(c *fiber.Ctx) error {
 			"msg":   "id is required",
 		})
 	}
-	if err := gw.RemoveUDPRoute(id); err != nil {
+	if err := apiGatewayEdit(c, gw, func() error { return gw.RemoveUDPRoute(id) }); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": true,
 			"msg":   err.Error(),
@@ -874,7 +880,7 @@ func APIGatewayValidateRoute(c *fiber.Ctx) error {
 		req.Host = "localhost"
 	}
 
-	route, service, err := gw.Validate(req.Method, req.Path, req.Host, req.Headers)
+	route, service, upstream, err := gw.Validate(req.Method, req.Path, req.Host, req.Headers)
 	if err != nil {
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
 			"error": true,
@@ -889,13 +895,57 @@ func APIGatewayValidateRoute(c *fiber.Ctx) error {
 		"error": false,
 		"msg":   nil,
 		"data": fiber.Map{
-			"matched": true,
-			"route":   route,
-			"service": service,
+			"matched":  true,
+			"route":    route,
+			"service":  service,
+			"upstream": upstream,
 		},
 	})
 }
 
+// APIGatewayPurgeCache removes cached responses from the gateway's response cache
+// @Description Purge cached responses by route, path prefix or exact cache key; an empty body purges everything
+// @Summary purge response cache
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Param request body object true "Purge request with optional route_id, prefix and key"
+// @Success 200 {object} map[string]interface{}
+// @Router /v1/api_gateway/cache/purge [post]
+func APIGatewayPurgeCache(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+
+	type PurgeCacheRequest struct {
+		RouteID string `json:"route_id"`
+		Prefix  string `json:"prefix"`
+		Key     string `json:"key"`
+	}
+
+	req := &PurgeCacheRequest{}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": true,
+				"msg":   err.Error(),
+			})
+		}
+	}
+
+	purged := gw.PurgeCache(req.RouteID, req.Prefix, req.Key)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"msg":   nil,
+		"data":  fiber.Map{"purged": purged},
+	})
+}
+
 // APIGatewayGetCertificateInfo returns certificate information
 // @Description Get SSL/TLS certificate information
 // @Summary get certificate info
@@ -920,6 +970,125 @@ func APIGatewayGetCertificateInfo(c *fiber.Ctx) error {
 	})
 }
 
+// APIGatewayListCertificates returns all certificates in the SNI certificate store
+// @Description List all certificates served by the HTTPS listener with their expiry
+// @Summary list certificates
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Success 200 {array} api_gateway.CertificateInfo
+// @Router /v1/api_gateway/certificates [get]
+func APIGatewayListCertificates(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"msg":   nil,
+		"data":  gw.ListCertificates(),
+	})
+}
+
+type certificateUploadRequest struct {
+	Name    string `json:"name"`
+	CertPEM string `json:"cert_pem"`
+	KeyPEM  string `json:"key_pem"`
+}
+
+// APIGatewayUploadCertificate uploads a certificate and key for SNI selection
+// @Description Upload a PEM certificate chain and private key; it is served for the hostnames it covers
+// @Summary upload certificate
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Param request body object true "Certificate upload with name, cert_pem and key_pem"
+// @Success 200 {object} map[string]interface{}
+// @Router /v1/api_gateway/certificates [post]
+func APIGatewayUploadCertificate(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+
+	req := &certificateUploadRequest{}
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+	if req.CertPEM == "" || req.KeyPEM == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   "cert_pem and key_pem are required",
+		})
+	}
+
+	var cert *api_gateway.TLSCertificate
+	err := apiGatewayEdit(c, gw, func() (err error) {
+		cert, err = gw.AddCertificate(req.Name, []byte(req.CertPEM), []byte(req.KeyPEM))
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"msg":   "Certificate uploaded successfully",
+		"data":  cert,
+	})
+}
+
+// APIGatewayDeleteCertificate removes an uploaded certificate
+// @Description Delete an uploaded certificate from the SNI certificate store
+// @Summary delete certificate
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Param id path string true "Certificate ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /v1/api_gateway/certificates/{id} [delete]
+func APIGatewayDeleteCertificate(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   "id is required",
+		})
+	}
+
+	if err := apiGatewayEdit(c, gw, func() error { return gw.DeleteCertificate(id) }); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"msg":   "Certificate deleted successfully",
+	})
+}
+
 // APIGatewayConfigureLetsEncrypt configures Let's Encrypt settings
 // @Description Configure Let's Encrypt for automatic SSL certificate management
 // @Summary configure Let's Encrypt
@@ -946,7 +1115,7 @@ func APIGatewayConfigureLetsEncrypt(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := gw.ConfigureLetsEncrypt(config); err != nil {
+	if err := apiGatewayEdit(c, gw, func() error { return gw.ConfigureLetsEncrypt(config) }); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": true,
 			"msg":   err.Error(),
@@ -1138,7 +1307,7 @@ func APIGatewayConfigureObservability(c *fiber.Ctx) error {
 	// Update the gateway config
 	gwConfig := gw.GetConfig()
 	gwConfig.Observability = config
-	if err := gw.UpdateConfig(gwConfig); err != nil {
+	if err := apiGatewayEdit(c, gw, func() error { return gw.UpdateConfig(gwConfig) }); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": true,
 			"msg":   err.Error(),
@@ -1160,3 +1329,501 @@ func APIGatewayConfigureObservability(c *fiber.Ctx) error {
 		"data":  config,
 	})
 }
+
+type consumerRequest struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Groups   []string `json:"groups"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Enabled  *bool    `json:"enabled"`
+}
+
+// toConsumer converts the request into a consumer, hashing the password if one is given
+func (req *consumerRequest) toConsumer() (api_gateway.Consumer, error) {
+	consumer := api_gateway.Consumer{
+		ID:      req.ID,
+		Name:    req.Name,
+		Groups:  req.Groups,
+		Enabled: req.Enabled == nil || *req.Enabled,
+	}
+	if req.Username != "" {
+		consumer.BasicAuth = &api_gateway.ConsumerBasicAuth{Username: req.Username}
+		if req.Password != "" {
+			hash, err := api_gateway.HashConsumerPassword(req.Password)
+			if err != nil {
+				return consumer, err
+			}
+			consumer.BasicAuth.PasswordHash = hash
+		}
+	}
+	return consumer, nil
+}
+
+// APIGatewayListConsumers returns all consumers
+// @Description List all API consumers (password and API key hashes are left out)
+// @Summary list consumers
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Success 200 {array} api_gateway.Consumer
+// @Router /v1/api_gateway/consumers [get]
+func APIGatewayListConsumers(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+	consumers := gw.ListConsumers()
+	if consumers == nil {
+		consumers = []api_gateway.Consumer{}
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"msg":   nil,
+		"data":  consumers,
+	})
+}
+
+// APIGatewayAddConsumer adds a new consumer
+// @Description Add a new API consumer; the basic auth password is stored as a bcrypt hash
+// @Summary add consumer
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Param consumer body object true "Consumer with name, groups, username and password"
+// @Success 200 {object} map[string]interface{}
+// @Router /v1/api_gateway/consumers [post]
+func APIGatewayAddConsumer(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+
+	req := &consumerRequest{}
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+	if req.Username != "" && req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   "password is required when username is set",
+		})
+	}
+
+	// Generate ID if not provided
+	if req.ID == "" {
+		req.ID = uuid.New().String()
+	}
+
+	consumer, err := req.toConsumer()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+	if err := apiGatewayEdit(c, gw, func() error { return gw.AddConsumer(consumer) }); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"msg":   "Consumer added successfully",
+		"data":  consumer,
+	})
+}
+
+// APIGatewayUpdateConsumer updates an existing consumer
+// @Description Update an API consumer; an empty password keeps the current one and API keys are left untouched
+// @Summary update consumer
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Param consumer body object true "Consumer with id, name, groups, username and password"
+// @Success 200 {object} map[string]interface{}
+// @Router /v1/api_gateway/consumers [put]
+func APIGatewayUpdateConsumer(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+
+	req := &consumerRequest{}
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+	if req.ID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   "Consumer ID is required",
+		})
+	}
+
+	consumer, err := req.toConsumer()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+	if err := apiGatewayEdit(c, gw, func() error { return gw.UpdateConsumer(consumer) }); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"msg":   "Consumer updated successfully",
+	})
+}
+
+// APIGatewayDeleteConsumer deletes a consumer
+// @Description Delete an API consumer and all of its API keys
+// @Summary delete consumer
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Param request body object true "Delete request with consumer ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /v1/api_gateway/consumers [delete]
+func APIGatewayDeleteConsumer(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+
+	type DeleteRequest struct {
+		ID string `json:"id"`
+	}
+
+	req := &DeleteRequest{}
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+
+	if req.ID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   "Consumer ID is required",
+		})
+	}
+
+	if err := apiGatewayEdit(c, gw, func() error { return gw.DeleteConsumer(req.ID) }); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"msg":   "Consumer deleted successfully",
+	})
+}
+
+// APIGatewayCreateConsumerAPIKey issues a new API key for a consumer
+// @Description Issue a new API key; the plain key is only returned in this response
+// @Summary create consumer API key
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Param id path string true "Consumer ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /v1/api_gateway/consumers/{id}/api_keys [post]
+func APIGatewayCreateConsumerAPIKey(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   "id is required",
+		})
+	}
+
+	var key string
+	var entry *api_gateway.ConsumerAPIKey
+	err := apiGatewayEdit(c, gw, func() (err error) {
+		key, entry, err = gw.CreateConsumerAPIKey(id)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"msg":   "API key created; store it now, it will not be shown again",
+		"data": fiber.Map{
+			"key":     key,
+			"api_key": entry,
+		},
+	})
+}
+
+// APIGatewayDeleteConsumerAPIKey revokes an API key of a consumer
+// @Description Revoke a consumer API key
+// @Summary delete consumer API key
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Param id path string true "Consumer ID"
+// @Param key_id path string true "API key ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /v1/api_gateway/consumers/{id}/api_keys/{key_id} [delete]
+func APIGatewayDeleteConsumerAPIKey(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+	id := c.Params("id")
+	keyID := c.Params("key_id")
+	if id == "" || keyID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   "id and key_id are required",
+		})
+	}
+
+	if err := apiGatewayEdit(c, gw, func() error { return gw.DeleteConsumerAPIKey(id, keyID) }); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"msg":   "API key deleted successfully",
+	})
+}
+
+// apiGatewayAuthor names the signed-in user for config revisions
+func apiGatewayAuthor(c *fiber.Ctx) string {
+	claims, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		return ""
+	}
+	if db := database.GetMemoryDB(); db != nil {
+		if user, err := memory.FindByID[*models.User](db, "users", uint(claims.UserID)); err == nil && user != nil && user.Email != "" {
+			return user.Email
+		}
+	}
+	return fmt.Sprintf("user %d", claims.UserID)
+}
+
+// apiGatewayEdit runs a configuration change on behalf of the signed-in user
+func apiGatewayEdit(c *fiber.Ctx, gw *api_gateway.Gateway, fn func() error) error {
+	return gw.EditAs(apiGatewayAuthor(c), fn)
+}
+
+// APIGatewayListConfigRevisions lists the saved configuration revisions
+// @Description List configuration revisions, newest first
+// @Summary list API gateway config revisions
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Success 200 {array} api_gateway.ConfigRevision
+// @Router /v1/api_gateway/config/revisions [get]
+func APIGatewayListConfigRevisions(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  gw.ListConfigRevisions(),
+	})
+}
+
+// APIGatewayGetConfigRevision returns a configuration revision
+// @Description Get a configuration revision including its configuration
+// @Summary get API gateway config revision
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Param revision path int true "Revision"
+// @Success 200 {object} api_gateway.ConfigRevision
+// @Router /v1/api_gateway/config/revisions/{revision} [get]
+func APIGatewayGetConfigRevision(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+	number, err := strconv.Atoi(c.Params("revision"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   "invalid revision",
+		})
+	}
+
+	rev, err := gw.GetConfigRevision(number)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  rev,
+	})
+}
+
+// APIGatewayDiffConfigRevisions lists the changes between two configuration revisions
+// @Description Diff two configuration revisions; without "to" the current configuration is compared
+// @Summary diff API gateway config revisions
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Param from query int true "Revision to compare from"
+// @Param to query int false "Revision to compare to (default: current configuration)"
+// @Success 200 {array} api_gateway.ConfigChange
+// @Router /v1/api_gateway/config/diff [get]
+func APIGatewayDiffConfigRevisions(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+	from := c.QueryInt("from")
+	to := c.QueryInt("to")
+	if from <= 0 || to < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   "from revision is required",
+		})
+	}
+
+	changes, err := gw.DiffConfigRevisions(from, to)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  changes,
+	})
+}
+
+// APIGatewayValidateConfig dry-runs a configuration without saving it
+// @Description Check a configuration for invalid settings, missing services, duplicate ports and overlapping routes, and list its changes
+// @Summary dry-run API gateway config
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Param config body api_gateway.GatewayConfig true "Gateway configuration"
+// @Success 200 {object} api_gateway.ConfigValidation
+// @Router /v1/api_gateway/config/validate [post]
+func APIGatewayValidateConfig(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+
+	config := &api_gateway.GatewayConfig{}
+	if err := c.BodyParser(config); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  gw.ValidateConfig(config),
+	})
+}
+
+// APIGatewayRollbackConfig restores an earlier configuration revision
+// @Description Apply an earlier configuration revision; the rollback is saved as a new revision
+// @Summary rollback API gateway config
+// @Tags API Gateway
+// @Accept json
+// @Produce json
+// @Param revision path int true "Revision"
+// @Success 200 {object} map[string]interface{}
+// @Router /v1/api_gateway/config/revisions/{revision}/rollback [post]
+func APIGatewayRollbackConfig(c *fiber.Ctx) error {
+	gw := api_gateway.GetGateway()
+	if gw == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": true,
+			"msg":   "API Gateway not initialized",
+		})
+	}
+	number, err := strconv.Atoi(c.Params("revision"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": true,
+			"msg":   "invalid revision",
+		})
+	}
+
+	if err := gw.RollbackConfig(number, apiGatewayAuthor(c)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"msg":   fmt.Sprintf("Configuration rolled back to revision %d", number),
+		"data":  gw.GetConfig(),
+	})
+}
@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"strconv"
+
 	"redock/app/models"
 	"redock/pkg/repository"
 	"redock/pkg/utils"
@@ -258,6 +260,57 @@ func AuthMe(c *fiber.Ctx) error {
 	})
 }
 
+// AuthVerify answers forward auth subrequests of the API gateway: 200 with the user in
+// X-Auth-User-* headers for a valid access token, 401 otherwise. ?role= requires a user role.
+// @Description Verify the access token for API gateway forward auth (auth_type=forward). Sets X-Auth-User-Id, X-Auth-User-Email and X-Auth-User-Role; any method is accepted.
+// @Summary verify access token for forward auth
+// @Tags Auth
+// @Security ApiKeyAuth
+// @Produce json
+// @Param role query string false "Required user role, e.g. admin"
+// @Success 200 {string} status "ok"
+// @Failure 401 {string} status "invalid or missing access token"
+// @Failure 403 {string} status "role not allowed"
+// @Router /v1/auth/verify [get]
+func AuthVerify(c *fiber.Ctx) error {
+	claims, err := utils.ExtractTokenMetadata(c)
+	if err != nil || claims == nil {
+		c.Set("WWW-Authenticate", `Bearer realm="redock"`)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": true,
+			"msg":   "invalid or missing access token",
+		})
+	}
+	db := database.GetMemoryDB()
+	if db == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": true,
+			"msg":   "database not initialized",
+		})
+	}
+	userPtr, err := memory.FindByID[*models.User](db, "users", uint(claims.UserID))
+	if err != nil || userPtr == nil || userPtr.Email == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": true,
+			"msg":   "user not found",
+		})
+	}
+	if role := c.Query("role"); role != "" && userPtr.UserRole != role {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": true,
+			"msg":   "user role " + role + " required",
+		})
+	}
+
+	c.Set("X-Auth-User-Id", strconv.FormatUint(uint64(userPtr.ID), 10))
+	c.Set("X-Auth-User-Email", userPtr.Email)
+	c.Set("X-Auth-User-Role", userPtr.UserRole)
+	return c.JSON(fiber.Map{
+		"error": false,
+		"msg":   nil,
+	})
+}
+
 // Menus returns menu items for the current user (allowed paths + name + icon). Frontend sadece route tanımlar, menü verisi backend'den.
 // @Summary get menus for current user
 // @Tags Auth
@@ -1174,7 +1174,9 @@ func BlockClient(c *fiber.Ctx) error {
 		clientSettings = *clients[0]
 		clientSettings.Blocked = true
 		clientSettings.BlockReason = req.Reason
+		clientSettings.BlockedBy = ""
 		clientSettings.BlockedAt = &now
+		clientSettings.BlockedUntil = nil
 		if err := memory.Update[*dns_server.DNSClientSettings](db, "dns_client_settings", &clientSettings); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": true,
@@ -1228,7 +1230,9 @@ func UnblockClient(c *fiber.Ctx) error {
 
 	clientSettings.Blocked = false
 	clientSettings.BlockReason = ""
+	clientSettings.BlockedBy = ""
 	clientSettings.BlockedAt = nil
+	clientSettings.BlockedUntil = nil
 
 	if err := memory.Update[*dns_server.DNSClientSettings](db, "dns_client_settings", &clientSettings); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"os"
+	"strings"
+
+	"redock/pkg/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Metrics exposes every registered collector in the Prometheus text format.
+// Scrapers must send METRICS_TOKEN as a bearer token; while it is not set every request is refused.
+// @Description Prometheus metrics of the gateway, DNS, VPN, tunnels, deployments and memory DB
+// @Summary prometheus metrics
+// @Tags Metrics
+// @Produce plain
+// @Success 200 {string} string
+// @Failure 401 {string} status "invalid or unconfigured metrics token"
+// @Router /metrics [get]
+func Metrics(c *fiber.Ctx) error {
+	token := os.Getenv("METRICS_TOKEN")
+	given := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": true,
+			"msg":   "invalid metrics token",
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := metrics.Default().WriteText(&buf); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": true,
+			"msg":   err.Error(),
+		})
+	}
+	c.Set(fiber.HeaderContentType, metrics.ContentType)
+	return c.Status(fiber.StatusOK).Send(buf.Bytes())
+}
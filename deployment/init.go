@@ -162,6 +162,10 @@ func (d *Deployment) Shutdown() {
 }
 
 func (d *Deployment) Deploy(project *DeploymentProjectEntity) {
+	start := time.Now()
+	outcome := outcomeFailed
+	defer func() { observeDeployment(project, outcome, start) }()
+
 	auth := d.getAuthForProject(project)
 	username, token := d.getCredentialsForProject(project)
 
@@ -237,10 +241,12 @@ func (d *Deployment) Deploy(project *DeploymentProjectEntity) {
 		}
 	}
 
+	outcome = outcomeUnchanged
 	if remoteUpdated {
 		d.Checkout(project)
 		d.RunScript(project)
 		project.LastDeployed = time.Now()
+		outcome = outcomeDeployed
 	} else if project.Check != "" {
 		path, err := d.CreateScript(project.Path+"check", project.Check)
 		if err == nil {
@@ -249,6 +255,7 @@ func (d *Deployment) Deploy(project *DeploymentProjectEntity) {
 				d.Checkout(project)
 				d.RunScript(project)
 				project.LastDeployed = time.Now()
+				outcome = outcomeDeployed
 			}
 		}
 	}
@@ -0,0 +1,31 @@
+package deployment
+
+import (
+	"time"
+
+	"redock/pkg/metrics"
+)
+
+// Outcomes of a deployment check reported by redock_deployment_runs_total
+const (
+	outcomeDeployed  = "deployed"
+	outcomeUnchanged = "unchanged"
+	outcomeFailed    = "failed"
+)
+
+var (
+	deploymentRuns = metrics.NewCounterVec("redock_deployment_runs_total",
+		"Deployment checks per project and outcome.", "project", "outcome")
+	deploymentDuration = metrics.NewHistogramVec("redock_deployment_duration_seconds",
+		"Duration of deployment checks including scripts.", []float64{1, 5, 15, 30, 60, 120, 300, 600}, "project")
+)
+
+func init() {
+	metrics.Register(deploymentRuns, deploymentDuration)
+}
+
+// observeDeployment records the outcome of one Deploy call
+func observeDeployment(project *DeploymentProjectEntity, outcome string, start time.Time) {
+	deploymentRuns.With(project.Path, outcome).Inc()
+	deploymentDuration.With(project.Path).ObserveSince(start)
+}
@@ -0,0 +1,81 @@
+package dns_server
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// acmeChallenges holds TXT records published for ACME DNS-01 challenges.
+// They are answered authoritatively and never cached or forwarded.
+var (
+	acmeChallenges   = make(map[string][]string)
+	acmeChallengesMu sync.RWMutex
+)
+
+func normalizeChallengeName(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
+
+// SetChallengeTXT publishes a TXT record for an ACME DNS-01 challenge.
+// Several values per name are allowed (e.g. example.com and *.example.com in one order).
+func (s *DNSServer) SetChallengeTXT(name, value string) {
+	name = normalizeChallengeName(name)
+	acmeChallengesMu.Lock()
+	defer acmeChallengesMu.Unlock()
+	for _, v := range acmeChallenges[name] {
+		if v == value {
+			return
+		}
+	}
+	acmeChallenges[name] = append(acmeChallenges[name], value)
+}
+
+// ClearChallengeTXT removes a TXT record published by SetChallengeTXT
+func (s *DNSServer) ClearChallengeTXT(name, value string) {
+	name = normalizeChallengeName(name)
+	acmeChallengesMu.Lock()
+	defer acmeChallengesMu.Unlock()
+	values := acmeChallenges[name]
+	for i, v := range values {
+		if v == value {
+			values = append(values[:i], values[i+1:]...)
+			break
+		}
+	}
+	if len(values) == 0 {
+		delete(acmeChallenges, name)
+		return
+	}
+	acmeChallenges[name] = values
+}
+
+// getChallengeTXT builds an authoritative TXT answer for a published challenge, or nil
+func (s *DNSServer) getChallengeTXT(domain string, qtype uint16) *dns.Msg {
+	if qtype != dns.TypeTXT {
+		return nil
+	}
+	name := normalizeChallengeName(domain)
+	acmeChallengesMu.RLock()
+	values := acmeChallenges[name]
+	acmeChallengesMu.RUnlock()
+	if len(values) == 0 {
+		return nil
+	}
+
+	msg := new(dns.Msg)
+	msg.Authoritative = true
+	for _, v := range values {
+		msg.Answer = append(msg.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{
+				Name:   dns.Fqdn(domain),
+				Rrtype: dns.TypeTXT,
+				Class:  dns.ClassINET,
+				Ttl:    60,
+			},
+			Txt: []string{v},
+		})
+	}
+	return msg
+}
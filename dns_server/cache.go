@@ -45,16 +45,19 @@ func (c *DNSCache) Get(domain string, qtype uint16) *dns.Msg {
 	entry, exists := c.cache[key]
 
 	if !exists {
+		dnsCacheLookups.With("miss").Inc()
 		return nil
 	}
 
 	// Check if expired
 	if time.Now().After(entry.ExpiresAt) {
 		// Don't delete here, let cleanup goroutine handle it
+		dnsCacheLookups.With("miss").Inc()
 		return nil
 	}
 
 	// Return a copy of the message
+	dnsCacheLookups.With("hit").Inc()
 	return entry.Message.Copy()
 }
 
@@ -16,6 +16,7 @@ import (
 // ClientRules holds cached client-specific rules
 type ClientRules struct {
 	Blocked        bool             // Client IP banned
+	BlockedUntil   time.Time        // End of a temporary ban (zero when permanent)
 	BlockedDomains map[string]bool  // Exact match blocked domains
 	AllowedDomains map[string]bool  // Exact match allowed domains
 	RegexRules     []*regexp.Regexp // Pre-compiled regex rules
@@ -327,6 +328,9 @@ func (f *FilterEngine) getClientRules(clientIP string) *ClientRules {
 	})
 	if len(clientSettings) > 0 {
 		rules.Blocked = clientSettings[0].Blocked
+		if clientSettings[0].BlockedUntil != nil {
+			rules.BlockedUntil = *clientSettings[0].BlockedUntil
+		}
 	}
 
 	// Load client-specific domain rules
@@ -399,7 +403,7 @@ func (f *FilterEngine) ShouldBlock(domain string, clientIP string) (bool, string
 	clientRules := f.getClientRules(clientIP)
 
 	// 1. Check if client is banned (from cache)
-	if clientRules.Blocked {
+	if clientRules.banned(time.Now()) {
 		return true, "client IP banned"
 	}
 
@@ -656,11 +660,83 @@ func (f *FilterEngine) IsClientBanned(clientIP string) bool {
 		return c.ClientIP == clientIP
 	})
 	if len(settings) > 0 && settings[0].Blocked {
-		return true
+		return settings[0].BlockedUntil == nil || settings[0].BlockedUntil.After(time.Now())
 	}
 	return false
 }
 
+// banned reports whether the cached client ban is in effect
+func (r *ClientRules) banned(now time.Time) bool {
+	return r.Blocked && (r.BlockedUntil.IsZero() || r.BlockedUntil.After(now))
+}
+
+// BanClient bans a client IP on behalf of owner until the given time (zero bans until lifted).
+// An existing ban is never shortened: it is only extended, and it keeps its owner and reason.
+func (f *FilterEngine) BanClient(clientIP, owner, reason string, until time.Time) error {
+	clients := memory.Filter[*DNSClientSettings](f.db, "dns_client_settings", func(c *DNSClientSettings) bool {
+		return c.ClientIP == clientIP
+	})
+
+	now := time.Now()
+	var blockedUntil *time.Time
+	if !until.IsZero() {
+		blockedUntil = &until
+	}
+	var err error
+	switch {
+	case len(clients) == 0:
+		err = memory.Create[*DNSClientSettings](f.db, "dns_client_settings", &DNSClientSettings{
+			ClientIP:     clientIP,
+			Blocked:      true,
+			BlockReason:  reason,
+			BlockedBy:    owner,
+			BlockedAt:    &now,
+			BlockedUntil: blockedUntil,
+		})
+	case clients[0].Blocked && (clients[0].BlockedUntil == nil || clients[0].BlockedUntil.After(now)):
+		if clients[0].BlockedUntil == nil || (blockedUntil != nil && !blockedUntil.After(*clients[0].BlockedUntil)) {
+			return nil
+		}
+		settings := *clients[0]
+		settings.BlockedUntil = blockedUntil
+		err = memory.Update[*DNSClientSettings](f.db, "dns_client_settings", &settings)
+	default:
+		settings := *clients[0]
+		settings.Blocked = true
+		settings.BlockReason = reason
+		settings.BlockedBy = owner
+		settings.BlockedAt = &now
+		settings.BlockedUntil = blockedUntil
+		err = memory.Update[*DNSClientSettings](f.db, "dns_client_settings", &settings)
+	}
+	if err != nil {
+		return err
+	}
+	f.InvalidateClientCache(clientIP)
+	return nil
+}
+
+// UnbanClient lifts the ban of a client IP if owner placed it; other bans are kept
+func (f *FilterEngine) UnbanClient(clientIP, owner string) error {
+	clients := memory.Filter[*DNSClientSettings](f.db, "dns_client_settings", func(c *DNSClientSettings) bool {
+		return c.ClientIP == clientIP
+	})
+	if len(clients) == 0 || !clients[0].Blocked || clients[0].BlockedBy != owner {
+		return nil
+	}
+	settings := *clients[0]
+	settings.Blocked = false
+	settings.BlockReason = ""
+	settings.BlockedBy = ""
+	settings.BlockedAt = nil
+	settings.BlockedUntil = nil
+	if err := memory.Update[*DNSClientSettings](f.db, "dns_client_settings", &settings); err != nil {
+		return err
+	}
+	f.InvalidateClientCache(clientIP)
+	return nil
+}
+
 // FilterStats represents filter statistics
 type FilterStats struct {
 	BlockedDomains   int       `json:"blocked_domains"`
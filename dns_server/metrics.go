@@ -0,0 +1,43 @@
+package dns_server
+
+import (
+	"redock/pkg/metrics"
+)
+
+// Query results reported by redock_dns_queries_total
+const (
+	queryResultCached    = "cached"
+	queryResultBlocked   = "blocked"
+	queryResultRewrite   = "rewrite"
+	queryResultForwarded = "forwarded"
+	queryResultFailed    = "failed"
+)
+
+var (
+	dnsQueries = metrics.NewCounterVec("redock_dns_queries_total",
+		"DNS queries answered, by how they were resolved.", "result")
+	dnsCacheLookups = metrics.NewCounterVec("redock_dns_cache_lookups_total",
+		"DNS cache lookups, by hit or miss.", "result")
+	dnsUpstreamDuration = metrics.NewHistogramVec("redock_dns_upstream_duration_seconds",
+		"Latency of queries forwarded to upstream resolvers.", nil, "upstream")
+	dnsUpstreamErrors = metrics.NewCounterVec("redock_dns_upstream_errors_total",
+		"Failed queries to upstream resolvers.", "upstream")
+)
+
+func init() {
+	metrics.Register(dnsQueries, dnsCacheLookups, dnsUpstreamDuration, dnsUpstreamErrors, metrics.CollectorFunc(collectDNSMetrics))
+}
+
+// collectDNSMetrics exposes the DNS cache size at scrape time
+func collectDNSMetrics() []*metrics.Family {
+	s := GetDNSServer()
+	s.mutex.RLock()
+	cache := s.cache
+	s.mutex.RUnlock()
+	if cache == nil {
+		return nil
+	}
+	entries := metrics.NewFamily("redock_dns_cache_entries", "Responses held in the DNS cache.", metrics.TypeGauge)
+	entries.Add(float64(cache.GetSize()))
+	return []*metrics.Family{entries}
+}
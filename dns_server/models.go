@@ -84,7 +84,9 @@ type DNSClientSettings struct {
 	ClientName             string     `json:"client_name,omitempty"`
 	Blocked                bool       `json:"blocked"` // IP Ban
 	BlockReason            string     `json:"block_reason,omitempty"`
+	BlockedBy              string     `json:"blocked_by,omitempty"` // component that placed the ban; empty for manual bans
 	BlockedAt              *time.Time `json:"blocked_at,omitempty"`
+	BlockedUntil           *time.Time `json:"blocked_until,omitempty"` // temporary ban; nil bans until lifted
 	BlockingEnabled        bool       `json:"blocking_enabled"`
 	SafeBrowsingEnabled    bool       `json:"safe_browsing_enabled"`
 	ParentalControlEnabled bool       `json:"parental_control_enabled"`
@@ -395,6 +395,14 @@ func (s *DNSServer) handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
 
 	clientIP := getClientIP(w)
 
+	// ACME DNS-01 challenge records are answered before cache, filters and upstreams
+	if challenge := s.getChallengeTXT(domain, question.Qtype); challenge != nil {
+		challenge.SetReply(r)
+		challenge.Authoritative = true
+		w.WriteMsg(challenge)
+		return
+	}
+
 	// Check cache first
 	var cached bool
 	var blocked bool
@@ -405,6 +413,7 @@ func (s *DNSServer) handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
 			cachedMsg.SetReply(r)
 			w.WriteMsg(cachedMsg)
 			cached = true
+			dnsQueries.With(queryResultCached).Inc()
 
 			// Log query
 			if s.config.QueryLogging {
@@ -424,6 +433,7 @@ func (s *DNSServer) handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
 			// Return NXDOMAIN
 			msg.Rcode = dns.RcodeNameError
 			w.WriteMsg(msg)
+			dnsQueries.With(queryResultBlocked).Inc()
 
 			// Log blocked query
 			if s.config.QueryLogging {
@@ -438,6 +448,7 @@ func (s *DNSServer) handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
 		msg = rewrite
 		msg.SetReply(r)
 		w.WriteMsg(msg)
+		dnsQueries.With(queryResultRewrite).Inc()
 
 		if s.config.QueryLogging {
 			s.logQuery(clientIP, domain, qtype, msg, false, "Rewrite", time.Since(startTime), false)
@@ -451,6 +462,7 @@ func (s *DNSServer) handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
 		log.Printf("Upstream query error for %s: %v", domain, err)
 		msg.Rcode = dns.RcodeServerFailure
 		w.WriteMsg(msg)
+		dnsQueries.With(queryResultFailed).Inc()
 		return
 	}
 
@@ -461,6 +473,7 @@ func (s *DNSServer) handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
 
 	// Write response
 	w.WriteMsg(response)
+	dnsQueries.With(queryResultForwarded).Inc()
 
 	// Log query
 	if s.config.QueryLogging {
@@ -46,9 +46,11 @@ func (u *UpstreamManager) Query(msg *dns.Msg) (*dns.Msg, error) {
 			continue
 		}
 
-		response, _, err := u.client.Exchange(msg, upstream)
+		response, rtt, err := u.client.Exchange(msg, upstream)
 
 		if err == nil && response != nil {
+			dnsUpstreamDuration.With(upstream).Observe(rtt.Seconds())
+
 			// Success - reset failure count
 			u.mutex.Lock()
 			u.failureMap[upstream] = 0
@@ -59,6 +61,7 @@ func (u *UpstreamManager) Query(msg *dns.Msg) (*dns.Msg, error) {
 		}
 
 		// Record failure
+		dnsUpstreamErrors.With(upstream).Inc()
 		u.mutex.Lock()
 		u.failureMap[upstream]++
 		u.lastAttempt[upstream] = time.Now()
@@ -164,6 +164,9 @@ func registerEntities(db *memory.Database) error {
 		{"php_xdebug_mappings", func() error { return memory.Register[*php_debug_adapter.PhpXDebugMappingEntity](db, "php_xdebug_mappings") }},
 		{"api_gateway_config", func() error { return memory.Register[*api_gateway.ApiGatewayConfigEntity](db, "api_gateway_config") }},
 		{"api_gateway_blocks", func() error { return memory.Register[*api_gateway.ApiGatewayBlockEntity](db, "api_gateway_blocks") }},
+		{"api_gateway_config_revisions", func() error {
+			return memory.Register[*api_gateway.ApiGatewayConfigRevisionEntity](db, "api_gateway_config_revisions")
+		}},
 		{"jwt_secrets", func() error { return memory.Register[*jwtsecrets.JWTSecretsEntity](db, jwtsecrets.TableName) }},
 		// Tunnel server
 		{"tunnel_server_config", func() error { return memory.Register[*tunnel_server.TunnelServerConfig](db, "tunnel_server_config") }},
@@ -0,0 +1,430 @@
+// Package metrics is a small registry of Prometheus collectors rendered in the text
+// exposition format. Subsystems declare their collectors in a metrics.go file and
+// register them with Register from init.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metric types as written in # TYPE lines
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// DefaultBuckets are latency buckets in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Label is a label name/value pair of a sample
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single exposed value. Name is the full sample name, which for histograms
+// carries the _bucket, _sum or _count suffix.
+type Sample struct {
+	Name   string
+	Labels []Label
+	Value  float64
+}
+
+// Family groups the samples of one metric name
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// NewFamily starts a family for collectors that read their values at scrape time
+func NewFamily(name, help, typ string) *Family {
+	return &Family{Name: name, Help: help, Type: typ}
+}
+
+// Add appends a sample; labels are name/value pairs
+func (f *Family) Add(value float64, labels ...string) {
+	f.Samples = append(f.Samples, Sample{Name: f.Name, Labels: pairs(labels), Value: value})
+}
+
+// Collector produces metric families when the registry is scraped
+type Collector interface {
+	Collect() []*Family
+}
+
+// CollectorFunc adapts a function to Collector
+type CollectorFunc func() []*Family
+
+// Collect calls f
+func (f CollectorFunc) Collect() []*Family {
+	return f()
+}
+
+// Registry holds the collectors exposed on /metrics
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+var defaultRegistry = NewRegistry()
+
+// Default returns the process-wide registry
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Register adds collectors to the process-wide registry
+func Register(collectors ...Collector) {
+	defaultRegistry.Register(collectors...)
+}
+
+// Register adds collectors to the registry
+func (r *Registry) Register(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collectors...)
+}
+
+// Gather collects all families, merging families of the same name and sorting them by name
+func (r *Registry) Gather() []*Family {
+	r.mu.RLock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	byName := make(map[string]*Family)
+	var families []*Family
+	for _, c := range collectors {
+		for _, f := range c.Collect() {
+			if f == nil {
+				continue
+			}
+			if existing, ok := byName[f.Name]; ok {
+				existing.Samples = append(existing.Samples, f.Samples...)
+				continue
+			}
+			merged := &Family{Name: f.Name, Help: f.Help, Type: f.Type, Samples: append([]Sample(nil), f.Samples...)}
+			byName[f.Name] = merged
+			families = append(families, merged)
+		}
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+	return families
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range r.Gather() {
+		if f.Help != "" {
+			bw.WriteString("# HELP " + f.Name + " " + escapeHelp(f.Help) + "\n")
+		}
+		if f.Type != "" {
+			bw.WriteString("# TYPE " + f.Name + " " + f.Type + "\n")
+		}
+		for _, s := range f.Samples {
+			bw.WriteString(s.Name)
+			if len(s.Labels) > 0 {
+				bw.WriteByte('{')
+				for i, l := range s.Labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					bw.WriteString(l.Name + `="` + escapeLabel(l.Value) + `"`)
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(formatFloat(s.Value))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+// ContentType is the media type of WriteText output
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func pairs(kv []string) []Label {
+	if len(kv) == 0 {
+		return nil
+	}
+	labels := make([]Label, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		labels = append(labels, Label{Name: kv[i], Value: kv[i+1]})
+	}
+	return labels
+}
+
+// vec holds the children of a labelled metric keyed by their label values
+type vec[T any] struct {
+	name       string
+	help       string
+	labelNames []string
+	newChild   func(labels []Label) *T
+
+	mu       sync.RWMutex
+	children map[string]*T
+	order    []string
+}
+
+func (v *vec[T]) with(values []string) *T {
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok = v.children[key]; ok {
+		return child
+	}
+	labels := make([]Label, len(v.labelNames))
+	for i, name := range v.labelNames {
+		if i < len(values) {
+			labels[i] = Label{Name: name, Value: values[i]}
+		} else {
+			labels[i] = Label{Name: name}
+		}
+	}
+	if v.children == nil {
+		v.children = make(map[string]*T)
+	}
+	child = v.newChild(labels)
+	v.children[key] = child
+	v.order = append(v.order, key)
+	return child
+}
+
+func (v *vec[T]) each(fn func(*T)) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	keys := append([]string(nil), v.order...)
+	sort.Strings(keys)
+	for _, key := range keys {
+		fn(v.children[key])
+	}
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	labels []Label
+	bits   atomic.Uint64
+}
+
+// Add increases the counter; negative values are ignored
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	for {
+		old := c.bits.Load()
+		if c.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Inc increases the counter by one
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Value returns the current count
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// CounterVec is a counter partitioned by label values
+type CounterVec struct {
+	v vec[Counter]
+}
+
+// NewCounterVec creates a counter with the given label names
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{v: vec[Counter]{name: name, help: help, labelNames: labelNames, newChild: func(labels []Label) *Counter {
+		return &Counter{labels: labels}
+	}}}
+}
+
+// With returns the counter for the label values, in the order of the label names
+func (cv *CounterVec) With(values ...string) *Counter {
+	return cv.v.with(values)
+}
+
+// Collect implements Collector
+func (cv *CounterVec) Collect() []*Family {
+	f := NewFamily(cv.v.name, cv.v.help, TypeCounter)
+	cv.v.each(func(c *Counter) {
+		f.Samples = append(f.Samples, Sample{Name: f.Name, Labels: c.labels, Value: c.Value()})
+	})
+	return []*Family{f}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	labels []Label
+	bits   atomic.Uint64
+}
+
+// Set replaces the gauge value
+func (g *Gauge) Set(value float64) {
+	g.bits.Store(math.Float64bits(value))
+}
+
+// Add changes the gauge by delta
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		if g.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Value returns the current value
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// GaugeVec is a gauge partitioned by label values
+type GaugeVec struct {
+	v vec[Gauge]
+}
+
+// NewGaugeVec creates a gauge with the given label names
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{v: vec[Gauge]{name: name, help: help, labelNames: labelNames, newChild: func(labels []Label) *Gauge {
+		return &Gauge{labels: labels}
+	}}}
+}
+
+// With returns the gauge for the label values, in the order of the label names
+func (gv *GaugeVec) With(values ...string) *Gauge {
+	return gv.v.with(values)
+}
+
+// Collect implements Collector
+func (gv *GaugeVec) Collect() []*Family {
+	f := NewFamily(gv.v.name, gv.v.help, TypeGauge)
+	gv.v.each(func(g *Gauge) {
+		f.Samples = append(f.Samples, Sample{Name: f.Name, Labels: g.labels, Value: g.Value()})
+	})
+	return []*Family{f}
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	labels  []Label
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Observe records a value
+func (h *Histogram) Observe(value float64) {
+	i := sort.SearchFloat64s(h.buckets, value)
+	h.mu.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += value
+	h.count++
+	h.mu.Unlock()
+}
+
+// ObserveSince records the seconds elapsed since start
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	v vec[Histogram]
+}
+
+// NewHistogramVec creates a histogram with the given upper bucket bounds (DefaultBuckets when nil)
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{v: vec[Histogram]{name: name, help: help, labelNames: labelNames, newChild: func(labels []Label) *Histogram {
+		return &Histogram{labels: labels, buckets: buckets, counts: make([]uint64, len(buckets))}
+	}}}
+}
+
+// With returns the histogram for the label values, in the order of the label names
+func (hv *HistogramVec) With(values ...string) *Histogram {
+	return hv.v.with(values)
+}
+
+// Collect implements Collector
+func (hv *HistogramVec) Collect() []*Family {
+	f := NewFamily(hv.v.name, hv.v.help, TypeHistogram)
+	hv.v.each(func(h *Histogram) {
+		h.mu.Lock()
+		counts := append([]uint64(nil), h.counts...)
+		sum, count := h.sum, h.count
+		h.mu.Unlock()
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += counts[i]
+			f.Samples = append(f.Samples, Sample{Name: f.Name + "_bucket", Labels: withLabel(h.labels, "le", formatFloat(bound)), Value: float64(cumulative)})
+		}
+		f.Samples = append(f.Samples,
+			Sample{Name: f.Name + "_bucket", Labels: withLabel(h.labels, "le", "+Inf"), Value: float64(count)},
+			Sample{Name: f.Name + "_sum", Labels: h.labels, Value: sum},
+			Sample{Name: f.Name + "_count", Labels: h.labels, Value: float64(count)},
+		)
+	})
+	return []*Family{f}
+}
+
+func withLabel(labels []Label, name, value string) []Label {
+	out := make([]Label, len(labels), len(labels)+1)
+	copy(out, labels)
+	return append(out, Label{Name: name, Value: value})
+}
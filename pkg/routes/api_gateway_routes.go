@@ -14,6 +14,11 @@ func APIGatewayRoutes(a *fiber.App) {
 	// Gateway control
 	route.Get("/api_gateway/config", controllers.APIGatewayGetConfig)
 	route.Post("/api_gateway/config", controllers.APIGatewayUpdateConfig)
+	route.Post("/api_gateway/config/validate", controllers.APIGatewayValidateConfig)
+	route.Get("/api_gateway/config/revisions", controllers.APIGatewayListConfigRevisions)
+	route.Get("/api_gateway/config/revisions/:revision", controllers.APIGatewayGetConfigRevision)
+	route.Post("/api_gateway/config/revisions/:revision/rollback", controllers.APIGatewayRollbackConfig)
+	route.Get("/api_gateway/config/diff", controllers.APIGatewayDiffConfigRevisions)
 	route.Post("/api_gateway/start", controllers.APIGatewayStart)
 	route.Post("/api_gateway/stop", controllers.APIGatewayStop)
 	route.Get("/api_gateway/status", controllers.APIGatewayStatus)
@@ -34,6 +39,14 @@ func APIGatewayRoutes(a *fiber.App) {
 	route.Put("/api_gateway/routes", controllers.APIGatewayUpdateRoute)
 	route.Delete("/api_gateway/routes", controllers.APIGatewayDeleteRoute)
 
+	// Consumers management
+	route.Get("/api_gateway/consumers", controllers.APIGatewayListConsumers)
+	route.Post("/api_gateway/consumers", controllers.APIGatewayAddConsumer)
+	route.Put("/api_gateway/consumers", controllers.APIGatewayUpdateConsumer)
+	route.Delete("/api_gateway/consumers", controllers.APIGatewayDeleteConsumer)
+	route.Post("/api_gateway/consumers/:id/api_keys", controllers.APIGatewayCreateConsumerAPIKey)
+	route.Delete("/api_gateway/consumers/:id/api_keys/:key_id", controllers.APIGatewayDeleteConsumerAPIKey)
+
 	// UDP routes management
 	route.Get("/api_gateway/udp_routes", controllers.APIGatewayListUDPRoutes)
 	route.Post("/api_gateway/udp_routes", controllers.APIGatewayAddUDPRoute)
@@ -44,8 +57,14 @@ func APIGatewayRoutes(a *fiber.App) {
 	route.Post("/api_gateway/health_check", controllers.APIGatewayHealthCheckNow)
 	route.Post("/api_gateway/validate", controllers.APIGatewayValidateRoute)
 
+	// Response cache
+	route.Post("/api_gateway/cache/purge", controllers.APIGatewayPurgeCache)
+
 	// SSL/TLS Certificate management
 	route.Get("/api_gateway/certificate", controllers.APIGatewayGetCertificateInfo)
+	route.Get("/api_gateway/certificates", controllers.APIGatewayListCertificates)
+	route.Post("/api_gateway/certificates", controllers.APIGatewayUploadCertificate)
+	route.Delete("/api_gateway/certificates/:id", controllers.APIGatewayDeleteCertificate)
 	route.Post("/api_gateway/letsencrypt", controllers.APIGatewayConfigureLetsEncrypt)
 	route.Post("/api_gateway/certificate/request", controllers.APIGatewayRequestCertificate)
 	route.Get("/api_gateway/certificate/renewer", controllers.APIGatewayGetRenewerStatus)
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"log"
+	"os"
+
+	"redock/app/controllers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MetricsRoutes mounts the Prometheus /metrics endpoint when METRICS_ENABLED is "true".
+// It is protected by METRICS_TOKEN instead of user JWTs so scrapers can reach it, and
+// refuses every request while no token is set.
+func MetricsRoutes(a *fiber.App) {
+	if os.Getenv("METRICS_ENABLED") != "true" {
+		return
+	}
+	if os.Getenv("METRICS_TOKEN") == "" {
+		log.Printf("⚠️  METRICS_ENABLED is set without METRICS_TOKEN; /metrics refuses all requests until a token is set")
+	}
+	a.Get("/metrics", controllers.Metrics)
+}
@@ -13,6 +13,8 @@ func PublicRoutes(a *fiber.App) {
 
 	// Auth setup (no JWT): for login page register visibility
 	route.Get("/auth/setup", controllers.AuthSetup)
+	// Forward auth for API gateway routes; checks the token itself so that any method gets 401, not 400
+	route.All("/auth/verify", controllers.AuthVerify)
 	// Routes for POST method:
 	route.Post("/user/sign/up", controllers.UserSignUp) // register a new user
 	route.Post("/user/sign/in", controllers.UserSignIn) // auth, return Access & Refresh tokens
@@ -326,7 +326,11 @@ func (db *Database) flushAll() {
 		table.mutex.RLock()
 		if table.dirty {
 			table.mutex.RUnlock()
-			table.save(db.baseDir)
+			start := time.Now()
+			if err := table.save(db.baseDir); err != nil {
+				flushErrors.With(table.name).Inc()
+			}
+			flushDuration.With(table.name).ObserveSince(start)
 		} else {
 			table.mutex.RUnlock()
 		}
@@ -0,0 +1,16 @@
+package memory
+
+import (
+	"redock/pkg/metrics"
+)
+
+var (
+	flushDuration = metrics.NewHistogramVec("redock_memorydb_flush_duration_seconds",
+		"Time to write a dirty memory DB table to disk.", []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}, "table")
+	flushErrors = metrics.NewCounterVec("redock_memorydb_flush_errors_total",
+		"Failed writes of memory DB tables to disk.", "table")
+)
+
+func init() {
+	metrics.Register(flushDuration, flushErrors)
+}
@@ -698,6 +698,7 @@ func handleBackendTCPStream(d *TunnelDomain, backendConn net.Conn, streamType st
 	streamsMu.Lock()
 	streams[key] = &stream{backend: backendConn}
 	streamsMu.Unlock()
+	tunnelStreamsOpened.With(streamType).Inc()
 	defer func() {
 		closeStream(key)
 		_ = writeControlFrameToClient(client, fmt.Sprintf("CLOSE_STREAM %d\n", streamID))
@@ -947,6 +948,7 @@ func handleBackendUDPPacket(internalPort int, clientAddr *net.UDPAddr, packet []
 		sk = streamKey{client: client, streamID: streamID}
 		udpStreams[sk] = &udpStream{clientAddr: clientAddr, port: internalPort}
 		udpStreamByAddr[addrKey] = sk
+		tunnelStreamsOpened.With("udp").Inc()
 	}
 	udpStreamsMu.Unlock()
 	if err := writeDataFrameToClient(client, sk.streamID, protocolUDP, packet); err != nil {
@@ -163,25 +163,24 @@ func addTunnelDomainToLetsEncrypt(gw *api_gateway.Gateway, fullDomain string) {
 		return
 	}
 	for _, d := range cfg.LetsEncrypt.Domains {
-		if strings.TrimSpace(d) == fullDomain {
+		d = strings.TrimSpace(d)
+		if d == fullDomain {
 			return
 		}
+		// A wildcard for the tunnel suffix (dns-01) already covers the subdomain
+		if strings.HasPrefix(d, "*.") {
+			if i := strings.IndexByte(fullDomain, '.'); i > 0 && fullDomain[i+1:] == d[2:] {
+				return
+			}
+		}
 	}
 	domains := make([]string, 0, len(cfg.LetsEncrypt.Domains)+1)
 	domains = append(domains, cfg.LetsEncrypt.Domains...)
 	domains = append(domains, fullDomain)
-	leCopy := &api_gateway.LetsEncryptConfig{
-		Enabled:          cfg.LetsEncrypt.Enabled,
-		Email:            cfg.LetsEncrypt.Email,
-		Domains:          domains,
-		Staging:          cfg.LetsEncrypt.Staging,
-		AutoRenew:        cfg.LetsEncrypt.AutoRenew,
-		RenewBeforeDays:  cfg.LetsEncrypt.RenewBeforeDays,
-		LastRenewAt:      cfg.LetsEncrypt.LastRenewAt,
-		ExpiresAt:        cfg.LetsEncrypt.ExpiresAt,
-		CertificateReady: cfg.LetsEncrypt.CertificateReady,
-	}
-	if err := gw.ConfigureLetsEncrypt(leCopy); err != nil {
+	// Copy every field so settings like the challenge type carry over
+	leCopy := *cfg.LetsEncrypt
+	leCopy.Domains = domains
+	if err := gw.ConfigureLetsEncrypt(&leCopy); err != nil {
 		log.Printf("tunnel_server: add domain to Let's Encrypt config: %v", err)
 		return
 	}
@@ -200,8 +199,17 @@ func addTunnelDomainToLetsEncrypt(gw *api_gateway.Gateway, fullDomain string) {
 	log.Println("tunnel_server: waiting for 15 seconds")
 	time.Sleep(15 * time.Second)
 	log.Println("tunnel_server: 15 seconds passed")
+	// Per-domain mode only needs an order for the new domain
+	if leCopy.PerDomain {
+		if err := gw.RequestDomainCertificate(fullDomain); err != nil {
+			log.Printf("tunnel_server: request certificate for %s: %v", fullDomain, err)
+			return
+		}
+		log.Printf("tunnel_server: Let's Encrypt certificate issued for %s", fullDomain)
+		return
+	}
 	// Request certificate for full domain list (one SAN cert: tls.crt / tls.key)
-	if err := gw.RequestCertificateWithConfig(leCopy); err != nil {
+	if err := gw.RequestCertificateWithConfig(&leCopy); err != nil {
 		log.Printf("tunnel_server: request certificate for %s (full list): %v", fullDomain, err)
 		return
 	}
@@ -228,18 +236,10 @@ func removeTunnelDomainFromLetsEncrypt(gw *api_gateway.Gateway, fullDomain strin
 	if len(newDomains) == len(cfg.LetsEncrypt.Domains) {
 		return
 	}
-	leCopy := &api_gateway.LetsEncryptConfig{
-		Enabled:          cfg.LetsEncrypt.Enabled,
-		Email:            cfg.LetsEncrypt.Email,
-		Domains:          newDomains,
-		Staging:          cfg.LetsEncrypt.Staging,
-		AutoRenew:        cfg.LetsEncrypt.AutoRenew,
-		RenewBeforeDays:  cfg.LetsEncrypt.RenewBeforeDays,
-		LastRenewAt:      cfg.LetsEncrypt.LastRenewAt,
-		ExpiresAt:        cfg.LetsEncrypt.ExpiresAt,
-		CertificateReady: cfg.LetsEncrypt.CertificateReady,
-	}
-	if err := gw.ConfigureLetsEncrypt(leCopy); err != nil {
+	// Copy every field so settings like the challenge type carry over
+	leCopy := *cfg.LetsEncrypt
+	leCopy.Domains = newDomains
+	if err := gw.ConfigureLetsEncrypt(&leCopy); err != nil {
 		log.Printf("tunnel_server: remove domain from Let's Encrypt config: %v", err)
 		return
 	}
@@ -0,0 +1,32 @@
+package tunnel_server
+
+import (
+	"redock/pkg/metrics"
+)
+
+var tunnelStreamsOpened = metrics.NewCounterVec("redock_tunnel_streams_opened_total",
+	"Streams opened through tunnel clients, by stream type.", "type")
+
+func init() {
+	metrics.Register(tunnelStreamsOpened, metrics.CollectorFunc(collectTunnelMetrics))
+}
+
+// collectTunnelMetrics exposes connected clients and open streams at scrape time
+func collectTunnelMetrics() []*metrics.Family {
+	clientsMu.RLock()
+	connected := len(clients)
+	clientsMu.RUnlock()
+	streamsMu.RLock()
+	tcpStreams := len(streams)
+	streamsMu.RUnlock()
+	udpStreamsMu.RLock()
+	udpOpen := len(udpStreams)
+	udpStreamsMu.RUnlock()
+
+	clientsFamily := metrics.NewFamily("redock_tunnel_clients", "Tunnel clients connected to the daemon.", metrics.TypeGauge)
+	clientsFamily.Add(float64(connected))
+	open := metrics.NewFamily("redock_tunnel_streams", "Streams currently open through tunnel clients.", metrics.TypeGauge)
+	open.Add(float64(tcpStreams), "protocol", "tcp")
+	open.Add(float64(udpOpen), "protocol", "udp")
+	return []*metrics.Family{clientsFamily, open}
+}
@@ -0,0 +1,40 @@
+package vpn_server
+
+import (
+	"strconv"
+
+	"redock/pkg/metrics"
+	"redock/platform/memory"
+)
+
+func init() {
+	metrics.Register(metrics.CollectorFunc(collectVPNMetrics))
+}
+
+// collectVPNMetrics exposes WireGuard peer transfer counters as last read by collectStats
+func collectVPNMetrics() []*metrics.Family {
+	m := GetWireGuardManager()
+	if m.db == nil {
+		return nil
+	}
+
+	m.mutex.RLock()
+	running := 0
+	for _, inst := range m.instances {
+		if inst.Running {
+			running++
+		}
+	}
+	m.mutex.RUnlock()
+
+	servers := metrics.NewFamily("redock_vpn_servers_running", "WireGuard servers currently running.", metrics.TypeGauge)
+	servers.Add(float64(running))
+	received := metrics.NewFamily("redock_vpn_peer_received_bytes_total", "Bytes received from a WireGuard peer.", metrics.TypeCounter)
+	sent := metrics.NewFamily("redock_vpn_peer_sent_bytes_total", "Bytes sent to a WireGuard peer.", metrics.TypeCounter)
+	for _, user := range memory.FindAll[*VPNUser](m.db, "vpn_users") {
+		server := strconv.FormatUint(uint64(user.ServerID), 10)
+		received.Add(float64(user.TotalBytesReceived), "server", server, "peer", user.Username)
+		sent.Add(float64(user.TotalBytesSent), "server", server, "peer", user.Username)
+	}
+	return []*metrics.Family{servers, received, sent}
+}